@@ -0,0 +1,379 @@
+// Package audit keeps a tamper-evident record of every change made to the
+// routes through the web server.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kellegous/go/internal"
+)
+
+// Op is the action an Entry records.
+type Op string
+
+const (
+	// Create is a route being added through the API.
+	Create Op = "create"
+
+	// Update is a route being replaced through the API.
+	Update Op = "update"
+
+	// Delete is a route being removed through the API.
+	Delete Op = "delete"
+
+	// Rename is a route being moved to a new name through the API. The entry
+	// is for the old name and its detail holds the new one.
+	Rename Op = "rename"
+
+	// Import is routes being imported by an admin.
+	Import Op = "import"
+
+	// Restore is a backup being restored by an admin.
+	Restore Op = "restore"
+
+	// Export is the routes being exported by an admin, as an export, a
+	// backup or a dump.
+	Export Op = "export"
+
+	// Rewrite is the URLs of routes being rewritten, or a rewrite being
+	// undone, by an admin. Each route changed is also recorded as updated.
+	Rewrite Op = "rewrite"
+
+	// Repair is the ID counter or indexes of the backend being repaired by an
+	// admin after a check.
+	Repair Op = "repair"
+)
+
+// Actor is who made a change.
+type Actor struct {
+	// User is named by the actor header, which is set by an authenticating
+	// proxy. It is empty for anonymous requests.
+	User string `json:"actor,omitempty"`
+
+	// IP is the address the request came from.
+	IP string `json:"ip,omitempty"`
+
+	// ForwardedFor is the X-Forwarded-For header, which is recorded as it is
+	// given since it cannot be trusted.
+	ForwardedFor string `json:"forwarded_for,omitempty"`
+
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// Entry is a single action in the log. Each entry holds the hash of the one
+// before it, so changing or removing an entry breaks the chain from there on.
+// A rename is recorded under the name it moved a route from, with the name it
+// moved it to in To.
+type Entry struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Actor
+	Op     Op              `json:"op"`
+	Name   string          `json:"name,omitempty"`
+	To     string          `json:"to,omitempty"`
+	Old    *internal.Route `json:"old,omitempty"`
+	New    *internal.Route `json:"new,omitempty"`
+	Detail json.RawMessage `json:"detail,omitempty"`
+	Prev   string          `json:"prev"`
+	Hash   string          `json:"hash,omitempty"`
+}
+
+// Compute the hash of an entry from the hash before it and the JSON of every
+// field but the hash, exactly as it is written to the log.
+func sum(prev string, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", prev)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// The hash ends every line of the log, after the rest of the entry.
+const hashField = `,"hash":"`
+
+// Split a line of the log into the JSON of the entry without its hash, which
+// is what was hashed, and the hash.
+func splitLine(line []byte) ([]byte, string, bool) {
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	ix := bytes.LastIndex(line, []byte(hashField))
+	if ix == -1 || !bytes.HasSuffix(line, []byte(`"}`)) {
+		return nil, "", false
+	}
+
+	body := append(line[:ix:ix], '}')
+	return body, string(line[ix+len(hashField) : len(line)-2]), true
+}
+
+// Options controls how actors are identified.
+type Options struct {
+	// ActorHeader is the request header holding the authenticated user.
+	ActorHeader string
+}
+
+// DefaultOptions takes the actor from the X-Forwarded-User header.
+var DefaultOptions = Options{
+	ActorHeader: "X-Forwarded-User",
+}
+
+// Log is an append-only file of entries, one JSON object per line.
+type Log struct {
+	path string
+	opts Options
+
+	mu   sync.Mutex
+	f    *os.File
+	seq  uint64
+	head string
+}
+
+// ErrInvalidEntry is reported for a line in the log that cannot be decoded.
+var ErrInvalidEntry = errors.New("invalid audit entry")
+
+// Read the complete lines of a log, ignoring a partial line at the end that
+// is still being written. Each entry is given along with the line it was read
+// from. The length of the complete lines is returned.
+func readEntries(r io.Reader, fn func(e *Entry, line []byte) error) (int64, error) {
+	var n int64
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return n, fmt.Errorf("%w: %s", ErrInvalidEntry, bytes.TrimSpace(line))
+		}
+
+		if err := fn(&e, line); err != nil {
+			return n, err
+		}
+		n += int64(len(line))
+	}
+}
+
+// Open the log at path, creating it if needed.
+func Open(path string, opts *Options) (*Log, error) {
+	if opts == nil {
+		opts = &DefaultOptions
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Log{
+		path: path,
+		opts: *opts,
+		f:    f,
+	}
+
+	// continue the chain from the last entry.
+	n, err := readEntries(f, func(e *Entry, line []byte) error {
+		l.seq = e.Seq
+		l.head = e.Hash
+		return nil
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	// a partial line was left by an append that never finished.
+	if err := f.Truncate(n); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Close the log.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Close()
+}
+
+// Actor identifies who made a request.
+func (l *Log) Actor(r *http.Request) *Actor {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	a := &Actor{
+		IP:           ip,
+		ForwardedFor: r.Header.Get("X-Forwarded-For"),
+		UserAgent:    r.UserAgent(),
+	}
+
+	if l.opts.ActorHeader != "" {
+		a.User = r.Header.Get(l.opts.ActorHeader)
+	}
+
+	return a
+}
+
+// Append adds e to the end of the log, filling in its sequence number, time
+// and hashes.
+func (l *Log) Append(e *Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.Seq = l.seq + 1
+	e.Prev = l.head
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC().Round(0)
+
+	// the hash is added to the end of the JSON it covers, so that the bytes
+	// hashed are the bytes written.
+	e.Hash = ""
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	e.Hash = sum(e.Prev, body)
+
+	line := append(body[:len(body)-1], hashField+e.Hash+"\"}\n"...)
+	if _, err := l.f.Write(line); err != nil {
+		return err
+	}
+
+	if err := l.f.Sync(); err != nil {
+		return err
+	}
+
+	l.seq = e.Seq
+	l.head = e.Hash
+	return nil
+}
+
+// Filter selects entries from the log. Empty fields match everything.
+type Filter struct {
+	Name  string
+	Actor string
+	Op    Op
+	Since time.Time
+	Until time.Time
+}
+
+// Match reports whether e passes the filter. A rename matches both the name
+// it moved a route from and the one it moved it to.
+func (f *Filter) Match(e *Entry) bool {
+	return (f.Name == "" || e.Name == f.Name || e.To == f.Name) &&
+		(f.Actor == "" || e.User == f.Actor) &&
+		(f.Op == "" || e.Op == f.Op) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until))
+}
+
+// Read every complete line of the log.
+func (l *Log) read(fn func(e *Entry, line []byte) error) error {
+	r, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	_, err = readEntries(r, fn)
+	return err
+}
+
+// Scan calls fn with each entry matching f, oldest first.
+func (l *Log) Scan(f *Filter, fn func(*Entry) error) error {
+	return l.read(func(e *Entry, line []byte) error {
+		if f.Match(e) {
+			return fn(e)
+		}
+		return nil
+	})
+}
+
+// Recent returns up to limit of the newest entries matching f, newest first.
+func (l *Log) Recent(f *Filter, limit int) ([]*Entry, error) {
+	var ents []*Entry
+	if err := l.Scan(f, func(e *Entry) error {
+		ents = append(ents, e)
+		if len(ents) > limit {
+			ents = ents[1:]
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(ents)-1; i < j; i, j = i+1, j-1 {
+		ents[i], ents[j] = ents[j], ents[i]
+	}
+	return ents, nil
+}
+
+// Verification is the result of checking the chain of hashes.
+type Verification struct {
+	Ok      bool   `json:"ok"`
+	Entries uint64 `json:"entries"`
+
+	// Head is the hash of the last entry. Recording it elsewhere allows
+	// entries removed from the end of the log to be detected too.
+	Head string `json:"head"`
+
+	// BrokenAt is the sequence number of the first entry that does not
+	// follow from the one before it.
+	BrokenAt uint64 `json:"broken_at,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ErrBrokenChain is reported for an entry whose hashes do not match.
+var ErrBrokenChain = errors.New("audit log has been modified")
+
+// Verify checks that every entry follows from the one before it. The hashes
+// are checked against the lines as they are in the log.
+func (l *Log) Verify() (*Verification, error) {
+	v := &Verification{Ok: true}
+	var prev string
+	err := l.read(func(e *Entry, line []byte) error {
+		body, hash, ok := splitLine(line)
+		if !ok || e.Seq != v.Entries+1 || e.Prev != prev || e.Hash != hash || hash != sum(prev, body) {
+			v.Ok = false
+			v.BrokenAt = v.Entries + 1
+			v.Error = ErrBrokenChain.Error()
+			return ErrBrokenChain
+		}
+
+		v.Entries++
+		prev = e.Hash
+		return nil
+	})
+
+	if errors.Is(err, ErrInvalidEntry) {
+		v.Ok = false
+		v.BrokenAt = v.Entries + 1
+		v.Error = err.Error()
+		return v, nil
+	} else if err == ErrBrokenChain {
+		return v, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	v.Head = prev
+	return v, nil
+}
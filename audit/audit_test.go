@@ -0,0 +1,380 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kellegous/go/backend/memory"
+	"github.com/kellegous/go/internal"
+)
+
+func tempLog(t *testing.T) (string, func()) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(tmp, "audit.log"), func() {
+		os.RemoveAll(tmp)
+	}
+}
+
+func mustOpen(t *testing.T, path string) *Log {
+	l, err := Open(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func mustAppend(t *testing.T, l *Log, e *Entry) {
+	if err := l.Append(e); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustVerify(t *testing.T, l *Log) *Verification {
+	v, err := l.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestChain(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	l := mustOpen(t, path)
+	mustAppend(t, l, &Entry{
+		Actor: Actor{User: "alice", IP: "10.0.0.1"},
+		Op:    Create,
+		Name:  "payroll",
+		New:   &internal.Route{URL: "http://payroll/", Time: time.Unix(1601418237, 0)},
+	})
+	mustAppend(t, l, &Entry{
+		Actor:  Actor{User: "bob"},
+		Op:     Import,
+		Detail: json.RawMessage(`{"created": 1, "note": "<b>"}`),
+	})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the chain carries on after reopening.
+	l = mustOpen(t, path)
+	mustAppend(t, l, &Entry{
+		Actor: Actor{User: "mallory"},
+		Op:    Update,
+		Name:  "payroll",
+		Old:   &internal.Route{URL: "http://payroll/"},
+		New:   &internal.Route{URL: "http://phish/"},
+	})
+
+	v := mustVerify(t, l)
+	if !v.Ok || v.Entries != 3 || v.Head == "" {
+		t.Fatalf("unexpected verification %+v", v)
+	}
+	l.Close()
+
+	// an edit to an entry breaks the chain there.
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(path, bytes.Replace(b, []byte("mallory"), []byte("alice"), 1), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	l = mustOpen(t, path)
+	defer l.Close()
+
+	v = mustVerify(t, l)
+	if v.Ok || v.BrokenAt != 3 {
+		t.Fatalf("expected the chain to break at 3, got %+v", v)
+	}
+
+	// as does removing one.
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	if err := ioutil.WriteFile(path, append(lines[0], lines[2]...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	v = mustVerify(t, l)
+	if v.Ok || v.BrokenAt != 2 {
+		t.Fatalf("expected the chain to break at 2, got %+v", v)
+	}
+
+	// and a line that is not an entry.
+	if err := ioutil.WriteFile(path, append(lines[0], []byte("{\n")...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	v = mustVerify(t, l)
+	if v.Ok || v.BrokenAt != 2 {
+		t.Fatalf("expected the chain to break at 2, got %+v", v)
+	}
+}
+
+func TestRawLines(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	l := mustOpen(t, path)
+	defer l.Close()
+
+	mustAppend(t, l, &Entry{Op: Create, Name: "a", New: &internal.Route{URL: "http://a/"}})
+	mustAppend(t, l, &Entry{Op: Delete, Name: "a", Old: &internal.Route{URL: "http://a/"}})
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the hashes cover the lines as they were written, so a change that
+	// decodes to the same entry still breaks the chain.
+	for _, test := range []struct {
+		old, new string
+	}{
+		{`"op":"delete"`, `"op": "delete"`},
+		{`"op":"delete"`, `"op":"delete","note":"x"`},
+		{`"name":"a"`, `"name":"\u0061"`},
+	} {
+		ix := bytes.LastIndex(b, []byte(test.old))
+		changed := append(append(append([]byte{}, b[:ix]...), test.new...), b[ix+len(test.old):]...)
+		if err := ioutil.WriteFile(path, changed, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if v := mustVerify(t, l); v.Ok || v.BrokenAt != 2 {
+			t.Fatalf("%s: expected the chain to break at 2, got %+v", test.new, v)
+		}
+	}
+
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := mustVerify(t, l); !v.Ok || v.Entries != 2 {
+		t.Fatalf("unexpected verification %+v", v)
+	}
+}
+
+func TestPartialEntry(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	l := mustOpen(t, path)
+	mustAppend(t, l, &Entry{Op: Create, Name: "a", New: &internal.Route{URL: "http://a/"}})
+	l.Close()
+
+	// an append that was cut short.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":2,"op":"cre`)
+	f.Close()
+
+	l = mustOpen(t, path)
+	defer l.Close()
+
+	mustAppend(t, l, &Entry{Op: Delete, Name: "a", Old: &internal.Route{URL: "http://a/"}})
+	if v := mustVerify(t, l); !v.Ok || v.Entries != 2 {
+		t.Fatalf("unexpected verification %+v", v)
+	}
+}
+
+func TestRecent(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	l := mustOpen(t, path)
+	defer l.Close()
+
+	t0 := time.Unix(1601418237, 0)
+	for i, e := range []*Entry{
+		{Actor: Actor{User: "alice"}, Op: Create, Name: "a"},
+		{Actor: Actor{User: "bob"}, Op: Create, Name: "b"},
+		{Actor: Actor{User: "alice"}, Op: Update, Name: "a"},
+		{Actor: Actor{User: "alice"}, Op: Delete, Name: "a"},
+		{Actor: Actor{User: "bob"}, Op: Export},
+		{Actor: Actor{User: "bob"}, Op: Rename, Name: "b", To: "a"},
+	} {
+		e.Time = t0.Add(time.Duration(i) * time.Minute)
+		mustAppend(t, l, e)
+	}
+
+	for _, test := range []struct {
+		f     *Filter
+		limit int
+		seqs  []uint64
+	}{
+		{&Filter{}, 10, []uint64{6, 5, 4, 3, 2, 1}},
+		{&Filter{}, 2, []uint64{6, 5}},
+		{&Filter{Name: "a"}, 10, []uint64{6, 4, 3, 1}},
+		{&Filter{Name: "b"}, 10, []uint64{6, 2}},
+		{&Filter{Actor: "bob"}, 10, []uint64{6, 5, 2}},
+		{&Filter{Op: Create}, 10, []uint64{2, 1}},
+		{&Filter{Since: t0.Add(time.Minute), Until: t0.Add(3 * time.Minute)}, 10, []uint64{3, 2}},
+	} {
+		ents, err := l.Recent(test.f, test.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var seqs []uint64
+		for _, e := range ents {
+			seqs = append(seqs, e.Seq)
+		}
+
+		if len(seqs) != len(test.seqs) {
+			t.Fatalf("%+v: expected %v, got %v", test.f, test.seqs, seqs)
+		}
+		for i := range seqs {
+			if seqs[i] != test.seqs[i] {
+				t.Fatalf("%+v: expected %v, got %v", test.f, test.seqs, seqs)
+			}
+		}
+	}
+}
+
+func TestActor(t *testing.T) {
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	l := mustOpen(t, path)
+	defer l.Close()
+
+	r, err := http.NewRequest("POST", "/api/url/a", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.RemoteAddr = "10.1.2.3:5555"
+	r.Header.Set("User-Agent", "curl/7.0")
+	r.Header.Set("X-Forwarded-For", "1.2.3.4")
+	r.Header.Set("X-Forwarded-User", "alice")
+
+	a := l.Actor(r)
+	if *a != (Actor{User: "alice", IP: "10.1.2.3", ForwardedFor: "1.2.3.4", UserAgent: "curl/7.0"}) {
+		t.Fatalf("unexpected actor %+v", a)
+	}
+}
+
+func TestBackend(t *testing.T) {
+	ctx := context.Background()
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	l := mustOpen(t, path)
+	defer l.Close()
+
+	mem, err := memory.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mem.Close()
+
+	b := Wrap(mem, l, &Actor{User: "alice"})
+	for _, url := range []string{"http://a/", "http://b/"} {
+		if err := b.Put(ctx, "a", &internal.Route{URL: url}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"a", "b"} {
+		if err := b.Del(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ents, err := l.Recent(&Filter{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// deleting b, which did not exist, is not recorded.
+	if len(ents) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(ents))
+	}
+
+	for i, exp := range []struct {
+		op       Op
+		old, new string
+	}{
+		{Delete, "http://b/", ""},
+		{Update, "http://a/", "http://b/"},
+		{Create, "", "http://a/"},
+	} {
+		e := ents[i]
+		if e.Op != exp.op || e.Name != "a" || e.User != "alice" {
+			t.Fatalf("unexpected entry %+v", e)
+		}
+
+		if (exp.old == "") != (e.Old == nil) || (e.Old != nil && e.Old.URL != exp.old) {
+			t.Fatalf("expected old route %q, got %+v", exp.old, e.Old)
+		}
+
+		if (exp.new == "") != (e.New == nil) || (e.New != nil && e.New.URL != exp.new) {
+			t.Fatalf("expected new route %q, got %+v", exp.new, e.New)
+		}
+	}
+
+	if err := b.Put(ctx, "c", &internal.Route{URL: "http://c/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, ver, err := b.GetVersion(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Rename(ctx, "c", ver, "d", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rename is found under both names.
+	for _, name := range []string{"c", "d"} {
+		ents, err := l.Recent(&Filter{Name: name, Op: Rename}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(ents) != 1 || ents[0].Name != "c" || ents[0].To != "d" || ents[0].Old.URL != "http://c/" || ents[0].New != nil {
+			t.Fatalf("%s: unexpected rename entries %+v", name, ents)
+		}
+	}
+}
+
+func TestBackendUnrecorded(t *testing.T) {
+	ctx := context.Background()
+	path, cleanup := tempLog(t)
+	defer cleanup()
+
+	mem, err := memory.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mem.Close()
+
+	// a change that cannot be recorded is still made, and not reported as
+	// failed since it cannot be undone.
+	l := mustOpen(t, path)
+	l.Close()
+
+	b := Wrap(mem, l, &Actor{User: "alice"})
+	if err := b.Put(ctx, "a", &internal.Route{URL: "http://a/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := mem.Get(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,211 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/internal"
+)
+
+// Backend records the routes that an actor puts and deletes through it. A
+// change that is made but cannot be recorded is logged rather than reported,
+// since it cannot be undone.
+type Backend struct {
+	backend.Backend
+	log   *Log
+	actor *Actor
+}
+
+// Wrap b so that the changes a made through it are recorded in l.
+func Wrap(b backend.Backend, l *Log, a *Actor) *Backend {
+	return &Backend{
+		Backend: b,
+		log:     l,
+		actor:   a,
+	}
+}
+
+// Get the route that a change will replace, if there is one.
+func (b *Backend) current(ctx context.Context, name string) (*internal.Route, error) {
+	rt, err := b.Backend.Get(ctx, name)
+	if errors.Is(err, internal.ErrRouteNotFound) {
+		return nil, nil
+	}
+	return rt, err
+}
+
+// Put stores a route and records it as created or updated.
+func (b *Backend) Put(ctx context.Context, name string, rt *internal.Route) error {
+	old, err := b.current(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if err := b.Backend.Put(ctx, name, rt); err != nil {
+		return err
+	}
+
+	b.recordPut(name, old, rt)
+	return nil
+}
+
+// PutIf stores a route if the one it replaces has the given version and
+// records it as created or updated.
+func (b *Backend) PutIf(ctx context.Context, name string, rt *internal.Route, version string) (string, error) {
+	// the route replaced must have the expected version, so if this one does
+	// it is the one replaced.
+	var old *internal.Route
+	if version != backend.NoVersion {
+		cur, ver, err := b.Backend.GetVersion(ctx, name)
+		if errors.Is(err, internal.ErrRouteNotFound) || (err == nil && ver != version) {
+			return backend.NoVersion, backend.ErrVersionMismatch
+		} else if err != nil {
+			return backend.NoVersion, err
+		}
+		old = cur
+	}
+
+	ver, err := b.Backend.PutIf(ctx, name, rt, version)
+	if err != nil {
+		return backend.NoVersion, err
+	}
+
+	b.recordPut(name, old, rt)
+	return ver, nil
+}
+
+// Record a change that has been made, logging it if it cannot be recorded.
+func (b *Backend) record(e *Entry) {
+	e.Actor = *b.actor
+	if err := b.log.Append(e); err != nil {
+		log.Printf("[error] could not record the %s of %s in the audit log: %s", e.Op, e.Name, err)
+	}
+}
+
+// Record rt replacing old, which is nil if rt is new.
+func (b *Backend) recordPut(name string, old, rt *internal.Route) {
+	op := Create
+	if old != nil {
+		op = Update
+	}
+
+	cp := *rt
+	b.record(&Entry{
+		Op:   op,
+		Name: name,
+		Old:  old,
+		New:  &cp,
+	})
+}
+
+// Rename moves a route and records it as renamed, along with the route left
+// behind in its place, if any.
+func (b *Backend) Rename(ctx context.Context, from, version, to string, leave *internal.Route) (string, error) {
+	// as with PutIf, a route with the expected version is the one moved.
+	old, ver, err := b.Backend.GetVersion(ctx, from)
+	if errors.Is(err, internal.ErrRouteNotFound) || (err == nil && ver != version) {
+		return backend.NoVersion, backend.ErrVersionMismatch
+	} else if err != nil {
+		return backend.NoVersion, err
+	}
+
+	ver, err = b.Backend.Rename(ctx, from, version, to, leave)
+	if err != nil {
+		return backend.NoVersion, err
+	}
+
+	var cp *internal.Route
+	if leave != nil {
+		cp = &internal.Route{}
+		*cp = *leave
+	}
+
+	b.record(&Entry{
+		Op:   Rename,
+		Name: from,
+		To:   to,
+		Old:  old,
+		New:  cp,
+	})
+	return ver, nil
+}
+
+// Apply makes a batch of changes and records each route created, updated or
+// deleted. As with PutIf, the routes replaced by conditional changes are
+// exactly the ones recorded.
+func (b *Backend) Apply(ctx context.Context, changes []*backend.Change) ([]string, error) {
+	olds := map[string]*internal.Route{}
+	for i, c := range changes {
+		if _, ok := olds[c.Name]; ok && !c.Conditional {
+			continue
+		}
+
+		old, ver, err := b.Backend.GetVersion(ctx, c.Name)
+		if errors.Is(err, internal.ErrRouteNotFound) {
+			old, ver = nil, backend.NoVersion
+		} else if err != nil {
+			return nil, err
+		}
+
+		if c.Conditional && ver != c.Version {
+			return nil, &backend.BatchError{Index: i}
+		}
+		olds[c.Name] = old
+	}
+
+	vers, err := b.Backend.Apply(ctx, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range changes {
+		old := olds[c.Name]
+		if c.Op == backend.OpPut {
+			b.recordPut(c.Name, old, c.Route)
+			cp := *c.Route
+			olds[c.Name] = &cp
+		} else if old != nil {
+			b.recordDel(c.Name, old)
+			olds[c.Name] = nil
+		}
+	}
+
+	return vers, nil
+}
+
+// Del removes a route and records it as deleted, if it existed.
+func (b *Backend) Del(ctx context.Context, name string) error {
+	old, err := b.current(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if err := b.Backend.Del(ctx, name); err != nil || old == nil {
+		return err
+	}
+
+	b.recordDel(name, old)
+	return nil
+}
+
+// Record old being deleted.
+func (b *Backend) recordDel(name string, old *internal.Route) {
+	b.record(&Entry{
+		Op:   Delete,
+		Name: name,
+		Old:  old,
+	})
+}
+
+// ListNames returns every name in the wrapped backend.
+func (b *Backend) ListNames(ctx context.Context) ([]string, error) {
+	return backend.NamesOf(ctx, b.Backend)
+}
+
+// RebuildIndexes rebuilds the indexes of the wrapped backend, which changes
+// no route, so nothing is recorded.
+func (b *Backend) RebuildIndexes(ctx context.Context) error {
+	return backend.RebuildIndexes(ctx, b.Backend)
+}
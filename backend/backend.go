@@ -2,6 +2,11 @@ package backend
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
 
 	"github.com/kellegous/go/internal"
 )
@@ -10,8 +15,162 @@ type Backend interface {
 	Close() error
 	Get(ctx context.Context, id string) (*internal.Route, error)
 	Put(ctx context.Context, key string, route *internal.Route) error
+
+	// GetVersion retrieves a route along with its version. Versions are
+	// opaque and change every time a route is put.
+	GetVersion(ctx context.Context, id string) (*internal.Route, string, error)
+
+	// PutIf stores a route only if the route currently stored under key has
+	// the given version, or, if version is NoVersion, only if there is no
+	// route stored under key. It returns the version of the new route, or
+	// ErrVersionMismatch if the condition does not hold.
+	PutIf(ctx context.Context, key string, route *internal.Route, version string) (string, error)
+
+	// Rename moves the route under from to the name to in a single change,
+	// as long as the route under from has the given version and there is no
+	// route under to. The route under from is replaced by leave or, if leave
+	// is nil, deleted. It returns the version of the moved route, or
+	// ErrVersionMismatch if the condition does not hold.
+	Rename(ctx context.Context, from, version, to string, leave *internal.Route) (string, error)
+
+	// Apply makes every change in a single write, or, if the condition of
+	// any change does not hold, none of them and returns a *BatchError. The
+	// conditions are checked against the routes as they were before the
+	// batch. It returns the version of each route put, and NoVersion for
+	// each route deleted.
+	Apply(ctx context.Context, changes []*Change) ([]string, error)
+
 	Del(ctx context.Context, id string) error
 	GetAll(ctx context.Context) (map[string]internal.Route, error)
 	List(ctx context.Context, start string) (internal.RouteIterator, error)
 	NextID(ctx context.Context) (uint64, error)
+
+	// NextIDs hands out n IDs at once, in increasing order, none of which is
+	// ever handed out again by NextID or NextIDs. The IDs need not be
+	// consecutive. It returns ErrIDOverflow rather than hand out an ID above
+	// MaxID.
+	NextIDs(ctx context.Context, n int) ([]uint64, error)
+
+	// LastID returns the highest ID handed out by NextID or NextIDs without
+	// advancing the counter.
+	LastID(ctx context.Context) (uint64, error)
+
+	// EnsureID advances the ID counter so that it is at least id. The counter
+	// is never moved backwards. It returns ErrIDOverflow if id is above
+	// MaxID.
+	EnsureID(ctx context.Context, id uint64) error
+
+	// NamesForURL returns the names of the routes that lead to url, in order.
+	// URLs are compared once normalized by internal.NormalizeURL.
+	NamesForURL(ctx context.Context, url string) ([]string, error)
+
+	// NamesForHost returns the names of the routes whose URL has the given
+	// host, in order. Hosts are compared once normalized by
+	// internal.NormalizeHost.
+	NamesForHost(ctx context.Context, host string) ([]string, error)
+}
+
+// MaxID is the highest ID a counter may reach, which is the highest that
+// every backend can store.
+const MaxID = math.MaxInt64
+
+// ErrIDOverflow is returned when the ID counter would go past MaxID.
+var ErrIDOverflow = errors.New("the ID counter would overflow")
+
+// CountedID returns the ID that a name was generated from, if the counter
+// must stay at or above it. Names that decode to IDs above MaxID could never
+// have been handed out, so they are not counted.
+func CountedID(name string) (uint64, bool) {
+	id, ok := internal.DecodeID(name)
+	if !ok || id > MaxID {
+		return 0, false
+	}
+	return id, true
+}
+
+// IDsEndingAt returns the n consecutive IDs that end with last, which is
+// what NextIDs hands out on backends with a single counter.
+func IDsEndingAt(last uint64, n int) []uint64 {
+	ids := make([]uint64, n)
+	for i := range ids {
+		ids[i] = last - uint64(n-1-i)
+	}
+	return ids
+}
+
+// NoVersion is the version of a route that does not exist.
+const NoVersion = ""
+
+// ErrVersionMismatch is returned by PutIf when the route has been changed.
+var ErrVersionMismatch = errors.New("route has been changed")
+
+// Change is a route being put or deleted as part of a batch.
+type Change struct {
+	Op    Op
+	Name  string
+	Route *internal.Route
+
+	// Conditional changes are only made if the route under Name has Version,
+	// or, if that is NoVersion, if there is no route under Name.
+	Conditional bool
+	Version     string
+}
+
+// BatchError is returned by Apply when the condition of a change does not
+// hold. It matches ErrVersionMismatch.
+type BatchError struct {
+	// Index is the position of the change in the batch, or -1 if the backend
+	// cannot tell which change it was.
+	Index int
+}
+
+func (e *BatchError) Error() string {
+	if e.Index < 0 {
+		return "batch: " + ErrVersionMismatch.Error()
+	}
+	return fmt.Sprintf("batch: change %d: %s", e.Index, ErrVersionMismatch)
+}
+
+// Unwrap makes a BatchError match ErrVersionMismatch.
+func (e *BatchError) Unwrap() error {
+	return ErrVersionMismatch
+}
+
+// VersionOf returns the version of a route stored with the encoding b, for
+// backends that version routes by their content.
+func VersionOf(b []byte) string {
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Snapshot is a read-only view of the routes and ID counter in a backend.
+type Snapshot interface {
+	List(ctx context.Context, start string) (internal.RouteIterator, error)
+	LastID(ctx context.Context) (uint64, error)
+
+	// Release disposes of the resources held by the snapshot.
+	Release()
+}
+
+// Snapshotter is implemented by backends that can provide a consistent view
+// of their contents at a single point in time.
+type Snapshotter interface {
+	Snapshot(ctx context.Context) (Snapshot, error)
+}
+
+// liveSnapshot reads directly from a backend that cannot take snapshots.
+type liveSnapshot struct {
+	Backend
+}
+
+func (s liveSnapshot) Release() {}
+
+// SnapshotOf returns a consistent snapshot of the backend if it supports
+// them. Otherwise, the returned snapshot reads from the live backend and may
+// observe changes made while it is in use.
+func SnapshotOf(ctx context.Context, b Backend) (Snapshot, error) {
+	if s, ok := b.(Snapshotter); ok {
+		return s.Snapshot(ctx)
+	}
+	return liveSnapshot{b}, nil
 }
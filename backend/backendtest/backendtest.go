@@ -0,0 +1,1008 @@
+// Package backendtest provides a conformance suite that every implementation
+// of backend.Backend is expected to pass.
+package backendtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/internal"
+)
+
+// Factory returns a new, empty backend along with a function that releases
+// it when the test is done.
+type Factory func(t *testing.T) (backend.Backend, func())
+
+// Options adjusts the suite for a particular backend.
+type Options struct {
+	// Skip maps the names of tests that the backend is known to fail to the
+	// reason they are skipped.
+	Skip map[string]string
+}
+
+// Run the conformance suite against backends from the given factory.
+func Run(t *testing.T, factory Factory, opts *Options) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, ctx context.Context, b backend.Backend)
+	}{
+		{"GetPutDel", testGetPutDel},
+		{"PutIf", testPutIf},
+		{"Rename", testRename},
+		{"Apply", testApply},
+		{"Reverse", testReverse},
+		{"RebuildIndexes", testRebuildIndexes},
+		{"List", testList},
+		{"ListCursor", testListCursor},
+		{"Seek", testSeek},
+		{"NextID", testNextID},
+		{"NextIDs", testNextIDs},
+		{"EnsureID", testEnsureID},
+		{"IDOverflow", testIDOverflow},
+		{"GeneratedNames", testGeneratedNames},
+		{"GetAll", testGetAll},
+		{"Snapshot", testSnapshot},
+		{"Watch", testWatch},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			if reason, ok := opts.Skip[test.name]; ok {
+				t.Skip(reason)
+			}
+
+			b, done := factory(t)
+			defer done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			test.fn(t, ctx, b)
+		})
+	}
+}
+
+func routeFor(name string) *internal.Route {
+	return &internal.Route{
+		URL:  fmt.Sprintf("http://%s/", name),
+		Time: time.Unix(1601418236, 123456000),
+	}
+}
+
+// Put routes for each of the names in a random order.
+func putRoutes(t *testing.T, ctx context.Context, b backend.Backend, names ...string) {
+	for _, i := range rand.Perm(len(names)) {
+		if err := b.Put(ctx, names[i], routeFor(names[i])); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Routes are compared at microsecond precision, which is all that firestore
+// retains.
+func mustBeRoute(t *testing.T, name string, got, want *internal.Route) {
+	if got == nil {
+		t.Fatalf("%s: expected a route, got nil", name)
+	}
+
+	if got.URL != want.URL {
+		t.Fatalf("%s: expected URL of %s, got %s", name, want.URL, got.URL)
+	}
+
+	if !got.Time.Truncate(time.Microsecond).Equal(want.Time.Truncate(time.Microsecond)) {
+		t.Fatalf("%s: expected time of %s, got %s", name, want.Time, got.Time)
+	}
+}
+
+func mustNotBeFound(t *testing.T, ctx context.Context, b backend.Backend, name string) {
+	if _, err := b.Get(ctx, name); !errors.Is(err, internal.ErrRouteNotFound) {
+		t.Fatalf("%s: expected ErrRouteNotFound, got %v", name, err)
+	}
+}
+
+// Read the rest of the iterator, checking each route, and release it.
+func drain(t *testing.T, iter internal.RouteIterator) []string {
+	defer iter.Release()
+
+	var names []string
+	for iter.Next() {
+		if !iter.Valid() {
+			t.Fatal("expected iterator to be valid after Next returns true")
+		}
+		mustBeRoute(t, iter.Name(), iter.Route(), routeFor(iter.Name()))
+		names = append(names, iter.Name())
+	}
+
+	if err := iter.Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if iter.Valid() {
+		t.Fatal("expected iterator to be invalid at end")
+	}
+
+	return names
+}
+
+func mustBeNames(t *testing.T, got []string, want ...string) {
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func testGetPutDel(t *testing.T, ctx context.Context, b backend.Backend) {
+	mustNotBeFound(t, ctx, b, "a")
+
+	putRoutes(t, ctx, b, "a")
+
+	rt, err := b.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeRoute(t, "a", rt, routeFor("a"))
+
+	// Put replaces an existing route.
+	nrt := &internal.Route{
+		URL:  "http://b/",
+		Time: time.Unix(1601418237, 0),
+	}
+	if err := b.Put(ctx, "a", nrt); err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err = b.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeRoute(t, "a", rt, nrt)
+
+	if err := b.Del(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	mustNotBeFound(t, ctx, b, "a")
+
+	// deleting a missing route is not an error.
+	if err := b.Del(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustPutIf(t *testing.T, ctx context.Context, b backend.Backend, name string, rt *internal.Route, version string) string {
+	ver, err := b.PutIf(ctx, name, rt, version)
+	if err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+	return ver
+}
+
+func mustBeMismatch(t *testing.T, ctx context.Context, b backend.Backend, name string, version string) {
+	_, err := b.PutIf(ctx, name, routeFor("x"), version)
+	if !errors.Is(err, backend.ErrVersionMismatch) {
+		t.Fatalf("%s: expected ErrVersionMismatch, got %v", name, err)
+	}
+}
+
+func testPutIf(t *testing.T, ctx context.Context, b backend.Backend) {
+	if _, _, err := b.GetVersion(ctx, "a"); !errors.Is(err, internal.ErrRouteNotFound) {
+		t.Fatalf("expected ErrRouteNotFound, got %v", err)
+	}
+
+	// a route is only created when there is none.
+	v1 := mustPutIf(t, ctx, b, "a", routeFor("a"), backend.NoVersion)
+	mustBeMismatch(t, ctx, b, "a", backend.NoVersion)
+
+	rt, ver, err := b.GetVersion(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeRoute(t, "a", rt, routeFor("a"))
+	if ver != v1 {
+		t.Fatalf("expected version %q, got %q", v1, ver)
+	}
+
+	// and only replaced when it has not changed.
+	nrt := &internal.Route{
+		URL:  "http://b/",
+		Time: time.Unix(1601418237, 0),
+	}
+	v2 := mustPutIf(t, ctx, b, "a", nrt, v1)
+	if v2 == v1 {
+		t.Fatal("expected the version to change")
+	}
+	mustBeMismatch(t, ctx, b, "a", v1)
+
+	rt, err = b.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeRoute(t, "a", rt, nrt)
+
+	// a put changes the version.
+	putRoutes(t, ctx, b, "a")
+	mustBeMismatch(t, ctx, b, "a", v2)
+
+	// a deleted route has no version.
+	if err := b.Del(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	mustBeMismatch(t, ctx, b, "a", v2)
+	mustPutIf(t, ctx, b, "a", routeFor("a"), backend.NoVersion)
+
+	names, err := b.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeNames(t, drain(t, names), "a")
+}
+
+func mustBeRenameMismatch(t *testing.T, ctx context.Context, b backend.Backend, from, version, to string) {
+	if _, err := b.Rename(ctx, from, version, to, nil); !errors.Is(err, backend.ErrVersionMismatch) {
+		t.Fatalf("rename %s to %s: expected ErrVersionMismatch, got %v", from, to, err)
+	}
+}
+
+func testRename(t *testing.T, ctx context.Context, b backend.Backend) {
+	putRoutes(t, ctx, b, "a", "b")
+
+	_, va, err := b.GetVersion(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a route is only moved if it has not changed and the name is free.
+	mustBeRenameMismatch(t, ctx, b, "a", va, "b")
+	mustBeRenameMismatch(t, ctx, b, "a", "x", "c")
+	mustBeRenameMismatch(t, ctx, b, "x", va, "c")
+
+	ver, err := b.Rename(ctx, "a", va, "c", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustNotBeFound(t, ctx, b, "a")
+
+	rt, vc, err := b.GetVersion(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeRoute(t, "c", rt, routeFor("a"))
+	if vc != ver {
+		t.Fatalf("expected version %q, got %q", ver, vc)
+	}
+
+	// a route can be left behind in its place.
+	alias := &internal.Route{
+		URL:   routeFor("a").URL,
+		Time:  time.Unix(1601418237, 0),
+		Alias: "d",
+	}
+	if _, err := b.Rename(ctx, "c", vc, "d", alias); err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err = b.Get(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeRoute(t, "c", rt, alias)
+	if rt.Alias != "d" {
+		t.Fatalf("expected an alias of d, got %q", rt.Alias)
+	}
+
+	rt, err = b.Get(ctx, "d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeRoute(t, "d", rt, routeFor("a"))
+
+	iter, err := b.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iter.Release()
+
+	var names []string
+	for iter.Next() {
+		names = append(names, iter.Name())
+	}
+	if err := iter.Error(); err != nil {
+		t.Fatal(err)
+	}
+	mustBeNames(t, names, "b", "c", "d")
+}
+
+func testApply(t *testing.T, ctx context.Context, b backend.Backend) {
+	putRoutes(t, ctx, b, "a", "b")
+
+	_, va, err := b.GetVersion(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nrt := &internal.Route{
+		URL:  "http://b2/",
+		Time: time.Unix(1601418237, 0),
+	}
+
+	vers, err := b.Apply(ctx, []*backend.Change{
+		{Op: backend.OpPut, Name: "c", Route: routeFor("c"), Conditional: true},
+		{Op: backend.OpDel, Name: "a", Conditional: true, Version: va},
+		{Op: backend.OpPut, Name: "b", Route: nrt},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vers) != 3 || vers[1] != backend.NoVersion {
+		t.Fatalf("unexpected versions %q", vers)
+	}
+
+	mustNotBeFound(t, ctx, b, "a")
+
+	rt, vb, err := b.GetVersion(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeRoute(t, "b", rt, nrt)
+	if vb != vers[2] {
+		t.Fatalf("expected version %q, got %q", vers[2], vb)
+	}
+
+	rt, err = b.Get(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeRoute(t, "c", rt, routeFor("c"))
+
+	// nothing is changed when any condition does not hold.
+	_, err = b.Apply(ctx, []*backend.Change{
+		{Op: backend.OpPut, Name: "d", Route: routeFor("d")},
+		{Op: backend.OpPut, Name: "c", Route: routeFor("c"), Conditional: true},
+	})
+	if !errors.Is(err, backend.ErrVersionMismatch) {
+		t.Fatalf("expected ErrVersionMismatch, got %v", err)
+	}
+
+	var berr *backend.BatchError
+	if !errors.As(err, &berr) || (berr.Index != 1 && berr.Index != -1) {
+		t.Fatalf("expected a BatchError for change 1, got %v", err)
+	}
+	mustNotBeFound(t, ctx, b, "d")
+}
+
+func mustHaveNamesForURL(t *testing.T, ctx context.Context, b backend.Backend, url string, want ...string) {
+	names, err := b.NamesForURL(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeNames(t, names, want...)
+}
+
+func mustHaveNamesForHost(t *testing.T, ctx context.Context, b backend.Backend, host string, want ...string) {
+	names, err := b.NamesForHost(ctx, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeNames(t, names, want...)
+}
+
+func testReverse(t *testing.T, ctx context.Context, b backend.Backend) {
+	when := time.Unix(1601418236, 0)
+	for name, url := range map[string]string{
+		"a": "https://old.example.com/a",
+		"b": "HTTPS://Old.Example.com:443/a#top",
+		"c": "https://old.example.com/c",
+		"d": "https://new.example.com/a",
+	} {
+		if err := b.Put(ctx, name, &internal.Route{URL: url, Time: when}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mustHaveNamesForURL(t, ctx, b, "https://old.example.com/a", "a", "b")
+	mustHaveNamesForURL(t, ctx, b, "https://old.example.com/x")
+	mustHaveNamesForHost(t, ctx, b, "OLD.example.com", "a", "b", "c")
+
+	// the index follows every kind of change.
+	_, vc, err := b.GetVersion(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustPutIf(t, ctx, b, "c", &internal.Route{URL: "https://new.example.com/a", Time: when}, vc)
+
+	_, va, err := b.GetVersion(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Rename(ctx, "a", va, "e", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Apply(ctx, []*backend.Change{
+		{Op: backend.OpDel, Name: "d"},
+		{Op: backend.OpPut, Name: "f", Route: &internal.Route{URL: "https://old.example.com/f", Time: when}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Del(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	mustHaveNamesForURL(t, ctx, b, "https://old.example.com/a", "e")
+	mustHaveNamesForURL(t, ctx, b, "https://new.example.com/a", "c")
+	mustHaveNamesForHost(t, ctx, b, "old.example.com", "e", "f")
+	mustHaveNamesForHost(t, ctx, b, "new.example.com", "c")
+}
+
+func testRebuildIndexes(t *testing.T, ctx context.Context, b backend.Backend) {
+	putRoutes(t, ctx, b, "a", "b", "c")
+
+	names, err := backend.NamesOf(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeNames(t, names, "a", "b", "c")
+
+	if err := backend.RebuildIndexes(ctx, b); err == backend.ErrNoIndexer {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	// rebuilding indexes that were right leaves them as they were.
+	mustHaveNamesForURL(t, ctx, b, "http://a/", "a")
+	mustHaveNamesForHost(t, ctx, b, "c", "c")
+
+	iter, err := b.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeNames(t, drain(t, iter), "a", "b", "c")
+}
+
+func testList(t *testing.T, ctx context.Context, b backend.Backend) {
+	iter, err := b.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeNames(t, drain(t, iter))
+
+	putRoutes(t, ctx, b, "0", ":a", ":b", "a", "aa", "b", "c")
+
+	iter, err = b.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if iter.Valid() {
+		t.Fatal("expected iterator to be invalid at start")
+	}
+
+	if iter.Name() != "" || iter.Route() != nil {
+		t.Fatal("expected iterator to have no route at start")
+	}
+
+	mustBeNames(t, drain(t, iter), "0", ":a", ":b", "a", "aa", "b", "c")
+
+	// start is a position, not a prefix.
+	iter, err = b.List(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeNames(t, drain(t, iter), "a", "aa", "b", "c")
+
+	iter, err = b.List(ctx, "ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeNames(t, drain(t, iter), "b", "c")
+
+	iter, err = b.List(ctx, "z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeNames(t, drain(t, iter))
+}
+
+// Page through the routes the way /api/urls/ does, using the name of the
+// first route that didn't fit as the start of the next page.
+func testListCursor(t *testing.T, ctx context.Context, b backend.Backend) {
+	names := make([]string, 25)
+	for i := range names {
+		names[i] = fmt.Sprintf("n%02d", i)
+	}
+	putRoutes(t, ctx, b, names...)
+
+	var got []string
+	cursor := ""
+	for page := 0; page <= len(names); page++ {
+		iter, err := b.List(ctx, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for n := 0; n < 4 && iter.Next(); n++ {
+			got = append(got, iter.Name())
+		}
+
+		cursor = ""
+		if iter.Next() {
+			cursor = iter.Name()
+		}
+
+		if err := iter.Error(); err != nil {
+			t.Fatal(err)
+		}
+		iter.Release()
+
+		if cursor == "" {
+			mustBeNames(t, got, names...)
+			return
+		}
+	}
+
+	t.Fatal("too many pages")
+}
+
+func testSeek(t *testing.T, ctx context.Context, b backend.Backend) {
+	putRoutes(t, ctx, b, ":a", ":b", "a", "b", "d")
+
+	iter, err := b.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iter.Release()
+
+	if !iter.Next() || iter.Name() != ":a" {
+		t.Fatalf("expected first route to be :a, got %s", iter.Name())
+	}
+
+	// seek past the generated names the way /api/urls/ does.
+	if !iter.Seek(";") || !iter.Valid() || iter.Name() != "a" {
+		t.Fatalf("expected seek to land on a, got %s", iter.Name())
+	}
+	mustBeRoute(t, "a", iter.Route(), routeFor("a"))
+
+	if !iter.Seek("c") || iter.Name() != "d" {
+		t.Fatalf("expected seek to land on d, got %s", iter.Name())
+	}
+
+	// seeking backwards is allowed.
+	if !iter.Seek("b") || iter.Name() != "b" {
+		t.Fatalf("expected seek to land on b, got %s", iter.Name())
+	}
+	mustBeNames(t, drain(t, iter), "d")
+
+	iter, err = b.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iter.Release()
+
+	if iter.Seek("e") || iter.Valid() {
+		t.Fatal("expected seek past the end to be invalid")
+	}
+
+	if iter.Next() {
+		t.Fatal("expected no routes after seeking past the end")
+	}
+}
+
+func testNextID(t *testing.T, ctx context.Context, b backend.Backend) {
+	const workers, each = 8, 25
+
+	var lck sync.Mutex
+	var wg sync.WaitGroup
+	var ids []uint64
+	errs := make(chan error, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				id, err := b.NextID(ctx)
+				if err != nil {
+					errs <- err
+					return
+				}
+				lck.Lock()
+				ids = append(ids, id)
+				lck.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+
+	for i, id := range ids {
+		if id != uint64(i+1) {
+			t.Fatalf("expected ids 1 to %d without gaps or repeats, got %d at %d", len(ids), id, i)
+		}
+	}
+
+	if id, err := b.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != workers*each {
+		t.Fatalf("expected last id of %d, got %d", workers*each, id)
+	}
+}
+
+func testNextIDs(t *testing.T, ctx context.Context, b backend.Backend) {
+	const workers = 8
+
+	var lck sync.Mutex
+	var wg sync.WaitGroup
+	seen := map[uint64]bool{}
+	var max uint64
+	errs := make(chan error, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				var ids []uint64
+				if n == 1 {
+					id, err := b.NextID(ctx)
+					if err != nil {
+						errs <- err
+						return
+					}
+					ids = []uint64{id}
+				} else {
+					var err error
+					if ids, err = b.NextIDs(ctx, n); err != nil {
+						errs <- err
+						return
+					}
+				}
+
+				if len(ids) != n {
+					errs <- fmt.Errorf("expected %d ids, got %d", n, len(ids))
+					return
+				}
+
+				var err error
+				lck.Lock()
+				for k, id := range ids {
+					if seen[id] {
+						err = fmt.Errorf("%d was handed out twice", id)
+					} else if k > 0 && id <= ids[k-1] {
+						err = fmt.Errorf("expected increasing ids, got %v", ids)
+					}
+					seen[id] = true
+					if id > max {
+						max = id
+					}
+				}
+				lck.Unlock()
+
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i + 1)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	if id, err := b.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id < max {
+		t.Fatalf("expected last id of at least %d, got %d", max, id)
+	}
+
+	if err := b.EnsureID(ctx, max+100); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := b.NextIDs(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 3 || ids[0] <= max+100 {
+		t.Fatalf("expected 3 ids above %d, got %v", max+100, ids)
+	}
+}
+
+func testEnsureID(t *testing.T, ctx context.Context, b backend.Backend) {
+	if id, err := b.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 0 {
+		t.Fatalf("expected last id of 0, got %d", id)
+	}
+
+	if err := b.EnsureID(ctx, 1<<40); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.EnsureID(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := b.NextID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 1<<40+1 {
+		t.Fatalf("expected next id of %d, got %d", 1<<40+1, id)
+	}
+}
+
+func testIDOverflow(t *testing.T, ctx context.Context, b backend.Backend) {
+	if err := b.EnsureID(ctx, backend.MaxID+1); !errors.Is(err, backend.ErrIDOverflow) {
+		t.Fatalf("expected an overflow raising the counter past the max, got %v", err)
+	}
+
+	if err := b.EnsureID(ctx, backend.MaxID-2); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.NextIDs(ctx, 3); !errors.Is(err, backend.ErrIDOverflow) {
+		t.Fatalf("expected an overflow handing out 3 ids, got %v", err)
+	}
+
+	for _, exp := range []uint64{backend.MaxID - 1, backend.MaxID} {
+		if id, err := b.NextID(ctx); err != nil {
+			t.Fatal(err)
+		} else if id != exp {
+			t.Fatalf("expected next id of %d, got %d", exp, id)
+		}
+	}
+
+	if _, err := b.NextID(ctx); !errors.Is(err, backend.ErrIDOverflow) {
+		t.Fatalf("expected an overflow past the max, got %v", err)
+	}
+
+	if id, err := b.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != backend.MaxID {
+		t.Fatalf("expected last id of %d, got %d", uint64(backend.MaxID), id)
+	}
+}
+
+// Check that the counter is at least id.
+func mustHaveCounterAtLeast(t *testing.T, ctx context.Context, b backend.Backend, id uint64) {
+	if last, err := b.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if last < id {
+		t.Fatalf("expected last id of at least %d, got %d", id, last)
+	}
+}
+
+func testGeneratedNames(t *testing.T, ctx context.Context, b backend.Backend) {
+	// routes stored under generated names raise the counter past their IDs,
+	// however they are written.
+	putRoutes(t, ctx, b, internal.EncodeID(10))
+	mustHaveCounterAtLeast(t, ctx, b, 10)
+
+	if _, err := b.PutIf(ctx, internal.EncodeID(20), routeFor("b"), backend.NoVersion); err != nil {
+		t.Fatal(err)
+	}
+	mustHaveCounterAtLeast(t, ctx, b, 20)
+
+	_, ver, err := b.GetVersion(ctx, internal.EncodeID(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Rename(ctx, internal.EncodeID(20), ver, internal.EncodeID(30), nil); err != nil {
+		t.Fatal(err)
+	}
+	mustHaveCounterAtLeast(t, ctx, b, 30)
+
+	if _, err := b.Apply(ctx, []*backend.Change{
+		{Op: backend.OpPut, Name: internal.EncodeID(40), Route: routeFor("c")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	mustHaveCounterAtLeast(t, ctx, b, 40)
+
+	// a name above the highest ID could never have been handed out.
+	putRoutes(t, ctx, b, internal.EncodeID(backend.MaxID+1))
+
+	if id, err := b.NextID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id <= 40 || id > 1<<20 {
+		t.Fatalf("expected next id just above 40, got %d", id)
+	}
+}
+
+func testGetAll(t *testing.T, ctx context.Context, b backend.Backend) {
+	names := make([]string, 250)
+	for i := range names {
+		names[i] = fmt.Sprintf("r%03d", i)
+	}
+	putRoutes(t, ctx, b, names...)
+
+	// generated IDs must not show up as routes.
+	if _, err := b.NextID(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := b.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != len(names) {
+		t.Fatalf("expected %d routes, got %d", len(names), len(all))
+	}
+
+	for _, name := range names {
+		rt, ok := all[name]
+		if !ok {
+			t.Fatalf("expected %s in GetAll", name)
+		}
+		mustBeRoute(t, name, &rt, routeFor(name))
+	}
+}
+
+func testSnapshot(t *testing.T, ctx context.Context, b backend.Backend) {
+	putRoutes(t, ctx, b, "a", "c")
+	if _, err := b.NextID(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := backend.SnapshotOf(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+
+	_, consistent := b.(backend.Snapshotter)
+	if consistent {
+		putRoutes(t, ctx, b, "b")
+		if err := b.Del(ctx, "c"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.NextID(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	iter, err := snap.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeNames(t, drain(t, iter), "a", "c")
+
+	if id, err := snap.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 1 {
+		t.Fatalf("expected snapshot id of 1, got %d", id)
+	}
+}
+
+// Receive the next event from a watch.
+func nextEvent(t *testing.T, ch <-chan *backend.Event) *backend.Event {
+	select {
+	case e, ok := <-ch:
+		if !ok {
+			t.Fatal("expected an event, watch was closed")
+		}
+		return e
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return nil
+}
+
+func mustBeEvent(t *testing.T, e *backend.Event, op backend.Op, name string, before, after *internal.Route) {
+	if e.Op != op || e.Name != name {
+		t.Fatalf("expected %s of %s, got %s of %s", op, name, e.Op, e.Name)
+	}
+
+	for _, v := range []struct {
+		what      string
+		got, want *internal.Route
+	}{
+		{"before", e.Before, before},
+		{"after", e.After, after},
+	} {
+		if v.want == nil {
+			if v.got != nil {
+				t.Fatalf("%s %s of %s: expected no %s route, got %v", e.Op, e.Name, v.what, v.what, v.got)
+			}
+			continue
+		}
+
+		if v.got == nil {
+			t.Fatalf("%s %s: expected a %s route", e.Op, e.Name, v.what)
+		}
+		mustBeRoute(t, name, v.got, v.want)
+	}
+}
+
+func testWatch(t *testing.T, ctx context.Context, b backend.Backend) {
+	putRoutes(t, ctx, b, "a")
+
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch, err := backend.Watch(wctx, b)
+	if errors.Is(err, backend.ErrWatchNotSupported) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	nrt := &internal.Route{
+		URL:  "http://a2/",
+		Time: time.Unix(1601418237, 0),
+	}
+	if err := b.Put(ctx, "a", nrt); err != nil {
+		t.Fatal(err)
+	}
+	putRoutes(t, ctx, b, "b")
+	if err := b.Del(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// deleting a missing route changes nothing.
+	if err := b.Del(ctx, "x"); err != nil {
+		t.Fatal(err)
+	}
+	putRoutes(t, ctx, b, "z")
+
+	events := []*backend.Event{
+		nextEvent(t, ch),
+		nextEvent(t, ch),
+		nextEvent(t, ch),
+		nextEvent(t, ch),
+	}
+	mustBeEvent(t, events[0], backend.OpPut, "a", routeFor("a"), nrt)
+	mustBeEvent(t, events[1], backend.OpPut, "b", nil, routeFor("b"))
+	mustBeEvent(t, events[2], backend.OpDel, "a", nrt, nil)
+	mustBeEvent(t, events[3], backend.OpPut, "z", nil, routeFor("z"))
+
+	for i := 1; i < len(events); i++ {
+		if events[i].Seq <= events[i-1].Seq {
+			t.Fatalf("expected increasing sequence numbers, got %d after %d",
+				events[i].Seq, events[i-1].Seq)
+		}
+	}
+
+	cancel()
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("expected watch to be closed when its context is done")
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Package cache provides a read-through cache that can sit in front of any
+// backend.
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/internal"
+)
+
+// Options controls the size of the cache and how long entries live.
+type Options struct {
+	// Size is the maximum number of names held in the cache.
+	Size int
+
+	// TTL bounds how long a route is served from the cache. Writes made
+	// through this cache are seen at once, but writes made by other servers
+	// sharing the backend are only seen after TTL. Zero means routes never
+	// expire.
+	TTL time.Duration
+
+	// NegativeTTL is how long a name that was not found is remembered. Zero
+	// disables negative caching.
+	NegativeTTL time.Duration
+}
+
+// Stats reports how well the cache is doing.
+type Stats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+type entry struct {
+	// rt is nil for a name that was not found.
+	rt      *internal.Route
+	expires time.Time
+}
+
+// Backend caches the results of Get from the backend it wraps. Put, PutIf and
+// Del invalidate the cached names they touch and every other method is passed
+// through.
+type Backend struct {
+	// accessed atomically and kept first for 64-bit alignment.
+	hits   uint64
+	misses uint64
+
+	backend.Backend
+
+	opts Options
+	now  func() time.Time
+
+	mu  sync.Mutex
+	lru *simplelru.LRU
+
+	// gen is bumped on every write so that a Get that raced with a write
+	// does not cache the value it read from before the write.
+	gen uint64
+}
+
+// New wraps b in a cache.
+func New(b backend.Backend, opts *Options) (*Backend, error) {
+	lru, err := simplelru.NewLRU(opts.Size, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Backend{
+		Backend: b,
+		opts:    *opts,
+		now:     time.Now,
+		lru:     lru,
+	}, nil
+}
+
+// Look up a name in the cache, returning the entry if it has not expired.
+func (c *Backend) lookup(name string) (*entry, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, ok := c.lru.Get(name); ok {
+		e := v.(*entry)
+		if e.expires.IsZero() || c.now().Before(e.expires) {
+			return e, c.gen, true
+		}
+		c.lru.Remove(name)
+	}
+
+	return nil, c.gen, false
+}
+
+// Add an entry for name unless the backend was written since gen.
+func (c *Backend) add(name string, rt *internal.Route, gen uint64) {
+	ttl := c.opts.TTL
+	if rt == nil {
+		ttl = c.opts.NegativeTTL
+	}
+
+	e := &entry{rt: rt}
+	if ttl > 0 {
+		e.expires = c.now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen == gen {
+		c.lru.Add(name, e)
+	}
+}
+
+// Invalidate forgets name, or everything if name is empty.
+func (c *Backend) Invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if name == "" {
+		c.lru.Purge()
+	} else {
+		c.lru.Remove(name)
+	}
+}
+
+// Get retrieves a route from the cache, falling back to the backend.
+func (c *Backend) Get(ctx context.Context, name string) (*internal.Route, error) {
+	e, gen, ok := c.lookup(name)
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+		if e.rt == nil {
+			return nil, internal.ErrRouteNotFound
+		}
+		rt := *e.rt
+		return &rt, nil
+	}
+
+	atomic.AddUint64(&c.misses, 1)
+
+	rt, err := c.Backend.Get(ctx, name)
+	if errors.Is(err, internal.ErrRouteNotFound) {
+		if c.opts.NegativeTTL > 0 {
+			c.add(name, nil, gen)
+		}
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	cp := *rt
+	c.add(name, &cp, gen)
+	return rt, nil
+}
+
+// Put stores a route in the backend and invalidates the cached name.
+func (c *Backend) Put(ctx context.Context, name string, rt *internal.Route) error {
+	defer c.Invalidate(name)
+	return c.Backend.Put(ctx, name, rt)
+}
+
+// PutIf stores a route in the backend if the one it replaces has the given
+// version and invalidates the cached name. Versions are not cached, so the
+// check is always made against the backend.
+func (c *Backend) PutIf(ctx context.Context, name string, rt *internal.Route, version string) (string, error) {
+	defer c.Invalidate(name)
+	return c.Backend.PutIf(ctx, name, rt, version)
+}
+
+// Rename moves a route in the backend and invalidates both of its names.
+func (c *Backend) Rename(ctx context.Context, from, version, to string, leave *internal.Route) (string, error) {
+	defer c.Invalidate(to)
+	defer c.Invalidate(from)
+	return c.Backend.Rename(ctx, from, version, to, leave)
+}
+
+// Apply makes a batch of changes in the backend and invalidates every name
+// that it changes.
+func (c *Backend) Apply(ctx context.Context, changes []*backend.Change) ([]string, error) {
+	defer func() {
+		for _, ch := range changes {
+			c.Invalidate(ch.Name)
+		}
+	}()
+	return c.Backend.Apply(ctx, changes)
+}
+
+// Del removes a route from the backend and invalidates the cached name.
+func (c *Backend) Del(ctx context.Context, name string) error {
+	defer c.Invalidate(name)
+	return c.Backend.Del(ctx, name)
+}
+
+// Snapshot takes a snapshot of the wrapped backend.
+func (c *Backend) Snapshot(ctx context.Context) (backend.Snapshot, error) {
+	return backend.SnapshotOf(ctx, c.Backend)
+}
+
+// Watch delivers the changes made to the wrapped backend.
+func (c *Backend) Watch(ctx context.Context) (<-chan *backend.Event, error) {
+	return backend.Watch(ctx, c.Backend)
+}
+
+// ListNames returns every name in the wrapped backend.
+func (c *Backend) ListNames(ctx context.Context) ([]string, error) {
+	return backend.NamesOf(ctx, c.Backend)
+}
+
+// RebuildIndexes rebuilds the indexes of the wrapped backend.
+func (c *Backend) RebuildIndexes(ctx context.Context) error {
+	return backend.RebuildIndexes(ctx, c.Backend)
+}
+
+// Stats returns the hit and miss counts along with the number of entries.
+func (c *Backend) Stats() Stats {
+	c.mu.Lock()
+	n := c.lru.Len()
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Entries: n,
+	}
+}
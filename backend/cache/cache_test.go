@@ -0,0 +1,262 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/backend/backendtest"
+	"github.com/kellegous/go/backend/memory"
+	"github.com/kellegous/go/internal"
+)
+
+// A backend that counts calls to Get.
+type countingBackend struct {
+	backend.Backend
+	gets int
+}
+
+func (b *countingBackend) Get(ctx context.Context, name string) (*internal.Route, error) {
+	b.gets++
+	return b.Backend.Get(ctx, name)
+}
+
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func newCache(t *testing.T, opts *Options) (*Backend, *countingBackend, *clock) {
+	mem, err := memory.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cb := &countingBackend{Backend: mem}
+	c, err := New(cb, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clk := &clock{t: time.Unix(1601418237, 0)}
+	c.now = clk.now
+	return c, cb, clk
+}
+
+func mustGet(t *testing.T, c *Backend, name, url string) {
+	rt, err := c.Get(context.Background(), name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rt.URL != url {
+		t.Fatalf("expected %s for %s, got %s", url, name, rt.URL)
+	}
+}
+
+func mustNotBeFound(t *testing.T, c *Backend, name string) {
+	if _, err := c.Get(context.Background(), name); !errors.Is(err, internal.ErrRouteNotFound) {
+		t.Fatalf("expected %s to not be found, got %v", name, err)
+	}
+}
+
+func mustHaveStats(t *testing.T, c *Backend, hits, misses uint64) {
+	s := c.Stats()
+	if s.Hits != hits || s.Misses != misses {
+		t.Fatalf("expected %d hits and %d misses, got %+v", hits, misses, s)
+	}
+}
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	c, cb, clk := newCache(t, &Options{
+		Size: 2,
+		TTL:  time.Minute,
+	})
+
+	if err := cb.Put(ctx, "a", &internal.Route{URL: "http://a/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	mustGet(t, c, "a", "http://a/")
+	mustGet(t, c, "a", "http://a/")
+	mustHaveStats(t, c, 1, 1)
+
+	// a route changed behind the cache's back is seen after the TTL.
+	if err := cb.Put(ctx, "a", &internal.Route{URL: "http://b/"}); err != nil {
+		t.Fatal(err)
+	}
+	mustGet(t, c, "a", "http://a/")
+
+	clk.t = clk.t.Add(time.Minute)
+	mustGet(t, c, "a", "http://b/")
+	mustHaveStats(t, c, 2, 2)
+
+	// the returned route is a copy.
+	rt, err := c.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.URL = "http://c/"
+	mustGet(t, c, "a", "http://b/")
+
+	if cb.gets != 2 {
+		t.Fatalf("expected 2 gets from the backend, got %d", cb.gets)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	ctx := context.Background()
+	c, cb, _ := newCache(t, &Options{Size: 2})
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := c.Put(ctx, name, &internal.Route{URL: "http://" + name + "/"}); err != nil {
+			t.Fatal(err)
+		}
+		mustGet(t, c, name, "http://"+name+"/")
+	}
+
+	if n := c.Stats().Entries; n != 2 {
+		t.Fatalf("expected 2 entries, got %d", n)
+	}
+
+	// a was the least recently used.
+	cb.gets = 0
+	mustGet(t, c, "c", "http://c/")
+	mustGet(t, c, "b", "http://b/")
+	mustGet(t, c, "a", "http://a/")
+	if cb.gets != 1 {
+		t.Fatalf("expected 1 get from the backend, got %d", cb.gets)
+	}
+}
+
+func TestNegative(t *testing.T) {
+	ctx := context.Background()
+	c, cb, clk := newCache(t, &Options{
+		Size:        10,
+		TTL:         time.Minute,
+		NegativeTTL: time.Second,
+	})
+
+	mustNotBeFound(t, c, "a")
+	mustNotBeFound(t, c, "a")
+	mustHaveStats(t, c, 1, 1)
+
+	// created behind the cache's back.
+	if err := cb.Put(ctx, "a", &internal.Route{URL: "http://a/"}); err != nil {
+		t.Fatal(err)
+	}
+	mustNotBeFound(t, c, "a")
+
+	clk.t = clk.t.Add(time.Second)
+	mustGet(t, c, "a", "http://a/")
+
+	// without negative caching, misses always go to the backend.
+	c, cb, _ = newCache(t, &Options{Size: 10})
+	mustNotBeFound(t, c, "a")
+	mustNotBeFound(t, c, "a")
+	if cb.gets != 2 {
+		t.Fatalf("expected 2 gets from the backend, got %d", cb.gets)
+	}
+}
+
+func TestInvalidation(t *testing.T) {
+	ctx := context.Background()
+	c, _, _ := newCache(t, &Options{
+		Size:        10,
+		NegativeTTL: time.Minute,
+	})
+
+	mustNotBeFound(t, c, "a")
+	if err := c.Put(ctx, "a", &internal.Route{URL: "http://a/"}); err != nil {
+		t.Fatal(err)
+	}
+	mustGet(t, c, "a", "http://a/")
+
+	if err := c.Put(ctx, "a", &internal.Route{URL: "http://b/"}); err != nil {
+		t.Fatal(err)
+	}
+	mustGet(t, c, "a", "http://b/")
+
+	if err := c.Del(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	mustNotBeFound(t, c, "a")
+
+	c.Invalidate("")
+	if n := c.Stats().Entries; n != 0 {
+		t.Fatalf("expected no entries, got %d", n)
+	}
+}
+
+// A backend whose Get lets a write happen between reading the route and
+// returning it.
+type racingBackend struct {
+	backend.Backend
+	during func()
+}
+
+func (b *racingBackend) Get(ctx context.Context, name string) (*internal.Route, error) {
+	rt, err := b.Backend.Get(ctx, name)
+	if b.during != nil {
+		during := b.during
+		b.during = nil
+		during()
+	}
+	return rt, err
+}
+
+func TestGetRacingPut(t *testing.T) {
+	ctx := context.Background()
+	mem, err := memory.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rb := &racingBackend{Backend: mem}
+	c, err := New(rb, &Options{Size: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Put(ctx, "a", &internal.Route{URL: "http://a/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rb.during = func() {
+		if err := c.Put(ctx, "a", &internal.Route{URL: "http://b/"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// this Get read the route from before the Put, which must not be cached.
+	mustGet(t, c, "a", "http://a/")
+	mustGet(t, c, "a", "http://b/")
+}
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) (backend.Backend, func()) {
+		mem, err := memory.New("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := New(mem, &Options{
+			Size:        100,
+			TTL:         time.Minute,
+			NegativeTTL: time.Minute,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return c, func() {
+			c.Close()
+		}
+	}, nil)
+}
@@ -0,0 +1,56 @@
+package backend
+
+import (
+	"context"
+	"errors"
+)
+
+// NameLister is implemented by backends that can list the names of their
+// routes without decoding them, so that routes that cannot be decoded are
+// still found.
+type NameLister interface {
+	ListNames(ctx context.Context) ([]string, error)
+}
+
+// NamesOf returns the name of every route in the backend, in order. Backends
+// that cannot list names on their own are listed with List, which stops at
+// the first route that cannot be decoded.
+func NamesOf(ctx context.Context, b Backend) ([]string, error) {
+	if l, ok := b.(NameLister); ok {
+		return l.ListNames(ctx)
+	}
+
+	iter, err := b.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Release()
+
+	var names []string
+	for iter.Next() {
+		names = append(names, iter.Name())
+	}
+
+	return names, iter.Error()
+}
+
+// Indexer is implemented by backends that keep indexes of their routes, such
+// as the reverse index, that can be rebuilt from the routes.
+type Indexer interface {
+	// RebuildIndexes makes every index agree with the routes. It is safe to
+	// call while routes are changing. Routes that cannot be decoded are left
+	// out of the indexes.
+	RebuildIndexes(ctx context.Context) error
+}
+
+// ErrNoIndexer is returned by RebuildIndexes for backends that cannot rebuild
+// their indexes.
+var ErrNoIndexer = errors.New("the backend cannot rebuild its indexes")
+
+// RebuildIndexes rebuilds the indexes of the backend if it supports it.
+func RebuildIndexes(ctx context.Context, b Backend) error {
+	if x, ok := b.(Indexer); ok {
+		return x.RebuildIndexes(ctx)
+	}
+	return ErrNoIndexer
+}
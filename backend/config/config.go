@@ -0,0 +1,166 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/backend/cache"
+	"github.com/kellegous/go/backend/firestore"
+	"github.com/kellegous/go/backend/lease"
+	"github.com/kellegous/go/backend/leveldb"
+	"github.com/kellegous/go/backend/memory"
+	"github.com/kellegous/go/backend/redis"
+)
+
+// AddFlags registers the flags needed to open a backend. Every flag name is
+// given the prefix, which allows a single command to configure more than one
+// backend.
+func AddFlags(fs *pflag.FlagSet, prefix string) {
+	fs.String(prefix+"backend", "leveldb", "backing store to use. 'leveldb', 'firestore', 'redis' and 'memory' currently supported.")
+	fs.String(prefix+"data", "data", "The location of the leveldb data directory")
+	fs.String(prefix+"project", "", "The GCP project to use for the firestore backend. Will attempt to use application default creds if not defined.")
+	fs.Int(prefix+"firestore-id-shards", 0, "Number of documents the firestore ID counter is spread over, so that servers generating names do not contend on one. Every server must use the same number.")
+	fs.String(prefix+"redis-url", "", "URL of the redis DB to use, redis[s]://[user[:pw]@]host[:port][,host[:port]...][/db][?option=value]. Other redis flags override it.")
+	fs.String(prefix+"redis-addr", "", "Address of the redis DB to use. A comma-separated list gives the seed nodes of a cluster or the sentinels of a master.")
+	fs.String(prefix+"redis-user", "", "ACL username for the redis DB")
+	fs.String(prefix+"redis-pw", "", "Password to the redis DB")
+	fs.String(prefix+"redis-db", "", "Redis DB to use.")
+	fs.String(prefix+"redis-master", "", "Name of the master to find through the sentinels in --redis-addr")
+	fs.String(prefix+"redis-sentinel-pw", "", "Password to the redis sentinels")
+	fs.Bool(prefix+"redis-cluster", false, "Connect to a redis cluster through the nodes in --redis-addr")
+	fs.Bool(prefix+"redis-tls", false, "Connect to redis over TLS")
+	fs.String(prefix+"redis-tls-ca", "", "PEM file of the CA that signed the redis server certificate")
+	fs.String(prefix+"redis-tls-cert", "", "PEM file of the client certificate to present to redis")
+	fs.String(prefix+"redis-tls-key", "", "PEM file of the key for --redis-tls-cert")
+	fs.String(prefix+"redis-tls-server-name", "", "Server name to verify the redis certificate against")
+	fs.Bool(prefix+"redis-tls-insecure", false, "Skip verification of the redis server certificate")
+	fs.Bool(prefix+"redis-debug", false, "Enable redis debug logging")
+	fs.String(prefix+"redis-prefix", "", "Prefix given to every key the redis backend uses (default \""+redis.DefaultPrefix+"\")")
+	fs.String(prefix+"redis-events", "", "Publish changes to routes through redis pub/sub so that they can be watched (default true)")
+	fs.Lookup(prefix + "redis-events").NoOptDefVal = "true"
+	fs.Bool(prefix+"redis-migrate-legacy", false, "Move routes stored as unprefixed redis keys under the redis prefix")
+	fs.String(prefix+"memory-file", "", "File the memory backend is loaded from and saved to on exit. Nothing is saved if empty.")
+	fs.Int(prefix+"id-lease-size", 0, "Number of IDs to lease from the backend at a time and hand out from memory, so that generating a name does not write the counter each time. IDs left in a lease when the server stops are never used. Leasing is disabled if 0 or 1.")
+	fs.Int(prefix+"cache-size", 0, "Number of routes to cache in memory in front of the backend. The cache is disabled if 0.")
+	fs.Duration(prefix+"cache-ttl", time.Minute, "How long a cached route is used before it is read from the backend again")
+	fs.Duration(prefix+"cache-negative-ttl", 10*time.Second, "How long a name that was not found is remembered. Not found names are not cached if 0.")
+}
+
+// Open the backend described by the flags with the given prefix. The flags
+// are read through viper so they may also be set from the environment.
+func Open(ctx context.Context, prefix string) (backend.Backend, error) {
+	b, err := open(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if n := viper.GetInt(prefix + "id-lease-size"); n > 1 {
+		b = lease.New(b, n)
+	}
+
+	size := viper.GetInt(prefix + "cache-size")
+	if size <= 0 {
+		return b, nil
+	}
+
+	c, err := cache.New(b, &cache.Options{
+		Size:        size,
+		TTL:         viper.GetDuration(prefix + "cache-ttl"),
+		NegativeTTL: viper.GetDuration(prefix + "cache-negative-ttl"),
+	})
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func open(ctx context.Context, prefix string) (backend.Backend, error) {
+	switch name := viper.GetString(prefix + "backend"); name {
+	case "leveldb":
+		return leveldb.New(viper.GetString(prefix + "data"))
+	case "firestore":
+		return firestore.New(ctx, viper.GetString(prefix+"project"), &firestore.Options{
+			IDShards: viper.GetInt(prefix + "firestore-id-shards"),
+		})
+	case "redis":
+		redis.Debug = redis.Debug || viper.GetBool(prefix+"redis-debug")
+		cfg, err := redisConfig(prefix)
+		if err != nil {
+			return nil, err
+		}
+		b, err := redis.New(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if viper.GetBool(prefix + "redis-migrate-legacy") {
+			n, err := b.MigrateLegacy(ctx)
+			if err != nil {
+				b.Close()
+				return nil, err
+			}
+			log.Printf("migrated %d legacy redis routes", n)
+		}
+		return b, nil
+	case "memory":
+		return memory.New(viper.GetString(prefix + "memory-file"))
+	default:
+		return nil, fmt.Errorf("unknown backend %s", name)
+	}
+}
+
+// Build the redis configuration from --redis-url and the other redis flags,
+// which take precedence over the URL when they are set.
+func redisConfig(prefix string) (*redis.Config, error) {
+	cfg := &redis.Config{
+		Prefix: redis.DefaultPrefix,
+		Events: true,
+	}
+	if u := viper.GetString(prefix + "redis-url"); u != "" {
+		var err error
+		if cfg, err = redis.ParseURL(u); err != nil {
+			return nil, err
+		}
+	}
+
+	str := func(dst *string, name string) {
+		if v := viper.GetString(prefix + name); v != "" {
+			*dst = v
+		}
+	}
+
+	flag := func(dst *bool, name string) {
+		*dst = *dst || viper.GetBool(prefix+name)
+	}
+
+	if addr := viper.GetString(prefix + "redis-addr"); addr != "" {
+		cfg.Addrs = strings.Split(addr, ",")
+	}
+	if viper.GetString(prefix+"redis-db") != "" {
+		cfg.DB = viper.GetInt(prefix + "redis-db")
+	}
+	if viper.GetString(prefix+"redis-events") != "" {
+		cfg.Events = viper.GetBool(prefix + "redis-events")
+	}
+	str(&cfg.Prefix, "redis-prefix")
+	str(&cfg.Username, "redis-user")
+	str(&cfg.Password, "redis-pw")
+	str(&cfg.MasterName, "redis-master")
+	str(&cfg.SentinelPassword, "redis-sentinel-pw")
+	str(&cfg.TLSCAFile, "redis-tls-ca")
+	str(&cfg.TLSCertFile, "redis-tls-cert")
+	str(&cfg.TLSKeyFile, "redis-tls-key")
+	str(&cfg.TLSServerName, "redis-tls-server-name")
+	flag(&cfg.Cluster, "redis-cluster")
+	flag(&cfg.TLS, "redis-tls")
+	flag(&cfg.TLSInsecureSkipVerify, "redis-tls-insecure")
+
+	return cfg, nil
+}
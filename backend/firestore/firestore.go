@@ -2,27 +2,96 @@ package firestore
 
 import (
 	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
 	"time"
 
 	fs "cloud.google.com/go/firestore"
+	be "github.com/kellegous/go/backend"
 	"github.com/kellegous/go/internal"
 	"golang.org/x/oauth2/google"
+	"google.golang.org/api/iterator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-// NextID is the next numeric ID to use for auto-generated IDs
+// NextID is the next numeric ID to use for auto-generated IDs. Firestore
+// stores integers as int64, which is wide enough for any ID in practice.
 type NextID struct {
-	ID uint32 `json:"id" firestore:"id"`
+	ID int64 `json:"id" firestore:"id"`
+}
+
+// routeDoc is the document stored for each route. Its fields are the
+// canonical route schema along with the version of the encoding that wrote
+// it. Documents written before the version existed decode with a zero
+// Version.
+type routeDoc struct {
+	Version int `firestore:"v"`
+	internal.Route
+
+	// URLKey and Host are the normalized URL and the host of the route, which
+	// are queried by NamesForURL and NamesForHost.
+	URLKey string `firestore:"nurl,omitempty"`
+	Host   string `firestore:"host,omitempty"`
+}
+
+// The document stored for a route.
+func newRouteDoc(rt *internal.Route) *routeDoc {
+	return &routeDoc{
+		Version: internal.RouteEncodingVersion,
+		Route:   *rt,
+		URLKey:  internal.NormalizeURL(rt.URL),
+		Host:    internal.HostOf(rt.URL),
+	}
+}
+
+// The updates that replace the fields of a document with those of d.
+func (d *routeDoc) updates() []fs.Update {
+	return []fs.Update{
+		{Path: "v", Value: d.Version},
+		{Path: "URL", Value: d.URL},
+		{Path: "Time", Value: d.Time},
+		{Path: "owner", Value: omitEmpty(d.Owner)},
+		{Path: "alias", Value: omitEmpty(d.Alias)},
+		{Path: "nurl", Value: omitEmpty(d.URLKey)},
+		{Path: "host", Value: omitEmpty(d.Host)},
+	}
+}
+
+// Decode the route held in the given document.
+func decodeRoute(snap *fs.DocumentSnapshot) (*internal.Route, error) {
+	var doc routeDoc
+	if err := snap.DataTo(&doc); err != nil {
+		return nil, err
+	}
+	return &doc.Route, nil
+}
+
+// Options controls how the firestore backend stores its ID counter.
+type Options struct {
+	// IDShards is the number of documents the ID counter is spread over, so
+	// that servers handing out IDs at once rarely contend on the same
+	// document. Every server sharing the database must use the same number.
+	// The counter is a single document if this is 0 or 1.
+	IDShards int
 }
 
 // Backend provides access to Google Firestore.
 type Backend struct {
 	db *fs.Client
+
+	// shard is the last shard an ID was taken from. Accessed atomically.
+	shard uint32
 }
 
 // New instantiates a new Backend
-func New(ctx context.Context, path string) (*Backend, error) {
+func New(ctx context.Context, path string, opts *Options) (*Backend, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
 	if path == "" {
 		path = getGoogleProject()
 	}
@@ -32,11 +101,100 @@ func New(ctx context.Context, path string) (*Backend, error) {
 	}
 	backend := Backend{
 		db: client,
+
+		// servers started at different times start on different shards.
+		shard: uint32(time.Now().UnixNano()),
+	}
+
+	if err := backend.shardIDs(ctx, opts.IDShards); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	// Routes written before the reverse index existed need to be indexed.
+	marker := client.Doc(reverseIndexMarker)
+	if _, err := marker.Get(ctx); status.Code(err) == codes.NotFound {
+		if err := backend.Reindex(ctx); err != nil {
+			client.Close()
+			return nil, err
+		}
+		if _, err := marker.Set(ctx, map[string]interface{}{"time": time.Now()}); err != nil {
+			client.Close()
+			return nil, err
+		}
+	} else if err != nil {
+		client.Close()
+		return nil, err
 	}
 
 	return &backend, nil
 }
 
+// The document that records that every route has been reverse indexed.
+const reverseIndexMarker = "indexes/reverse"
+
+// Reindex sets the normalized URL and host of every route that does not have
+// them. Each route is only updated if it has not changed since it was read,
+// since a change indexes the route itself. Updating a route changes its
+// version.
+func (backend *Backend) Reindex(ctx context.Context) error {
+	iter := backend.db.Collection("routes").Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		snap, err := iter.Next()
+		if err == iterator.Done {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// a route that cannot be decoded is left as it is to be repaired.
+		var doc routeDoc
+		if err := snap.DataTo(&doc); err != nil {
+			log.Printf("[Firestore] not indexing %s: %s", snap.Ref.ID, err)
+			continue
+		}
+
+		want := newRouteDoc(&doc.Route)
+		if doc.URLKey == want.URLKey && doc.Host == want.Host {
+			continue
+		}
+
+		_, err = snap.Ref.Update(ctx, []fs.Update{
+			{Path: "nurl", Value: omitEmpty(want.URLKey)},
+			{Path: "host", Value: omitEmpty(want.Host)},
+		}, fs.LastUpdateTime(snap.UpdateTime))
+		switch status.Code(err) {
+		case codes.OK, codes.FailedPrecondition, codes.NotFound:
+		default:
+			return err
+		}
+	}
+}
+
+// RebuildIndexes sets the normalized URL and host of every route that does
+// not have the right ones.
+func (backend *Backend) RebuildIndexes(ctx context.Context) error {
+	return backend.Reindex(ctx)
+}
+
+// ListNames returns the name of every route, including those that cannot be
+// decoded.
+func (backend *Backend) ListNames(ctx context.Context) ([]string, error) {
+	refs, err := backend.db.Collection("routes").DocumentRefs(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		names = append(names, ref.ID)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
 // Close the resources associated with this backend.
 func (backend *Backend) Close() error {
 	return backend.db.Close()
@@ -44,29 +202,44 @@ func (backend *Backend) Close() error {
 
 // Get retreives a shortcut from the data store.
 func (backend *Backend) Get(ctx context.Context, name string) (*internal.Route, error) {
+	rt, _, err := backend.GetVersion(ctx, name)
+	return rt, err
+}
+
+// Versions are the update time of the route's document, in nanoseconds.
+func versionOf(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// GetVersion retreives a shortcut along with its version.
+func (backend *Backend) GetVersion(ctx context.Context, name string) (*internal.Route, string, error) {
 	ref := backend.db.Doc("routes/" + name)
 
 	snap, err := ref.Get(ctx)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
-			return nil, internal.ErrRouteNotFound
+			return nil, be.NoVersion, internal.ErrRouteNotFound
 		}
-		return nil, err
+		return nil, be.NoVersion, err
 	}
 
-	var rt internal.Route
-	if err := snap.DataTo(&rt); err != nil {
-		return nil, err
+	rt, err := decodeRoute(snap)
+	if err != nil {
+		return nil, be.NoVersion, err
 	}
 
-	return &rt, nil
+	return rt, versionOf(snap.UpdateTime), nil
 }
 
 // Put stores a new shortcut in the data store.
 func (backend *Backend) Put(ctx context.Context, key string, rt *internal.Route) error {
+	if err := backend.ensureCounted(ctx, key); err != nil {
+		return err
+	}
+
 	ref := backend.db.Doc("routes/" + key)
 
-	_, err := ref.Set(ctx, rt)
+	_, err := ref.Set(ctx, newRouteDoc(rt))
 	if err != nil {
 		return err
 	}
@@ -74,6 +247,173 @@ func (backend *Backend) Put(ctx context.Context, key string, rt *internal.Route)
 	return nil
 }
 
+// PutIf stores a shortcut if the one it replaces has the given version. A new
+// route is created, which fails if the document exists, and an existing one
+// is updated with a precondition on its update time.
+func (backend *Backend) PutIf(ctx context.Context, key string, rt *internal.Route, version string) (string, error) {
+	if err := backend.ensureCounted(ctx, key); err != nil {
+		return be.NoVersion, err
+	}
+
+	ref := backend.db.Doc("routes/" + key)
+
+	var res *fs.WriteResult
+	var err error
+	if version == be.NoVersion {
+		res, err = ref.Create(ctx, newRouteDoc(rt))
+	} else {
+		ns, perr := strconv.ParseInt(version, 10, 64)
+		if perr != nil {
+			return be.NoVersion, be.ErrVersionMismatch
+		}
+
+		res, err = ref.Update(ctx, newRouteDoc(rt).updates(), fs.LastUpdateTime(time.Unix(0, ns)))
+	}
+
+	switch status.Code(err) {
+	case codes.OK:
+		return versionOf(res.UpdateTime), nil
+	case codes.AlreadyExists, codes.FailedPrecondition, codes.NotFound:
+		return be.NoVersion, be.ErrVersionMismatch
+	default:
+		return be.NoVersion, err
+	}
+}
+
+// An empty field is left out of the document, as it is by Set.
+func omitEmpty(v string) interface{} {
+	if v == "" {
+		return fs.Delete
+	}
+	return v
+}
+
+// Rename moves a shortcut to a new name if it has the given version and the
+// name is not in use. The checks and the writes are made in a transaction.
+func (backend *Backend) Rename(ctx context.Context, from, version, to string, leave *internal.Route) (string, error) {
+	if err := backend.ensureCounted(ctx, to); err != nil {
+		return be.NoVersion, err
+	}
+
+	fref := backend.db.Doc("routes/" + from)
+	tref := backend.db.Doc("routes/" + to)
+
+	err := backend.db.RunTransaction(ctx, func(ctx context.Context, tx *fs.Transaction) error {
+		snap, err := tx.Get(fref)
+		if status.Code(err) == codes.NotFound {
+			return be.ErrVersionMismatch
+		} else if err != nil {
+			return err
+		}
+
+		if versionOf(snap.UpdateTime) != version {
+			return be.ErrVersionMismatch
+		}
+
+		if _, err := tx.Get(tref); err == nil {
+			return be.ErrVersionMismatch
+		} else if status.Code(err) != codes.NotFound {
+			return err
+		}
+
+		rt, err := decodeRoute(snap)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Create(tref, newRouteDoc(rt)); err != nil {
+			return err
+		}
+
+		if leave == nil {
+			return tx.Delete(fref)
+		}
+		return tx.Set(fref, newRouteDoc(leave))
+	})
+	if err != nil {
+		return be.NoVersion, err
+	}
+
+	// a transaction does not report the update times of its writes.
+	snap, err := tref.Get(ctx)
+	if err != nil {
+		return be.NoVersion, err
+	}
+	return versionOf(snap.UpdateTime), nil
+}
+
+// Apply makes every change in a single batched write. The conditions are
+// preconditions on the writes, so Firestore does not report which one failed,
+// and a delete cannot be conditional on there being no route.
+func (backend *Backend) Apply(ctx context.Context, changes []*be.Change) ([]string, error) {
+	// firestore refuses to commit an empty batch.
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	var puts []string
+	for _, c := range changes {
+		if c.Op == be.OpPut {
+			puts = append(puts, c.Name)
+		}
+	}
+
+	if err := backend.ensureCounted(ctx, puts...); err != nil {
+		return nil, err
+	}
+
+	batch := backend.db.Batch()
+	for _, c := range changes {
+		ref := backend.db.Doc("routes/" + c.Name)
+
+		var pre []fs.Precondition
+		if c.Conditional && c.Version != be.NoVersion {
+			ns, err := strconv.ParseInt(c.Version, 10, 64)
+			if err != nil {
+				return nil, &be.BatchError{Index: -1}
+			}
+			pre = append(pre, fs.LastUpdateTime(time.Unix(0, ns)))
+		}
+
+		doc := &routeDoc{
+			Version: internal.RouteEncodingVersion,
+		}
+		if c.Route != nil {
+			doc = newRouteDoc(c.Route)
+		}
+
+		switch {
+		case c.Op == be.OpDel && c.Conditional && c.Version == be.NoVersion:
+			return nil, fmt.Errorf("firestore: delete of %s cannot require that it does not exist", c.Name)
+		case c.Op == be.OpDel:
+			batch.Delete(ref, pre...)
+		case c.Conditional && c.Version == be.NoVersion:
+			batch.Create(ref, doc)
+		case c.Conditional:
+			batch.Update(ref, doc.updates(), pre...)
+		default:
+			batch.Set(ref, doc)
+		}
+	}
+
+	res, err := batch.Commit(ctx)
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.AlreadyExists, codes.FailedPrecondition, codes.NotFound:
+		return nil, &be.BatchError{Index: -1}
+	default:
+		return nil, err
+	}
+
+	vers := make([]string, len(changes))
+	for i, c := range changes {
+		if c.Op == be.OpPut {
+			vers[i] = versionOf(res[i].UpdateTime)
+		}
+	}
+	return vers, nil
+}
+
 // Del removes an existing shortcut from the data store.
 func (backend *Backend) Del(ctx context.Context, key string) error {
 	ref := backend.db.Doc("routes/" + key)
@@ -112,53 +452,43 @@ func (backend *Backend) GetAll(ctx context.Context) (map[string]internal.Route,
 		return nil, err
 	}
 	for _, doc := range routes {
-		var rt internal.Route
-		if err := doc.DataTo(&rt); err != nil {
+		rt, err := decodeRoute(doc)
+		if err != nil {
 			return nil, err
 		}
-		golinks[doc.Ref.ID] = rt
+		golinks[doc.Ref.ID] = *rt
 	}
 	return golinks, nil
 }
 
-// NextID generates the next numeric ID to be used for an auto-named shortcut.
-func (backend *Backend) NextID(ctx context.Context) (uint64, error) {
-	ref := backend.db.Doc("IDs/nextID")
-	var nid uint32
-
-	err := backend.db.RunTransaction(ctx, func(ctx context.Context, tx *fs.Transaction) error {
-		var nextID *NextID
-
-		doc, err := tx.Get(ref)
-		if err != nil {
-			if status.Code(err) == codes.NotFound {
-				// this is the very first auto-generated ID, we can make it
-				// as :1 and return it
-				nextID = new(NextID)
-				nextID.ID = 1
-				nid = 1
-				err := tx.Create(ref, nextID)
-				if err != nil {
-					return err
-				}
-				return nil
-			}
-			return err
-		}
-
-		if err := doc.DataTo(&nextID); err != nil {
-			return err
-		}
-		nextID.ID += 1
-		nid = nextID.ID
-
-		return tx.Set(ref, &nextID)
-	})
+// The names of the routes that have value in the field at path, in order.
+func (backend *Backend) namesWhere(ctx context.Context, path, value string) ([]string, error) {
+	// no fields are selected, since only the names are needed.
+	snaps, err := backend.db.Collection("routes").
+		Where(path, "==", value).
+		Select().
+		Documents(ctx).
+		GetAll()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	return uint64(nid), nil
+	names := make([]string, 0, len(snaps))
+	for _, snap := range snaps {
+		names = append(names, snap.Ref.ID)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// NamesForURL returns the names of the shortcuts that lead to url.
+func (backend *Backend) NamesForURL(ctx context.Context, url string) ([]string, error) {
+	return backend.namesWhere(ctx, "nurl", internal.NormalizeURL(url))
+}
+
+// NamesForHost returns the names of the shortcuts with URLs on host.
+func (backend *Backend) NamesForHost(ctx context.Context, host string) ([]string, error) {
+	return backend.namesWhere(ctx, "host", internal.NormalizeHost(host))
 }
 
 func getGoogleProject() string {
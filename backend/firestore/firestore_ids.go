@@ -0,0 +1,307 @@
+package firestore
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	fs "cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	be "github.com/kellegous/go/backend"
+)
+
+// The documents holding the ID counter. Without shards the counter is the
+// single document nextIDDoc. With shards, shardsDoc holds their layout and
+// each shard holds the number of IDs it has handed out.
+const (
+	nextIDDoc = "IDs/nextID"
+	shardsDoc = "IDs/shards"
+)
+
+// The document of shard k.
+func shardDoc(k int) string {
+	return fmt.Sprintf("IDs/shard-%d", k)
+}
+
+// idShards is the layout of a sharded ID counter. Shard k hands out the IDs
+// Base+k+1, Base+k+1+N, Base+k+1+2N and so on, so no two shards ever hand out
+// the same ID. Base is the highest ID handed out before the shards were laid
+// out.
+type idShards struct {
+	N    int   `firestore:"n"`
+	Base int64 `firestore:"base"`
+}
+
+// The ID handed out by the shard k when it has already handed out count.
+func (l *idShards) id(k int, count int64) uint64 {
+	return uint64(l.Base + count*int64(l.N) + int64(k) + 1)
+}
+
+// counter is the state of the ID counter as read in a transaction.
+type counter struct {
+	// shards is nil if the counter is a single document.
+	shards *idShards
+	counts []int64
+
+	// last is the highest ID handed out.
+	last uint64
+}
+
+// Read the whole ID counter, through get.
+func readCounter(db *fs.Client, get func([]*fs.DocumentRef) ([]*fs.DocumentSnapshot, error)) (*counter, error) {
+	snaps, err := get([]*fs.DocumentRef{db.Doc(shardsDoc), db.Doc(nextIDDoc)})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &counter{}
+	if !snaps[0].Exists() {
+		if snaps[1].Exists() {
+			var nextID NextID
+			if err := snaps[1].DataTo(&nextID); err != nil {
+				return nil, err
+			}
+			c.last = uint64(nextID.ID)
+		}
+		return c, nil
+	}
+
+	c.shards = &idShards{}
+	if err := snaps[0].DataTo(c.shards); err != nil {
+		return nil, err
+	}
+
+	refs := make([]*fs.DocumentRef, c.shards.N)
+	for k := range refs {
+		refs[k] = db.Doc(shardDoc(k))
+	}
+
+	if snaps, err = get(refs); err != nil {
+		return nil, err
+	}
+
+	c.counts = make([]int64, c.shards.N)
+	c.last = uint64(c.shards.Base)
+	for k, snap := range snaps {
+		if snap.Exists() {
+			var count NextID
+			if err := snap.DataTo(&count); err != nil {
+				return nil, err
+			}
+			c.counts[k] = count.ID
+		}
+
+		if c.counts[k] > 0 {
+			if id := c.shards.id(k, c.counts[k]-1); id > c.last {
+				c.last = id
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// Lay the shards out again, or, if shards is nil, go back to a single
+// document, so that every ID handed out from now on is above last.
+func (backend *Backend) relayout(tx *fs.Transaction, old *counter, shards *idShards, last uint64) error {
+	oldN := 0
+	if old.shards != nil {
+		oldN = old.shards.N
+	}
+
+	newN := 0
+	if shards != nil {
+		newN = shards.N
+		if err := tx.Set(backend.db.Doc(shardsDoc), shards); err != nil {
+			return err
+		}
+	} else {
+		if err := tx.Set(backend.db.Doc(nextIDDoc), &NextID{ID: int64(last)}); err != nil {
+			return err
+		}
+		if err := tx.Delete(backend.db.Doc(shardsDoc)); err != nil {
+			return err
+		}
+	}
+
+	for k := 0; k < newN; k++ {
+		if err := tx.Set(backend.db.Doc(shardDoc(k)), &NextID{}); err != nil {
+			return err
+		}
+	}
+
+	for k := newN; k < oldN; k++ {
+		if err := tx.Delete(backend.db.Doc(shardDoc(k))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Spread the ID counter over n shards, or keep it in a single document if n
+// is 0 or 1. Changing the layout starts every shard above the highest ID
+// handed out so far, so no ID is ever handed out twice.
+func (backend *Backend) shardIDs(ctx context.Context, n int) error {
+	return backend.db.RunTransaction(ctx, func(ctx context.Context, tx *fs.Transaction) error {
+		c, err := readCounter(backend.db, tx.GetAll)
+		if err != nil {
+			return err
+		}
+
+		if n <= 1 {
+			if c.shards == nil {
+				return nil
+			}
+			return backend.relayout(tx, c, nil, c.last)
+		}
+
+		if c.shards != nil && c.shards.N == n {
+			return nil
+		}
+
+		return backend.relayout(tx, c, &idShards{
+			N:    n,
+			Base: int64(c.last),
+		}, c.last)
+	})
+}
+
+// NextID generates the next numeric ID to be used for an auto-named shortcut.
+func (backend *Backend) NextID(ctx context.Context) (uint64, error) {
+	ids, err := backend.NextIDs(ctx, 1)
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// NextIDs hands out n IDs in a single transaction. With shards, the IDs are
+// taken from one shard, so they are not consecutive.
+func (backend *Backend) NextIDs(ctx context.Context, n int) ([]uint64, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	var ids []uint64
+	err := backend.db.RunTransaction(ctx, func(ctx context.Context, tx *fs.Transaction) error {
+		var shards idShards
+		doc, err := tx.Get(backend.db.Doc(shardsDoc))
+		if status.Code(err) == codes.NotFound {
+			var nextID NextID
+			ref := backend.db.Doc(nextIDDoc)
+			doc, err := tx.Get(ref)
+			if err != nil && status.Code(err) != codes.NotFound {
+				return err
+			} else if err == nil {
+				if err := doc.DataTo(&nextID); err != nil {
+					return err
+				}
+			}
+
+			if uint64(nextID.ID) > be.MaxID-uint64(n) {
+				return be.ErrIDOverflow
+			}
+
+			nextID.ID += int64(n)
+			ids = be.IDsEndingAt(uint64(nextID.ID), n)
+			return tx.Set(ref, &nextID)
+		} else if err != nil {
+			return err
+		} else if err := doc.DataTo(&shards); err != nil {
+			return err
+		} else if shards.N <= 0 {
+			return fmt.Errorf("invalid ID counter layout with %d shards", shards.N)
+		}
+
+		// each server goes around the shards in turn.
+		k := int(atomic.AddUint32(&backend.shard, 1) % uint32(shards.N))
+		ref := backend.db.Doc(shardDoc(k))
+
+		var count NextID
+		doc, err = tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		} else if err == nil {
+			if err := doc.DataTo(&count); err != nil {
+				return err
+			}
+		}
+
+		// the shard's last ID is Base+k+1+(count+n-1)*N.
+		room := (be.MaxID - uint64(shards.Base) - uint64(k) - 1) / uint64(shards.N)
+		if uint64(count.ID)+uint64(n)-1 > room {
+			return be.ErrIDOverflow
+		}
+
+		ids = make([]uint64, n)
+		for i := range ids {
+			ids[i] = shards.id(k, count.ID+int64(i))
+		}
+
+		count.ID += int64(n)
+		return tx.Set(ref, &count)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// LastID returns the highest ID handed out by NextID or NextIDs.
+func (backend *Backend) LastID(ctx context.Context) (uint64, error) {
+	c, err := readCounter(backend.db, func(refs []*fs.DocumentRef) ([]*fs.DocumentSnapshot, error) {
+		return backend.db.GetAll(ctx, refs)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return c.last, nil
+}
+
+// EnsureID advances the ID counter to id if it is currently lower. A sharded
+// counter is laid out again above id.
+func (backend *Backend) EnsureID(ctx context.Context, id uint64) error {
+	return backend.db.RunTransaction(ctx, func(ctx context.Context, tx *fs.Transaction) error {
+		c, err := readCounter(backend.db, tx.GetAll)
+		if err != nil {
+			return err
+		}
+
+		if c.last >= id {
+			return nil
+		} else if id > be.MaxID {
+			return be.ErrIDOverflow
+		}
+
+		if c.shards == nil {
+			return tx.Set(backend.db.Doc(nextIDDoc), &NextID{ID: int64(id)})
+		}
+
+		return backend.relayout(tx, c, &idShards{
+			N:    c.shards.N,
+			Base: int64(id),
+		}, id)
+	})
+}
+
+// Raise the ID counter to the highest ID the given names were generated from,
+// before routes are written under them. Firestore cannot do both in one
+// write, and raising it first means a failed write only skips IDs, rather
+// than a route being left under a name the counter will hand out.
+func (backend *Backend) ensureCounted(ctx context.Context, names ...string) error {
+	var max uint64
+	for _, name := range names {
+		if id, ok := be.CountedID(name); ok && id > max {
+			max = id
+		}
+	}
+
+	if max == 0 {
+		return nil
+	}
+	return backend.EnsureID(ctx, max)
+}
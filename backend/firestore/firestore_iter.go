@@ -69,12 +69,12 @@ func (i *RouteIterator) Name() string {
 
 // Route is the current route.
 func (i *RouteIterator) Route() *internal.Route {
-	var rt internal.Route
-	if err := i.doc.DataTo(&rt); err != nil {
+	rt, err := decodeRoute(i.doc)
+	if err != nil {
 		i.err = err
 		return nil
 	}
-	return &rt
+	return rt
 }
 
 // Release disposes of the resources in the iterator.
@@ -0,0 +1,87 @@
+package firestore
+
+import (
+	"context"
+	"log"
+
+	fs "cloud.google.com/go/firestore"
+	be "github.com/kellegous/go/backend"
+	"github.com/kellegous/go/internal"
+)
+
+// Watch delivers changes to the routes through a snapshot listener, so it
+// sees the changes made by every server. Firestore may coalesce changes made
+// to a route in quick succession into a single event. Sequence numbers are
+// assigned by this watcher and are not comparable across watchers.
+func (backend *Backend) Watch(ctx context.Context) (<-chan *be.Event, error) {
+	it := backend.db.Collection("routes").Snapshots(ctx)
+
+	// the first snapshot holds the routes as they are now, which are needed to
+	// report what a modified route was before.
+	snap, err := it.Next()
+	if err != nil {
+		it.Stop()
+		return nil, err
+	}
+
+	routes := map[string]*internal.Route{}
+	for _, c := range snap.Changes {
+		rt, err := decodeRoute(c.Doc)
+		if err != nil {
+			it.Stop()
+			return nil, err
+		}
+		routes[c.Doc.Ref.ID] = rt
+	}
+
+	ch := make(chan *be.Event, be.WatchBuffer)
+	go func() {
+		defer close(ch)
+		defer it.Stop()
+
+		var seq uint64
+		for {
+			// Next fails once ctx is done.
+			snap, err := it.Next()
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("[Firestore] watch: %s", err)
+				}
+				return
+			}
+
+			for _, c := range snap.Changes {
+				name := c.Doc.Ref.ID
+				e := &be.Event{
+					Op:     be.OpPut,
+					Name:   name,
+					Before: routes[name],
+				}
+
+				if c.Kind == fs.DocumentRemoved {
+					e.Op = be.OpDel
+					delete(routes, name)
+				} else {
+					rt, err := decodeRoute(c.Doc)
+					if err != nil {
+						log.Printf("[Firestore] invalid route %s: %s", name, err)
+						continue
+					}
+					e.After = rt
+					routes[name] = rt
+				}
+
+				seq++
+				e.Seq = seq
+				select {
+				case ch <- e:
+				default:
+					// the watcher has fallen behind.
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,127 @@
+// Package lease hands out IDs from blocks leased from any backend, so that
+// generating a name does not write the backend's ID counter every time.
+package lease
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/kellegous/go/backend"
+)
+
+// Backend hands out IDs from a block it leases from the backend it wraps,
+// leasing another when the block runs out. A block is taken from the backend
+// before any of its IDs are handed out, so an ID is never handed out twice,
+// even by servers sharing the backend or after a crash. The IDs left in a
+// block when the server stops are never handed out. Every other method is
+// passed through.
+//
+// IDs are only handed out in order by a single server, and LastID reports the
+// highest ID leased rather than the highest handed out.
+type Backend struct {
+	backend.Backend
+
+	size int
+
+	mu   sync.Mutex
+	free []uint64
+}
+
+// New wraps b so that it leases size IDs at a time.
+func New(b backend.Backend, size int) *Backend {
+	return &Backend{
+		Backend: b,
+		size:    size,
+	}
+}
+
+// Lease a new block if the current one has run out. Must be called with mu
+// held.
+func (l *Backend) fill(ctx context.Context, n int) error {
+	if len(l.free) >= n {
+		return nil
+	}
+
+	size := l.size
+	if size < n-len(l.free) {
+		size = n - len(l.free)
+	}
+
+	// near the end of the counter there may only be room for the IDs needed.
+	ids, err := l.Backend.NextIDs(ctx, size)
+	if errors.Is(err, backend.ErrIDOverflow) && size > n-len(l.free) {
+		ids, err = l.Backend.NextIDs(ctx, n-len(l.free))
+	}
+	if err != nil {
+		return err
+	}
+
+	l.free = append(l.free, ids...)
+	return nil
+}
+
+// NextID hands out the next ID in the block.
+func (l *Backend) NextID(ctx context.Context) (uint64, error) {
+	ids, err := l.NextIDs(ctx, 1)
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// NextIDs hands out the next n IDs in the block, leasing more if there are
+// not enough left.
+func (l *Backend) NextIDs(ctx context.Context, n int) ([]uint64, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.fill(ctx, n); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint64, n)
+	copy(ids, l.free)
+	l.free = l.free[n:]
+	return ids, nil
+}
+
+// EnsureID advances the backend's counter to id and drops the IDs in the
+// block that are not above it.
+func (l *Backend) EnsureID(ctx context.Context, id uint64) error {
+	if err := l.Backend.EnsureID(ctx, id); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for len(l.free) > 0 && l.free[0] <= id {
+		l.free = l.free[1:]
+	}
+	return nil
+}
+
+// Snapshot takes a snapshot of the wrapped backend.
+func (l *Backend) Snapshot(ctx context.Context) (backend.Snapshot, error) {
+	return backend.SnapshotOf(ctx, l.Backend)
+}
+
+// Watch delivers the changes made to the wrapped backend.
+func (l *Backend) Watch(ctx context.Context) (<-chan *backend.Event, error) {
+	return backend.Watch(ctx, l.Backend)
+}
+
+// ListNames returns every name in the wrapped backend.
+func (l *Backend) ListNames(ctx context.Context) ([]string, error) {
+	return backend.NamesOf(ctx, l.Backend)
+}
+
+// RebuildIndexes rebuilds the indexes of the wrapped backend.
+func (l *Backend) RebuildIndexes(ctx context.Context) error {
+	return backend.RebuildIndexes(ctx, l.Backend)
+}
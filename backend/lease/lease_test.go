@@ -0,0 +1,119 @@
+package lease
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/backend/backendtest"
+	"github.com/kellegous/go/backend/memory"
+)
+
+// A backend that counts calls to NextIDs.
+type countingBackend struct {
+	backend.Backend
+	leases int
+}
+
+func (b *countingBackend) NextIDs(ctx context.Context, n int) ([]uint64, error) {
+	b.leases++
+	return b.Backend.NextIDs(ctx, n)
+}
+
+func newLease(t *testing.T, size int) (*Backend, *countingBackend) {
+	mem, err := memory.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cb := &countingBackend{Backend: mem}
+	return New(cb, size), cb
+}
+
+func mustNextID(t *testing.T, l *Backend, exp uint64) {
+	id, err := l.NextID(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != exp {
+		t.Fatalf("expected id %d, got %d", exp, id)
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	ctx := context.Background()
+	l, cb := newLease(t, 10)
+	defer l.Close()
+
+	for id := uint64(1); id <= 15; id++ {
+		mustNextID(t, l, id)
+	}
+
+	if cb.leases != 2 {
+		t.Fatalf("expected 2 leases, got %d", cb.leases)
+	}
+
+	// the whole block is taken from the backend at once.
+	if id, err := l.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 20 {
+		t.Fatalf("expected last id of 20, got %d", id)
+	}
+
+	// another server sharing the backend leases the next block.
+	other := New(cb.Backend, 10)
+	if id, err := other.NextID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 21 {
+		t.Fatalf("expected id 21 from another lease, got %d", id)
+	}
+
+	// more IDs than a block holds are leased at once.
+	ids, err := l.NextIDs(ctx, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 12 || ids[0] != 16 || ids[4] != 20 || ids[5] != 31 || ids[11] != 37 {
+		t.Fatalf("unexpected ids %v", ids)
+	}
+}
+
+func TestEnsureID(t *testing.T) {
+	l, _ := newLease(t, 10)
+	defer l.Close()
+
+	mustNextID(t, l, 1)
+
+	if err := l.EnsureID(context.Background(), 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// IDs in the block at or below an ensured ID are dropped.
+	mustNextID(t, l, 6)
+
+	if err := l.EnsureID(context.Background(), 100); err != nil {
+		t.Fatal(err)
+	}
+
+	mustNextID(t, l, 101)
+}
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) (backend.Backend, func()) {
+		mem, err := memory.New("")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		l := New(mem, 10)
+		return l, func() {
+			l.Close()
+		}
+	}, &backendtest.Options{
+		Skip: map[string]string{
+			"Snapshot": "LastID reports the highest ID leased, not the highest handed out",
+		},
+	})
+}
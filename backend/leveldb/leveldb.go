@@ -5,6 +5,9 @@ import (
 	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
@@ -13,58 +16,99 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 
+	be "github.com/kellegous/go/backend"
 	"github.com/kellegous/go/internal"
 )
 
 const (
 	routesDbFilename = "routes.db"
-	idLogFilename    = "id"
+
+	// idLogFilename is the file older versions kept the ID counter in. It is
+	// moved into the database when the database is opened.
+	idLogFilename = "id"
 )
 
-// Backend provides access to the leveldb store.
-type Backend struct {
-	// Path contains the location on disk where this DB exists.
-	path string
-	db   *leveldb.DB
-	lck  sync.Mutex
-	id   uint64
-}
+// Keys that start with metaPrefix hold the backend's own records rather than
+// routes, so no route may be stored under them. Every route sorts at or
+// after routesStart.
+var (
+	metaPrefix  = []byte{0}
+	routesStart = []byte{1}
+	idKey       = []byte("\x00id")
+)
 
-// Commit the given ID to the data store.
-func commit(filename string, id uint64) error {
-	w, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer w.Close()
+var errReservedName = errors.New("names starting with a NUL are reserved")
 
-	if err := binary.Write(w, binary.LittleEndian, id); err != nil {
-		return err
+// Whether a route may be stored under name.
+func isReserved(name string) bool {
+	return bytes.HasPrefix([]byte(name), metaPrefix)
+}
+
+// The range of keys that hold routes, starting with start.
+func routesFrom(start string) *util.Range {
+	if bytes.Compare([]byte(start), routesStart) < 0 {
+		return &util.Range{Start: routesStart}
 	}
+	return &util.Range{Start: []byte(start)}
+}
 
-	return w.Sync()
+// Encode the ID counter as it is stored under idKey.
+func encodeCounter(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, id)
+	return b
 }
 
-// Load the current ID from the data store.
-func load(filename string) (uint64, error) {
-	if _, err := os.Stat(filename); err != nil {
-		return 0, commit(filename, 0)
+// Decode the ID counter stored under idKey.
+func decodeCounter(b []byte) (uint64, error) {
+	if len(b) != 8 {
+		return 0, fmt.Errorf("invalid ID counter of %d bytes", len(b))
 	}
+	return binary.LittleEndian.Uint64(b), nil
+}
 
-	r, err := os.Open(filename)
-	if err != nil {
+// Read the counter that older versions kept in the id file, which is 0 if
+// there is no such file. A file that a crash left short is reported and
+// read as 0, since the counter is rebuilt from the routes anyway.
+func readLegacyID(filename string) (uint64, error) {
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
 		return 0, err
 	}
-	defer r.Close()
 
-	var id uint64
-	if err := binary.Read(r, binary.LittleEndian, &id); err != nil {
-		return 0, err
+	id, err := decodeCounter(b)
+	if err != nil {
+		log.Printf("[leveldb] ignoring %s: %s", filename, err)
+		return 0, nil
 	}
-
 	return id, nil
 }
 
+// Backend provides access to the leveldb store.
+type Backend struct {
+	// Path contains the location on disk where this DB exists.
+	path string
+	db   *leveldb.DB
+
+	// lck guards id, which is a copy of the counter stored under idKey. It is
+	// held while writing the counter, and by writes to routes with generated
+	// names, which raise the counter in the same write.
+	lck sync.Mutex
+	id  uint64
+
+	// wlck serializes writes to routes so that each change can be published
+	// along with the route it replaced, in the order the changes were made.
+	wlck sync.Mutex
+	feed be.Feed
+
+	// rev is only ever held in memory, since no other process can open the
+	// database while this one has it. It is rebuilt when the database is
+	// opened.
+	rev be.ReverseIndex
+}
+
 // New instantiates a new Backend
 func New(path string) (*Backend, error) {
 	backend := Backend{
@@ -84,67 +128,578 @@ func New(path string) (*Backend, error) {
 	}
 	backend.db = db
 
-	id, err := load(filepath.Join(backend.path, idLogFilename))
+	if err := backend.loadID(); err != nil {
+		backend.db.Close()
+		return nil, err
+	}
+
+	n, err := backend.Upgrade(context.Background())
 	if err != nil {
+		backend.db.Close()
+		return nil, err
+	}
+	if n > 0 {
+		log.Printf("[leveldb] upgraded %d routes to encoding version %d", n, internal.RouteEncodingVersion)
+	}
+
+	if err := backend.index(); err != nil {
+		backend.db.Close()
 		return nil, err
 	}
-	backend.id = id
 
 	return &backend, nil
 }
 
+// Load the ID counter from the database. If it is not there, it is moved from
+// the file older versions kept it in. If it is missing or cannot be read, it
+// is rebuilt from the generated names of the routes.
+func (backend *Backend) loadID() error {
+	val, err := backend.db.Get(idKey, nil)
+	if err == nil {
+		id, err := decodeCounter(val)
+		if err == nil {
+			backend.id = id
+			return nil
+		}
+		log.Printf("[leveldb] rebuilding the ID counter: %s", err)
+	} else if !errors.Is(err, leveldb.ErrNotFound) {
+		return err
+	}
+
+	filename := filepath.Join(backend.path, idLogFilename)
+	id, err := readLegacyID(filename)
+	if err != nil {
+		return err
+	}
+
+	max, err := backend.maxGeneratedID()
+	if err != nil {
+		return err
+	}
+
+	if max > id {
+		id = max
+	}
+
+	if err := backend.db.Put(idKey, encodeCounter(id), &opt.WriteOptions{Sync: true}); err != nil {
+		return err
+	}
+	backend.id = id
+
+	// the counter is safely in the database, so the file is no longer needed.
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// The highest ID among the generated names of the routes.
+func (backend *Backend) maxGeneratedID() (uint64, error) {
+	iter := backend.db.NewIterator(util.BytesPrefix([]byte{internal.GeneratedPrefix}), nil)
+	defer iter.Release()
+
+	var max uint64
+	for iter.Next() {
+		if id, ok := be.CountedID(string(iter.Key())); ok && id > max {
+			max = id
+		}
+	}
+
+	return max, iter.Error()
+}
+
+// RebuildID raises the ID counter to the highest ID among the generated names
+// of the routes, for when it has fallen behind them. It never lowers the
+// counter, and returns the counter as it is afterwards.
+func (backend *Backend) RebuildID(ctx context.Context) (uint64, error) {
+	max, err := backend.maxGeneratedID()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := backend.EnsureID(ctx, max); err != nil {
+		return 0, err
+	}
+
+	return backend.LastID(ctx)
+}
+
+// The counter needed once routes are stored under names, which is above the
+// current one if any of them is a generated name for a higher ID. Must be
+// called with lck held.
+func (backend *Backend) idFor(names ...string) uint64 {
+	id := backend.id
+	for _, name := range names {
+		if n, ok := be.CountedID(name); ok && n > id {
+			id = n
+		}
+	}
+	return id
+}
+
+// Build the reverse index from every route in the store. Routes that cannot
+// be decoded are left out, so that they can still be found and repaired.
+func (backend *Backend) index() error {
+	iter := backend.db.NewIterator(routesFrom(""), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		rt := &internal.Route{}
+		if err := rt.Read(bytes.NewBuffer(iter.Value())); err != nil {
+			log.Printf("[leveldb] not indexing %q: %s", iter.Key(), err)
+			continue
+		}
+		backend.rev.Update(string(iter.Key()), nil, rt)
+	}
+
+	return iter.Error()
+}
+
+// RebuildIndexes rebuilds the reverse index from the routes.
+func (backend *Backend) RebuildIndexes(ctx context.Context) error {
+	backend.wlck.Lock()
+	defer backend.wlck.Unlock()
+
+	backend.rev.Reset()
+	return backend.index()
+}
+
+// ListNames returns the name of every route without decoding them.
+func (backend *Backend) ListNames(ctx context.Context) ([]string, error) {
+	iter := backend.db.NewIterator(routesFrom(""), nil)
+	defer iter.Release()
+
+	var names []string
+	for iter.Next() {
+		names = append(names, string(iter.Key()))
+	}
+
+	return names, iter.Error()
+}
+
+// Upgrade rewrites every route that is not stored in the current route
+// encoding and returns the number of routes that were rewritten. Routes in
+// older encodings are still readable, so this only needs to run once.
+func (backend *Backend) Upgrade(ctx context.Context) (int, error) {
+	iter := backend.db.NewIterator(routesFrom(""), nil)
+	defer iter.Release()
+
+	var batch leveldb.Batch
+	for iter.Next() {
+		if internal.IsCurrentEncoding(iter.Value()) {
+			continue
+		}
+
+		// a route that cannot be decoded is left as it is to be repaired.
+		rt := &internal.Route{}
+		if err := rt.Read(bytes.NewBuffer(iter.Value())); err != nil {
+			log.Printf("[leveldb] not upgrading %q: %s", iter.Key(), err)
+			continue
+		}
+
+		b, err := rt.MarshalBinary()
+		if err != nil {
+			return 0, err
+		}
+		batch.Put(iter.Key(), b)
+	}
+
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+
+	if batch.Len() == 0 {
+		return 0, nil
+	}
+
+	if err := backend.db.Write(&batch, &opt.WriteOptions{Sync: true}); err != nil {
+		return 0, err
+	}
+
+	return batch.Len(), nil
+}
+
 // Close the resources associated with this backend.
 func (backend *Backend) Close() error {
+	backend.feed.Close()
 	return backend.db.Close()
 }
 
 // Get retreives a shortcut from the data store.
 func (backend *Backend) Get(ctx context.Context, name string) (*internal.Route, error) {
+	rt, _, err := backend.GetVersion(ctx, name)
+	return rt, err
+}
+
+// GetVersion retreives a shortcut along with its version, which is derived
+// from its encoding.
+func (backend *Backend) GetVersion(ctx context.Context, name string) (*internal.Route, string, error) {
+	if isReserved(name) {
+		return nil, be.NoVersion, internal.ErrRouteNotFound
+	}
+
 	val, err := backend.db.Get([]byte(name), nil)
 	if err != nil {
 		if errors.Is(err, leveldb.ErrNotFound) {
-			return nil, internal.ErrRouteNotFound
+			return nil, be.NoVersion, internal.ErrRouteNotFound
 		}
-		return nil, err
+		return nil, be.NoVersion, err
 	}
 
 	rt := &internal.Route{}
 	if err := rt.Read(bytes.NewBuffer(val)); err != nil {
-		return nil, err
+		return nil, be.NoVersion, err
+	}
+
+	return rt, be.VersionOf(val), nil
+}
+
+// Publish the change made by putting rt in place of before.
+func (backend *Backend) publishPut(key string, before, rt *internal.Route) {
+	e := &be.Event{
+		Op:     be.OpPut,
+		Name:   key,
+		Before: before,
+		After:  &internal.Route{},
 	}
+	*e.After = *rt
+	backend.rev.Update(key, before, e.After)
+	backend.feed.Publish(e)
+}
 
-	return rt, nil
+// Publish the deletion of before.
+func (backend *Backend) publishDel(key string, before *internal.Route) {
+	backend.rev.Update(key, before, nil)
+	backend.feed.Publish(&be.Event{
+		Op:     be.OpDel,
+		Name:   key,
+		Before: before,
+	})
 }
 
 // Put stores a new shortcut in the data store.
 func (backend *Backend) Put(ctx context.Context, key string, rt *internal.Route) error {
+	if isReserved(key) {
+		return errReservedName
+	}
+
 	var buf bytes.Buffer
 	if err := rt.Write(&buf); err != nil {
 		return err
 	}
 
-	return backend.db.Put([]byte(key), buf.Bytes(), &opt.WriteOptions{Sync: true})
+	backend.wlck.Lock()
+	defer backend.wlck.Unlock()
+
+	before, err := backend.Get(ctx, key)
+	if err != nil && !errors.Is(err, internal.ErrRouteNotFound) {
+		return err
+	}
+
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	var batch leveldb.Batch
+	batch.Put([]byte(key), buf.Bytes())
+
+	id := backend.idFor(key)
+	if id > backend.id {
+		batch.Put(idKey, encodeCounter(id))
+	}
+
+	if err := backend.db.Write(&batch, &opt.WriteOptions{Sync: true}); err != nil {
+		return err
+	}
+	backend.id = id
+
+	backend.publishPut(key, before, rt)
+	return nil
+}
+
+// PutIf stores a shortcut if the one it replaces has the given version. The
+// check and the write are made in a single transaction.
+func (backend *Backend) PutIf(ctx context.Context, key string, rt *internal.Route, version string) (string, error) {
+	if isReserved(key) {
+		return be.NoVersion, errReservedName
+	}
+
+	val, err := rt.MarshalBinary()
+	if err != nil {
+		return be.NoVersion, err
+	}
+
+	backend.wlck.Lock()
+	defer backend.wlck.Unlock()
+
+	// the counter may be written in the transaction, and a transaction
+	// blocks every other write until it is done.
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	tr, err := backend.db.OpenTransaction()
+	if err != nil {
+		return be.NoVersion, err
+	}
+	// this does nothing once the transaction is committed.
+	defer tr.Discard()
+
+	ver := be.NoVersion
+	var before *internal.Route
+	if cur, err := tr.Get([]byte(key), nil); err == nil {
+		ver = be.VersionOf(cur)
+		before = &internal.Route{}
+		if err := before.Read(bytes.NewBuffer(cur)); err != nil {
+			return be.NoVersion, err
+		}
+	} else if !errors.Is(err, leveldb.ErrNotFound) {
+		return be.NoVersion, err
+	}
+
+	if ver != version {
+		return be.NoVersion, be.ErrVersionMismatch
+	}
+
+	if err := tr.Put([]byte(key), val, nil); err != nil {
+		return be.NoVersion, err
+	}
+
+	id := backend.idFor(key)
+	if id > backend.id {
+		if err := tr.Put(idKey, encodeCounter(id), nil); err != nil {
+			return be.NoVersion, err
+		}
+	}
+
+	if err := tr.Commit(); err != nil {
+		return be.NoVersion, err
+	}
+	backend.id = id
+
+	backend.publishPut(key, before, rt)
+	return be.VersionOf(val), nil
+}
+
+// Rename moves a shortcut to a new name if it has the given version and the
+// name is not in use. The checks and the writes are made in a single
+// transaction.
+func (backend *Backend) Rename(ctx context.Context, from, version, to string, leave *internal.Route) (string, error) {
+	var lval []byte
+	if leave != nil {
+		var err error
+		if lval, err = leave.MarshalBinary(); err != nil {
+			return be.NoVersion, err
+		}
+	}
+
+	if isReserved(from) || isReserved(to) {
+		return be.NoVersion, errReservedName
+	}
+
+	backend.wlck.Lock()
+	defer backend.wlck.Unlock()
+
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	tr, err := backend.db.OpenTransaction()
+	if err != nil {
+		return be.NoVersion, err
+	}
+	defer tr.Discard()
+
+	val, err := tr.Get([]byte(from), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return be.NoVersion, be.ErrVersionMismatch
+	} else if err != nil {
+		return be.NoVersion, err
+	}
+
+	if be.VersionOf(val) != version {
+		return be.NoVersion, be.ErrVersionMismatch
+	}
+
+	if ok, err := tr.Has([]byte(to), nil); err != nil {
+		return be.NoVersion, err
+	} else if ok {
+		return be.NoVersion, be.ErrVersionMismatch
+	}
+
+	rt := &internal.Route{}
+	if err := rt.Read(bytes.NewBuffer(val)); err != nil {
+		return be.NoVersion, err
+	}
+
+	if err := tr.Put([]byte(to), val, nil); err != nil {
+		return be.NoVersion, err
+	}
+
+	if leave != nil {
+		err = tr.Put([]byte(from), lval, nil)
+	} else {
+		err = tr.Delete([]byte(from), nil)
+	}
+	if err != nil {
+		return be.NoVersion, err
+	}
+
+	id := backend.idFor(to)
+	if id > backend.id {
+		if err := tr.Put(idKey, encodeCounter(id), nil); err != nil {
+			return be.NoVersion, err
+		}
+	}
+
+	if err := tr.Commit(); err != nil {
+		return be.NoVersion, err
+	}
+	backend.id = id
+
+	backend.publishPut(to, nil, rt)
+	if leave != nil {
+		backend.publishPut(from, rt, leave)
+	} else {
+		backend.publishDel(from, rt)
+	}
+	return version, nil
+}
+
+// Apply makes every change in the batch if all of their conditions hold. The
+// routes are read and the batch is written in a single transaction.
+func (backend *Backend) Apply(ctx context.Context, changes []*be.Change) ([]string, error) {
+	var batch leveldb.Batch
+	vers := make([]string, len(changes))
+	var names []string
+	for i, c := range changes {
+		if isReserved(c.Name) {
+			return nil, errReservedName
+		}
+
+		if c.Op != be.OpPut {
+			batch.Delete([]byte(c.Name))
+			continue
+		}
+
+		val, err := c.Route.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		batch.Put([]byte(c.Name), val)
+		vers[i] = be.VersionOf(val)
+		names = append(names, c.Name)
+	}
+
+	backend.wlck.Lock()
+	defer backend.wlck.Unlock()
+
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	id := backend.idFor(names...)
+	if id > backend.id {
+		batch.Put(idKey, encodeCounter(id))
+	}
+
+	tr, err := backend.db.OpenTransaction()
+	if err != nil {
+		return nil, err
+	}
+	defer tr.Discard()
+
+	// the routes before the batch, which are needed for the events.
+	befores := map[string]*internal.Route{}
+	for i, c := range changes {
+		if _, ok := befores[c.Name]; ok && !c.Conditional {
+			continue
+		}
+
+		ver := be.NoVersion
+		var before *internal.Route
+		if cur, err := tr.Get([]byte(c.Name), nil); err == nil {
+			ver = be.VersionOf(cur)
+			before = &internal.Route{}
+			if err := before.Read(bytes.NewBuffer(cur)); err != nil {
+				return nil, err
+			}
+		} else if !errors.Is(err, leveldb.ErrNotFound) {
+			return nil, err
+		}
+
+		if c.Conditional && ver != c.Version {
+			return nil, &be.BatchError{Index: i}
+		}
+		befores[c.Name] = before
+	}
+
+	if err := tr.Write(&batch, nil); err != nil {
+		return nil, err
+	}
+
+	if err := tr.Commit(); err != nil {
+		return nil, err
+	}
+	backend.id = id
+
+	for _, c := range changes {
+		before := befores[c.Name]
+		if c.Op == be.OpPut {
+			backend.publishPut(c.Name, before, c.Route)
+			after := *c.Route
+			befores[c.Name] = &after
+		} else if before != nil {
+			backend.publishDel(c.Name, before)
+			befores[c.Name] = nil
+		}
+	}
+
+	return vers, nil
 }
 
 // Del removes an existing shortcut from the data store.
 func (backend *Backend) Del(ctx context.Context, key string) error {
-	return backend.db.Delete([]byte(key), &opt.WriteOptions{Sync: true})
+	backend.wlck.Lock()
+	defer backend.wlck.Unlock()
+
+	before, err := backend.Get(ctx, key)
+	if errors.Is(err, internal.ErrRouteNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := backend.db.Delete([]byte(key), &opt.WriteOptions{Sync: true}); err != nil {
+		return err
+	}
+
+	backend.publishDel(key, before)
+	return nil
+}
+
+// NamesForURL returns the names of the shortcuts that lead to url.
+func (backend *Backend) NamesForURL(ctx context.Context, url string) ([]string, error) {
+	return backend.rev.NamesForURL(url), nil
+}
+
+// NamesForHost returns the names of the shortcuts with URLs on host.
+func (backend *Backend) NamesForHost(ctx context.Context, host string) ([]string, error) {
+	return backend.rev.NamesForHost(host), nil
+}
+
+// Watch delivers every change made through this backend after it is called.
+func (backend *Backend) Watch(ctx context.Context) (<-chan *be.Event, error) {
+	return backend.feed.Watch(ctx)
 }
 
 // List all routes in an iterator, starting with the key prefix of start (which can also be nil).
 func (backend *Backend) List(ctx context.Context, start string) (internal.RouteIterator, error) {
 	return &RouteIterator{
-		it: backend.db.NewIterator(&util.Range{
-			Start: []byte(start),
-			Limit: nil,
-		}, nil),
+		it: backend.db.NewIterator(routesFrom(start), nil),
 	}, nil
 }
 
 // GetAll gets everything in the db to dump it out for backup purposes
 func (backend *Backend) GetAll(ctx context.Context) (map[string]internal.Route, error) {
 	golinks := map[string]internal.Route{}
-	iter := backend.db.NewIterator(nil, nil)
+	iter := backend.db.NewIterator(routesFrom(""), nil)
 	defer iter.Release()
 
 	for iter.Next() {
@@ -164,18 +719,13 @@ func (backend *Backend) GetAll(ctx context.Context) (map[string]internal.Route,
 	return golinks, nil
 }
 
-func (backend *Backend) commit(id uint64) error {
-	w, err := os.Create(filepath.Join(backend.path, idLogFilename))
-	if err != nil {
+// Write the ID counter. Must be called with lck held.
+func (backend *Backend) writeID(id uint64) error {
+	if err := backend.db.Put(idKey, encodeCounter(id), &opt.WriteOptions{Sync: true}); err != nil {
 		return err
 	}
-	defer w.Close()
-
-	if err := binary.Write(w, binary.LittleEndian, id); err != nil {
-		return err
-	}
-
-	return w.Sync()
+	backend.id = id
+	return nil
 }
 
 // NextID generates the next numeric ID to be used for an auto-named shortcut.
@@ -183,11 +733,91 @@ func (backend *Backend) NextID(ctx context.Context) (uint64, error) {
 	backend.lck.Lock()
 	defer backend.lck.Unlock()
 
-	backend.id++
+	if backend.id >= be.MaxID {
+		return 0, be.ErrIDOverflow
+	}
 
-	if err := commit(filepath.Join(backend.path, idLogFilename), backend.id); err != nil {
+	if err := backend.writeID(backend.id + 1); err != nil {
 		return 0, err
 	}
 
 	return backend.id, nil
 }
+
+// NextIDs hands out the next n IDs at once, writing the counter only once.
+func (backend *Backend) NextIDs(ctx context.Context, n int) ([]uint64, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	if backend.id > be.MaxID-uint64(n) {
+		return nil, be.ErrIDOverflow
+	}
+
+	if err := backend.writeID(backend.id + uint64(n)); err != nil {
+		return nil, err
+	}
+
+	return be.IDsEndingAt(backend.id, n), nil
+}
+
+// LastID returns the highest ID handed out by NextID or NextIDs.
+func (backend *Backend) LastID(ctx context.Context) (uint64, error) {
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	return backend.id, nil
+}
+
+// EnsureID advances the ID counter to id if it is currently lower.
+func (backend *Backend) EnsureID(ctx context.Context, id uint64) error {
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	if id <= backend.id {
+		return nil
+	} else if id > be.MaxID {
+		return be.ErrIDOverflow
+	}
+
+	return backend.writeID(id)
+}
+
+// snapshot is a consistent view of the routes and the ID counter.
+type snapshot struct {
+	snap *leveldb.Snapshot
+}
+
+// Snapshot captures the current state of the store.
+func (backend *Backend) Snapshot(ctx context.Context) (be.Snapshot, error) {
+	snap, err := backend.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot{snap: snap}, nil
+}
+
+// List all routes in the snapshot, starting with start.
+func (s *snapshot) List(ctx context.Context, start string) (internal.RouteIterator, error) {
+	return &RouteIterator{
+		it: s.snap.NewIterator(routesFrom(start), nil),
+	}, nil
+}
+
+// LastID returns the ID counter as it was when the snapshot was taken.
+func (s *snapshot) LastID(ctx context.Context) (uint64, error) {
+	val, err := s.snap.Get(idKey, nil)
+	if err != nil {
+		return 0, err
+	}
+	return decodeCounter(val)
+}
+
+// Release the snapshot.
+func (s *snapshot) Release() {
+	s.snap.Release()
+}
@@ -1,7 +1,9 @@
 package leveldb
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -9,6 +11,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/syndtr/goleveldb/leveldb"
+
+	be "github.com/kellegous/go/backend"
+	"github.com/kellegous/go/backend/backendtest"
 	"github.com/kellegous/go/internal"
 )
 
@@ -86,6 +92,260 @@ func TestNextID(t *testing.T) {
 	}
 }
 
+func TestEnsureID(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	backend, err := New(filepath.Join(tmp, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := backend.EnsureID(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.EnsureID(ctx, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := backend.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 10 {
+		t.Fatalf("expected last id of 10, got %d", id)
+	}
+
+	// the counter must survive reopening the backend.
+	backend.Close()
+	backend, err = New(filepath.Join(tmp, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	if id, err := backend.NextID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 11 {
+		t.Fatalf("expected next id of 11, got %d", id)
+	}
+}
+
+// Reopen the backend in dir after changing what is on disk with fn.
+func reopen(t *testing.T, backend *Backend, dir string, fn func()) *Backend {
+	backend.Close()
+	fn()
+
+	backend, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+func mustHaveLastID(t *testing.T, ctx context.Context, backend *Backend, exp uint64) {
+	if id, err := backend.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != exp {
+		t.Fatalf("expected last id of %d, got %d", exp, id)
+	}
+}
+
+// Remove the counter from the database, as if it was never moved there.
+func dropCounter(t *testing.T, dir string) {
+	db, err := leveldb.OpenFile(filepath.Join(dir, routesDbFilename), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Delete(idKey, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLegacyID(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := filepath.Join(tmp, "data")
+	backend, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := putRoutes(ctx, backend, internal.EncodeID(7)); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(dir, idLogFilename)
+
+	// the counter in the file of an older version is moved into the database.
+	backend = reopen(t, backend, dir, func() {
+		dropCounter(t, dir)
+		if err := ioutil.WriteFile(filename, encodeCounter(42), 0644); err != nil {
+			t.Fatal(err)
+		}
+	})
+	mustHaveLastID(t, ctx, backend, 42)
+
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got %v", filename, err)
+	}
+
+	// a file cut short by a crash is rebuilt from the generated names.
+	backend = reopen(t, backend, dir, func() {
+		dropCounter(t, dir)
+		if err := ioutil.WriteFile(filename, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	})
+	defer backend.Close()
+	mustHaveLastID(t, ctx, backend, 7)
+}
+
+func TestRebuildID(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	backend, err := New(filepath.Join(tmp, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// putting a generated name raises the counter in the same write.
+	if err := putRoutes(ctx, backend, internal.EncodeID(20), ":not-an-id", "a"); err != nil {
+		t.Fatal(err)
+	}
+	mustHaveLastID(t, ctx, backend, 20)
+
+	val, err := backend.db.Get(idKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := decodeCounter(val); err != nil || id != 20 {
+		t.Fatalf("expected a stored counter of 20, got %d, %v", id, err)
+	}
+
+	// a route written behind the backend's back leaves the counter behind.
+	b, err := (&internal.Route{URL: "http://b/"}).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.db.Put([]byte(internal.EncodeID(30)), b, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := backend.RebuildID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 30 {
+		t.Fatalf("expected the counter to be rebuilt to 30, got %d", id)
+	}
+
+	if err := backend.EnsureID(ctx, 50); err != nil {
+		t.Fatal(err)
+	}
+
+	// the counter is never lowered.
+	if id, err := backend.RebuildID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 50 {
+		t.Fatalf("expected the counter to stay at 50, got %d", id)
+	}
+}
+
+func TestReservedNames(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	backend, err := New(filepath.Join(tmp, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if _, err := backend.NextID(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := putRoutes(ctx, backend, string(idKey)); err != errReservedName {
+		t.Fatalf("expected errReservedName, got %v", err)
+	}
+
+	if _, err := backend.Get(ctx, string(idKey)); err != internal.ErrRouteNotFound {
+		t.Fatalf("expected ErrRouteNotFound, got %v", err)
+	}
+
+	if err := putRoutes(ctx, backend, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// nor can the counter be renamed away, or replaced by a rename.
+	val, err := backend.db.Get(idKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := backend.Rename(ctx, string(idKey), be.VersionOf(val), "b", nil); err != errReservedName {
+		t.Fatalf("expected errReservedName, got %v", err)
+	}
+
+	if _, err := backend.db.Get(idKey, nil); err != nil {
+		t.Fatalf("expected the counter to be left in place, got %v", err)
+	}
+
+	_, ver, err := backend.GetVersion(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := backend.Rename(ctx, "a", ver, string(idKey), nil); err != errReservedName {
+		t.Fatalf("expected errReservedName, got %v", err)
+	}
+
+	// the counter is never listed as a route.
+	iter, err := backend.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeIterOf(t, iter, "a")
+
+	all, err := backend.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 1 {
+		t.Fatalf("expected only a, got %v", all)
+	}
+}
+
 func TestEmptyList(t *testing.T) {
 	tmp, err := ioutil.TempDir("", "")
 	if err != nil {
@@ -212,3 +472,148 @@ func TestList(t *testing.T) {
 	}
 	mustBeIterOf(t, iter)
 }
+
+func TestUpgrade(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	backend, err := New(filepath.Join(tmp, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// write a route in the original, unversioned encoding, with a timestamp
+	// whose low byte is '{'.
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, int64(0x17b)); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("http://legacy/")
+
+	if err := backend.db.Put([]byte("legacy"), buf.Bytes(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := putRoutes(ctx, backend, "current"); err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err := backend.Get(ctx, "legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rt.URL != "http://legacy/" || rt.Time.UnixNano() != 0x17b {
+		t.Fatalf("unexpected legacy route %v", rt)
+	}
+
+	n, err := backend.Upgrade(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 1 {
+		t.Fatalf("expected 1 upgraded route, got %d", n)
+	}
+
+	val, err := backend.db.Get([]byte("legacy"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !internal.IsCurrentEncoding(val) {
+		t.Fatal("expected legacy route to be rewritten in the current encoding")
+	}
+
+	if n, err := backend.Upgrade(ctx); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("expected no routes to be upgraded, got %d", n)
+	}
+}
+
+func TestUndecodable(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := filepath.Join(tmp, "data")
+	backend, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := putRoutes(ctx, backend, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a route in an encoding from the future cannot be decoded.
+	if err := backend.db.Put([]byte("bad"), []byte{0xff, 'g', 'o', 9}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the route does not stop the store from opening.
+	backend = reopen(t, backend, dir, func() {})
+	defer backend.Close()
+
+	if _, err := backend.Get(ctx, "bad"); err == nil {
+		t.Fatal("expected bad to be undecodable")
+	}
+
+	names, err := backend.ListNames(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != 2 || names[0] != "a" || names[1] != "bad" {
+		t.Fatalf("expected a and bad, got %v", names)
+	}
+
+	if n, err := backend.Upgrade(ctx); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatalf("expected no routes to be upgraded, got %d", n)
+	}
+
+	if err := backend.RebuildIndexes(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if names, err := backend.NamesForHost(ctx, "a"); err != nil {
+		t.Fatal(err)
+	} else if len(names) != 1 || names[0] != "a" {
+		t.Fatalf("expected a, got %v", names)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) (be.Backend, func()) {
+		tmp, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		backend, err := New(filepath.Join(tmp, "data"))
+		if err != nil {
+			os.RemoveAll(tmp)
+			t.Fatal(err)
+		}
+
+		return backend, func() {
+			backend.Close()
+			os.RemoveAll(tmp)
+		}
+	}, nil)
+}
@@ -0,0 +1,485 @@
+// Package memory provides a backend that holds every route in memory. It is
+// intended for development and tests, and serves as the reference for how the
+// other backends should behave.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	be "github.com/kellegous/go/backend"
+	"github.com/kellegous/go/internal"
+)
+
+// Backend is a thread-safe, in-memory store of routes.
+type Backend struct {
+	lck    sync.RWMutex
+	path   string
+	routes map[string]internal.Route
+
+	// names holds every key in routes, in order. It is replaced rather than
+	// changed, so that iterators can share it.
+	names []string
+	id    uint64
+
+	feed be.Feed
+	rev  be.ReverseIndex
+}
+
+// The contents of the file a backend is saved to.
+type file struct {
+	LastID uint64                    `json:"last_id"`
+	Routes map[string]internal.Route `json:"routes"`
+}
+
+// New instantiates a new Backend. If path is not empty, the routes are loaded
+// from that file, if it exists, and are saved back to it by Save and Close.
+func New(path string) (*Backend, error) {
+	backend := &Backend{
+		path:   path,
+		routes: map[string]internal.Route{},
+	}
+
+	if path == "" {
+		return backend, nil
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return backend, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+
+	backend.id = f.LastID
+	for name, rt := range f.Routes {
+		rt := rt
+		backend.routes[name] = rt
+		backend.names = append(backend.names, name)
+		backend.rev.Update(name, nil, &rt)
+	}
+	sort.Strings(backend.names)
+
+	return backend, nil
+}
+
+// Save writes the contents of the backend to its file. It does nothing if the
+// backend has no file.
+func (backend *Backend) Save() error {
+	if backend.path == "" {
+		return nil
+	}
+
+	backend.lck.RLock()
+	b, err := json.Marshal(&file{
+		LastID: backend.id,
+		Routes: backend.routes,
+	})
+	backend.lck.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first so a crash never leaves a partial file.
+	tmp, err := ioutil.TempFile(filepath.Dir(backend.path), ".memory")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), backend.path)
+}
+
+// Close saves the backend to its file, if it has one.
+func (backend *Backend) Close() error {
+	backend.feed.Close()
+	return backend.Save()
+}
+
+// Get retreives a shortcut from the data store.
+func (backend *Backend) Get(ctx context.Context, name string) (*internal.Route, error) {
+	backend.lck.RLock()
+	defer backend.lck.RUnlock()
+
+	rt, ok := backend.routes[name]
+	if !ok {
+		return nil, internal.ErrRouteNotFound
+	}
+
+	return &rt, nil
+}
+
+// The version of a route, which is derived from its encoding.
+func versionOf(rt *internal.Route) (string, error) {
+	b, err := rt.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return be.VersionOf(b), nil
+}
+
+// GetVersion retrieves a shortcut along with its version.
+func (backend *Backend) GetVersion(ctx context.Context, name string) (*internal.Route, string, error) {
+	backend.lck.RLock()
+	defer backend.lck.RUnlock()
+
+	rt, ok := backend.routes[name]
+	if !ok {
+		return nil, be.NoVersion, internal.ErrRouteNotFound
+	}
+
+	ver, err := versionOf(&rt)
+	if err != nil {
+		return nil, be.NoVersion, err
+	}
+
+	return &rt, ver, nil
+}
+
+// Store a route, raising the ID counter if it is stored under a generated
+// name for a higher ID. The caller must hold the write lock.
+func (backend *Backend) put(key string, rt *internal.Route) {
+	before, ok := backend.routes[key]
+	if !ok {
+		ix := sort.SearchStrings(backend.names, key)
+		names := make([]string, len(backend.names)+1)
+		copy(names, backend.names[:ix])
+		names[ix] = key
+		copy(names[ix+1:], backend.names[ix:])
+		backend.names = names
+	}
+
+	backend.routes[key] = *rt
+	if id, ok := be.CountedID(key); ok && id > backend.id {
+		backend.id = id
+	}
+
+	e := &be.Event{
+		Op:    be.OpPut,
+		Name:  key,
+		After: &internal.Route{},
+	}
+	*e.After = *rt
+	if ok {
+		e.Before = &before
+	}
+	backend.rev.Update(key, e.Before, e.After)
+	backend.feed.Publish(e)
+}
+
+// Put stores a new shortcut in the data store.
+func (backend *Backend) Put(ctx context.Context, key string, rt *internal.Route) error {
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	backend.put(key, rt)
+	return nil
+}
+
+// PutIf stores a shortcut if the one it replaces has the given version.
+func (backend *Backend) PutIf(ctx context.Context, key string, rt *internal.Route, version string) (string, error) {
+	ver, err := versionOf(rt)
+	if err != nil {
+		return be.NoVersion, err
+	}
+
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	cur := be.NoVersion
+	if before, ok := backend.routes[key]; ok {
+		if cur, err = versionOf(&before); err != nil {
+			return be.NoVersion, err
+		}
+	}
+
+	if cur != version {
+		return be.NoVersion, be.ErrVersionMismatch
+	}
+
+	backend.put(key, rt)
+	return ver, nil
+}
+
+// Rename moves a shortcut to a new name if it has the given version and the
+// name is not in use.
+func (backend *Backend) Rename(ctx context.Context, from, version, to string, leave *internal.Route) (string, error) {
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	rt, ok := backend.routes[from]
+	if !ok {
+		return be.NoVersion, be.ErrVersionMismatch
+	}
+
+	ver, err := versionOf(&rt)
+	if err != nil {
+		return be.NoVersion, err
+	}
+
+	if _, ok := backend.routes[to]; ok || ver != version {
+		return be.NoVersion, be.ErrVersionMismatch
+	}
+
+	backend.put(to, &rt)
+	if leave != nil {
+		backend.put(from, leave)
+	} else {
+		backend.del(from)
+	}
+	return ver, nil
+}
+
+// Apply makes every change in the batch if all of their conditions hold.
+func (backend *Backend) Apply(ctx context.Context, changes []*be.Change) ([]string, error) {
+	vers := make([]string, len(changes))
+	for i, c := range changes {
+		if c.Op != be.OpPut {
+			continue
+		}
+
+		ver, err := versionOf(c.Route)
+		if err != nil {
+			return nil, err
+		}
+		vers[i] = ver
+	}
+
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	for i, c := range changes {
+		if !c.Conditional {
+			continue
+		}
+
+		cur := be.NoVersion
+		if rt, ok := backend.routes[c.Name]; ok {
+			var err error
+			if cur, err = versionOf(&rt); err != nil {
+				return nil, err
+			}
+		}
+
+		if cur != c.Version {
+			return nil, &be.BatchError{Index: i}
+		}
+	}
+
+	for _, c := range changes {
+		if c.Op == be.OpPut {
+			backend.put(c.Name, c.Route)
+		} else {
+			backend.del(c.Name)
+		}
+	}
+
+	return vers, nil
+}
+
+// Del removes an existing shortcut from the data store.
+func (backend *Backend) Del(ctx context.Context, key string) error {
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	backend.del(key)
+	return nil
+}
+
+// Remove a route, if it exists. The caller must hold the write lock.
+func (backend *Backend) del(key string) {
+	before, ok := backend.routes[key]
+	if !ok {
+		return
+	}
+
+	delete(backend.routes, key)
+	ix := sort.SearchStrings(backend.names, key)
+	names := make([]string, 0, len(backend.names)-1)
+	names = append(names, backend.names[:ix]...)
+	backend.names = append(names, backend.names[ix+1:]...)
+	backend.rev.Update(key, &before, nil)
+
+	backend.feed.Publish(&be.Event{
+		Op:     be.OpDel,
+		Name:   key,
+		Before: &before,
+	})
+}
+
+// NamesForURL returns the names of the shortcuts that lead to url.
+func (backend *Backend) NamesForURL(ctx context.Context, url string) ([]string, error) {
+	return backend.rev.NamesForURL(url), nil
+}
+
+// NamesForHost returns the names of the shortcuts with URLs on host.
+func (backend *Backend) NamesForHost(ctx context.Context, host string) ([]string, error) {
+	return backend.rev.NamesForHost(host), nil
+}
+
+// RebuildIndexes rebuilds the reverse index from the routes.
+func (backend *Backend) RebuildIndexes(ctx context.Context) error {
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	backend.rev.Reset()
+	for name, rt := range backend.routes {
+		rt := rt
+		backend.rev.Update(name, nil, &rt)
+	}
+	return nil
+}
+
+// Watch delivers every change made to the store after it is called.
+func (backend *Backend) Watch(ctx context.Context) (<-chan *be.Event, error) {
+	return backend.feed.Watch(ctx)
+}
+
+// Look up a route for an iterator.
+func (backend *Backend) lookup(name string) (internal.Route, bool) {
+	backend.lck.RLock()
+	defer backend.lck.RUnlock()
+
+	rt, ok := backend.routes[name]
+	return rt, ok
+}
+
+// List all routes in an iterator, starting with the key prefix of start (which can also be nil).
+// The iterator goes over the names as they were when List was called, and
+// reads each route when it gets to it, skipping those deleted since.
+func (backend *Backend) List(ctx context.Context, start string) (internal.RouteIterator, error) {
+	backend.lck.RLock()
+	defer backend.lck.RUnlock()
+
+	return newIterator(backend.names, start, backend.lookup), nil
+}
+
+// GetAll gets everything in the db to dump it out for backup purposes
+func (backend *Backend) GetAll(ctx context.Context) (map[string]internal.Route, error) {
+	backend.lck.RLock()
+	defer backend.lck.RUnlock()
+
+	golinks := make(map[string]internal.Route, len(backend.routes))
+	for name, rt := range backend.routes {
+		golinks[name] = rt
+	}
+
+	return golinks, nil
+}
+
+// NextID generates the next numeric ID to be used for an auto-named shortcut.
+func (backend *Backend) NextID(ctx context.Context) (uint64, error) {
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	if backend.id >= be.MaxID {
+		return 0, be.ErrIDOverflow
+	}
+
+	backend.id++
+	return backend.id, nil
+}
+
+// NextIDs hands out the next n IDs at once.
+func (backend *Backend) NextIDs(ctx context.Context, n int) ([]uint64, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	if backend.id > be.MaxID-uint64(n) {
+		return nil, be.ErrIDOverflow
+	}
+
+	backend.id += uint64(n)
+	return be.IDsEndingAt(backend.id, n), nil
+}
+
+// LastID returns the highest ID handed out by NextID or NextIDs.
+func (backend *Backend) LastID(ctx context.Context) (uint64, error) {
+	backend.lck.RLock()
+	defer backend.lck.RUnlock()
+
+	return backend.id, nil
+}
+
+// EnsureID advances the ID counter to id if it is currently lower.
+func (backend *Backend) EnsureID(ctx context.Context, id uint64) error {
+	if id > be.MaxID {
+		return be.ErrIDOverflow
+	}
+
+	backend.lck.Lock()
+	defer backend.lck.Unlock()
+
+	if id > backend.id {
+		backend.id = id
+	}
+	return nil
+}
+
+// snapshot is a copy of the routes and the ID counter.
+type snapshot struct {
+	names  []string
+	routes map[string]internal.Route
+	id     uint64
+}
+
+// Snapshot captures the current state of the store.
+func (backend *Backend) Snapshot(ctx context.Context) (be.Snapshot, error) {
+	backend.lck.RLock()
+	defer backend.lck.RUnlock()
+
+	routes := make(map[string]internal.Route, len(backend.routes))
+	for name, rt := range backend.routes {
+		routes[name] = rt
+	}
+
+	return &snapshot{
+		names:  backend.names,
+		routes: routes,
+		id:     backend.id,
+	}, nil
+}
+
+// List all routes in the snapshot, starting with start.
+func (s *snapshot) List(ctx context.Context, start string) (internal.RouteIterator, error) {
+	return newIterator(s.names, start, func(name string) (internal.Route, bool) {
+		rt, ok := s.routes[name]
+		return rt, ok
+	}), nil
+}
+
+// LastID returns the ID counter as it was when the snapshot was taken.
+func (s *snapshot) LastID(ctx context.Context) (uint64, error) {
+	return s.id, nil
+}
+
+// Release the snapshot.
+func (s *snapshot) Release() {}
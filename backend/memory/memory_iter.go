@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"sort"
+
+	"github.com/kellegous/go/internal"
+)
+
+// RouteIterator allows iteration of the named routes in the store.
+type RouteIterator struct {
+	names []string
+	get   func(name string) (internal.Route, bool)
+	pos   int
+	route internal.Route
+}
+
+// An iterator over the names at or after start, which reads each route with
+// get. Names that get does not find are skipped.
+func newIterator(names []string, start string, get func(name string) (internal.Route, bool)) *RouteIterator {
+	return &RouteIterator{
+		names: names[sort.SearchStrings(names, start):],
+		get:   get,
+		pos:   -1,
+	}
+}
+
+// Valid indicates whether the current values of the iterator are valid.
+func (i *RouteIterator) Valid() bool {
+	return i.pos >= 0 && i.pos < len(i.names)
+}
+
+// Next advances the iterator to the next value.
+func (i *RouteIterator) Next() bool {
+	for i.pos < len(i.names) {
+		i.pos++
+		if !i.Valid() {
+			break
+		}
+
+		if rt, ok := i.get(i.names[i.pos]); ok {
+			i.route = rt
+			return true
+		}
+	}
+	return false
+}
+
+// Seek moves the iterator to the first route at or after cur.
+func (i *RouteIterator) Seek(cur string) bool {
+	i.pos = sort.SearchStrings(i.names, cur) - 1
+	return i.Next()
+}
+
+// Error returns any active error that has stopped the iterator.
+func (i *RouteIterator) Error() error {
+	return nil
+}
+
+// Name is the name of the current route.
+func (i *RouteIterator) Name() string {
+	if !i.Valid() {
+		return ""
+	}
+	return i.names[i.pos]
+}
+
+// Route is the current route.
+func (i *RouteIterator) Route() *internal.Route {
+	if !i.Valid() {
+		return nil
+	}
+	rt := i.route
+	return &rt
+}
+
+// Release disposes of the resources in the iterator.
+func (i *RouteIterator) Release() {
+	i.names = nil
+	i.pos = -1
+}
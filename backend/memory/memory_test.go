@@ -0,0 +1,160 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/backend/backendtest"
+	"github.com/kellegous/go/internal"
+)
+
+func putRoutes(ctx context.Context, backend *Backend, names ...string) error {
+	for _, name := range names {
+		if err := backend.Put(ctx, name, &internal.Route{
+			URL:  fmt.Sprintf("http://%s/", name),
+			Time: time.Unix(0, 420),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mustBeNames(t *testing.T, iter internal.RouteIterator, names ...string) {
+	defer iter.Release()
+
+	for i, name := range names {
+		if !iter.Next() {
+			t.Fatalf("at item %d, expected more items", i)
+		}
+
+		if iter.Name() != name {
+			t.Fatalf("expected name of %s, got %s", name, iter.Name())
+		}
+
+		if iter.Route().URL != fmt.Sprintf("http://%s/", name) {
+			t.Fatalf("expected URL of http://%s/, got %s", name, iter.Route().URL)
+		}
+	}
+
+	if iter.Next() || iter.Valid() {
+		t.Fatal("iterator has too many items")
+	}
+}
+
+func TestList(t *testing.T) {
+	backend, err := New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	if err := putRoutes(ctx, backend, "d", "a", "c", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.Del(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	iter, err := backend.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the iterator does not see routes added after it was created, and skips
+	// those deleted.
+	if err := putRoutes(ctx, backend, "e"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.Del(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	mustBeNames(t, iter, "a", "d")
+
+	if err := putRoutes(ctx, backend, "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	iter, err = backend.List(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeNames(t, iter, "c", "d", "e")
+
+	iter, err = backend.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !iter.Seek("b") || iter.Name() != "c" {
+		t.Fatalf("expected seek to land on c, got %s", iter.Name())
+	}
+	mustBeNames(t, iter, "d", "e")
+}
+
+func TestSave(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	filename := filepath.Join(tmp, "routes.json")
+
+	backend, err := New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	if err := putRoutes(ctx, backend, "b", "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := backend.NextID(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err = New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iter, err := backend.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeNames(t, iter, "a", "b")
+
+	if id, err := backend.NextID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 2 {
+		t.Fatalf("expected id of 2, got %d", id)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) (backend.Backend, func()) {
+		backend, err := New("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return backend, func() {
+			backend.Close()
+		}
+	}, nil)
+}
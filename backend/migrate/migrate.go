@@ -0,0 +1,180 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/internal"
+)
+
+// Action is what a copy does, or would do, with a single route.
+type Action int
+
+const (
+	// Unchanged indicates the route already exists in the destination.
+	Unchanged Action = iota
+
+	// Create indicates the route is missing from the destination.
+	Create
+
+	// Update indicates the destination has a different route by that name.
+	Update
+)
+
+func (a Action) String() string {
+	switch a {
+	case Create:
+		return "create"
+	case Update:
+		return "update"
+	default:
+		return "unchanged"
+	}
+}
+
+// Change describes the difference between source and destination for a
+// single route.
+type Change struct {
+	Action Action
+	Name   string
+
+	// Old is the route in the destination, it is nil if the route is missing.
+	Old *internal.Route
+
+	// New is the route in the source.
+	New *internal.Route
+}
+
+// Options controls the behavior of Copy.
+type Options struct {
+	// DryRun reports changes without applying any of them.
+	DryRun bool
+
+	// Start is the name of the first route to copy. Since routes are copied in
+	// order, the last name reported by Progress can be used to resume an
+	// interrupted copy.
+	Start string
+
+	// Change is called for each route that differs between the source and the
+	// destination.
+	Change func(c *Change)
+
+	// Progress is called after each route has been handled. An error aborts
+	// the copy.
+	Progress func(name string) error
+}
+
+// Report summarizes a copy.
+type Report struct {
+	Created   int    `json:"created"`
+	Updated   int    `json:"updated"`
+	Unchanged int    `json:"unchanged"`
+	SrcID     uint64 `json:"src_id"`
+	DstID     uint64 `json:"dst_id"`
+}
+
+// InSync indicates whether the destination held every source route and an ID
+// counter at least as high as the source when the report was made.
+func (r *Report) InSync() bool {
+	return r.Created == 0 && r.Updated == 0 && r.DstID >= r.SrcID
+}
+
+// Equal indicates whether two routes hold the same values. Times are compared
+// at microsecond precision, which is all that firestore retains.
+func Equal(a, b *internal.Route) bool {
+	return a.URL == b.URL &&
+		a.Time.Truncate(time.Microsecond).Equal(b.Time.Truncate(time.Microsecond))
+}
+
+// Copy every route and the ID counter from src to dst. Routes that already
+// exist in dst are overwritten when they differ and are otherwise left
+// untouched, so a copy may be safely repeated.
+func Copy(ctx context.Context, src, dst backend.Backend, opts *Options) (*Report, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	var rep Report
+	var err error
+
+	if rep.SrcID, err = src.LastID(ctx); err != nil {
+		return nil, err
+	}
+
+	if rep.DstID, err = dst.LastID(ctx); err != nil {
+		return nil, err
+	}
+
+	// Raise the counter first so that dst cannot generate a name that is
+	// about to be copied from src.
+	if !opts.DryRun && rep.DstID < rep.SrcID {
+		if err := dst.EnsureID(ctx, rep.SrcID); err != nil {
+			return nil, err
+		}
+		rep.DstID = rep.SrcID
+	}
+
+	iter, err := src.List(ctx, opts.Start)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Release()
+
+	for iter.Next() {
+		name, rt := iter.Name(), iter.Route()
+
+		c := Change{
+			Name: name,
+			New:  rt,
+		}
+
+		old, err := dst.Get(ctx, name)
+		if errors.Is(err, internal.ErrRouteNotFound) {
+			c.Action = Create
+			rep.Created++
+		} else if err != nil {
+			return nil, err
+		} else if !Equal(old, rt) {
+			c.Action = Update
+			c.Old = old
+			rep.Updated++
+		} else {
+			rep.Unchanged++
+		}
+
+		if c.Action != Unchanged {
+			if opts.Change != nil {
+				opts.Change(&c)
+			}
+
+			if !opts.DryRun {
+				if err := dst.Put(ctx, name, rt); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if opts.Progress != nil {
+			if err := opts.Progress(name); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	return &rep, nil
+}
+
+// Verify compares every route and the ID counter in src with those in dst
+// without changing either one.
+func Verify(ctx context.Context, src, dst backend.Backend, change func(c *Change)) (*Report, error) {
+	return Copy(ctx, src, dst, &Options{
+		DryRun: true,
+		Change: change,
+	})
+}
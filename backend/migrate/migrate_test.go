@@ -0,0 +1,160 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kellegous/go/backend/leveldb"
+	"github.com/kellegous/go/internal"
+)
+
+func needBackend(t *testing.T, dir, name string) *leveldb.Backend {
+	backend, err := leveldb.New(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+func putRoutes(ctx context.Context, t *testing.T, backend *leveldb.Backend, names ...string) {
+	for i, name := range names {
+		if err := backend.Put(ctx, name, &internal.Route{
+			URL:  fmt.Sprintf("http://%s/", name),
+			Time: time.Unix(0, int64(420+i)),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCopy(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := needBackend(t, tmp, "src")
+	defer src.Close()
+
+	dst := needBackend(t, tmp, "dst")
+	defer dst.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	putRoutes(ctx, t, src, "a", "b", "c")
+	putRoutes(ctx, t, dst, "b")
+	if err := dst.Put(ctx, "c", &internal.Route{URL: "http://other/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := src.EnsureID(ctx, 42); err != nil {
+		t.Fatal(err)
+	}
+
+	var changes []*Change
+	rep, err := Copy(ctx, src, dst, &Options{
+		DryRun: true,
+		Change: func(c *Change) {
+			changes = append(changes, c)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.Created != 1 || rep.Updated != 1 || rep.Unchanged != 1 {
+		t.Fatalf("unexpected dry run report %+v", rep)
+	}
+
+	if len(changes) != 2 ||
+		changes[0].Name != "a" || changes[0].Action != Create ||
+		changes[1].Name != "c" || changes[1].Action != Update {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+
+	if _, err := dst.Get(ctx, "a"); err != internal.ErrRouteNotFound {
+		t.Fatal("dry run should not have created a")
+	}
+
+	rep, err = Copy(ctx, src, dst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.Created != 1 || rep.Updated != 1 || rep.Unchanged != 1 || rep.DstID != 42 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+
+	rep, err = Verify(ctx, src, dst, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !rep.InSync() || rep.Unchanged != 3 {
+		t.Fatalf("expected destination to be in sync, got %+v", rep)
+	}
+
+	rt, err := dst.Get(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rt.URL != "http://c/" || rt.Time.UnixNano() != 422 {
+		t.Fatalf("expected c to be copied with its time, got %v", rt)
+	}
+
+	id, err := dst.NextID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id != 43 {
+		t.Fatalf("expected next id of 43, got %d", id)
+	}
+}
+
+func TestCopyResume(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	src := needBackend(t, tmp, "src")
+	defer src.Close()
+
+	dst := needBackend(t, tmp, "dst")
+	defer dst.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	putRoutes(ctx, t, src, "a", "b", "c", "d")
+
+	var names []string
+	rep, err := Copy(ctx, src, dst, &Options{
+		Start: "c",
+		Progress: func(name string) error {
+			names = append(names, name)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.Created != 2 || len(names) != 2 || names[0] != "c" || names[1] != "d" {
+		t.Fatalf("expected to copy c and d, got %v (%+v)", names, rep)
+	}
+
+	if _, err := dst.Get(ctx, "a"); err != internal.ErrRouteNotFound {
+		t.Fatal("expected a to be skipped")
+	}
+}
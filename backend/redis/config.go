@@ -0,0 +1,218 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultPort         = "6379"
+	defaultSentinelPort = "26379"
+)
+
+// Config describes how to reach redis and how the backend lays out its keys.
+type Config struct {
+	// Addrs holds a single server address, the seed nodes of a cluster or,
+	// when MasterName is set, the addresses of the sentinels.
+	Addrs []string
+
+	// DB is the database to select. It must be 0 for a cluster.
+	DB int
+
+	// Username and Password authenticate the connection. Username is only
+	// needed for an ACL user other than default.
+	Username string
+	Password string
+
+	// MasterName enables Sentinel failover for the named master.
+	MasterName       string
+	SentinelPassword string
+
+	// Cluster connects to a Redis Cluster through the nodes in Addrs.
+	Cluster bool
+
+	// TLS enables TLS. TLSCAFile verifies the server against a custom CA and
+	// TLSCertFile and TLSKeyFile present a client certificate.
+	TLS                   bool
+	TLSCAFile             string
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSServerName         string
+	TLSInsecureSkipVerify bool
+
+	// Prefix is given to every key the backend uses.
+	Prefix string
+
+	// Events publishes every change to a route so that it can be watched.
+	Events bool
+}
+
+// ParseURL parses a redis URL of the form
+//
+//	redis[s]://[user[:password]@]host[:port][,host[:port]...][/db][?option=value...]
+//
+// where rediss enables TLS. Several hosts may be listed for a cluster or for
+// a set of sentinels. The supported options are master, sentinel-password,
+// cluster, events, tls-ca, tls-cert, tls-key, tls-server-name and
+// tls-insecure.
+func ParseURL(s string) (*Config, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{
+		Prefix: DefaultPrefix,
+		Events: true,
+	}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		cfg.TLS = true
+	default:
+		return nil, fmt.Errorf("invalid redis URL scheme: %q", u.Scheme)
+	}
+
+	if u.User != nil {
+		cfg.Username = u.User.Username()
+		cfg.Password, _ = u.User.Password()
+	}
+
+	q := u.Query()
+	for k, v := range q {
+		val := v[len(v)-1]
+		switch k {
+		case "master":
+			cfg.MasterName = val
+		case "sentinel-password":
+			cfg.SentinelPassword = val
+		case "cluster":
+			if cfg.Cluster, err = strconv.ParseBool(val); err != nil {
+				return nil, fmt.Errorf("invalid redis URL option %s: %q", k, val)
+			}
+		case "events":
+			if cfg.Events, err = strconv.ParseBool(val); err != nil {
+				return nil, fmt.Errorf("invalid redis URL option %s: %q", k, val)
+			}
+		case "tls-ca":
+			cfg.TLSCAFile = val
+		case "tls-cert":
+			cfg.TLSCertFile = val
+		case "tls-key":
+			cfg.TLSKeyFile = val
+		case "tls-server-name":
+			cfg.TLSServerName = val
+		case "tls-insecure":
+			if cfg.TLSInsecureSkipVerify, err = strconv.ParseBool(val); err != nil {
+				return nil, fmt.Errorf("invalid redis URL option %s: %q", k, val)
+			}
+		default:
+			return nil, fmt.Errorf("unknown redis URL option: %s", k)
+		}
+	}
+
+	port := defaultPort
+	if cfg.MasterName != "" {
+		port = defaultSentinelPort
+	}
+
+	for _, h := range strings.Split(u.Host, ",") {
+		if h == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(h); err != nil {
+			h = net.JoinHostPort(h, port)
+		}
+		cfg.Addrs = append(cfg.Addrs, h)
+	}
+
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if cfg.DB, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database: %q", db)
+		}
+	}
+
+	return cfg, nil
+}
+
+// Create the client described by this Config.
+func (c *Config) newClient() (redis.UniversalClient, error) {
+	addrs := c.Addrs
+	if len(addrs) == 0 {
+		addrs = []string{"localhost:" + defaultPort}
+	}
+
+	tc, err := c.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:            addrs,
+		DB:               c.DB,
+		Username:         c.Username,
+		Password:         c.Password,
+		SentinelPassword: c.SentinelPassword,
+		MasterName:       c.MasterName,
+		TLSConfig:        tc,
+	}
+
+	switch {
+	case c.MasterName != "" && c.Cluster:
+		return nil, errors.New("redis: a sentinel master cannot be used with a cluster")
+	case c.MasterName != "":
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case c.Cluster:
+		if c.DB != 0 {
+			return nil, errors.New("redis: a cluster only has database 0")
+		}
+		return redis.NewClusterClient(opts.Cluster()), nil
+	case len(addrs) > 1:
+		return nil, errors.New("redis: several addresses need either a cluster or a sentinel master")
+	default:
+		return redis.NewClient(opts.Simple()), nil
+	}
+}
+
+// Build the TLS configuration, which is nil when TLS is not enabled.
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	if !c.TLS {
+		return nil, nil
+	}
+
+	tc := &tls.Config{
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: c.TLSInsecureSkipVerify,
+	}
+
+	if c.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		tc.RootCAs = x509.NewCertPool()
+		if !tc.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("redis: no certificates found in %s", c.TLSCAFile)
+		}
+	}
+
+	if c.TLSCertFile != "" || c.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	return tc, nil
+}
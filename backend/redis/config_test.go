@@ -0,0 +1,511 @@
+package redis
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/alicebob/miniredis/server"
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/backend/backendtest"
+	"github.com/kellegous/go/internal"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		url string
+		cfg *Config
+	}{
+		{"redis://localhost", &Config{
+			Addrs:  []string{"localhost:6379"},
+			Prefix: DefaultPrefix,
+			Events: true,
+		}},
+		{"rediss://user:pw@example.com:6380/2", &Config{
+			Addrs:    []string{"example.com:6380"},
+			DB:       2,
+			Username: "user",
+			Password: "pw",
+			TLS:      true,
+			Prefix:   DefaultPrefix,
+			Events:   true,
+		}},
+		{"redis://a,b:26380/1?master=mymaster&sentinel-password=spw", &Config{
+			Addrs:            []string{"a:26379", "b:26380"},
+			DB:               1,
+			MasterName:       "mymaster",
+			SentinelPassword: "spw",
+			Prefix:           DefaultPrefix,
+			Events:           true,
+		}},
+		{"rediss://a:7000,b:7001?cluster=true&events=false&tls-ca=ca.pem&tls-cert=c.pem&tls-key=k.pem&tls-server-name=redis", &Config{
+			Addrs:         []string{"a:7000", "b:7001"},
+			Cluster:       true,
+			TLS:           true,
+			TLSCAFile:     "ca.pem",
+			TLSCertFile:   "c.pem",
+			TLSKeyFile:    "k.pem",
+			TLSServerName: "redis",
+			Prefix:        DefaultPrefix,
+		}},
+	}
+
+	for _, test := range tests {
+		cfg, err := ParseURL(test.url)
+		if err != nil {
+			t.Fatalf("%s: %s", test.url, err)
+		}
+
+		if !reflect.DeepEqual(cfg, test.cfg) {
+			t.Fatalf("%s: expected %+v, got %+v", test.url, test.cfg, cfg)
+		}
+	}
+
+	for _, u := range []string{
+		"http://localhost",
+		"redis://localhost/x",
+		"redis://localhost?cluster=maybe",
+		"redis://localhost?unknown=1",
+	} {
+		if _, err := ParseURL(u); err == nil {
+			t.Fatalf("%s: expected an error", u)
+		}
+	}
+}
+
+// A sentinel that always names the address in master.
+type fakeSentinel struct {
+	*server.Server
+
+	mu     sync.Mutex
+	master string
+}
+
+func newFakeSentinel(t *testing.T, master string) *fakeSentinel {
+	srv, err := server.NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeSentinel{Server: srv, master: master}
+	srv.Register("PING", func(c *server.Peer, cmd string, args []string) {
+		c.WriteInline("PONG")
+	})
+	srv.Register("SENTINEL", func(c *server.Peer, cmd string, args []string) {
+		switch strings.ToLower(args[0]) {
+		case "get-master-addr-by-name":
+			s.mu.Lock()
+			host, port, _ := net.SplitHostPort(s.master)
+			s.mu.Unlock()
+			c.WriteLen(2)
+			c.WriteBulk(host)
+			c.WriteBulk(port)
+		default:
+			c.WriteLen(0)
+		}
+	})
+	srv.Register("SUBSCRIBE", func(c *server.Peer, cmd string, args []string) {
+		for i, ch := range args {
+			c.WriteLen(3)
+			c.WriteBulk("subscribe")
+			c.WriteBulk(ch)
+			c.WriteInt(i + 1)
+		}
+	})
+	return s
+}
+
+func (s *fakeSentinel) failover(master string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.master = master
+}
+
+func TestSentinelFailover(t *testing.T) {
+	ctx := context.Background()
+	ma, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ma.Close()
+
+	mb, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mb.Close()
+
+	sentinel := newFakeSentinel(t, ma.Addr())
+	defer sentinel.Close()
+
+	b, err := New(ctx, &Config{
+		Addrs:      []string{sentinel.Addr().String()},
+		MasterName: "mymaster",
+		Prefix:     DefaultPrefix,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if err := b.Put(ctx, "a", &internal.Route{URL: "http://a/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ma.Exists(DefaultPrefix + routeNS + "a") {
+		t.Fatal("expected route to be written to the first master")
+	}
+
+	sentinel.failover(mb.Addr())
+	ma.Close()
+
+	// connections to the old master fail until the client redials.
+	for i := 0; ; i++ {
+		err := b.Put(ctx, "b", &internal.Route{URL: "http://b/"})
+		if err == nil {
+			break
+		} else if i == 10 {
+			t.Fatal(err)
+		}
+	}
+
+	if !mb.Exists(DefaultPrefix + routeNS + "b") {
+		t.Fatal("expected route to be written to the new master")
+	}
+}
+
+// A cluster of miniredis nodes that split the slots between them. The seed
+// node only answers CLUSTER SLOTS.
+type fakeCluster struct {
+	seed  *server.Server
+	nodes []*miniredis.Miniredis
+}
+
+func newFakeCluster(t *testing.T, n int) *fakeCluster {
+	c := &fakeCluster{}
+	for i := 0; i < n; i++ {
+		m, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.nodes = append(c.nodes, m)
+	}
+
+	seed, err := server.NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.seed = seed
+
+	// The client finds the key of each command from COMMAND, which miniredis
+	// does not implement.
+	seed.Register("COMMAND", func(p *server.Peer, cmd string, args []string) {
+		keyed := []string{"del", "exists", "get", "hkeys", "incr", "incrby", "set", "type", "zadd", "zrange", "zrangebylex", "zrem"}
+		p.WriteLen(len(keyed))
+		for _, name := range keyed {
+			p.WriteLen(6)
+			p.WriteBulk(name)
+			p.WriteInt(-2)
+			p.WriteLen(0)
+			p.WriteInt(1)
+			p.WriteInt(1)
+			p.WriteInt(1)
+		}
+	})
+
+	seed.Register("CLUSTER", func(p *server.Peer, cmd string, args []string) {
+		if strings.ToLower(args[0]) != "slots" {
+			p.WriteError("ERR unsupported")
+			return
+		}
+
+		per := 16384 / len(c.nodes)
+		p.WriteLen(len(c.nodes))
+		for i, m := range c.nodes {
+			end := (i+1)*per - 1
+			if i == len(c.nodes)-1 {
+				end = 16383
+			}
+			p.WriteLen(3)
+			p.WriteInt(i * per)
+			p.WriteInt(end)
+			p.WriteLen(2)
+			p.WriteBulk(m.Host())
+			p.WriteBulk(m.Port())
+		}
+	})
+	return c
+}
+
+func (c *fakeCluster) Close() {
+	c.seed.Close()
+	for _, m := range c.nodes {
+		m.Close()
+	}
+}
+
+func TestClusterConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) (backend.Backend, func()) {
+		c := newFakeCluster(t, 2)
+		b, err := New(context.Background(), &Config{
+			Addrs:   []string{c.seed.Addr().String()},
+			Cluster: true,
+			Prefix:  DefaultPrefix,
+		})
+		if err != nil {
+			c.Close()
+			t.Fatal(err)
+		}
+
+		return b, func() {
+			b.Close()
+			c.Close()
+		}
+	}, nil)
+}
+
+func TestClusterSlots(t *testing.T) {
+	ctx := context.Background()
+	c := newFakeCluster(t, 2)
+	defer c.Close()
+
+	b, err := New(ctx, &Config{
+		Addrs:   []string{c.seed.Addr().String()},
+		Cluster: true,
+		Prefix:  DefaultPrefix,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if err := b.Put(ctx, name, &internal.Route{URL: "http://" + name + "/"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := b.NextID(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// every key shares a hash tag, so they are all on the same node.
+	var used int
+	for _, m := range c.nodes {
+		keys := m.Keys()
+		for _, key := range keys {
+			if !strings.HasPrefix(key, "{"+DefaultPrefix+"}") {
+				t.Fatalf("expected key %s to have a hash tag", key)
+			}
+		}
+		if len(keys) > 0 {
+			used++
+		}
+	}
+
+	if used != 1 {
+		t.Fatalf("expected keys on one node, got %d", used)
+	}
+
+	if err := b.Reindex(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := b.GetAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 4 {
+		t.Fatalf("expected 4 routes, got %d", len(all))
+	}
+}
+
+// Write a certificate for key, signed by parent, as PEM files in dir.
+func writeCert(t *testing.T, dir, name string, tmpl, parent *x509.Certificate, key, signer *ecdsa.PrivateKey) *x509.Certificate {
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ext, b := range map[string]*pem.Block{
+		".pem":     {Type: "CERTIFICATE", Bytes: der},
+		".key.pem": {Type: "EC PRIVATE KEY", Bytes: kb},
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name+ext), pem.EncodeToMemory(b), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return cert
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// Create a CA along with server and client certificates signed by it.
+func writeCerts(t *testing.T, dir string) {
+	tmpl := func(serial int64, cn string) *x509.Certificate {
+		return &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+	}
+
+	caKey := newKey(t)
+	caTmpl := tmpl(1, "ca")
+	caTmpl.IsCA = true
+	caTmpl.BasicConstraintsValid = true
+	caTmpl.KeyUsage = x509.KeyUsageCertSign
+	ca := writeCert(t, dir, "ca", caTmpl, caTmpl, caKey, caKey)
+
+	srvTmpl := tmpl(2, "server")
+	srvTmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	srvTmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	writeCert(t, dir, "server", srvTmpl, ca, newKey(t), caKey)
+
+	cliTmpl := tmpl(3, "client")
+	cliTmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	writeCert(t, dir, "client", cliTmpl, ca, newKey(t), caKey)
+}
+
+// Terminate TLS in front of addr, requiring a client certificate signed by
+// the CA in dir.
+func tlsProxy(t *testing.T, dir, addr string) net.Listener {
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server.key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := ioutil.ReadFile(filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer c.Close()
+				u, err := net.Dial("tcp", addr)
+				if err != nil {
+					return
+				}
+				defer u.Close()
+				go io.Copy(u, c)
+				io.Copy(c, u)
+			}()
+		}
+	}()
+
+	return l
+}
+
+func TestTLS(t *testing.T) {
+	ctx := context.Background()
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	writeCerts(t, tmp)
+
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	l := tlsProxy(t, tmp, mr.Addr())
+	defer l.Close()
+
+	cfg := &Config{
+		Addrs:       []string{l.Addr().String()},
+		TLS:         true,
+		TLSCAFile:   filepath.Join(tmp, "ca.pem"),
+		TLSCertFile: filepath.Join(tmp, "client.pem"),
+		TLSKeyFile:  filepath.Join(tmp, "client.key.pem"),
+		Prefix:      DefaultPrefix,
+	}
+
+	b, err := New(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if err := b.Put(ctx, "a", &internal.Route{URL: "http://a/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !mr.Exists(DefaultPrefix + routeNS + "a") {
+		t.Fatal("expected route to be written through the TLS connection")
+	}
+
+	// the server requires a client certificate.
+	noCert := *cfg
+	noCert.TLSCertFile, noCert.TLSKeyFile = "", ""
+	if b, err := New(ctx, &noCert); err == nil {
+		b.Close()
+		t.Fatal("expected connecting without a client certificate to fail")
+	}
+
+	// the server certificate is not signed by a system CA.
+	noCA := *cfg
+	noCA.TLSCAFile = ""
+	if b, err := New(ctx, &noCA); err == nil {
+		b.Close()
+		t.Fatal("expected connecting without the custom CA to fail")
+	}
+}
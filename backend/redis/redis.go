@@ -2,23 +2,67 @@ package redis
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
 	redis "github.com/go-redis/redis/v8"
+	be "github.com/kellegous/go/backend"
 	"github.com/kellegous/go/internal"
 )
 
 var Debug bool
 
+// DefaultPrefix is the key prefix used when none is configured.
+const DefaultPrefix = "go:"
+
+// Keys are laid out under the configured prefix as:
+//
+//	<prefix>route:<name>  the encoded route
+//	<prefix>id            the ID counter used by NextID
+//	<prefix>index         a sorted set holding the name of every route. All
+//	                      members have the same score so that they are
+//	                      ordered lexicographically.
+//	<prefix>seq           the sequence number of the last change to a route
+//	<prefix>byurl:<url>   a sorted set of the names of the routes that lead
+//	                      to the normalized URL, ordered as in the index
+//	<prefix>byhost:<host> a sorted set of the names of the routes with URLs
+//	                      on the host
+//	<prefix>rev           a hash from the name of each route to the byurl
+//	                      and byhost keys it is in, separated by a newline
+//
+// Changes are published on the <prefix>events pub/sub channel.
+//
+// Route names live in their own namespace so no name can collide with the
+// counter or the index. In a cluster the prefix is wrapped in a hash tag so
+// that every key lands in the same slot, which lets a route and the index be
+// updated in one transaction.
+const (
+	routeNS  = "route:"
+	idKey    = "id"
+	indexKey = "index"
+	seqKey   = "seq"
+	byURLNS  = "byurl:"
+	byHostNS = "byhost:"
+	revKey   = "rev"
+
+	eventsChannel = "events"
+)
+
+// Keys used before routes were namespaced.
 const (
-	nextIDKey = "nextID"
+	legacyNextIDKey = "nextID"
+	legacyIndexKey  = "routes:index"
 )
 
 // Backend provides access to Redis
 type Backend struct {
-	client *redis.Client
+	client redis.UniversalClient
+	prefix string
+	events bool
 }
 
 func dbgLogf(format string, v ...interface{}) {
@@ -28,26 +72,379 @@ func dbgLogf(format string, v ...interface{}) {
 }
 
 // New instantiates a new Backend
-func New(ctx context.Context, addr, pw string, db int) (*Backend, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     addr,
-		Password: pw,
-		DB:       db,
-	})
+func New(ctx context.Context, cfg *Config) (*Backend, error) {
+	client, err := cfg.newClient()
+	if err != nil {
+		return nil, err
+	}
 
 	pong, err := client.Ping(ctx).Result()
 	if err != nil {
 		log.Print(err)
+		client.Close()
 		return nil, err
 	}
 	dbgLogf("Redis: %s", pong)
+
+	prefix := cfg.Prefix
+	if cfg.Cluster && !strings.ContainsAny(prefix, "{}") {
+		prefix = "{" + prefix + "}"
+	}
+
 	backend := &Backend{
 		client: client,
+		prefix: prefix,
+		events: cfg.Events,
+	}
+
+	// Data written before the index existed needs to be indexed.
+	n, err := client.Exists(ctx, backend.indexKey()).Result()
+	if err != nil {
+		log.Print(err)
+		client.Close()
+		return nil, err
+	}
+	if n == 0 {
+		if err := backend.Reindex(ctx); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	// As are routes written before the reverse index existed.
+	if n, err = client.Exists(ctx, backend.revKey()).Result(); err != nil {
+		log.Print(err)
+		client.Close()
+		return nil, err
+	}
+	if n == 0 {
+		if err := backend.ReindexReverse(ctx); err != nil {
+			client.Close()
+			return nil, err
+		}
 	}
 
 	return backend, nil
 }
 
+func (backend *Backend) routeKey(name string) string {
+	return backend.prefix + routeNS + name
+}
+
+func (backend *Backend) idKey() string {
+	return backend.prefix + idKey
+}
+
+func (backend *Backend) indexKey() string {
+	return backend.prefix + indexKey
+}
+
+func (backend *Backend) seqKey() string {
+	return backend.prefix + seqKey
+}
+
+func (backend *Backend) revKey() string {
+	return backend.prefix + revKey
+}
+
+// A newline separates the keys in an entry of the rev hash, so it is escaped
+// as it would be in a URL.
+func (backend *Backend) byURLKey(url string) string {
+	return backend.prefix + byURLNS + strings.ReplaceAll(internal.NormalizeURL(url), "\n", "%0A")
+}
+
+func (backend *Backend) byHostKey(host string) string {
+	return backend.prefix + byHostNS + internal.NormalizeHost(host)
+}
+
+// The entry of the rev hash for a route, or "" if there is no route.
+func (backend *Backend) revEntry(rt *internal.Route) string {
+	if rt == nil {
+		return ""
+	}
+
+	entry := backend.byURLKey(rt.URL)
+	if host := internal.HostOf(rt.URL); host != "" {
+		entry += "\n" + backend.byHostKey(host)
+	}
+	return entry
+}
+
+func (backend *Backend) eventsChannel() string {
+	return backend.prefix + eventsChannel
+}
+
+// Escape the glob metacharacters in s so that it can be used in a SCAN
+// pattern.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// Find every key that matches the SCAN pattern, on every master of a cluster.
+func (backend *Backend) keys(ctx context.Context, match string) ([]string, error) {
+	scan := func(ctx context.Context, client *redis.Client) ([]string, error) {
+		var keys []string
+		iter := client.Scan(ctx, 0, match, 0).Iterator()
+		for iter.Next(ctx) {
+			keys = append(keys, iter.Val())
+		}
+		return keys, iter.Err()
+	}
+
+	switch client := backend.client.(type) {
+	case *redis.Client:
+		return scan(ctx, client)
+	case *redis.ClusterClient:
+		var mu sync.Mutex
+		var keys []string
+		err := client.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			k, err := scan(ctx, client)
+			mu.Lock()
+			defer mu.Unlock()
+			keys = append(keys, k...)
+			return err
+		})
+		return keys, err
+	default:
+		return nil, fmt.Errorf("redis: cannot scan with %T", client)
+	}
+}
+
+// Reindex rebuilds the index of route names by scanning the route keys.
+func (backend *Backend) Reindex(ctx context.Context) error {
+	dbgLogf("[Redis] Reindex\n")
+	ns := backend.routeKey("")
+	keys, err := backend.keys(ctx, escapeGlob(ns)+"*")
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	names := make([]*redis.Z, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, &redis.Z{Member: key[len(ns):]})
+	}
+
+	_, err = backend.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, backend.indexKey())
+		if len(names) > 0 {
+			pipe.ZAdd(ctx, backend.indexKey(), names...)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	if len(names) > 0 {
+		log.Printf("[Redis] indexed %d routes", len(names))
+	}
+	return nil
+}
+
+// ReindexReverse adds every route that is missing from the reverse index. It
+// is safe to run while routes are changing, since every change indexes the
+// route it writes.
+func (backend *Backend) ReindexReverse(ctx context.Context) error {
+	dbgLogf("[Redis] ReindexReverse\n")
+	iter, err := backend.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	defer iter.Release()
+
+	var n int
+	for iter.Next() {
+		name := iter.Name()
+		entry := backend.revEntry(iter.Route())
+		ok, err := backend.runReindexing(ctx, reindexScript, []string{
+			backend.routeKey(name),
+			backend.revKey(),
+		}, []string{name}, []string{entry}, name, entry).Bool()
+		if err != nil && err != redis.Nil {
+			log.Print(err)
+			return err
+		}
+		if ok {
+			n++
+		}
+	}
+
+	if err := iter.Error(); err != nil {
+		log.Print(err)
+		return err
+	}
+
+	if n > 0 {
+		log.Printf("[Redis] reverse indexed %d routes", n)
+	}
+	return nil
+}
+
+// ListNames returns the name of every route. The names are found by scanning
+// the route keys rather than read from the index, so that routes missing from
+// the index are found too.
+func (backend *Backend) ListNames(ctx context.Context) ([]string, error) {
+	dbgLogf("[Redis] ListNames\n")
+	ns := backend.routeKey("")
+	keys, err := backend.keys(ctx, escapeGlob(ns)+"*")
+	if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, key[len(ns):])
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// RebuildIndexes makes the index of names and the reverse index agree with
+// the routes. Every name with a route key or an entry in either index is
+// repaired on its own, and only if its route has not changed since it was
+// read, so it is safe to run while routes are changing.
+func (backend *Backend) RebuildIndexes(ctx context.Context) error {
+	dbgLogf("[Redis] RebuildIndexes\n")
+	names, err := backend.ListNames(ctx)
+	if err != nil {
+		return err
+	}
+
+	indexed, err := backend.client.ZRange(ctx, backend.indexKey(), 0, -1).Result()
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	reversed, err := backend.client.HKeys(ctx, backend.revKey()).Result()
+	if err != nil {
+		log.Print(err)
+		return err
+	}
+
+	seen := map[string]bool{}
+	for _, name := range append(append(names, indexed...), reversed...) {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		entry, version := "", be.NoVersion
+		val, err := backend.client.Get(ctx, backend.routeKey(name)).Bytes()
+		if err == nil {
+			// a route that cannot be decoded is left as it is to be repaired.
+			rt := &internal.Route{}
+			if err := rt.UnmarshalBinary(val); err != nil {
+				log.Printf("[Redis] not indexing %s: %s", name, err)
+				continue
+			}
+			entry, version = backend.revEntry(rt), be.VersionOf(val)
+		} else if err != redis.Nil {
+			log.Print(err)
+			return err
+		}
+
+		if err := backend.runReindexing(ctx, repairScript, []string{
+			backend.routeKey(name),
+			backend.indexKey(),
+			backend.revKey(),
+		}, []string{name}, []string{entry}, name, entry, version).Err(); err != nil && err != redis.Nil {
+			log.Print(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MigrateLegacy moves routes stored as bare top-level keys, along with the
+// legacy counter, into the prefixed layout. Only string keys whose value
+// decodes as a route are moved, so unrelated keys are left alone. It returns
+// the number of routes that were moved.
+func (backend *Backend) MigrateLegacy(ctx context.Context) (int, error) {
+	dbgLogf("[Redis] MigrateLegacy\n")
+	keys, err := backend.keys(ctx, "*")
+	if err != nil {
+		log.Print(err)
+		return 0, err
+	}
+
+	var n int
+	for _, key := range keys {
+		if key == legacyNextIDKey || key == legacyIndexKey ||
+			strings.HasPrefix(key, backend.prefix) {
+			continue
+		}
+
+		typ, err := backend.client.Type(ctx, key).Result()
+		if err != nil {
+			log.Print(err)
+			return n, err
+		} else if typ != "string" {
+			continue
+		}
+
+		val, err := backend.client.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			log.Print(err)
+			return n, err
+		}
+
+		// redis has only ever stored routes as bare JSON or in the versioned
+		// encoding, the legacy leveldb encoding would match almost anything.
+		if !internal.IsCurrentEncoding(val) && (len(val) == 0 || val[0] != '{') {
+			continue
+		}
+
+		rt := &internal.Route{}
+		if err := rt.UnmarshalBinary(val); err != nil || rt.URL == "" {
+			continue
+		}
+
+		if err := backend.Put(ctx, key, rt); err != nil {
+			return n, err
+		}
+
+		if err := backend.client.Del(ctx, key).Err(); err != nil {
+			log.Print(err)
+			return n, err
+		}
+		n++
+	}
+
+	id, err := backend.client.Get(ctx, legacyNextIDKey).Uint64()
+	if err != nil && err != redis.Nil {
+		log.Print(err)
+		return n, err
+	}
+	if err := backend.EnsureID(ctx, id); err != nil {
+		return n, err
+	}
+
+	// deleted one at a time since, in a cluster, they may be in different slots.
+	for _, key := range []string{legacyNextIDKey, legacyIndexKey} {
+		if err := backend.client.Del(ctx, key).Err(); err != nil {
+			log.Print(err)
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
 // Close the Backend and release associated resources
 func (backend *Backend) Close() error {
 	return backend.client.Close()
@@ -55,116 +452,334 @@ func (backend *Backend) Close() error {
 
 // Get retreives a shortcut from the data store.
 func (backend *Backend) Get(ctx context.Context, name string) (*internal.Route, error) {
+	route, _, err := backend.GetVersion(ctx, name)
+	return route, err
+}
+
+// GetVersion retreives a shortcut along with its version, which is the SHA-1
+// of its encoding so that it can be checked in a script.
+func (backend *Backend) GetVersion(ctx context.Context, name string) (*internal.Route, string, error) {
 	dbgLogf("[Redis] GET %s\n", name)
-	val, err := backend.client.Get(ctx, name).Result()
+	val, err := backend.client.Get(ctx, backend.routeKey(name)).Bytes()
 	if err != nil {
 		if err == redis.Nil {
-			log.Printf("Route %s does not exist\n", name)
-			return nil, internal.ErrRouteNotFound
+			return nil, be.NoVersion, internal.ErrRouteNotFound
 		}
 		log.Print(err)
-		return nil, err
+		return nil, be.NoVersion, err
 	}
 	route := &internal.Route{}
-	err = json.Unmarshal([]byte(val), &route)
-	if err != nil {
+	if err := route.UnmarshalBinary(val); err != nil {
 		log.Print(err)
-		return nil, err
+		return nil, be.NoVersion, err
 	}
-	return route, nil
+	return route, be.VersionOf(val), nil
 }
 
 // Put stores a new route in the data store
 func (backend *Backend) Put(ctx context.Context, key string, rt *internal.Route) error {
 	dbgLogf("[Redis] SET %s\n", key)
-	val, err := json.Marshal(rt)
+	val, err := rt.MarshalBinary()
 	if err != nil {
 		log.Print(err)
 		return err
 	}
-	err = backend.client.Set(ctx, key, string(val), 0).Err()
-	if err != nil {
+	if _, err := backend.write(ctx, be.OpPut, key, val, backend.revEntry(rt), nil); err != nil {
 		log.Print(err)
+		return err
 	}
 	return nil
 }
 
+// PutIf stores a route if the one it replaces has the given version
+func (backend *Backend) PutIf(ctx context.Context, key string, rt *internal.Route, version string) (string, error) {
+	dbgLogf("[Redis] SET %s IF %s\n", key, version)
+	val, err := rt.MarshalBinary()
+	if err != nil {
+		log.Print(err)
+		return be.NoVersion, err
+	}
+	if _, err := backend.write(ctx, be.OpPut, key, val, backend.revEntry(rt), &version); err == be.ErrVersionMismatch {
+		return be.NoVersion, err
+	} else if err != nil {
+		log.Print(err)
+		return be.NoVersion, err
+	}
+	return be.VersionOf(val), nil
+}
+
+// Rename moves a route to a new name if it has the given version and the name
+// is not in use. The route keeps its encoding, so its version is unchanged.
+func (backend *Backend) Rename(ctx context.Context, from, version, to string, leave *internal.Route) (string, error) {
+	dbgLogf("[Redis] RENAME %s %s IF %s\n", from, to, version)
+	var val []byte
+	if leave != nil {
+		var err error
+		if val, err = leave.MarshalBinary(); err != nil {
+			log.Print(err)
+			return be.NoVersion, err
+		}
+	}
+
+	var ch string
+	if backend.events {
+		ch = backend.eventsChannel()
+	}
+
+	entry := backend.revEntry(leave)
+	err := backend.runReindexing(ctx, renameScript, []string{
+		backend.routeKey(from),
+		backend.routeKey(to),
+		backend.indexKey(),
+		backend.seqKey(),
+		backend.revKey(),
+		backend.idKey(),
+	}, []string{from, to}, []string{entry}, from, to, val, ch, version, entry, countedID(to)).Err()
+	if err != nil && err.Error() == errVersionMismatch {
+		return be.NoVersion, be.ErrVersionMismatch
+	} else if err != nil {
+		log.Print(err)
+		return be.NoVersion, err
+	}
+	return version, nil
+}
+
+// Apply makes every change in a batch, in a script so that the conditions are
+// checked and the changes are made as a single transaction.
+func (backend *Backend) Apply(ctx context.Context, changes []*be.Change) ([]string, error) {
+	dbgLogf("[Redis] APPLY %d\n", len(changes))
+	var ch string
+	if backend.events {
+		ch = backend.eventsChannel()
+	}
+
+	keys := []string{backend.indexKey(), backend.seqKey(), backend.revKey(), backend.idKey()}
+	args := []interface{}{ch, ""}
+	names := make([]string, len(changes))
+	var puts []string
+	entries := make([]string, len(changes))
+	vers := make([]string, len(changes))
+	for i, c := range changes {
+		var val []byte
+		if c.Op == be.OpPut {
+			var err error
+			if val, err = c.Route.MarshalBinary(); err != nil {
+				log.Print(err)
+				return nil, err
+			}
+			vers[i] = be.VersionOf(val)
+		}
+
+		cond := "0"
+		if c.Conditional {
+			cond = "1"
+		}
+
+		var entry string
+		if c.Op == be.OpPut {
+			entry = backend.revEntry(c.Route)
+			puts = append(puts, c.Name)
+		}
+
+		names[i], entries[i] = c.Name, entry
+		keys = append(keys, backend.routeKey(c.Name))
+		args = append(args, string(c.Op), c.Name, val, cond, c.Version, entry)
+	}
+	args[1] = countedID(puts...)
+
+	err := backend.runReindexing(ctx, batchScript, keys, names, entries, args...).Err()
+	if err != nil && strings.HasPrefix(err.Error(), errVersionMismatch+" ") {
+		ix, perr := strconv.Atoi(err.Error()[len(errVersionMismatch)+1:])
+		if perr != nil {
+			ix = -1
+		}
+		return nil, &be.BatchError{Index: ix}
+	} else if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	return vers, nil
+}
+
 // Del deletes a route from the data store
 func (backend *Backend) Del(ctx context.Context, key string) error {
 	dbgLogf("[Redis] DEL %s\n", key)
-	res, err := backend.client.Del(ctx, key).Result()
+	msg, err := backend.write(ctx, be.OpDel, key, nil, "", nil)
 	if err != nil {
 		log.Print(err)
 		return err
 	}
-	log.Printf("Route %s has been deleted. Result: %d", key, res)
+	if msg != "" {
+		log.Printf("Route %s has been deleted.", key)
+	}
 	return nil
 }
 
-// List all routes in an iterator, starting with the key prefix of start
+// List all routes in an iterator, in order, starting with start
 func (backend *Backend) List(ctx context.Context, start string) (internal.RouteIterator, error) {
 	dbgLogf("[Redis] LIST %s\n", start)
-	cmd := backend.client.Scan(ctx, 0, fmt.Sprintf("%s*", start), 0)
-	iterator := cmd.Iterator()
-	keys, cursor, err := cmd.Result()
+	return &RouteIterator{
+		ctx:     ctx,
+		backend: backend,
+		start:   start,
+		next:    "[" + start,
+		pos:     -1,
+	}, nil
+}
+
+// Read the names in a sorted set of the reverse index.
+func (backend *Backend) namesIn(ctx context.Context, key string) ([]string, error) {
+	names, err := backend.client.ZRange(ctx, key, 0, -1).Result()
 	if err != nil {
+		log.Print(err)
 		return nil, err
 	}
-	for _, key := range keys {
-		dbgLogf("%s", key)
-	}
-	dbgLogf("cursor: %d\n", cursor)
+	return names, nil
+}
 
-	return &RouteIterator{
-		it:     iterator,
-		ctx:    ctx,
-		pos:    int(cursor),
-		client: backend.client,
-	}, nil
+// NamesForURL returns the names of the routes that lead to url
+func (backend *Backend) NamesForURL(ctx context.Context, url string) ([]string, error) {
+	dbgLogf("[Redis] NamesForURL %s\n", url)
+	return backend.namesIn(ctx, backend.byURLKey(url))
+}
+
+// NamesForHost returns the names of the routes with URLs on host
+func (backend *Backend) NamesForHost(ctx context.Context, host string) ([]string, error) {
+	dbgLogf("[Redis] NamesForHost %s\n", host)
+	return backend.namesIn(ctx, backend.byHostKey(host))
 }
 
 // NextID generates the next numeric ID to be used for an auto-named route
 func (backend *Backend) NextID(ctx context.Context) (uint64, error) {
 	dbgLogf("[Redis] NextID\n")
-	result, err := backend.client.Incr(ctx, nextIDKey).Uint64()
+	ids, err := backend.NextIDs(ctx, 1)
 	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// idLessFunc defines idLess, which compares two IDs given as decimal strings
+// without leading zeros. Lua numbers are doubles, which cannot hold every ID.
+const idLessFunc = `
+local function idLess(a, b)
+	if #a ~= #b then
+		return #a < #b
+	end
+	return a < b
+end
+`
+
+// nextIDsScript adds ARGV[2] to the counter in KEYS[1] and returns it, unless
+// the counter is above ARGV[1], in which case it returns nil. INCRBY's reply
+// is a Lua number, which is only exact below 2^53, so higher counters are
+// read back as strings.
+var nextIDsScript = redis.NewScript(idLessFunc + `
+if idLess(ARGV[1], redis.call("GET", KEYS[1]) or "0") then
+	return false
+end
+local id = redis.call("INCRBY", KEYS[1], ARGV[2])
+if id < 2^53 then
+	return id
+end
+return redis.call("GET", KEYS[1])
+`)
+
+// NextIDs hands out the next n IDs at once, with a single INCRBY.
+func (backend *Backend) NextIDs(ctx context.Context, n int) ([]uint64, error) {
+	dbgLogf("[Redis] NextIDs %d\n", n)
+	if n <= 0 {
+		return nil, nil
+	}
+
+	max := strconv.FormatUint(be.MaxID-uint64(n), 10)
+	result, err := nextIDsScript.Run(ctx, backend.client, []string{backend.idKey()}, max, n).Uint64()
+	if err == redis.Nil {
+		return nil, be.ErrIDOverflow
+	} else if err != nil {
+		log.Print(err)
+		return nil, err
+	}
+	return be.IDsEndingAt(result, n), nil
+}
+
+// ensureIDFunc defines ensureID(key, id), which raises the counter in key to
+// id, a decimal string, without ever lowering it. An empty id is ignored.
+const ensureIDFunc = idLessFunc + `
+local function ensureID(key, id)
+	if id ~= "" and idLess(redis.call("GET", key) or "0", id) then
+		redis.call("SET", key, id)
+	end
+end
+`
+
+// ensureIDScript raises the counter in KEYS[1] to ARGV[1] without ever
+// lowering it.
+var ensureIDScript = redis.NewScript(ensureIDFunc + `
+ensureID(KEYS[1], ARGV[1])
+return 0
+`)
+
+// The highest ID that the given names were generated from, as the scripts
+// that write routes expect it, which is empty if there is none.
+func countedID(names ...string) string {
+	var max uint64
+	for _, name := range names {
+		if id, ok := be.CountedID(name); ok && id > max {
+			max = id
+		}
+	}
+
+	if max == 0 {
+		return ""
+	}
+	return strconv.FormatUint(max, 10)
+}
+
+// LastID returns the highest ID handed out by NextID or NextIDs
+func (backend *Backend) LastID(ctx context.Context) (uint64, error) {
+	dbgLogf("[Redis] LastID\n")
+	result, err := backend.client.Get(ctx, backend.idKey()).Uint64()
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
 		log.Print(err)
 		return 0, err
 	}
 	return result, nil
 }
 
+// EnsureID advances the ID counter to id if it is currently lower
+func (backend *Backend) EnsureID(ctx context.Context, id uint64) error {
+	dbgLogf("[Redis] EnsureID %d\n", id)
+	if id > be.MaxID {
+		return be.ErrIDOverflow
+	}
+
+	if err := ensureIDScript.Run(ctx, backend.client, []string{backend.idKey()}, id).Err(); err != nil && err != redis.Nil {
+		log.Print(err)
+		return err
+	}
+	return nil
+}
+
 // GetAll dumps everything in the db for backup purposes
 func (backend *Backend) GetAll(ctx context.Context) (map[string]internal.Route, error) {
 	dbgLogf("[Redis] GetAll\n")
 	golinks := map[string]internal.Route{}
-	cmd := backend.client.Scan(ctx, 0, "*", 0)
-	keys, cursor, err := cmd.Result()
+	iter, err := backend.List(ctx, "")
 	if err != nil {
 		return nil, err
 	}
-	for _, key := range keys {
-		if key == nextIDKey {
-			continue
-		}
-		dbgLogf("%s", key)
-		val, err := backend.client.Get(ctx, key).Result()
-		if err != nil {
-			if err == redis.Nil {
-				log.Printf("Route %s does not exist\n", key)
-				return golinks, nil
-			}
-			log.Print(err)
-			return nil, err
-		}
-		route := &internal.Route{}
-		err = json.Unmarshal([]byte(val), &route)
-		if err != nil {
-			return nil, err
-		}
-		golinks[key] = *route
+	defer iter.Release()
+
+	for iter.Next() {
+		golinks[iter.Name()] = *iter.Route()
+	}
+	if err := iter.Error(); err != nil {
+		log.Print(err)
+		return nil, err
 	}
-	dbgLogf("cursor: %d\n", cursor)
 	dbgLogf("[Redis] Getall - RouteMap: %+v\n", golinks)
 
 	return golinks, nil
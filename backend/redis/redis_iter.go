@@ -2,90 +2,164 @@ package redis
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 
 	redis "github.com/go-redis/redis/v8"
 	"github.com/kellegous/go/internal"
 )
 
-// RouteIterator allows iteration on the named routes in the store
+// batchSize is the number of routes fetched from redis at a time.
+const batchSize = 100
+
+// RouteIterator allows iteration on the named routes in the store, in order
 type RouteIterator struct {
-	it     *redis.ScanIterator
-	ctx    context.Context
-	name   string
-	err    error
-	cmd    *redis.ScanCmd
+	ctx     context.Context
+	backend *Backend
+
+	// start is the lowest name the iterator will return.
+	start string
+
+	// next is the ZRANGEBYLEX bound of the batch that follows this one, it is
+	// empty once the last batch has been fetched.
+	next string
+
+	names  []string
+	routes []*internal.Route
 	pos    int
-	rt     *internal.Route
-	client *redis.Client
+	err    error
 }
 
-// Valid checks if the current values of the Iterator are valid
-func (i *RouteIterator) Valid() bool {
-	// TODO implement me
-	return i.cmd != nil
+// Fetch the batch of routes at or after the given ZRANGEBYLEX bound.
+func (i *RouteIterator) fetch(min string) {
+	dbgLogf("[REDIS] - fetch %s\n", min)
+	i.names, i.routes, i.pos, i.next = nil, nil, 0, ""
+
+	names, err := i.backend.client.ZRangeByLex(i.ctx, i.backend.indexKey(), &redis.ZRangeBy{
+		Min:   min,
+		Max:   "+",
+		Count: batchSize,
+	}).Result()
+	if err != nil {
+		log.Print(err)
+		i.err = err
+		return
+	}
+
+	if len(names) == batchSize {
+		i.next = "(" + names[len(names)-1]
+	}
+
+	// Some redis implementations (miniredis among them) return the whole set
+	// when nothing falls inside the range.
+	for len(names) > 0 && !inLexRange(names[0], min) {
+		names = names[1:]
+	}
+
+	if len(names) == 0 {
+		return
+	}
+
+	cmds := make([]*redis.StringCmd, len(names))
+	if _, err := i.backend.client.Pipelined(i.ctx, func(pipe redis.Pipeliner) error {
+		for j, name := range names {
+			cmds[j] = pipe.Get(i.ctx, i.backend.routeKey(name))
+		}
+		return nil
+	}); err != nil && err != redis.Nil {
+		log.Print(err)
+		i.err = err
+		return
+	}
+
+	for j, cmd := range cmds {
+		val, err := cmd.Bytes()
+		if err == redis.Nil {
+			// the route was deleted after the index was read.
+			continue
+		} else if err != nil {
+			i.err = err
+			return
+		}
+
+		rt := &internal.Route{}
+		if err := rt.UnmarshalBinary(val); err != nil {
+			i.err = err
+			return
+		}
+
+		i.names = append(i.names, names[j])
+		i.routes = append(i.routes, rt)
+	}
+}
+
+// Is name at or after the ZRANGEBYLEX bound min?
+func inLexRange(name, min string) bool {
+	if min[0] == '(' {
+		return name > min[1:]
+	}
+	return name >= min[1:]
 }
 
-// Val returns the key/field at the current cursor position
-func (i *RouteIterator) Val() string {
-	return i.it.Val()
+// Valid checks if the current values of the Iterator are valid
+func (i *RouteIterator) Valid() bool {
+	return i.err == nil && i.pos >= 0 && i.pos < len(i.names)
 }
 
-// re-implementing this with identical logic to satisfy the calling Interface
-// https://github.com/go-redis/redis/blob/master/iterator.go
+// Error returns any error that has stopped the iterator
 func (i *RouteIterator) Error() error {
-	return i.it.Err()
+	return i.err
 }
 
-// Seek ...
+// Seek moves the iterator to the first route at or after s
 func (i *RouteIterator) Seek(s string) bool {
-	// Since we have the current position available to us,
-	// we should (hopefully) be able to avoid fully implementing this
+	if s < i.start {
+		s = i.start
+	}
+
+	i.fetch("[" + s)
+	for !i.Valid() && i.err == nil && i.next != "" {
+		i.fetch(i.next)
+	}
 
-	return i.it.Next(i.ctx)
+	return i.Valid()
 }
 
-// Name returns the iterator name
+// Name returns the name of the current route
 func (i *RouteIterator) Name() string {
-	return i.name
+	if !i.Valid() {
+		return ""
+	}
+	return i.names[i.pos]
 }
 
 // Route is the current route
 func (i *RouteIterator) Route() *internal.Route {
-	return i.rt
+	if !i.Valid() {
+		return nil
+	}
+	return i.routes[i.pos]
 }
 
-// Release should release any resources used by the Iterator
-// Since the redis Iterator is safe to call concurrently, can we safely skip?
+// Release disposes of the routes held by the Iterator
 func (i *RouteIterator) Release() {
-	return
+	i.names, i.routes, i.next = nil, nil, ""
 }
 
 // Next advances the Iterator to the next value
 // will return true if more values can be read
 func (i *RouteIterator) Next() bool {
-	next := i.it.Next(i.ctx)
-	dbgLogf("[REDIS] - Next()\n")
-	dbgLogf("%s", i.it.Val())
-	i.name = i.it.Val()
-
-	ctx := context.Background()
-	val, err := i.client.Get(ctx, i.name).Result()
-	if err != nil {
-		if err == redis.Nil {
-			log.Printf("Route %s does not exist\n", i.name)
-			return false
-		}
-		log.Print(err)
+	if i.err != nil {
 		return false
 	}
-	route := &internal.Route{}
-	err = json.Unmarshal([]byte(val), &route)
-	i.rt = route
 
-	if !next {
-		return false
+	if i.pos == -1 && i.names == nil {
+		return i.Seek(i.start)
 	}
-	return true
+
+	i.pos++
+	for i.pos >= len(i.names) && i.err == nil && i.next != "" {
+		i.fetch(i.next)
+	}
+
+	return i.Valid()
 }
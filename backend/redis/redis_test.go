@@ -11,6 +11,8 @@ import (
 	"github.com/alicebob/miniredis"
 	redismock "github.com/elliotchance/redismock/v8"
 	redis "github.com/go-redis/redis/v8"
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/backend/backendtest"
 	"github.com/kellegous/go/internal"
 	"github.com/stretchr/testify/assert"
 )
@@ -47,7 +49,7 @@ func TestNew(t *testing.T) {
 
 	_ = redismock.NewNiceMock(client)
 
-	MockBackend, err = New(context.Background(), Addr, "", 0)
+	MockBackend, err = New(context.Background(), &Config{Addrs: []string{Addr}, Prefix: DefaultPrefix})
 	if err != nil {
 		t.Fatalf("Failed with err: %s", err)
 	}
@@ -126,6 +128,22 @@ func TestNextID2(t *testing.T) {
 	assert.Equal(t, uint64(2), next)
 }
 
+// TestEnsureID makes sure the counter can be raised but never lowered
+func TestEnsureID(t *testing.T) {
+	ctx := context.Background()
+
+	last, err := MockBackend.LastID(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), last)
+
+	assert.NoError(t, MockBackend.EnsureID(ctx, 1))
+	assert.NoError(t, MockBackend.EnsureID(ctx, 10))
+
+	next, err := MockBackend.NextID(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(11), next)
+}
+
 func TestGetAll(t *testing.T) {
 	var err error
 	Mock.On("Get", key).Return(redis.NewStringResult(val, nil))
@@ -183,3 +201,289 @@ func TestList(t *testing.T) {
 	assert.Equal(t, true, next)
 	assert.Equal(t, case1, string(jRoute))
 }
+
+func TestConformance(t *testing.T) {
+	backendtest.Run(t, func(t *testing.T) (backend.Backend, func()) {
+		mr, err := miniredis.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := New(context.Background(), &Config{Addrs: []string{mr.Addr()}, Prefix: DefaultPrefix})
+		if err != nil {
+			mr.Close()
+			t.Fatal(err)
+		}
+
+		return b, func() {
+			b.Close()
+			mr.Close()
+		}
+	}, nil)
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	// routes written before keys were prefixed, next to unrelated keys.
+	mr.Set("b", case1)
+	mr.Set("a", case1)
+	mr.Set(legacyNextIDKey, "2")
+	mr.Set("session", "not a route")
+	mr.HSet("hash", "url", "http://x/")
+
+	b, err := New(ctx, &Config{Addrs: []string{mr.Addr()}, Prefix: DefaultPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	n, err := b.MigrateLegacy(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	all, err := b.GetAll(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, all, 2)
+	assert.Equal(t, "http://czan.io", all["a"].URL)
+
+	id, err := b.NextID(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), id)
+
+	assert.False(t, mr.Exists("a"))
+	assert.False(t, mr.Exists(legacyNextIDKey))
+	assert.True(t, mr.Exists("session"))
+	assert.True(t, mr.Exists("hash"))
+
+	// a route may now be named like the old counter.
+	assert.NoError(t, b.Put(ctx, "nextID", &internal.Route{URL: "http://n/"}))
+	id, err = b.NextID(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), id)
+}
+
+func TestReindex(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	// routes written without the index, under a prefix with glob characters.
+	prefix := "go[1]*:"
+	mr.Set(prefix+routeNS+"b", case1)
+	mr.Set(prefix+routeNS+"a", case1)
+	mr.Set("go1x:"+routeNS+"c", case1)
+
+	b, err := New(ctx, &Config{Addrs: []string{mr.Addr()}, Prefix: prefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	it, err := b.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Release()
+
+	var names []string
+	for it.Next() {
+		names = append(names, it.Name())
+	}
+	assert.NoError(t, it.Error())
+	assert.Equal(t, []string{"a", "b"}, names)
+}
+
+func TestReindexReverse(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	// routes written before the reverse index existed.
+	mr.Set(DefaultPrefix+routeNS+"b", case1)
+	mr.Set(DefaultPrefix+routeNS+"a", case1)
+	mr.ZAdd(DefaultPrefix+indexKey, 0, "a")
+	mr.ZAdd(DefaultPrefix+indexKey, 0, "b")
+
+	b, err := New(ctx, &Config{Addrs: []string{mr.Addr()}, Prefix: DefaultPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	names, err := b.NamesForURL(ctx, "http://CZAN.io")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, names)
+
+	names, err = b.NamesForHost(ctx, "czan.io")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, names)
+
+	// indexing again leaves out the routes deleted since.
+	assert.NoError(t, b.Del(ctx, "a"))
+	assert.NoError(t, b.ReindexReverse(ctx))
+	names, err = b.NamesForURL(ctx, "http://czan.io/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b"}, names)
+}
+
+func TestRebuildIndexes(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	b, err := New(ctx, &Config{Addrs: []string{mr.Addr()}, Prefix: DefaultPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	assert.NoError(t, b.Put(ctx, "a", &internal.Route{URL: "http://czan.io"}))
+
+	// a route missing from the indexes, indexes of a route that is gone and a
+	// route that cannot be decoded.
+	mr.Set(DefaultPrefix+routeNS+"b", case1)
+	mr.ZAdd(DefaultPrefix+indexKey, 0, "gone")
+	mr.HSet(DefaultPrefix+revKey, "gone", DefaultPrefix+byHostNS+"czan.io")
+	mr.ZAdd(DefaultPrefix+byHostNS+"czan.io", 0, "gone")
+	mr.Set(DefaultPrefix+routeNS+"bad", "{broken")
+
+	names, err := b.ListNames(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "bad"}, names)
+
+	assert.NoError(t, b.RebuildIndexes(ctx))
+
+	it, err := b.List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Release()
+
+	names = nil
+	for it.Next() {
+		names = append(names, it.Name())
+	}
+	assert.NoError(t, it.Error())
+	assert.Equal(t, []string{"a", "b"}, names)
+
+	names, err = b.NamesForURL(ctx, "http://czan.io/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, names)
+
+	names, err = b.NamesForHost(ctx, "czan.io")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, names)
+
+	// the route that cannot be decoded is left to be repaired.
+	val, err := mr.Get(DefaultPrefix + routeNS + "bad")
+	assert.NoError(t, err)
+	assert.Equal(t, "{broken", val)
+}
+
+// A hook that calls fn before the first script is run and counts the
+// scripts run. Every script is tried with EVALSHA first.
+type beforeScript struct {
+	fn   func()
+	runs int
+}
+
+func (h *beforeScript) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if cmd.Name() == "evalsha" {
+		if h.fn != nil {
+			h.fn()
+			h.fn = nil
+		}
+		h.runs++
+	}
+	return ctx, nil
+}
+
+func (h *beforeScript) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (h *beforeScript) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *beforeScript) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestStaleIndex(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	b, err := New(ctx, &Config{Addrs: []string{mr.Addr()}, Prefix: DefaultPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	assert.NoError(t, b.Put(ctx, "a", &internal.Route{URL: "http://czan.io"}))
+
+	// the route is reindexed after the sets it is in are read, so the script
+	// is run again with the set it was moved to.
+	moved := DefaultPrefix + byURLNS + "moved"
+	hook := &beforeScript{fn: func() {
+		mr.HSet(DefaultPrefix+revKey, "a", moved)
+		mr.ZAdd(moved, 0, "a")
+	}}
+	b.client.AddHook(hook)
+
+	assert.NoError(t, b.Put(ctx, "a", &internal.Route{URL: "http://other.io"}))
+	assert.Equal(t, 2, hook.runs)
+	assert.False(t, mr.Exists(moved))
+
+	names, err := b.NamesForHost(ctx, "other.io")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, names)
+}
+
+func TestEnsureIDPrecision(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	b, err := New(ctx, &Config{Addrs: []string{mr.Addr()}, Prefix: DefaultPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// above 2^53, IDs that differ by one are the same Lua number.
+	const id = 1<<53 + 1
+	assert.NoError(t, b.EnsureID(ctx, id-1))
+	assert.NoError(t, b.EnsureID(ctx, id))
+
+	last, err := b.LastID(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(id), last)
+
+	assert.NoError(t, b.EnsureID(ctx, id-1))
+	last, err = b.LastID(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(id), last)
+}
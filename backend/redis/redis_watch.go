@@ -0,0 +1,519 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	redis "github.com/go-redis/redis/v8"
+	be "github.com/kellegous/go/backend"
+	"github.com/kellegous/go/internal"
+)
+
+// reindexFunc defines reindex(name, entry) for the scripts that change routes,
+// which moves name from the byurl and byhost sets it is in to those in entry,
+// a newline-separated list of keys that is empty for a deleted route. It
+// expects the rev hash in KEYS[revKey] and the sets in the keys from the one
+// at the Lua expression first to the end, as added by runReindexing. It also
+// defines indexed(name), which is false if name is in a set that is not
+// among them, in which case the script must return errStaleIndex before it
+// changes anything.
+func reindexFunc(revKey int, first string) string {
+	return fmt.Sprintf(`
+local declared = {}
+for i = %s, #KEYS do
+	declared[KEYS[i]] = true
+end
+local function indexed(name)
+	local old = redis.call("HGET", KEYS[%d], name)
+	if old then
+		for key in string.gmatch(old, "[^\n]+") do
+			if not declared[key] then
+				return false
+			end
+		end
+	end
+	return true
+end
+local function reindex(name, entry)
+	local old = redis.call("HGET", KEYS[%d], name)
+	if old then
+		for key in string.gmatch(old, "[^\n]+") do
+			redis.call("ZREM", key, name)
+		end
+	end
+	if entry == "" then
+		redis.call("HDEL", KEYS[%d], name)
+		return
+	end
+	for key in string.gmatch(entry, "[^\n]+") do
+		redis.call("ZADD", key, 0, name)
+	end
+	redis.call("HSET", KEYS[%d], name, entry)
+end
+`, first, revKey, revKey, revKey, revKey)
+}
+
+// writeScript applies a change to a route and describes it in a message that
+// is published on the events channel in ARGV[4], unless that is empty. The
+// message is returned, or false if deleting a route that does not exist. When
+// ARGV[5] is "1", the change is only made if the version of the route, the
+// SHA-1 of its encoding or empty if it does not exist, is ARGV[6]; otherwise
+// a version mismatch error is returned. A put raises the ID counter to the ID
+// the name was generated from, if any.
+//
+//	KEYS[1] the route key
+//	KEYS[2] the index
+//	KEYS[3] the event sequence counter
+//	KEYS[4] the rev hash
+//	KEYS[5] the ID counter
+//	KEYS[6...] the byurl and byhost sets
+//	ARGV[1] the route name
+//	ARGV[2] "put" or "del"
+//	ARGV[3] the encoded route for a put
+//	ARGV[4] the events channel
+//	ARGV[5] "1" if the change is conditional
+//	ARGV[6] the expected version
+//	ARGV[7] the entry of the rev hash for a put
+//	ARGV[8] the ID the name was generated from, or empty
+//
+// The message holds the sequence number and the op on their own lines, then
+// the name, the route before and the route after, each preceded by its length
+// on its own line. An empty route is one that did not exist.
+var writeScript = redis.NewScript(ensureIDFunc + reindexFunc(4, "6") + `
+if not indexed(ARGV[1]) then
+	return redis.error_reply("` + errStaleIndex + `")
+end
+local before = redis.call("GET", KEYS[1])
+if ARGV[5] == "1" then
+	local version = ""
+	if before then
+		version = redis.sha1hex(before)
+	end
+	if version ~= ARGV[6] then
+		return redis.error_reply("` + errVersionMismatch + `")
+	end
+end
+local after = ""
+if ARGV[2] == "del" then
+	if not before then
+		return false
+	end
+	redis.call("DEL", KEYS[1])
+	redis.call("ZREM", KEYS[2], ARGV[1])
+	reindex(ARGV[1], "")
+else
+	after = ARGV[3]
+	redis.call("SET", KEYS[1], after)
+	redis.call("ZADD", KEYS[2], 0, ARGV[1])
+	reindex(ARGV[1], ARGV[7])
+	ensureID(KEYS[5], ARGV[8])
+end
+if not before then
+	before = ""
+end
+local seq = redis.call("INCR", KEYS[3])
+local msg = seq .. "\n" .. ARGV[2] .. "\n" ..
+	#ARGV[1] .. "\n" .. ARGV[1] ..
+	#before .. "\n" .. before ..
+	#after .. "\n" .. after
+if ARGV[4] ~= "" then
+	redis.call("PUBLISH", ARGV[4], msg)
+end
+return msg
+`)
+
+// reindexScript adds the route in KEYS[1] to the reverse index with the entry
+// in ARGV[2], as long as it still exists and is not already indexed. It
+// returns whether the route was added.
+//
+//	KEYS[1] the route key
+//	KEYS[2] the rev hash
+//	KEYS[3...] the byurl and byhost sets
+//	ARGV[1] the route name
+//	ARGV[2] the entry of the rev hash
+var reindexScript = redis.NewScript(reindexFunc(2, "3") + `
+if redis.call("EXISTS", KEYS[1]) == 0 or redis.call("HEXISTS", KEYS[2], ARGV[1]) == 1 then
+	return false
+end
+reindex(ARGV[1], ARGV[2])
+return 1
+`)
+
+// repairScript makes the index of names and the reverse index agree with the
+// route in KEYS[1], as long as it has the version in ARGV[3], which is empty
+// if it did not exist. A route that has changed since was indexed by the
+// change.
+//
+//	KEYS[1] the route key
+//	KEYS[2] the index
+//	KEYS[3] the rev hash
+//	KEYS[4...] the byurl and byhost sets
+//	ARGV[1] the route name
+//	ARGV[2] the entry of the rev hash, which is empty if there is no route
+//	ARGV[3] the version of the route
+var repairScript = redis.NewScript(reindexFunc(3, "4") + `
+local val = redis.call("GET", KEYS[1])
+local version = ""
+if val then
+	version = redis.sha1hex(val)
+end
+if version ~= ARGV[3] then
+	return false
+end
+if not indexed(ARGV[1]) then
+	return redis.error_reply("` + errStaleIndex + `")
+end
+if val then
+	redis.call("ZADD", KEYS[2], 0, ARGV[1])
+else
+	redis.call("ZREM", KEYS[2], ARGV[1])
+end
+reindex(ARGV[1], ARGV[2])
+return 1
+`)
+
+// The error returned by writeScript when a conditional change does not apply.
+const errVersionMismatch = "version mismatch"
+
+// The error returned by the scripts that reindex routes when a route is in a
+// set that was not given to them, because it was reindexed after the sets
+// were read.
+const errStaleIndex = "stale index"
+
+// Run a script that reindexes the routes with the given names, moving them to
+// the sets in entries. The sets the routes are in and those in entries are
+// added to the end of keys, so that every key the script touches is declared,
+// and the script is run again if the routes are reindexed in the meantime.
+func (backend *Backend) runReindexing(ctx context.Context, script *redis.Script, keys, names, entries []string, args ...interface{}) *redis.Cmd {
+	for {
+		olds, err := backend.client.HMGet(ctx, backend.revKey(), names...).Result()
+		if err != nil {
+			cmd := redis.NewCmd(ctx)
+			cmd.SetErr(err)
+			return cmd
+		}
+
+		all := append([]string{}, keys...)
+		seen := map[string]bool{}
+		add := func(entry string) {
+			for _, key := range strings.Split(entry, "\n") {
+				if key != "" && !seen[key] {
+					seen[key] = true
+					all = append(all, key)
+				}
+			}
+		}
+
+		for _, old := range olds {
+			if entry, ok := old.(string); ok {
+				add(entry)
+			}
+		}
+
+		for _, entry := range entries {
+			add(entry)
+		}
+
+		cmd := script.Run(ctx, backend.client, all, args...)
+		if err := cmd.Err(); err == nil || err.Error() != errStaleIndex {
+			return cmd
+		}
+	}
+}
+
+// Apply a change to a route, returning the message describing it, or an
+// empty message if nothing changed. If version is not nil, the change is only
+// made if the route has that version. The route is indexed under entry.
+func (backend *Backend) write(ctx context.Context, op be.Op, name string, val []byte, entry string, version *string) (string, error) {
+	var ch string
+	if backend.events {
+		ch = backend.eventsChannel()
+	}
+
+	cond, expect := "0", ""
+	if version != nil {
+		cond, expect = "1", *version
+	}
+
+	var id string
+	if op == be.OpPut {
+		id = countedID(name)
+	}
+
+	msg, err := backend.runReindexing(ctx, writeScript, []string{
+		backend.routeKey(name),
+		backend.indexKey(),
+		backend.seqKey(),
+		backend.revKey(),
+		backend.idKey(),
+	}, []string{name}, []string{entry}, name, string(op), val, ch, cond, expect, entry, id).Text()
+	if err == redis.Nil {
+		return "", nil
+	} else if err != nil && err.Error() == errVersionMismatch {
+		return "", be.ErrVersionMismatch
+	}
+	return msg, err
+}
+
+// publishFunc defines publish(op, name, before, after) for the scripts that
+// make several changes, which describes a change as writeScript does. It
+// expects the event sequence counter in KEYS[seqKey] and the events channel
+// in ARGV[channelArg].
+func publishFunc(seqKey, channelArg int) string {
+	return fmt.Sprintf(`
+local function publish(op, name, before, after)
+	local seq = redis.call("INCR", KEYS[%d])
+	local msg = seq .. "\n" .. op .. "\n" ..
+		#name .. "\n" .. name ..
+		#before .. "\n" .. before ..
+		#after .. "\n" .. after
+	if ARGV[%d] ~= "" then
+		redis.call("PUBLISH", ARGV[%d], msg)
+	end
+end
+`, seqKey, channelArg, channelArg)
+}
+
+// renameScript moves the route in KEYS[1] to KEYS[2] if it has the version
+// in ARGV[5] and there is no route in KEYS[2]; otherwise a version mismatch
+// error is returned. The route left in KEYS[1] is ARGV[3] or, if that is
+// empty, it is deleted. Each change is published as writeScript does. The
+// moved route keeps its entry in the rev hash, and the ID counter is raised
+// to the ID the new name was generated from, if any.
+//
+//	KEYS[1] the key of the route being moved
+//	KEYS[2] the key it is moved to
+//	KEYS[3] the index
+//	KEYS[4] the event sequence counter
+//	KEYS[5] the rev hash
+//	KEYS[6] the ID counter
+//	KEYS[7...] the byurl and byhost sets
+//	ARGV[1] the name being moved
+//	ARGV[2] the name it is moved to
+//	ARGV[3] the encoded route left behind, if any
+//	ARGV[4] the events channel
+//	ARGV[5] the expected version
+//	ARGV[6] the entry of the rev hash for the route left behind
+//	ARGV[7] the ID the new name was generated from, or empty
+var renameScript = redis.NewScript(publishFunc(4, 4) + ensureIDFunc + reindexFunc(5, "7") + `
+local val = redis.call("GET", KEYS[1])
+if not val or redis.sha1hex(val) ~= ARGV[5] or redis.call("EXISTS", KEYS[2]) == 1 then
+	return redis.error_reply("` + errVersionMismatch + `")
+end
+if not indexed(ARGV[1]) or not indexed(ARGV[2]) then
+	return redis.error_reply("` + errStaleIndex + `")
+end
+redis.call("SET", KEYS[2], val)
+redis.call("ZADD", KEYS[3], 0, ARGV[2])
+reindex(ARGV[2], redis.call("HGET", KEYS[5], ARGV[1]) or "")
+ensureID(KEYS[6], ARGV[7])
+publish("put", ARGV[2], "", val)
+if ARGV[3] == "" then
+	redis.call("DEL", KEYS[1])
+	redis.call("ZREM", KEYS[3], ARGV[1])
+	reindex(ARGV[1], "")
+	publish("del", ARGV[1], val, "")
+else
+	redis.call("SET", KEYS[1], ARGV[3])
+	reindex(ARGV[1], ARGV[6])
+	publish("put", ARGV[1], val, ARGV[3])
+end
+return 1
+`)
+
+// batchScript makes every change in a batch, publishing each as writeScript
+// does, if the condition of every change holds. Otherwise it makes none of
+// them and returns a version mismatch error followed by the zero-based index
+// of the change that failed. Each of the n changes takes six arguments,
+// starting at ARGV[3]: the op, the name, the encoded route for a put, "1" if
+// the change is conditional, the expected version and the entry of the rev
+// hash for a put. The ID counter is raised to the highest ID the names put
+// were generated from, if any.
+//
+//	KEYS[1]   the index
+//	KEYS[2]   the event sequence counter
+//	KEYS[3]   the rev hash
+//	KEYS[4]   the ID counter
+//	KEYS[4+i] the route key of the i-th change
+//	KEYS[5+n...] the byurl and byhost sets
+//	ARGV[1]   the events channel
+//	ARGV[2]   the highest ID the names put were generated from, or empty
+var batchScript = redis.NewScript(publishFunc(2, 1) + ensureIDFunc + reindexFunc(3, "5 + (#ARGV - 2) / 6") + `
+local n = (#ARGV - 2) / 6
+for i = 1, n do
+	if not indexed(ARGV[3 + (i - 1) * 6 + 1]) then
+		return redis.error_reply("` + errStaleIndex + `")
+	end
+end
+for i = 1, n do
+	local a = 3 + (i - 1) * 6
+	if ARGV[a + 3] == "1" then
+		local cur = redis.call("GET", KEYS[i + 4])
+		local version = ""
+		if cur then
+			version = redis.sha1hex(cur)
+		end
+		if version ~= ARGV[a + 4] then
+			return redis.error_reply("` + errVersionMismatch + ` " .. (i - 1))
+		end
+	end
+end
+for i = 1, n do
+	local a = 3 + (i - 1) * 6
+	local op, name = ARGV[a], ARGV[a + 1]
+	local before = redis.call("GET", KEYS[i + 4])
+	if op == "del" then
+		if before then
+			redis.call("DEL", KEYS[i + 4])
+			redis.call("ZREM", KEYS[1], name)
+			reindex(name, "")
+			publish(op, name, before, "")
+		end
+	else
+		redis.call("SET", KEYS[i + 4], ARGV[a + 2])
+		redis.call("ZADD", KEYS[1], 0, name)
+		reindex(name, ARGV[a + 5])
+		publish(op, name, before or "", ARGV[a + 2])
+	end
+end
+ensureID(KEYS[4], ARGV[2])
+return 1
+`)
+
+// Read a line from a message.
+func readLine(s string) (string, string, error) {
+	ix := strings.IndexByte(s, '\n')
+	if ix == -1 {
+		return "", "", errors.New("missing newline")
+	}
+	return s[:ix], s[ix+1:], nil
+}
+
+// Read a length-prefixed field from a message.
+func readField(s string) (string, string, error) {
+	l, s, err := readLine(s)
+	if err != nil {
+		return "", "", err
+	}
+
+	n, err := strconv.Atoi(l)
+	if err != nil || n < 0 || n > len(s) {
+		return "", "", fmt.Errorf("invalid length %q", l)
+	}
+
+	return s[:n], s[n:], nil
+}
+
+// Decode a route from a message, where empty means no route.
+func decodeEventRoute(s string) (*internal.Route, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	rt := &internal.Route{}
+	if err := rt.UnmarshalBinary([]byte(s)); err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// Decode the message written by writeScript.
+func decodeEvent(msg string) (*be.Event, error) {
+	seq, msg, err := readLine(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	op, msg, err := readLine(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &be.Event{Op: be.Op(op)}
+	if e.Seq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+		return nil, err
+	}
+
+	if e.Name, msg, err = readField(msg); err != nil {
+		return nil, err
+	}
+
+	before, msg, err := readField(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	after, msg, err := readField(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if msg != "" {
+		return nil, errors.New("trailing data in event")
+	}
+
+	if e.Before, err = decodeEventRoute(before); err != nil {
+		return nil, err
+	}
+
+	if e.After, err = decodeEventRoute(after); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Watch delivers the changes published by every server sharing this redis
+// after it is called. Events are published through redis pub/sub, so a
+// watcher that disconnects misses the changes made while it was away.
+func (backend *Backend) Watch(ctx context.Context) (<-chan *be.Event, error) {
+	if !backend.events {
+		return nil, be.ErrWatchNotSupported
+	}
+
+	sub := backend.client.Subscribe(ctx, backend.eventsChannel())
+
+	// wait for the subscription so that no change made after Watch returns
+	// can be missed.
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	ch := make(chan *be.Event, be.WatchBuffer)
+	go func() {
+		defer close(ch)
+		defer sub.Close()
+
+		msgs := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case m, ok := <-msgs:
+				if !ok {
+					return
+				}
+
+				e, err := decodeEvent(m.Payload)
+				if err != nil {
+					log.Printf("[Redis] invalid event: %s", err)
+					continue
+				}
+
+				select {
+				case ch <- e:
+				default:
+					// the watcher has fallen behind.
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,223 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	redis "github.com/go-redis/redis/v8"
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/internal"
+)
+
+func mustWrite(t *testing.T, b *Backend, op backend.Op, name string, rt *internal.Route) string {
+	var val []byte
+	if rt != nil {
+		var err error
+		if val, err = rt.MarshalBinary(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg, err := b.write(context.Background(), op, name, val, b.revEntry(rt), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func mustDecodeEvent(t *testing.T, msg string) *backend.Event {
+	e, err := decodeEvent(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func routeURL(rt *internal.Route) string {
+	if rt == nil {
+		return ""
+	}
+	return rt.URL
+}
+
+func mustBeEvent(t *testing.T, e *backend.Event, seq uint64, op backend.Op, name, before, after string) {
+	if e.Seq != seq || e.Op != op || e.Name != name || routeURL(e.Before) != before || routeURL(e.After) != after {
+		t.Fatalf("expected %d %s %s (%q, %q), got %d %s %s (%q, %q)",
+			seq, op, name, before, after,
+			e.Seq, e.Op, e.Name, routeURL(e.Before), routeURL(e.After))
+	}
+}
+
+func TestWriteEvents(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	b, err := New(context.Background(), &Config{Addrs: []string{mr.Addr()}, Prefix: DefaultPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// names can hold the characters that separate the fields of a message.
+	name := "a\n1"
+
+	mustBeEvent(t, mustDecodeEvent(t, mustWrite(t, b, backend.OpPut, name, &internal.Route{URL: "http://a/"})),
+		1, backend.OpPut, name, "", "http://a/")
+	mustBeEvent(t, mustDecodeEvent(t, mustWrite(t, b, backend.OpPut, name, &internal.Route{URL: "http://b/"})),
+		2, backend.OpPut, name, "http://a/", "http://b/")
+	mustBeEvent(t, mustDecodeEvent(t, mustWrite(t, b, backend.OpDel, name, nil)),
+		3, backend.OpDel, name, "http://b/", "")
+
+	if msg := mustWrite(t, b, backend.OpDel, name, nil); msg != "" {
+		t.Fatalf("expected no event deleting a missing route, got %q", msg)
+	}
+
+	for _, msg := range []string{
+		"",
+		"1\nput\n",
+		"x\nput\n1\na0\n0\n",
+		"1\nput\n5\na0\n0\n",
+		"1\nput\n1\na0\n0\nextra",
+	} {
+		if _, err := decodeEvent(msg); err == nil {
+			t.Fatalf("expected an error decoding %q", msg)
+		}
+	}
+}
+
+// A pub/sub server for a single subscriber that publishes each message sent
+// on msgs.
+type fakePubSub struct {
+	net.Listener
+	msgs chan string
+}
+
+func newFakePubSub(t *testing.T) *fakePubSub {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps := &fakePubSub{
+		Listener: l,
+		msgs:     make(chan string),
+	}
+	go ps.serve()
+	return ps
+}
+
+// Read a command, which is an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, strings.TrimSuffix(arg, "\r\n"))
+	}
+	return args, nil
+}
+
+func (ps *fakePubSub) serve() {
+	c, err := ps.Accept()
+	if err != nil {
+		return
+	}
+	defer c.Close()
+
+	cmd, err := readCommand(bufio.NewReader(c))
+	if err != nil || len(cmd) != 2 || strings.ToLower(cmd[0]) != "subscribe" {
+		return
+	}
+
+	ch := cmd[1]
+	fmt.Fprintf(c, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(ch), ch)
+	for msg := range ps.msgs {
+		fmt.Fprintf(c, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n",
+			len(ch), ch, len(msg), msg)
+	}
+}
+
+func mustReceive(t *testing.T, ch <-chan *backend.Event) *backend.Event {
+	select {
+	case e, ok := <-ch:
+		if !ok {
+			t.Fatal("expected an event, got a closed channel")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return nil
+}
+
+func TestWatch(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	b, err := New(context.Background(), &Config{Addrs: []string{mr.Addr()}, Prefix: DefaultPrefix})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// without events there is nothing to watch.
+	if _, err := b.Watch(context.Background()); err != backend.ErrWatchNotSupported {
+		t.Fatalf("expected ErrWatchNotSupported, got %v", err)
+	}
+
+	ps := newFakePubSub(t)
+	defer ps.Close()
+
+	w := &Backend{
+		client: redis.NewClient(&redis.Options{Addr: ps.Addr().String()}),
+		prefix: DefaultPrefix,
+		events: true,
+	}
+	defer w.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := w.Watch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps.msgs <- mustWrite(t, b, backend.OpPut, "a", &internal.Route{URL: "http://a/"})
+	ps.msgs <- "invalid"
+	ps.msgs <- mustWrite(t, b, backend.OpDel, "a", nil)
+
+	mustBeEvent(t, mustReceive(t, ch), 1, backend.OpPut, "a", "", "http://a/")
+	mustBeEvent(t, mustReceive(t, ch), 2, backend.OpDel, "a", "http://a/", "")
+
+	cancel()
+	for range ch {
+	}
+	close(ps.msgs)
+}
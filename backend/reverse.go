@@ -0,0 +1,95 @@
+package backend
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/kellegous/go/internal"
+)
+
+// ReverseIndex maps the normalized URLs and hosts of routes back to their
+// names, for backends that keep their index in memory. It is safe for
+// concurrent use and the zero value is ready to use.
+type ReverseIndex struct {
+	mu    sync.RWMutex
+	urls  map[string]map[string]struct{}
+	hosts map[string]map[string]struct{}
+}
+
+func addName(m map[string]map[string]struct{}, key, name string) {
+	names, ok := m[key]
+	if !ok {
+		names = map[string]struct{}{}
+		m[key] = names
+	}
+	names[name] = struct{}{}
+}
+
+func removeName(m map[string]map[string]struct{}, key, name string) {
+	names := m[key]
+	delete(names, name)
+	if len(names) == 0 {
+		delete(m, key)
+	}
+}
+
+// Update moves name from the entries for before to those for after. Either
+// may be nil, for a route that is created or deleted.
+func (x *ReverseIndex) Update(name string, before, after *internal.Route) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.urls == nil {
+		x.urls = map[string]map[string]struct{}{}
+		x.hosts = map[string]map[string]struct{}{}
+	}
+
+	if before != nil {
+		removeName(x.urls, internal.NormalizeURL(before.URL), name)
+		removeName(x.hosts, internal.HostOf(before.URL), name)
+	}
+
+	if after != nil {
+		addName(x.urls, internal.NormalizeURL(after.URL), name)
+		if host := internal.HostOf(after.URL); host != "" {
+			addName(x.hosts, host, name)
+		}
+	}
+}
+
+// Reset empties the index.
+func (x *ReverseIndex) Reset() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.urls = nil
+	x.hosts = nil
+}
+
+// The names under key in either the URLs or the hosts, in order.
+func (x *ReverseIndex) lookup(key string, hosts bool) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	m := x.urls
+	if hosts {
+		m = x.hosts
+	}
+
+	names := make([]string, 0, len(m[key]))
+	for name := range m[key] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NamesForURL returns the names of the routes that lead to url, in order.
+func (x *ReverseIndex) NamesForURL(url string) []string {
+	return x.lookup(internal.NormalizeURL(url), false)
+}
+
+// NamesForHost returns the names of the routes whose URL has host, in order.
+func (x *ReverseIndex) NamesForHost(host string) []string {
+	return x.lookup(internal.NormalizeHost(host), true)
+}
@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/kellegous/go/internal"
+)
+
+// Op is the kind of change an Event describes.
+type Op string
+
+const (
+	// OpPut is a route being created or replaced.
+	OpPut Op = "put"
+
+	// OpDel is a route being deleted.
+	OpDel Op = "del"
+)
+
+// Event describes a single change to a route. Events are shared between
+// watchers and must not be modified.
+type Event struct {
+	// Seq orders the events from a backend. It increases with every event but
+	// is not guaranteed to be contiguous.
+	Seq    uint64          `json:"seq"`
+	Op     Op              `json:"op"`
+	Name   string          `json:"name"`
+	Before *internal.Route `json:"before"`
+	After  *internal.Route `json:"after"`
+}
+
+// Watcher is implemented by backends that can report changes to their routes.
+type Watcher interface {
+	// Watch delivers every change made after it returns, in order, until ctx
+	// is done. The channel is also closed if the watcher falls too far
+	// behind, after which it must resynchronize from the backend.
+	Watch(ctx context.Context) (<-chan *Event, error)
+}
+
+// ErrWatchNotSupported is returned when watching a backend that cannot report
+// changes.
+var ErrWatchNotSupported = errors.New("backend does not support watching")
+
+// Watch watches the backend if it supports it.
+func Watch(ctx context.Context, b Backend) (<-chan *Event, error) {
+	if w, ok := b.(Watcher); ok {
+		return w.Watch(ctx)
+	}
+	return nil, ErrWatchNotSupported
+}
+
+// WatchBuffer is the number of events that can be waiting for a watcher
+// before it is considered to have fallen behind.
+const WatchBuffer = 256
+
+type subscriber struct {
+	ch   chan *Event
+	done chan struct{}
+}
+
+// Feed fans events out to the watchers in this process, for backends that
+// have no native way to observe changes. The zero value is ready to use.
+type Feed struct {
+	mu     sync.Mutex
+	seq    uint64
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+// Publish delivers e to every watcher, giving it the next sequence number.
+// Backends must publish in the order their changes were applied, which
+// usually means publishing while holding their write lock.
+func (f *Feed) Publish(e *Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.seq++
+	e.Seq = f.seq
+	for s := range f.subs {
+		select {
+		case s.ch <- e:
+		default:
+			f.drop(s)
+		}
+	}
+}
+
+// Remove a subscriber. The caller must hold the lock.
+func (f *Feed) drop(s *subscriber) {
+	delete(f.subs, s)
+	close(s.ch)
+	close(s.done)
+}
+
+// Watch delivers every event published after it returns until ctx is done.
+func (f *Feed) Watch(ctx context.Context) (<-chan *Event, error) {
+	s := &subscriber{
+		ch:   make(chan *Event, WatchBuffer),
+		done: make(chan struct{}),
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, errors.New("feed is closed")
+	}
+
+	if f.subs == nil {
+		f.subs = map[*subscriber]struct{}{}
+	}
+	f.subs[s] = struct{}{}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if _, ok := f.subs[s]; ok {
+				f.drop(s)
+			}
+		case <-s.done:
+		}
+	}()
+
+	return s.ch, nil
+}
+
+// Close ends every watch.
+func (f *Feed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	for s := range f.subs {
+		f.drop(s)
+	}
+}
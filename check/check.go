@@ -0,0 +1,337 @@
+// Package check walks every route in a backend looking for the damage left by
+// crashes, restores and bugs, and repairs what can be repaired without losing
+// or changing any route.
+package check
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/internal"
+)
+
+// Kind is the kind of a problem.
+type Kind string
+
+const (
+	// Unreadable routes cannot be read back, usually because they cannot be
+	// decoded.
+	Unreadable Kind = "unreadable"
+
+	// Invalid routes could not have been created through the API, such as
+	// those with a banned name or an unsupported URL.
+	Invalid Kind = "invalid"
+
+	// Index problems are routes that the backend does not list or find by
+	// their URL or host, or names it finds that it should not.
+	Index Kind = "index"
+
+	// Counter problems are ID counters below the highest generated name, which
+	// would hand out names that are already in use.
+	Counter Kind = "counter"
+)
+
+// Problem is something wrong with the backend.
+type Problem struct {
+	Kind   Kind   `json:"kind"`
+	Name   string `json:"name,omitempty"`
+	Detail string `json:"detail"`
+
+	// Repairable problems are repaired by Run when asked to. The others are
+	// left for an operator, since fixing them means deleting or changing a
+	// route.
+	Repairable bool `json:"repairable"`
+	Repaired   bool `json:"repaired"`
+}
+
+// Options controls what Run checks and whether it repairs what it finds.
+type Options struct {
+	// Validate, if set, is called for each route. Routes that fail validation
+	// are reported as invalid.
+	Validate func(name string, rt *internal.Route) error
+
+	// Counter is set when generated names encode IDs from the counter, so
+	// that the counter must be at least the highest ID in use.
+	Counter bool
+
+	// Repair advances the counter and rebuilds the indexes if they are found
+	// to be wrong.
+	Repair bool
+}
+
+// Report describes the state of the backend and the problems found in it.
+type Report struct {
+	Routes int `json:"routes"`
+
+	// LastID is the counter as it was found and MaxID the highest ID encoded
+	// in a name, if Options.Counter is set.
+	LastID uint64 `json:"last_id"`
+	MaxID  uint64 `json:"max_id"`
+
+	Problems []*Problem `json:"problems"`
+}
+
+// Unrepaired returns the number of problems that have not been repaired.
+func (r *Report) Unrepaired() int {
+	n := 0
+	for _, p := range r.Problems {
+		if !p.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Report) add(kind Kind, name, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, &Problem{
+		Kind:       kind,
+		Name:       name,
+		Detail:     fmt.Sprintf(format, args...),
+		Repairable: kind == Index || kind == Counter,
+	})
+}
+
+// Read every route by name, reporting those that cannot be read.
+func readAll(ctx context.Context, b backend.Backend, rep *Report) (map[string]*internal.Route, error) {
+	names, err := backend.NamesOf(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := map[string]*internal.Route{}
+	for _, name := range names {
+		rt, err := b.Get(ctx, name)
+		if err == internal.ErrRouteNotFound {
+			// deleted since it was listed.
+			continue
+		} else if err != nil {
+			rep.add(Unreadable, name, "%s", err)
+			continue
+		}
+		routes[name] = rt
+	}
+
+	rep.Routes = len(routes)
+	for _, p := range rep.Problems {
+		if p.Kind == Unreadable {
+			rep.Routes++
+		}
+	}
+
+	return routes, nil
+}
+
+// Check that List finds every route. Listing stops at a route that cannot be
+// decoded, so nothing is reported when it does.
+func checkList(ctx context.Context, b backend.Backend, routes map[string]*internal.Route, unreadable map[string]bool, rep *Report) error {
+	iter, err := b.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	defer iter.Release()
+
+	listed := map[string]bool{}
+	for iter.Next() {
+		listed[iter.Name()] = true
+	}
+
+	if err := iter.Error(); err != nil {
+		if len(unreadable) > 0 {
+			return nil
+		}
+		return err
+	}
+
+	for _, name := range sortedNames(routes) {
+		if !listed[name] {
+			rep.add(Index, name, "not listed")
+		}
+	}
+
+	return nil
+}
+
+// The routes that share a URL or host, with a URL to look them up by.
+type group struct {
+	url   string
+	names []string
+}
+
+// Check that the names the backend finds under each URL and host are those
+// of the routes with that URL or host. Routes that cannot be read are
+// ignored, since it cannot be known where they belong.
+func checkReverse(ctx context.Context, b backend.Backend, routes map[string]*internal.Route, unreadable map[string]bool, rep *Report) error {
+	urls := map[string]*group{}
+	hosts := map[string]*group{}
+	for _, name := range sortedNames(routes) {
+		u := routes[name].URL
+		key := internal.NormalizeURL(u)
+		if urls[key] == nil {
+			urls[key] = &group{url: u}
+		}
+		urls[key].names = append(urls[key].names, name)
+
+		if host := internal.HostOf(u); host != "" {
+			if hosts[host] == nil {
+				hosts[host] = &group{url: host}
+			}
+			hosts[host].names = append(hosts[host].names, name)
+		}
+	}
+
+	compare := func(what, key string, want, got []string) {
+		in := map[string]bool{}
+		for _, name := range got {
+			in[name] = true
+		}
+
+		for _, name := range want {
+			if !in[name] {
+				rep.add(Index, name, "not found by %s %s", what, key)
+			}
+			delete(in, name)
+		}
+
+		for _, name := range got {
+			if in[name] && !unreadable[name] {
+				rep.add(Index, name, "wrongly found by %s %s", what, key)
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(urls) {
+		g := urls[key]
+		names, err := b.NamesForURL(ctx, g.url)
+		if err != nil {
+			return err
+		}
+		compare("URL", key, g.names, names)
+	}
+
+	for _, key := range sortedKeys(hosts) {
+		names, err := b.NamesForHost(ctx, key)
+		if err != nil {
+			return err
+		}
+		compare("host", key, hosts[key].names, names)
+	}
+
+	return nil
+}
+
+// Run checks every route in the backend. Problems that are repairable are
+// repaired if opts.Repair is set. The backend should not be changing while
+// it is checked, or the changes may be reported as problems; repairing is
+// safe either way.
+func Run(ctx context.Context, b backend.Backend, opts *Options) (*Report, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	rep := &Report{}
+	routes, err := readAll(ctx, b, rep)
+	if err != nil {
+		return nil, err
+	}
+
+	unreadable := map[string]bool{}
+	var maxName string
+	for _, p := range rep.Problems {
+		// only unreadable routes have been reported so far.
+		unreadable[p.Name] = true
+		if id, ok := backend.CountedID(p.Name); opts.Counter && ok && id > rep.MaxID {
+			rep.MaxID, maxName = id, p.Name
+		}
+	}
+
+	for _, name := range sortedNames(routes) {
+		if opts.Validate != nil {
+			if err := opts.Validate(name, routes[name]); err != nil {
+				rep.add(Invalid, name, "%s", err)
+			}
+		}
+
+		if id, ok := backend.CountedID(name); opts.Counter && ok && id > rep.MaxID {
+			rep.MaxID, maxName = id, name
+		}
+	}
+
+	if err := checkList(ctx, b, routes, unreadable, rep); err != nil {
+		return nil, err
+	}
+
+	if err := checkReverse(ctx, b, routes, unreadable, rep); err != nil {
+		return nil, err
+	}
+
+	if rep.LastID, err = b.LastID(ctx); err != nil {
+		return nil, err
+	}
+
+	if opts.Counter && rep.LastID < rep.MaxID {
+		rep.add(Counter, maxName, "the ID counter is at %d, below the ID %d of this name", rep.LastID, rep.MaxID)
+	}
+
+	if opts.Repair {
+		if err := repair(ctx, b, rep); err != nil {
+			return rep, err
+		}
+	}
+
+	return rep, nil
+}
+
+// Repair the problems that can be repaired safely. The indexes are rebuilt
+// from the routes and the counter advanced, neither of which changes a route.
+func repair(ctx context.Context, b backend.Backend, rep *Report) error {
+	reindex := false
+	for _, p := range rep.Problems {
+		switch p.Kind {
+		case Index:
+			reindex = true
+		case Counter:
+			if err := b.EnsureID(ctx, rep.MaxID); err != nil {
+				return err
+			}
+			p.Repaired = true
+		}
+	}
+
+	if !reindex {
+		return nil
+	}
+
+	if err := backend.RebuildIndexes(ctx, b); err == backend.ErrNoIndexer {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, p := range rep.Problems {
+		if p.Kind == Index {
+			p.Repaired = true
+		}
+	}
+
+	return nil
+}
+
+func sortedNames(routes map[string]*internal.Route) []string {
+	names := make([]string, 0, len(routes))
+	for name := range routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m map[string]*group) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,220 @@
+package check
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/backend/memory"
+	"github.com/kellegous/go/internal"
+)
+
+// A backend with a damaged index, which leaves the name lost out of the
+// routes it finds by URL until the index is rebuilt, with routes that cannot
+// be read and with a counter of its own that routes do not raise.
+type damaged struct {
+	backend.Backend
+	lost       string
+	unreadable map[string]bool
+	rebuilt    int
+	id         uint64
+}
+
+func (d *damaged) LastID(ctx context.Context) (uint64, error) {
+	return d.id, nil
+}
+
+func (d *damaged) EnsureID(ctx context.Context, id uint64) error {
+	if id > d.id {
+		d.id = id
+	}
+	return nil
+}
+
+func (d *damaged) Get(ctx context.Context, name string) (*internal.Route, error) {
+	if d.unreadable[name] {
+		return nil, errors.New("cannot decode")
+	}
+	return d.Backend.Get(ctx, name)
+}
+
+func (d *damaged) NamesForURL(ctx context.Context, url string) ([]string, error) {
+	names, err := d.Backend.NamesForURL(ctx, url)
+	if err != nil || d.lost == "" {
+		return names, err
+	}
+
+	var found []string
+	for _, name := range names {
+		if name != d.lost {
+			found = append(found, name)
+		}
+	}
+	return found, nil
+}
+
+func (d *damaged) RebuildIndexes(ctx context.Context) error {
+	d.rebuilt++
+	d.lost = ""
+	return backend.RebuildIndexes(ctx, d.Backend)
+}
+
+func newDamaged(t *testing.T, routes map[string]string) *damaged {
+	mem, err := memory.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for name, u := range routes {
+		if err := mem.Put(ctx, name, &internal.Route{
+			URL:  u,
+			Time: time.Unix(0, 0),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &damaged{
+		Backend:    mem,
+		unreadable: map[string]bool{},
+	}
+}
+
+// Fail unless the problems are of the given kinds, in order.
+func mustHaveKinds(t *testing.T, rep *Report, kinds ...Kind) {
+	if len(rep.Problems) != len(kinds) {
+		t.Fatalf("expected %d problems, got %d: %v", len(kinds), len(rep.Problems), rep.Problems)
+	}
+
+	for i, p := range rep.Problems {
+		if p.Kind != kinds[i] {
+			t.Fatalf("expected problem %d to be %s, got %s: %s", i, kinds[i], p.Kind, p.Detail)
+		}
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	b := newDamaged(t, map[string]string{
+		"a":  "https://a.example.com/",
+		"b":  "https://a.example.com/",
+		":1": "https://b.example.com/x",
+	})
+	defer b.Close()
+
+	ctx := context.Background()
+	if err := b.EnsureID(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := Run(ctx, b, &Options{Counter: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustHaveKinds(t, rep)
+
+	if rep.Routes != 3 || rep.LastID != 1 || rep.MaxID != 1 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+}
+
+func TestProblems(t *testing.T) {
+	b := newDamaged(t, map[string]string{
+		"a":   "https://a.example.com/",
+		"b":   "https://a.example.com/",
+		"bad": "gopher://a.example.com/",
+		":5":  "https://b.example.com/x",
+		":7":  "https://b.example.com/y",
+	})
+	defer b.Close()
+	b.lost = "b"
+	b.unreadable[":7"] = true
+
+	validate := func(name string, rt *internal.Route) error {
+		if strings.HasPrefix(rt.URL, "gopher:") {
+			return errors.New("invalid URL")
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	rep, err := Run(ctx, b, &Options{
+		Validate: validate,
+		Counter:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustHaveKinds(t, rep, Unreadable, Invalid, Index, Counter)
+
+	if rep.Routes != 5 || rep.LastID != 0 || rep.MaxID != 7 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+
+	if p := rep.Problems[2]; p.Name != "b" || !p.Repairable || p.Repaired {
+		t.Fatalf("unexpected index problem %+v", p)
+	}
+
+	// nothing is repaired unless asked.
+	if b.rebuilt != 0 {
+		t.Fatal("expected the indexes not to be rebuilt")
+	}
+
+	rep, err = Run(ctx, b, &Options{
+		Validate: validate,
+		Counter:  true,
+		Repair:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.Unrepaired() != 2 {
+		t.Fatalf("expected 2 problems to be left, got %d", rep.Unrepaired())
+	}
+
+	if b.rebuilt != 1 {
+		t.Fatalf("expected the indexes to be rebuilt once, got %d", b.rebuilt)
+	}
+
+	if id, err := b.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 7 {
+		t.Fatalf("expected the counter to be advanced to 7, got %d", id)
+	}
+
+	// only the problems that need an operator are left.
+	rep, err = Run(ctx, b, &Options{
+		Validate: validate,
+		Counter:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustHaveKinds(t, rep, Unreadable, Invalid)
+}
+
+func TestNoCounter(t *testing.T) {
+	b := newDamaged(t, map[string]string{
+		":zzzzzz": "https://a.example.com/",
+	})
+	defer b.Close()
+
+	// names that do not come from the counter leave it alone.
+	rep, err := Run(context.Background(), b, &Options{Repair: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustHaveKinds(t, rep)
+
+	if rep.LastID != 0 || rep.MaxID != 0 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/kellegous/go/dump"
+	"github.com/kellegous/go/internal"
+)
+
+// An error response from the server.
+type statusError struct {
+	status int
+	msg    string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.status, http.StatusText(e.status), e.msg)
+}
+
+// Server errors and throttling are worth retrying, other errors are not.
+func retryable(err error) bool {
+	if se, ok := err.(*statusError); ok {
+		return se.status >= 500 || se.status == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// client talks to the API of a go link server.
+type client struct {
+	base    string
+	headers http.Header
+	http    *http.Client
+	retries int
+	backoff time.Duration
+}
+
+// Make a single request, decoding the JSON response into res.
+func (c *client) once(ctx context.Context, method, path string, body []byte, res interface{}) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, c.base+path, r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	for k, v := range c.headers {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var m struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+
+	if resp.StatusCode/100 != 2 {
+		json.Unmarshal(b, &m)
+		return &statusError{resp.StatusCode, m.Error}
+	}
+
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	} else if !m.Ok {
+		return &statusError{resp.StatusCode, m.Error}
+	}
+
+	if res == nil {
+		return nil
+	}
+	return json.Unmarshal(b, res)
+}
+
+// Make a request, retrying with exponential backoff when it fails in a way
+// that might succeed the next time.
+func (c *client) do(ctx context.Context, method, path string, req, res interface{}) error {
+	var body []byte
+	if req != nil {
+		var err error
+		if body, err = json.Marshal(req); err != nil {
+			return err
+		}
+	}
+
+	backoff := c.backoff
+	for i := 0; ; i++ {
+		err := c.once(ctx, method, path, body, res)
+		if err == nil || i >= c.retries || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+type routeWithName struct {
+	Name string `json:"name"`
+	internal.Route
+}
+
+// list fetches every route on the server, including those with generated
+// names.
+func (c *client) list(ctx context.Context) (map[string]*internal.Route, error) {
+	routes := map[string]*internal.Route{}
+
+	params := url.Values{
+		"include-generated-names": {"true"},
+		"limit":                   {"1000"},
+	}
+
+	for {
+		var res struct {
+			Routes []*routeWithName `json:"routes"`
+			Next   string           `json:"next"`
+		}
+
+		if err := c.do(ctx, "GET", "/api/urls/?"+params.Encode(), nil, &res); err != nil {
+			return nil, err
+		}
+
+		for _, rt := range res.Routes {
+			routes[rt.Name] = &rt.Route
+		}
+
+		if res.Next == "" {
+			return routes, nil
+		}
+
+		params.Set("cursor", res.Next)
+	}
+}
+
+// The part of an import report that tells whether the entry was imported.
+type importReport struct {
+	Invalid int `json:"invalid"`
+	Results []struct {
+		Error string `json:"error"`
+	} `json:"results"`
+}
+
+// put creates or replaces a route through the admin import, which keeps its
+// time and accepts generated names. The entry is sent as a single line of
+// NDJSON.
+func (c *client) put(ctx context.Context, name string, rt *internal.Route) error {
+	params := url.Values{
+		"format":   {"ndjson"},
+		"conflict": {"overwrite"},
+	}
+
+	var res struct {
+		Report importReport `json:"report"`
+	}
+
+	if err := c.do(ctx, "POST", "/admin/import?"+params.Encode(), &dump.Entry{
+		Name:  name,
+		Route: *rt,
+	}, &res); err != nil {
+		return err
+	}
+
+	if rep := &res.Report; rep.Invalid > 0 && len(rep.Results) > 0 {
+		return &statusError{http.StatusBadRequest, rep.Results[0].Error}
+	}
+
+	return nil
+}
+
+// del removes a route.
+func (c *client) del(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", "/api/url/"+url.PathEscape(name), nil, nil)
+}
@@ -1,38 +1,71 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+
+	"github.com/kellegous/go/dump"
 )
 
 const (
-	apiPath = "%s://%s:%s/api/url/%s"
+	baseURL = "%s://%s:%s"
 )
 
 type config struct {
-	proto    string
-	host     string
-	port     string
-	dumpFile string
+	proto       string
+	host        string
+	port        string
+	dumpFile    string
+	format      string
+	headers     []string
+	del         bool
+	dryRun      bool
+	concurrency int
+	retries     int
+	timeout     time.Duration
 }
 
-type RoutesDump struct {
-	OK     bool    `json:"ok"`
-	Routes []Route `json:"routes"`
-	Next   string  `json:"next"`
+// Parse "Name: value" headers given on the command line.
+func parseHeaders(hs []string) (http.Header, error) {
+	h := http.Header{}
+	for _, v := range hs {
+		ix := strings.Index(v, ":")
+		if ix == -1 {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: value\"", v)
+		}
+		h.Add(strings.TrimSpace(v[:ix]), strings.TrimSpace(v[ix+1:]))
+	}
+	return h, nil
 }
 
-type Route struct {
-	Name string `json:"name"`
-	URL  string `json:"url"`
+func readDump(filename, format string) ([]*dump.Entry, error) {
+	var f dump.Format
+	var err error
+	if format != "" {
+		f, err = dump.ParseFormat(format)
+	} else {
+		f, err = dump.FormatForFile(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return dump.Decode(r, &dump.Options{Format: f})
 }
 
 func main() {
@@ -41,6 +74,13 @@ func main() {
 	pflag.StringVar(&c.host, "host", "localhost", "host to post data to")
 	pflag.StringVar(&c.port, "port", "8067", "port on host to talk to")
 	pflag.StringVar(&c.dumpFile, "file", "", "dump file to load from")
+	pflag.StringVar(&c.format, "format", "", "format of the dump file: json, ndjson, csv, yaml or html. Guessed from the file extension by default")
+	pflag.StringArrayVarP(&c.headers, "header", "H", nil, "header to send with every request, e.g. \"Authorization: Bearer xxx\". May be repeated")
+	pflag.BoolVar(&c.del, "delete", false, "delete links on the server that are not in the dump")
+	pflag.BoolVar(&c.dryRun, "dry-run", false, "print the changes that would be made without making them")
+	pflag.IntVar(&c.concurrency, "concurrency", 4, "number of requests to make at once")
+	pflag.IntVar(&c.retries, "retries", 3, "number of times to retry a failed request")
+	pflag.DurationVar(&c.timeout, "timeout", 30*time.Second, "timeout for each request")
 	pflag.Parse()
 
 	if err := viper.BindPFlags(pflag.CommandLine); err != nil {
@@ -55,36 +95,47 @@ func main() {
 		log.Fatal("dump file must be specified with --file argument")
 	}
 
-	var d RoutesDump
-
-	f, err := ioutil.ReadFile(c.dumpFile)
+	headers, err := parseHeaders(c.headers)
+	if err != nil {
+		log.Fatal(err)
+	}
 
+	ents, err := readDump(c.dumpFile, c.format)
 	if err != nil {
 		log.Printf("error reading dump file : %s\n", c.dumpFile)
 		log.Fatal(err)
 	}
 
-	err = json.Unmarshal(f, &d)
+	cl := &client{
+		base:    fmt.Sprintf(baseURL, c.proto, c.host, c.port),
+		headers: headers,
+		http:    &http.Client{Timeout: c.timeout},
+		retries: c.retries,
+		backoff: 500 * time.Millisecond,
+	}
+
+	ctx := context.Background()
 
+	live, err := cl.list(ctx)
 	if err != nil {
-		log.Printf("error parsing dump file : %s\n", c.dumpFile)
+		log.Fatalf("error listing links on server : %s", err)
+	}
+
+	ops, unchanged := plan(ents, live, c.del)
+
+	if !c.dryRun {
+		apply(ctx, cl, ops, c.concurrency)
+	}
+
+	s := summarize(ops, unchanged, c.dryRun)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
 		log.Fatal(err)
 	}
 
-	for _, v := range d.Routes {
-		req := fmt.Sprintf(apiPath, c.proto, c.host, c.port, v.Name)
-		p, err := json.Marshal(&v)
-		if err != nil {
-			log.Printf("error marshalling data for link : %s\n", v.Name)
-			log.Println(err)
-			continue
-		}
-		resp, err := http.Post(req, "application/json", bytes.NewReader(p))
-		if err != nil {
-			log.Printf("error POSTing link : %s %s\n", v.Name, err.Error())
-		} else {
-			log.Printf("POSTed short link (%s) : %s\n", resp.Status, v.Name)
-			resp.Body.Close()
-		}
+	if s.Failed > 0 {
+		os.Exit(1)
 	}
 }
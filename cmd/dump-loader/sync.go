@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kellegous/go/backend/migrate"
+	"github.com/kellegous/go/dump"
+	"github.com/kellegous/go/internal"
+)
+
+const (
+	actionCreate = "create"
+	actionUpdate = "update"
+	actionDelete = "delete"
+)
+
+// An op is a single change needed to bring the server in line with the dump.
+type op struct {
+	Action string     `json:"action"`
+	Name   string     `json:"name"`
+	URL    string     `json:"url,omitempty"`
+	Time   *time.Time `json:"time,omitempty"`
+	OldURL string     `json:"old_url,omitempty"`
+	Error  string     `json:"error,omitempty"`
+	route  *internal.Route
+}
+
+// The summary printed when the sync is done.
+type summary struct {
+	DryRun    bool  `json:"dry_run"`
+	Created   int   `json:"created"`
+	Updated   int   `json:"updated"`
+	Deleted   int   `json:"deleted"`
+	Unchanged int   `json:"unchanged"`
+	Failed    int   `json:"failed"`
+	Ops       []*op `json:"ops"`
+}
+
+// Do two routes match? A dump without times only needs to match URLs.
+func same(want, have *internal.Route) bool {
+	if want.Time.IsZero() {
+		return want.URL == have.URL
+	}
+	return migrate.Equal(want, have)
+}
+
+// plan the ops needed to make live match the dump. Routes on the server that
+// are not in the dump are only removed if del is true.
+func plan(ents []*dump.Entry, live map[string]*internal.Route, del bool) ([]*op, int) {
+	var ops []*op
+	unchanged := 0
+
+	seen := map[string]bool{}
+	for _, ent := range ents {
+		seen[ent.Name] = true
+
+		rt := ent.Route
+		o := &op{
+			Name:  ent.Name,
+			URL:   rt.URL,
+			route: &rt,
+		}
+
+		if !rt.Time.IsZero() {
+			o.Time = &rt.Time
+		}
+
+		if cur, ok := live[ent.Name]; !ok {
+			o.Action = actionCreate
+		} else if !same(&rt, cur) {
+			o.Action = actionUpdate
+			o.OldURL = cur.URL
+		} else {
+			unchanged++
+			continue
+		}
+
+		ops = append(ops, o)
+	}
+
+	if del {
+		for name, rt := range live {
+			if !seen[name] {
+				ops = append(ops, &op{
+					Action: actionDelete,
+					Name:   name,
+					OldURL: rt.URL,
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].Name < ops[j].Name
+	})
+
+	return ops, unchanged
+}
+
+// apply the ops using the given number of concurrent requests. Failures are
+// recorded on each op.
+func apply(ctx context.Context, c *client, ops []*op, concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ch := make(chan *op)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for o := range ch {
+				var err error
+				switch o.Action {
+				case actionCreate, actionUpdate:
+					err = c.put(ctx, o.Name, o.route)
+				case actionDelete:
+					err = c.del(ctx, o.Name)
+				}
+
+				if err != nil {
+					o.Error = err.Error()
+				}
+			}
+		}()
+	}
+
+	for _, o := range ops {
+		ch <- o
+	}
+	close(ch)
+	wg.Wait()
+}
+
+// Tally up the ops into a summary.
+func summarize(ops []*op, unchanged int, dryRun bool) *summary {
+	s := summary{
+		DryRun:    dryRun,
+		Unchanged: unchanged,
+		Ops:       ops,
+	}
+
+	if s.Ops == nil {
+		s.Ops = []*op{}
+	}
+
+	for _, o := range ops {
+		if o.Error != "" {
+			s.Failed++
+			continue
+		}
+
+		switch o.Action {
+		case actionCreate:
+			s.Created++
+		case actionUpdate:
+			s.Updated++
+		case actionDelete:
+			s.Deleted++
+		}
+	}
+
+	return &s
+}
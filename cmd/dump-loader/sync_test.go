@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kellegous/go/backend/leveldb"
+	"github.com/kellegous/go/dump"
+	"github.com/kellegous/go/internal"
+	"github.com/kellegous/go/web"
+)
+
+func entryOf(name, url string, t time.Time) *dump.Entry {
+	e := &dump.Entry{Name: name}
+	e.URL = url
+	e.Time = t
+	return e
+}
+
+func TestSync(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	backend, err := leveldb.New(filepath.Join(tmp, "data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for name, url := range map[string]string{
+		"a": "http://a.com/",
+		"b": "http://old.com/",
+		"z": "http://z.com/",
+	} {
+		if err := backend.Put(ctx, name, &internal.Route{
+			URL:  url,
+			Time: time.Unix(1601418236, 0),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mux := http.NewServeMux()
+	web.Setup(mux, backend, "", "", nil, nil, nil)
+	web.SetupAdmin(mux, backend, nil, nil, nil)
+
+	// require auth and fail every other request to exercise retries.
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xxx" {
+			http.Error(w, "{}", http.StatusUnauthorized)
+			return
+		}
+
+		if atomic.AddInt32(&n, 1)%2 == 0 {
+			http.Error(w, "{}", http.StatusServiceUnavailable)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	c := &client{
+		base:    srv.URL,
+		headers: http.Header{"Authorization": {"Bearer xxx"}},
+		http:    srv.Client(),
+		retries: 3,
+		backoff: time.Millisecond,
+	}
+
+	ents := []*dump.Entry{
+		entryOf("a", "http://a.com/", time.Time{}),
+		entryOf("b", "http://b.com/", time.Unix(1601418237, 0)),
+		entryOf("c", "http://c.com/", time.Unix(1601418238, 0)),
+		entryOf(":5", "http://gen.com/", time.Unix(1601418239, 0)),
+	}
+
+	live, err := c.list(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops, unchanged := plan(ents, live, true)
+	s := summarize(ops, unchanged, true)
+	if s.Created != 2 || s.Updated != 1 || s.Deleted != 1 || s.Unchanged != 1 {
+		t.Fatalf("unexpected plan %+v", s)
+	}
+
+	apply(ctx, c, ops, 2)
+	s = summarize(ops, unchanged, false)
+	if s.Failed != 0 {
+		t.Fatalf("expected no failures, got %+v", s.Ops)
+	}
+
+	if _, err := backend.Get(ctx, "z"); err != internal.ErrRouteNotFound {
+		t.Fatal("expected z to be deleted")
+	}
+
+	rt, err := backend.Get(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rt.URL != "http://c.com/" || rt.Time.Unix() != 1601418238 {
+		t.Fatalf("expected c to be created with its time, got %v", rt)
+	}
+
+	// generated names are created as they are and never handed out again.
+	rt, err = backend.Get(ctx, ":5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rt.URL != "http://gen.com/" || rt.Time.Unix() != 1601418239 {
+		t.Fatalf("expected :5 to be created with its time, got %v", rt)
+	}
+
+	if id, err := backend.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 5 {
+		t.Fatalf("expected the id counter to be 5, got %d", id)
+	}
+
+	// a second sync has nothing to do.
+	live, err = c.list(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ops, unchanged = plan(ents, live, true); len(ops) != 0 || unchanged != 4 {
+		t.Fatalf("expected nothing to change, got %v", ops)
+	}
+
+	// only the time of b differs, which is enough to update it.
+	ents[1].Time = time.Unix(1601418240, 0)
+	if ops, _ = plan(ents, live, true); len(ops) != 1 || ops[0].Action != actionUpdate {
+		t.Fatalf("expected b to be updated, got %v", ops)
+	}
+
+	apply(ctx, c, ops, 1)
+	if ops[0].Error != "" {
+		t.Fatal(ops[0].Error)
+	}
+
+	if rt, err := backend.Get(ctx, "b"); err != nil {
+		t.Fatal(err)
+	} else if rt.Time.Unix() != 1601418240 {
+		t.Fatalf("expected b to have the new time, got %v", rt)
+	}
+
+	// entries the server will not import are failures.
+	bad := []*op{{Action: actionCreate, Name: "edit", route: &internal.Route{URL: "http://edit.com/"}}}
+	if apply(ctx, c, bad, 1); bad[0].Error == "" {
+		t.Fatal("expected a banned name to fail")
+	}
+
+	c.headers = nil
+	apply(ctx, c, []*op{{Action: actionDelete, Name: "a"}}, 1)
+	if _, err := backend.Get(ctx, "a"); err != nil {
+		t.Fatal("expected a not to be deleted without auth")
+	}
+}
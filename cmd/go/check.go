@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kellegous/go/backend/config"
+	"github.com/kellegous/go/check"
+	"github.com/kellegous/go/ids"
+	"github.com/kellegous/go/web"
+)
+
+func runCheck(args []string) error {
+	fs := pflag.NewFlagSet("check", pflag.ExitOnError)
+	config.AddFlags(fs, "")
+	ids.AddFlags(fs)
+	repair := fs.Bool("repair", false, "advance the ID counter and rebuild the indexes if they are wrong")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 0 {
+		return errors.New("usage: check [flags]")
+	}
+
+	ctx := context.Background()
+
+	backend, err := config.Open(ctx, "")
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+
+	names, err := ids.Open(backend)
+	if err != nil {
+		return err
+	}
+
+	rep, err := check.Run(ctx, backend, &check.Options{
+		Validate: web.ValidateRoute,
+		Counter:  ids.FromCounter(names),
+		Repair:   *repair,
+	})
+
+	// the problems found before an error are still reported.
+	if rep != nil {
+		for _, p := range rep.Problems {
+			fmt.Printf("%-10s %s: %s", p.Kind, p.Name, p.Detail)
+			if p.Repaired {
+				fmt.Print(" (repaired)")
+			} else if p.Repairable {
+				fmt.Print(" (repairable with --repair)")
+			}
+			fmt.Println()
+		}
+		fmt.Printf("%d routes, last ID %d, highest generated ID %d, %d problems, %d repaired\n",
+			rep.Routes, rep.LastID, rep.MaxID, len(rep.Problems), len(rep.Problems)-rep.Unrepaired())
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if n := rep.Unrepaired(); n > 0 {
+		return fmt.Errorf("%d problems left", n)
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kellegous/go/backend/config"
+	"github.com/kellegous/go/dump"
+	"github.com/kellegous/go/ids"
+	"github.com/kellegous/go/web"
+)
+
+// Determine the dump options from the flags, guessing the format from the
+// filename if one wasn't given.
+func dumpOptions(format, columns, filename string) (*dump.Options, error) {
+	var f dump.Format
+	var err error
+	if format != "" {
+		f, err = dump.ParseFormat(format)
+	} else if filename != "" && filename != "-" {
+		f, err = dump.FormatForFile(filename)
+	} else {
+		f = dump.JSON
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cols, err := dump.ParseColumns(columns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dump.Options{
+		Format:  f,
+		Columns: cols,
+	}, nil
+}
+
+func runImport(args []string) error {
+	fs := pflag.NewFlagSet("import", pflag.ExitOnError)
+	config.AddFlags(fs, "")
+	ids.AddFlags(fs)
+	format := fs.String("format", "", "format of the file: json, ndjson, csv, yaml or html. Guessed from the file extension by default")
+	columns := fs.String("columns", "", "CSV column mapping, e.g. name=Short,url=Destination,time=Created")
+	conflict := fs.String("conflict", "skip", "what to do when a name is already used: skip, overwrite or rename")
+	dryRun := fs.Bool("dry-run", false, "show what would change without changing anything")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: import [flags] <file>")
+	}
+	filename := fs.Arg(0)
+
+	opts, err := dumpOptions(*format, *columns, filename)
+	if err != nil {
+		return err
+	}
+
+	strategy, err := dump.ParseConflict(*conflict)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	ents, err := dump.Decode(r, opts)
+	if err != nil {
+		return fmt.Errorf("unable to read %s: %s", filename, err)
+	}
+
+	ctx := context.Background()
+
+	backend, err := config.Open(ctx, "")
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+
+	names, err := ids.Open(backend)
+	if err != nil {
+		return err
+	}
+
+	rep, err := dump.Import(ctx, backend, ents, &dump.ImportOptions{
+		Conflict: strategy,
+		DryRun:   *dryRun,
+		Validate: web.ValidateRoute,
+		Names:    names,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, res := range rep.Results {
+		fmt.Printf("%-11s %s", res.Action, res.Name)
+		if res.NewName != "" {
+			fmt.Printf(" -> %s", res.NewName)
+		}
+		if res.Error != "" {
+			fmt.Printf(" (%s)", res.Error)
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("%d created, %d overwritten, %d renamed, %d skipped, %d unchanged, %d invalid\n",
+		rep.Created, rep.Overwritten, rep.Renamed, rep.Skipped, rep.Unchanged, rep.Invalid)
+	return nil
+}
+
+func runExport(args []string) error {
+	fs := pflag.NewFlagSet("export", pflag.ExitOnError)
+	config.AddFlags(fs, "")
+	format := fs.String("format", "", "format of the file: json, ndjson, csv, yaml or html. Guessed from the file extension by default")
+	columns := fs.String("columns", "", "CSV column names, e.g. name=Short,url=Destination,time=Created")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	filename := "-"
+	if fs.NArg() > 0 {
+		filename = fs.Arg(0)
+	}
+
+	opts, err := dumpOptions(*format, *columns, filename)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	backend, err := config.Open(ctx, "")
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+
+	var w io.Writer = os.Stdout
+	if filename != "-" {
+		f, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := dump.Export(ctx, backend, w, opts)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("exported %d routes", n)
+	return nil
+}
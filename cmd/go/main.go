@@ -4,68 +4,106 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"os"
+	"sort"
 	"strings"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
-	"github.com/kellegous/go/backend"
-	"github.com/kellegous/go/backend/firestore"
-	"github.com/kellegous/go/backend/leveldb"
-	"github.com/kellegous/go/backend/redis"
+	"github.com/kellegous/go/backend/config"
+	"github.com/kellegous/go/ids"
 	"github.com/kellegous/go/web"
 )
 
-func main() {
+// A command is run as `go <name> [flags]`. Each command parses its own flags.
+type command struct {
+	desc string
+	run  func(args []string) error
+}
+
+var commands = map[string]*command{
+	"check":   {"check the backend for problems and repair them", runCheck},
+	"import":  {"import routes from a file", runImport},
+	"export":  {"export routes to a file", runExport},
+	"rewrite": {"rewrite the URLs of many routes at once", runRewrite},
+}
+
+// Parse the given flags and make them, and the environment, available
+// through viper.
+func parseFlags(fs *pflag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := viper.BindPFlags(fs); err != nil {
+		return err
+	}
+
+	// allow env vars to set pflags
+	viper.AutomaticEnv()
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [command] [flags]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "With no command, the server is started. Commands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].desc)
+	}
+	fmt.Fprintf(os.Stderr, "\nServer flags:\n")
+	pflag.PrintDefaults()
+}
+
+func serve() {
 	pflag.String("addr", ":8067", "default bind address")
 	pflag.Bool("admin", false, "allow admin-level requests")
 	pflag.String("version", "", "version string")
-	pflag.String("backend", "leveldb", "backing store to use. 'leveldb' and 'firestore' currently supported.")
-	pflag.String("data", "data", "The location of the leveldb data directory")
-	pflag.String("project", "", "The GCP project to use for the firestore backend. Will attempt to use application default creds if not defined.")
-	pflag.String("redis-addr", "", "Address of the redis DB to use")
-	pflag.String("redis-pw", "", "Password to the redis DB")
-	pflag.String("redis-db", "", "Redis DB to use.")
-	pflag.Bool("redis-debug", false, "Enable redis debug logging")
+	config.AddFlags(pflag.CommandLine, "")
+	ids.AddFlags(pflag.CommandLine)
 	pflag.String("host", "", "The host field to use when gnerating the source URL of a link. Defaults to the Host header of the generate request")
-	pflag.Parse()
+	pflag.String("webhooks", "", "JSON file of webhook subscriptions that are sent changes made through the API")
+	pflag.String("webhook-queue", "webhooks", "The directory holding the webhook delivery queue and log")
+	pflag.String("audit-log", "", "File recording every change made through the API and every admin action")
+	pflag.String("user-header", "X-Forwarded-User", "Request header naming the user, set by an authenticating proxy. It is recorded as the owner of new links and in the audit log")
+	pflag.Usage = usage
 
-	if err := viper.BindPFlags(pflag.CommandLine); err != nil {
+	if err := parseFlags(pflag.CommandLine, os.Args[1:]); err != nil {
 		log.Panic(err)
 	}
 
-	// allow env vars to set pflags
-	viper.AutomaticEnv()
-	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	backend, err := config.Open(context.Background(), "")
+	if err != nil {
+		log.Panic(err)
+	}
 
-	var backend backend.Backend
+	// the backend must be closed for its changes to be saved, the memory
+	// backend's in particular.
+	if err := web.ListenAndServe(backend); err != nil {
+		backend.Close()
+		log.Panic(err)
+	}
 
-	switch viper.GetString("backend") {
-	case "leveldb":
-		var err error
-		backend, err = leveldb.New(viper.GetString("data"))
-		if err != nil {
-			log.Panic(err)
-		}
-	case "firestore":
-		var err error
+	if err := backend.Close(); err != nil {
+		log.Panic(err)
+	}
+}
 
-		backend, err = firestore.New(context.Background(), viper.GetString("project"))
-		if err != nil {
-			log.Panic(err)
-		}
-	case "redis":
-		var err error
-		redis.Debug = viper.GetBool("redis-debug")
-		backend, err = redis.New(context.Background(), viper.GetString("redis-addr"), viper.GetString("redis-pw"), viper.GetInt("redis-db"))
-		if err != nil {
-			log.Panic(err)
+func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
 		}
-	default:
-		log.Panic(fmt.Sprintf("unknown backend %s", viper.GetString("backend")))
 	}
 
-	defer backend.Close()
-
-	log.Panic(web.ListenAndServe(backend))
+	serve()
 }
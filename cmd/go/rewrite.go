@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/spf13/pflag"
+
+	"github.com/kellegous/go/backend/config"
+	"github.com/kellegous/go/rewrite"
+	"github.com/kellegous/go/web"
+)
+
+// Print each change, with a label.
+func printChanges(label string, changes []*rewrite.Change) {
+	for _, c := range changes {
+		fmt.Printf("%-9s %s: %s -> %s", label, c.Name, c.Before, c.After)
+		if c.Error != "" {
+			fmt.Printf(" (%s)", c.Error)
+		}
+		fmt.Println()
+	}
+}
+
+func runRewrite(args []string) error {
+	fs := pflag.NewFlagSet("rewrite", pflag.ExitOnError)
+	config.AddFlags(fs, "")
+	prefix := fs.String("prefix", "", "rewrite the URLs that start with this prefix")
+	pattern := fs.String("pattern", "", "rewrite the URLs that match this regular expression")
+	replace := fs.String("replace", "", "what the prefix, or each match of the pattern, is replaced with. $1 refers to the first group of a pattern")
+	dryRun := fs.Bool("dry-run", false, "show what would change without changing anything")
+	save := fs.String("save", "", "file to write the report to, which can be undone with --undo")
+	undo := fs.String("undo", "", "undo the rewrite reported in this file")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 0 {
+		return errors.New("usage: rewrite [flags]")
+	}
+
+	ctx := context.Background()
+
+	var changes []*rewrite.Change
+	if *undo != "" {
+		b, err := ioutil.ReadFile(*undo)
+		if err != nil {
+			return err
+		}
+
+		var rep rewrite.Report
+		if err := json.Unmarshal(b, &rep); err != nil {
+			return fmt.Errorf("unable to read %s: %s", *undo, err)
+		}
+		changes = rewrite.Reverse(rep.Changed)
+	}
+
+	backend, err := config.Open(ctx, "")
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+
+	if *undo == "" {
+		rule, err := rewrite.NewRule(*prefix, *pattern, *replace)
+		if err != nil {
+			return err
+		}
+
+		if changes, err = rewrite.Plan(ctx, backend, rule); err != nil {
+			return err
+		}
+	}
+
+	if *dryRun {
+		printChanges("rewrite", changes)
+		fmt.Printf("%d would be rewritten\n", len(changes))
+		return nil
+	}
+
+	rep, err := rewrite.Apply(ctx, backend, changes, &rewrite.Options{
+		Validate: web.ValidateRoute,
+	})
+
+	// the routes changed before an error are still reported.
+	if rep != nil {
+		printChanges("rewritten", rep.Changed)
+		printChanges("skipped", rep.Skipped)
+		printChanges("invalid", rep.Invalid)
+		fmt.Printf("%d rewritten, %d skipped, %d invalid\n",
+			len(rep.Changed), len(rep.Skipped), len(rep.Invalid))
+
+		if *save != "" {
+			b, err := json.MarshalIndent(rep, "", "  ")
+			if err != nil {
+				return err
+			}
+
+			if err := ioutil.WriteFile(*save, b, 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/kellegous/go/backend/config"
+	"github.com/kellegous/go/backend/migrate"
+)
+
+// How many routes to copy between writes of the state file.
+const checkpointEvery = 100
+
+type options struct {
+	dryRun    bool
+	verify    bool
+	stateFile string
+}
+
+// The progress of an interrupted migration.
+type state struct {
+	Last string `json:"last"`
+}
+
+func loadState(filename string) (*state, error) {
+	var s state
+	if filename == "" {
+		return &s, nil
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return &s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func saveState(filename string, s *state) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filename)
+}
+
+func printChange(c *migrate.Change) {
+	switch c.Action {
+	case migrate.Create:
+		fmt.Printf("+ %s %s (%s)\n", c.Name, c.New.URL, c.New.Time.Format(time.RFC3339Nano))
+	case migrate.Update:
+		fmt.Printf("~ %s %s (%s) -> %s (%s)\n", c.Name,
+			c.Old.URL, c.Old.Time.Format(time.RFC3339Nano),
+			c.New.URL, c.New.Time.Format(time.RFC3339Nano))
+	}
+}
+
+func printReport(title string, r *migrate.Report) {
+	fmt.Printf("%s: %d created, %d updated, %d unchanged, id counter %d -> %d\n",
+		title, r.Created, r.Updated, r.Unchanged, r.SrcID, r.DstID)
+}
+
+func main() {
+	c := options{}
+	config.AddFlags(pflag.CommandLine, "from-")
+	config.AddFlags(pflag.CommandLine, "to-")
+	pflag.BoolVar(&c.dryRun, "dry-run", false, "show the changes that would be made without making them")
+	pflag.BoolVar(&c.verify, "verify", true, "compare the source and destination after copying")
+	pflag.StringVar(&c.stateFile, "state", "", "file used to record progress so that an interrupted migration can be resumed")
+	pflag.Parse()
+
+	if err := viper.BindPFlags(pflag.CommandLine); err != nil {
+		log.Panic(err)
+	}
+
+	// allow env vars to set pflags
+	viper.AutomaticEnv()
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+
+	ctx := context.Background()
+
+	src, err := config.Open(ctx, "from-")
+	if err != nil {
+		log.Fatalf("unable to open source: %s", err)
+	}
+	defer src.Close()
+
+	dst, err := config.Open(ctx, "to-")
+	if err != nil {
+		log.Fatalf("unable to open destination: %s", err)
+	}
+	defer dst.Close()
+
+	st, err := loadState(c.stateFile)
+	if err != nil {
+		log.Fatalf("unable to read state file %s: %s", c.stateFile, err)
+	}
+
+	if st.Last != "" {
+		log.Printf("resuming from %s", st.Last)
+	}
+
+	n := 0
+	opts := migrate.Options{
+		DryRun: c.dryRun,
+		Start:  st.Last,
+		Change: printChange,
+	}
+
+	if c.stateFile != "" && !c.dryRun {
+		opts.Progress = func(name string) error {
+			n++
+			if n%checkpointEvery != 0 {
+				return nil
+			}
+			st.Last = name
+			return saveState(c.stateFile, st)
+		}
+	}
+
+	rep, err := migrate.Copy(ctx, src, dst, &opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if c.dryRun {
+		printReport("dry run", rep)
+		return
+	}
+	printReport("copied", rep)
+
+	if c.stateFile != "" {
+		if err := os.Remove(c.stateFile); err != nil && !os.IsNotExist(err) {
+			log.Printf("unable to remove state file %s: %s", c.stateFile, err)
+		}
+	}
+
+	if !c.verify {
+		return
+	}
+
+	rep, err = migrate.Verify(ctx, src, dst, printChange)
+	if err != nil {
+		log.Fatal(err)
+	}
+	printReport("verified", rep)
+
+	if !rep.InSync() {
+		log.Fatal("verification failed: destination differs from source")
+	}
+}
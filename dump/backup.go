@@ -0,0 +1,315 @@
+package dump
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/kellegous/go/backend"
+)
+
+// BackupVersion is the version of the backup format written by Backup.
+const BackupVersion = 1
+
+// DefaultBatchSize is the number of routes Restore applies at a time.
+const DefaultBatchSize = 500
+
+// maxLineSize bounds the length of a single line in a backup.
+const maxLineSize = 1 << 20
+
+// A backup is NDJSON. The first line is a header, followed by a line for each
+// route and finally a footer with a checksum of every line before it.
+type backupHeader struct {
+	Type    string    `json:"type"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	LastID  uint64    `json:"last_id"`
+}
+
+type backupRoute struct {
+	Type string `json:"type"`
+	*Entry
+}
+
+type backupFooter struct {
+	Type   string `json:"type"`
+	Count  int    `json:"count"`
+	SHA256 string `json:"sha256"`
+}
+
+// backupLine holds any of the lines in a backup.
+type backupLine struct {
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+	LastID  uint64 `json:"last_id"`
+	Count   int    `json:"count"`
+	SHA256  string `json:"sha256"`
+	*Entry
+}
+
+// BackupInfo describes a backup.
+type BackupInfo struct {
+	Count  int    `json:"count"`
+	LastID uint64 `json:"last_id"`
+	SHA256 string `json:"sha256"`
+}
+
+// A writer that hashes every line that passes through it.
+type hashWriter struct {
+	w io.Writer
+	h hash.Hash
+}
+
+func (w *hashWriter) line(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	w.h.Write(b)
+	_, err = w.w.Write(b)
+	return err
+}
+
+// Backup writes every route in the snapshot, along with its ID counter, to w.
+// The routes are streamed in order, so the backup is never held in memory.
+func Backup(ctx context.Context, snap backend.Snapshot, w io.Writer) (*BackupInfo, error) {
+	id, err := snap.LastID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hw := &hashWriter{
+		w: w,
+		h: sha256.New(),
+	}
+
+	if err := hw.line(&backupHeader{
+		Type:    "header",
+		Version: BackupVersion,
+		Created: time.Now(),
+		LastID:  id,
+	}); err != nil {
+		return nil, err
+	}
+
+	iter, err := snap.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Release()
+
+	info := BackupInfo{LastID: id}
+	for iter.Next() {
+		if err := hw.line(&backupRoute{
+			Type: "route",
+			Entry: &Entry{
+				Name:  iter.Name(),
+				Route: *iter.Route(),
+			},
+		}); err != nil {
+			return nil, err
+		}
+		info.Count++
+	}
+
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	info.SHA256 = hex.EncodeToString(hw.h.Sum(nil))
+
+	b, err := json.Marshal(&backupFooter{
+		Type:   "footer",
+		Count:  info.Count,
+		SHA256: info.SHA256,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(append(b, '\n')); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// ErrBadBackup is returned by Restore when a backup is malformed, incomplete
+// or fails its checksum.
+var ErrBadBackup = errors.New("invalid backup")
+
+func badBackup(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrBadBackup, fmt.Sprintf(format, args...))
+}
+
+// Read a backup, verifying it as it goes, and spool the routes into a
+// temporary file so that nothing is restored from a backup that turns out to
+// be corrupt.
+func spoolBackup(r io.Reader) (*os.File, *BackupInfo, error) {
+	tmp, err := ioutil.TempFile("", "restore")
+	if err != nil {
+		return nil, nil, err
+	}
+	os.Remove(tmp.Name())
+
+	fail := func(err error) (*os.File, *BackupInfo, error) {
+		tmp.Close()
+		return nil, nil, err
+	}
+
+	h := sha256.New()
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxLineSize)
+	w := bufio.NewWriter(tmp)
+
+	var info *BackupInfo
+	var footer *backupLine
+	for s.Scan() {
+		b := s.Bytes()
+		if len(b) == 0 {
+			continue
+		}
+
+		if footer != nil {
+			return fail(badBackup("data after footer"))
+		}
+
+		var l backupLine
+		if err := json.Unmarshal(b, &l); err != nil {
+			return fail(badBackup("%s", err))
+		}
+
+		if info == nil && l.Type != "header" {
+			return fail(badBackup("missing header"))
+		}
+
+		switch l.Type {
+		case "header":
+			if info != nil {
+				return fail(badBackup("duplicate header"))
+			} else if l.Version != BackupVersion {
+				return fail(badBackup("unsupported version %d", l.Version))
+			}
+			info = &BackupInfo{LastID: l.LastID}
+		case "route":
+			if l.Entry == nil || l.Name == "" {
+				return fail(badBackup("route without a name"))
+			}
+			info.Count++
+			if _, err := w.Write(b); err != nil {
+				return fail(err)
+			}
+			if err := w.WriteByte('\n'); err != nil {
+				return fail(err)
+			}
+		case "footer":
+			footer = &l
+			continue
+		default:
+			return fail(badBackup("unknown line type %q", l.Type))
+		}
+
+		h.Write(b)
+		h.Write([]byte{'\n'})
+	}
+
+	if err := s.Err(); err != nil {
+		return fail(err)
+	}
+
+	if footer == nil {
+		return fail(badBackup("missing footer, the backup may be truncated"))
+	}
+
+	info.SHA256 = hex.EncodeToString(h.Sum(nil))
+	if footer.SHA256 != info.SHA256 {
+		return fail(badBackup("checksum mismatch"))
+	} else if footer.Count != info.Count {
+		return fail(badBackup("expected %d routes, found %d", footer.Count, info.Count))
+	}
+
+	if err := w.Flush(); err != nil {
+		return fail(err)
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+
+	return tmp, info, nil
+}
+
+// Restore verifies a backup written by Backup and then writes every route in
+// it to dst, in batches of batchSize routes that are each written at once, and
+// raises the ID counter to that of the backup. Routes in the backend that are
+// not in the backup are left alone. Nothing is written if the backup fails
+// verification.
+func Restore(ctx context.Context, dst backend.Backend, r io.Reader, batchSize int) (*BackupInfo, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	f, info, err := spoolBackup(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := dst.EnsureID(ctx, info.LastID); err != nil {
+		return nil, err
+	}
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, maxLineSize)
+	batch := make([]*backend.Change, 0, batchSize)
+
+	apply := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if _, err := dst.Apply(ctx, batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for s.Scan() {
+		var l backupLine
+		if err := json.Unmarshal(s.Bytes(), &l); err != nil {
+			return nil, err
+		}
+
+		batch = append(batch, &backend.Change{
+			Op:    backend.OpPut,
+			Name:  l.Entry.Name,
+			Route: &l.Entry.Route,
+		})
+		if len(batch) == batchSize {
+			if err := apply(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := apply(); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
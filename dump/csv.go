@@ -0,0 +1,156 @@
+package dump
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Columns names the CSV columns that hold each field of an entry.
+type Columns struct {
+	Name string
+	URL  string
+	Time string
+}
+
+// DefaultColumns are used when no columns are given.
+var DefaultColumns = Columns{
+	Name: "name",
+	URL:  "url",
+	Time: "time",
+}
+
+// ParseColumns parses a column mapping of the form
+// "name=Short Name,url=Destination,time=Created". Fields that are not
+// mentioned keep their default column.
+func ParseColumns(s string) (*Columns, error) {
+	c := DefaultColumns
+	if strings.TrimSpace(s) == "" {
+		return &c, nil
+	}
+
+	for _, m := range strings.Split(s, ",") {
+		ix := strings.Index(m, "=")
+		if ix == -1 {
+			return nil, fmt.Errorf("invalid column mapping %q", m)
+		}
+
+		col := strings.TrimSpace(m[ix+1:])
+		switch field := strings.TrimSpace(m[:ix]); field {
+		case "name":
+			c.Name = col
+		case "url":
+			c.URL = col
+		case "time":
+			c.Time = col
+		default:
+			return nil, fmt.Errorf("unknown field %q in column mapping", field)
+		}
+	}
+
+	return &c, nil
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func newCSVEncoder(w io.Writer, cols *Columns) (*csvEncoder, error) {
+	if cols == nil {
+		cols = &DefaultColumns
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{cols.Name, cols.URL, cols.Time}); err != nil {
+		return nil, err
+	}
+
+	return &csvEncoder{w: cw}, nil
+}
+
+func (e *csvEncoder) Encode(ent *Entry) error {
+	return e.w.Write([]string{
+		ent.Name,
+		ent.URL,
+		ent.Time.Format(time.RFC3339Nano),
+	})
+}
+
+func (e *csvEncoder) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// Parse a time from a CSV cell, which may be RFC 3339 or seconds since the
+// epoch.
+func parseCSVTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(n, 0), nil
+	}
+
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+func decodeCSV(r io.Reader, cols *Columns) ([]*Entry, error) {
+	if cols == nil {
+		cols = &DefaultColumns
+	}
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	index := func(col string) int {
+		for i, h := range header {
+			if strings.EqualFold(strings.TrimSpace(h), col) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	ni, ui, ti := index(cols.Name), index(cols.URL), index(cols.Time)
+	if ui == -1 {
+		return nil, fmt.Errorf("csv has no %q column", cols.URL)
+	}
+
+	cell := func(rec []string, i int) string {
+		if i < 0 || i >= len(rec) {
+			return ""
+		}
+		return strings.TrimSpace(rec[i])
+	}
+
+	var ents []*Entry
+	for row := 2; ; row++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return ents, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		t, err := parseCSVTime(cell(rec, ti))
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid time: %s", row, err)
+		}
+
+		ent := &Entry{Name: cell(rec, ni)}
+		ent.URL = cell(rec, ui)
+		ent.Time = t
+		ents = append(ents, ent)
+	}
+}
@@ -0,0 +1,163 @@
+// Package dump reads and writes routes in the file formats used to move links
+// into and out of the service.
+package dump
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/internal"
+)
+
+// Entry is a single named route in a dump.
+type Entry struct {
+	Name           string `json:"name" yaml:"name"`
+	internal.Route `yaml:",inline"`
+}
+
+// Format identifies one of the supported file formats.
+type Format string
+
+const (
+	// JSON is a single object mapping names to routes, as served by
+	// /admin/dumps.
+	JSON Format = "json"
+
+	// NDJSON is one JSON entry per line.
+	NDJSON Format = "ndjson"
+
+	// CSV is a table with a header row, see Columns.
+	CSV Format = "csv"
+
+	// YAML is a list of entries.
+	YAML Format = "yaml"
+
+	// HTML is the Netscape bookmarks format that browsers import and export.
+	HTML Format = "html"
+)
+
+// ParseFormat returns the format with the given name.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case JSON, NDJSON, CSV, YAML, HTML:
+		return f, nil
+	case "jsonl":
+		return NDJSON, nil
+	case "yml":
+		return YAML, nil
+	case "htm", "bookmarks":
+		return HTML, nil
+	default:
+		return "", fmt.Errorf("unknown format %q", s)
+	}
+}
+
+// FormatForFile guesses the format of a file from its extension.
+func FormatForFile(filename string) (Format, error) {
+	return ParseFormat(strings.TrimPrefix(filepath.Ext(filename), "."))
+}
+
+// ContentType is the MIME type used when serving this format.
+func (f Format) ContentType() string {
+	switch f {
+	case NDJSON:
+		return "application/x-ndjson;charset=utf-8"
+	case CSV:
+		return "text/csv;charset=utf-8"
+	case YAML:
+		return "application/x-yaml;charset=utf-8"
+	case HTML:
+		return "text/html;charset=utf-8"
+	default:
+		return "application/json;charset=utf-8"
+	}
+}
+
+// Options control how entries are read and written.
+type Options struct {
+	Format Format
+
+	// Columns maps entry fields to CSV columns. The default columns are
+	// used when this is nil.
+	Columns *Columns
+}
+
+// An Encoder writes entries to a dump.
+type Encoder interface {
+	Encode(e *Entry) error
+
+	// Close finishes the dump, it does not close the underlying writer.
+	Close() error
+}
+
+// NewEncoder returns an Encoder that writes entries in the given format.
+func NewEncoder(w io.Writer, opts *Options) (Encoder, error) {
+	switch opts.Format {
+	case JSON:
+		return newJSONEncoder(w), nil
+	case NDJSON:
+		return newNDJSONEncoder(w), nil
+	case CSV:
+		return newCSVEncoder(w, opts.Columns)
+	case YAML:
+		return newYAMLEncoder(w), nil
+	case HTML:
+		return newHTMLEncoder(w)
+	default:
+		return nil, fmt.Errorf("unknown format %q", opts.Format)
+	}
+}
+
+// Decode reads every entry from a dump.
+func Decode(r io.Reader, opts *Options) ([]*Entry, error) {
+	switch opts.Format {
+	case JSON:
+		return decodeJSON(r)
+	case NDJSON:
+		return decodeNDJSON(r)
+	case CSV:
+		return decodeCSV(r, opts.Columns)
+	case YAML:
+		return decodeYAML(r)
+	case HTML:
+		return decodeHTML(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q", opts.Format)
+	}
+}
+
+// Export writes every route in the backend, in order, and returns the number
+// of routes written.
+func Export(ctx context.Context, backend backend.Backend, w io.Writer, opts *Options) (int, error) {
+	enc, err := NewEncoder(w, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	iter, err := backend.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	defer iter.Release()
+
+	n := 0
+	for iter.Next() {
+		if err := enc.Encode(&Entry{
+			Name:  iter.Name(),
+			Route: *iter.Route(),
+		}); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	if err := iter.Error(); err != nil {
+		return n, err
+	}
+
+	return n, enc.Close()
+}
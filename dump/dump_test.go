@@ -0,0 +1,413 @@
+package dump
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kellegous/go/backend/leveldb"
+	"github.com/kellegous/go/internal"
+)
+
+func needBackend(t *testing.T) (*leveldb.Backend, func()) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err := leveldb.New(filepath.Join(tmp, "data"))
+	if err != nil {
+		os.RemoveAll(tmp)
+		t.Fatal(err)
+	}
+
+	return backend, func() {
+		backend.Close()
+		os.RemoveAll(tmp)
+	}
+}
+
+func entryOf(name, url string, t time.Time) *Entry {
+	e := &Entry{Name: name}
+	e.URL = url
+	e.Time = t
+	return e
+}
+
+func mustBeSameEntries(t *testing.T, a, b []*Entry) {
+	if len(a) != len(b) {
+		t.Fatalf("expected %d entries, got %d", len(a), len(b))
+	}
+
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].URL != b[i].URL || !a[i].Time.Equal(b[i].Time) {
+			t.Fatalf("entry %d: expected %v, got %v", i, a[i], b[i])
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	backend, done := needBackend(t)
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	ents := []*Entry{
+		entryOf(":a", "http://ga.com/", time.Unix(1601418236, 0)),
+		entryOf("a", "http://a.com/?x=1&y=2", time.Unix(1601418237, 0)),
+		entryOf("b", "http://b.com/", time.Unix(1601418238, 0)),
+	}
+
+	for _, e := range ents {
+		rt := e.Route
+		if err := backend.Put(ctx, e.Name, &rt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, f := range []Format{JSON, NDJSON, CSV, YAML, HTML} {
+		t.Logf("format %s", f)
+
+		opts := &Options{Format: f}
+
+		var buf bytes.Buffer
+		n, err := Export(ctx, backend, &buf, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n != len(ents) {
+			t.Fatalf("expected %d routes exported, got %d", len(ents), n)
+		}
+
+		res, err := Decode(&buf, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mustBeSameEntries(t, ents, res)
+	}
+}
+
+func TestEmptyExport(t *testing.T) {
+	backend, done := needBackend(t)
+	defer done()
+
+	for _, f := range []Format{JSON, NDJSON, CSV, YAML, HTML} {
+		opts := &Options{Format: f}
+
+		var buf bytes.Buffer
+		if _, err := Export(context.Background(), backend, &buf, opts); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := Decode(&buf, opts)
+		if err != nil {
+			t.Fatalf("format %s: %s", f, err)
+		}
+
+		if len(res) != 0 {
+			t.Fatalf("format %s: expected no entries, got %d", f, len(res))
+		}
+	}
+}
+
+func TestCSVColumns(t *testing.T) {
+	cols, err := ParseColumns("name=Short, url=Destination")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := "Destination,Owner,Short,time\n" +
+		"http://a.com/,kel,a,1601418236\n" +
+		"http://b.com/,kel,,\n"
+
+	res, err := Decode(strings.NewReader(src), &Options{
+		Format:  CSV,
+		Columns: cols,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustBeSameEntries(t, []*Entry{
+		entryOf("a", "http://a.com/", time.Unix(1601418236, 0)),
+		entryOf("", "http://b.com/", time.Time{}),
+	}, res)
+
+	if _, err := ParseColumns("owner=Owner"); err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+
+	if _, err := Decode(strings.NewReader(src), &Options{Format: CSV}); err == nil {
+		t.Fatal("expected an error for a missing url column")
+	}
+}
+
+func TestBookmarks(t *testing.T) {
+	src := `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<DL><p>
+	<DT><H3>Folder</H3>
+	<DL><p>
+		<DT><A HREF="http://a.com/" ADD_DATE="1601418236">The A Page!</A>
+		<DT><A HREF="http://b.com/" SHORTCUTURL="b">B</A>
+	</DL><p>
+</DL><p>`
+
+	res, err := Decode(strings.NewReader(src), &Options{Format: HTML})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustBeSameEntries(t, []*Entry{
+		entryOf("the-a-page", "http://a.com/", time.Unix(1601418236, 0)),
+		entryOf("b", "http://b.com/", time.Time{}),
+	}, res)
+}
+
+func TestImport(t *testing.T) {
+	backend, done := needBackend(t)
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := backend.Put(ctx, name, &internal.Route{
+			URL:  "http://old/",
+			Time: time.Now(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ents := []*Entry{
+		entryOf("a", "http://new/", time.Time{}),
+		entryOf("c", "http://old/", time.Time{}),
+		entryOf("d", "http://new/", time.Unix(1601418236, 0)),
+		entryOf(":5", "http://gen/", time.Time{}),
+		entryOf("", "http://unnamed/", time.Time{}),
+		entryOf("bad", "not a url", time.Time{}),
+	}
+
+	validate := func(name string, rt *internal.Route) error {
+		if !strings.HasPrefix(rt.URL, "http://") {
+			return errors.New("invalid URL")
+		}
+		return nil
+	}
+
+	rep, err := Import(ctx, backend, ents, &ImportOptions{
+		Conflict: Rename,
+		DryRun:   true,
+		Validate: validate,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.Renamed != 1 || rep.Created != 3 || rep.Unchanged != 1 || rep.Invalid != 1 {
+		t.Fatalf("unexpected dry run report %+v", rep)
+	}
+
+	if _, err := backend.Get(ctx, "d"); err != internal.ErrRouteNotFound {
+		t.Fatal("dry run should not have created d")
+	}
+
+	rep, err = Import(ctx, backend, ents, &ImportOptions{
+		Conflict: Rename,
+		Validate: validate,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.Results[0].Action != Renamed || rep.Results[0].NewName != "a-2" {
+		t.Fatalf("expected a to be renamed to a-2, got %+v", rep.Results[0])
+	}
+
+	for name, url := range map[string]string{
+		"a":   "http://old/",
+		"a-2": "http://new/",
+		"d":   "http://new/",
+		":5":  "http://gen/",
+		":6":  "http://unnamed/",
+	} {
+		rt, err := backend.Get(ctx, name)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if rt.URL != url {
+			t.Fatalf("%s: expected url of %s, got %s", name, url, rt.URL)
+		}
+	}
+
+	if rt, _ := backend.Get(ctx, "d"); rt.Time.Unix() != 1601418236 {
+		t.Fatalf("expected time to be preserved, got %s", rt.Time)
+	}
+
+	if id, err := backend.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 6 {
+		t.Fatalf("expected the id counter to be 6, got %d", id)
+	}
+
+	rep, err = Import(ctx, backend, ents[:1], &ImportOptions{Conflict: Overwrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.Overwritten != 1 {
+		t.Fatalf("expected a to be overwritten, got %+v", rep)
+	}
+
+	rep, err = Import(ctx, backend, []*Entry{entryOf("b", "http://new/", time.Time{})}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.Skipped != 1 {
+		t.Fatalf("expected b to be skipped, got %+v", rep)
+	}
+
+	// a route is only unchanged if its time matches too, when there is one.
+	rep, err = Import(ctx, backend, []*Entry{
+		entryOf("d", "http://new/", time.Unix(1601418237, 0)),
+	}, &ImportOptions{Conflict: Overwrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.Overwritten != 1 {
+		t.Fatalf("expected d to be overwritten, got %+v", rep)
+	}
+
+	rep, err = Import(ctx, backend, []*Entry{
+		entryOf("d", "http://new/", time.Unix(1601418237, 0)),
+	}, &ImportOptions{Conflict: Overwrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rep.Unchanged != 1 {
+		t.Fatalf("expected d to be unchanged, got %+v", rep)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	src, done := needBackend(t)
+	defer done()
+
+	dst, done := needBackend(t)
+	defer done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	names := []string{"a", "b", "c", "d", "e"}
+	for i, name := range names {
+		if err := src.Put(ctx, name, &internal.Route{
+			URL:  "http://" + name + "/",
+			Time: time.Unix(0, int64(i)),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := src.EnsureID(ctx, 7); err != nil {
+		t.Fatal(err)
+	}
+
+	snap, err := src.Snapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+
+	// changes after the snapshot must not appear in the backup.
+	if err := src.Put(ctx, "f", &internal.Route{URL: "http://f/"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.NextID(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	info, err := Backup(ctx, snap, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Count != len(names) || info.LastID != 7 {
+		t.Fatalf("unexpected backup info %+v", info)
+	}
+
+	b := buf.Bytes()
+
+	// corrupt a route and make sure nothing is restored.
+	bad := bytes.Replace(b, []byte("http://c/"), []byte("http://x/"), 1)
+	if _, err := Restore(ctx, dst, bytes.NewReader(bad), 2); !errors.Is(err, ErrBadBackup) {
+		t.Fatalf("expected ErrBadBackup, got %v", err)
+	}
+
+	// a truncated backup is also rejected.
+	if _, err := Restore(ctx, dst, bytes.NewReader(b[:len(b)/2]), 2); !errors.Is(err, ErrBadBackup) {
+		t.Fatalf("expected ErrBadBackup, got %v", err)
+	}
+
+	if _, err := dst.Get(ctx, "a"); err != internal.ErrRouteNotFound {
+		t.Fatal("expected nothing to be restored from a bad backup")
+	}
+
+	res, err := Restore(ctx, dst, bytes.NewReader(b), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *res != *info {
+		t.Fatalf("expected restore info %+v, got %+v", info, res)
+	}
+
+	for i, name := range names {
+		rt, err := dst.Get(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rt.URL != "http://"+name+"/" || rt.Time.UnixNano() != int64(i) {
+			t.Fatalf("unexpected route for %s: %v", name, rt)
+		}
+	}
+
+	if _, err := dst.Get(ctx, "f"); err != internal.ErrRouteNotFound {
+		t.Fatal("expected f not to be restored")
+	}
+
+	if id, err := dst.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 7 {
+		t.Fatalf("expected id counter of 7, got %d", id)
+	}
+}
+
+func TestDecodeAPIRoutes(t *testing.T) {
+	src := `{"ok":true,"routes":[{"name":"a","url":"http://a.com/"},{"name":"b","url":"http://b.com/","time":"2020-09-29T22:23:56Z"}],"next":""}`
+
+	res, err := Decode(strings.NewReader(src), &Options{Format: JSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustBeSameEntries(t, []*Entry{
+		entryOf("a", "http://a.com/", time.Time{}),
+		entryOf("b", "http://b.com/", time.Unix(1601418236, 0)),
+	}, res)
+}
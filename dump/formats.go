@@ -0,0 +1,179 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/kellegous/go/internal"
+)
+
+type jsonEncoder struct {
+	w io.Writer
+	n int
+}
+
+func newJSONEncoder(w io.Writer) *jsonEncoder {
+	return &jsonEncoder{w: w}
+}
+
+func (e *jsonEncoder) Encode(ent *Entry) error {
+	k, err := json.Marshal(ent.Name)
+	if err != nil {
+		return err
+	}
+
+	v, err := json.Marshal(&ent.Route)
+	if err != nil {
+		return err
+	}
+
+	sep := ","
+	if e.n == 0 {
+		sep = "{"
+	}
+	e.n++
+
+	_, err = io.WriteString(e.w, sep+string(k)+":"+string(v))
+	return err
+}
+
+func (e *jsonEncoder) Close() error {
+	end := "}\n"
+	if e.n == 0 {
+		end = "{}\n"
+	}
+	_, err := io.WriteString(e.w, end)
+	return err
+}
+
+func decodeJSON(r io.Reader) ([]*Entry, error) {
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	if isAPIRoutes(raw) {
+		var ents []*Entry
+		if err := json.Unmarshal(raw["routes"], &ents); err != nil {
+			return nil, err
+		}
+		return ents, nil
+	}
+
+	m := make(map[string]internal.Route, len(raw))
+	for name, b := range raw {
+		var rt internal.Route
+		if err := json.Unmarshal(b, &rt); err != nil {
+			return nil, err
+		}
+		m[name] = rt
+	}
+
+	ents := make([]*Entry, 0, len(m))
+	for name, rt := range m {
+		ents = append(ents, &Entry{
+			Name:  name,
+			Route: rt,
+		})
+	}
+
+	sort.Slice(ents, func(i, j int) bool {
+		return ents[i].Name < ents[j].Name
+	})
+
+	return ents, nil
+}
+
+// Is this the response of /api/urls/, which has long been used as a dump,
+// rather than a map of names to routes?
+func isAPIRoutes(raw map[string]json.RawMessage) bool {
+	ok, routes := raw["ok"], raw["routes"]
+	return len(ok) > 0 && ok[0] != '{' &&
+		len(routes) > 0 && routes[0] == '['
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func newNDJSONEncoder(w io.Writer) *ndjsonEncoder {
+	return &ndjsonEncoder{
+		enc: json.NewEncoder(w),
+	}
+}
+
+func (e *ndjsonEncoder) Encode(ent *Entry) error {
+	return e.enc.Encode(ent)
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
+
+func decodeNDJSON(r io.Reader) ([]*Entry, error) {
+	var ents []*Entry
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var ent Entry
+		if err := json.Unmarshal(line, &ent); err != nil {
+			return nil, err
+		}
+		ents = append(ents, &ent)
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return ents, nil
+}
+
+type yamlEncoder struct {
+	w io.Writer
+	n int
+}
+
+func newYAMLEncoder(w io.Writer) *yamlEncoder {
+	return &yamlEncoder{w: w}
+}
+
+func (e *yamlEncoder) Encode(ent *Entry) error {
+	// Each entry is written as a list of one so that the output, taken
+	// together, is a single list.
+	b, err := yaml.Marshal([]*Entry{ent})
+	if err != nil {
+		return err
+	}
+	e.n++
+
+	_, err = e.w.Write(b)
+	return err
+}
+
+func (e *yamlEncoder) Close() error {
+	if e.n > 0 {
+		return nil
+	}
+	_, err := io.WriteString(e.w, "[]\n")
+	return err
+}
+
+func decodeYAML(r io.Reader) ([]*Entry, error) {
+	var ents []*Entry
+	if err := yaml.NewDecoder(r).Decode(&ents); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return ents, nil
+}
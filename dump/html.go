@@ -0,0 +1,119 @@
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	nethtml "golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const bookmarksHeader = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+`
+
+type htmlEncoder struct {
+	w io.Writer
+}
+
+func newHTMLEncoder(w io.Writer) (*htmlEncoder, error) {
+	if _, err := io.WriteString(w, bookmarksHeader); err != nil {
+		return nil, err
+	}
+	return &htmlEncoder{w: w}, nil
+}
+
+func (e *htmlEncoder) Encode(ent *Entry) error {
+	_, err := fmt.Fprintf(e.w,
+		"    <DT><A HREF=\"%s\" ADD_DATE=\"%d\" SHORTCUTURL=\"%s\">%s</A>\n",
+		html.EscapeString(ent.URL),
+		ent.Time.Unix(),
+		html.EscapeString(ent.Name),
+		html.EscapeString(ent.Name))
+	return err
+}
+
+func (e *htmlEncoder) Close() error {
+	_, err := io.WriteString(e.w, "</DL><p>\n")
+	return err
+}
+
+// Turn the title of a bookmark into something that can be used as a name.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+// Bookmarks are named after their keyword (SHORTCUTURL) when they have one and
+// otherwise after their title.
+func decodeHTML(r io.Reader) ([]*Entry, error) {
+	var ents []*Entry
+	var cur *Entry
+	var title bytes.Buffer
+
+	z := nethtml.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case nethtml.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			return ents, nil
+		case nethtml.StartTagToken:
+			tok := z.Token()
+			if tok.DataAtom != atom.A {
+				continue
+			}
+
+			cur = &Entry{}
+			title.Reset()
+			for _, a := range tok.Attr {
+				switch strings.ToLower(a.Key) {
+				case "href":
+					cur.URL = a.Val
+				case "shortcuturl":
+					cur.Name = a.Val
+				case "add_date":
+					if n, err := strconv.ParseInt(a.Val, 10, 64); err == nil {
+						cur.Time = time.Unix(n, 0)
+					}
+				}
+			}
+		case nethtml.TextToken:
+			if cur != nil {
+				title.Write(z.Text())
+			}
+		case nethtml.EndTagToken:
+			if cur == nil || z.Token().DataAtom != atom.A {
+				continue
+			}
+
+			if cur.Name == "" {
+				cur.Name = slugify(title.String())
+			}
+
+			if cur.URL != "" {
+				ents = append(ents, cur)
+			}
+			cur = nil
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package dump
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/backend/migrate"
+	"github.com/kellegous/go/ids"
+	"github.com/kellegous/go/internal"
+)
+
+// maxRenames bounds the search for a free name when renaming.
+const maxRenames = 1000
+
+// Conflict is the strategy used when an imported name already exists with a
+// different URL or time.
+type Conflict string
+
+const (
+	// Skip leaves the existing route in place.
+	Skip Conflict = "skip"
+
+	// Overwrite replaces the existing route.
+	Overwrite Conflict = "overwrite"
+
+	// Rename imports the route under a new name with a numeric suffix.
+	Rename Conflict = "rename"
+)
+
+// ParseConflict returns the strategy with the given name.
+func ParseConflict(s string) (Conflict, error) {
+	switch c := Conflict(s); c {
+	case Skip, Overwrite, Rename:
+		return c, nil
+	case "":
+		return Skip, nil
+	default:
+		return "", fmt.Errorf("unknown conflict strategy %q", s)
+	}
+}
+
+// Action is what an import did, or would do, with an entry.
+type Action string
+
+const (
+	Created     Action = "created"
+	Overwritten Action = "overwritten"
+	Renamed     Action = "renamed"
+	Skipped     Action = "skipped"
+	Unchanged   Action = "unchanged"
+	Invalid     Action = "invalid"
+)
+
+// ImportOptions controls the behavior of Import.
+type ImportOptions struct {
+	Conflict Conflict
+
+	// DryRun reports what would change without changing anything.
+	DryRun bool
+
+	// Validate, if set, is called for each entry. Entries that fail
+	// validation are reported as invalid and are not imported.
+	Validate func(name string, rt *internal.Route) error
+
+	// Names generates the names of entries without one. If it is nil, names
+	// are generated sequentially.
+	Names ids.Generator
+}
+
+// Result describes what happened to a single entry.
+type Result struct {
+	Name   string `json:"name"`
+	Action Action `json:"action"`
+
+	// NewName is the name the entry was stored under if it was renamed or was
+	// given a generated name.
+	NewName string `json:"new_name,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Report summarizes an import. Results includes every entry that was not
+// unchanged.
+type Report struct {
+	Created     int       `json:"created"`
+	Overwritten int       `json:"overwritten"`
+	Renamed     int       `json:"renamed"`
+	Skipped     int       `json:"skipped"`
+	Unchanged   int       `json:"unchanged"`
+	Invalid     int       `json:"invalid"`
+	Results     []*Result `json:"results"`
+}
+
+func (r *Report) add(res *Result) {
+	switch res.Action {
+	case Created:
+		r.Created++
+	case Overwritten:
+		r.Overwritten++
+	case Renamed:
+		r.Renamed++
+	case Skipped:
+		r.Skipped++
+	case Unchanged:
+		r.Unchanged++
+		return
+	case Invalid:
+		r.Invalid++
+	}
+	r.Results = append(r.Results, res)
+}
+
+// Does the entry match the existing route? Entries without a time only need
+// to match its URL.
+func same(ent *Entry, cur *internal.Route) bool {
+	if ent.Time.IsZero() {
+		return ent.URL == cur.URL
+	}
+	return migrate.Equal(&ent.Route, cur)
+}
+
+// Find the first name of the form name-N that is not in use.
+func freeName(ctx context.Context, backend backend.Backend, name string) (string, error) {
+	for i := 2; i < maxRenames; i++ {
+		n := fmt.Sprintf("%s-%d", name, i)
+		if _, err := backend.Get(ctx, n); errors.Is(err, internal.ErrRouteNotFound) {
+			return n, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no free name for %s", name)
+}
+
+// Import the given entries into the backend. Entries without a name are given
+// a generated name. Errors from the backend abort the import, problems with
+// individual entries are recorded in the report.
+func Import(ctx context.Context, backend backend.Backend, ents []*Entry, opts *ImportOptions) (*Report, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+
+	conflict := opts.Conflict
+	if conflict == "" {
+		conflict = Skip
+	}
+
+	names := opts.Names
+	if names == nil {
+		names = ids.NewSequential(backend)
+	}
+
+	// Generated names that are imported must never be handed out again, so
+	// they are reserved before any new names are generated.
+	if !opts.DryRun {
+		named := make([]string, 0, len(ents))
+		for _, ent := range ents {
+			if ent.Name != "" {
+				named = append(named, ent.Name)
+			}
+		}
+
+		if err := names.Reserve(ctx, named...); err != nil {
+			return nil, err
+		}
+	}
+
+	var rep Report
+	now := time.Now()
+
+	for _, ent := range ents {
+		rt := ent.Route
+		if rt.Time.IsZero() {
+			rt.Time = now
+		}
+
+		res := &Result{Name: ent.Name}
+
+		if opts.Validate != nil {
+			if err := opts.Validate(ent.Name, &rt); err != nil {
+				res.Action = Invalid
+				res.Error = err.Error()
+				rep.add(res)
+				continue
+			}
+		}
+
+		name := ent.Name
+		if name == "" {
+			res.Action = Created
+			if !opts.DryRun {
+				var err error
+				name, err = names.Next(ctx)
+				if err != nil {
+					return nil, err
+				}
+				res.NewName = name
+			}
+		} else if cur, err := backend.Get(ctx, name); errors.Is(err, internal.ErrRouteNotFound) {
+			res.Action = Created
+		} else if err != nil {
+			return nil, err
+		} else if same(ent, cur) {
+			res.Action = Unchanged
+		} else {
+			switch conflict {
+			case Skip:
+				res.Action = Skipped
+			case Overwrite:
+				res.Action = Overwritten
+			case Rename:
+				res.Action = Renamed
+				if name, err = freeName(ctx, backend, name); err != nil {
+					return nil, err
+				}
+				res.NewName = name
+			}
+		}
+
+		rep.add(res)
+
+		if opts.DryRun || res.Action == Unchanged || res.Action == Skipped {
+			continue
+		}
+
+		if err := backend.Put(ctx, name, &rt); err != nil {
+			return nil, err
+		}
+	}
+
+	return &rep, nil
+}
@@ -0,0 +1,38 @@
+package ids
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	"github.com/kellegous/go/backend"
+)
+
+// AddFlags registers the flags that choose how names are generated.
+func AddFlags(fs *pflag.FlagSet) {
+	fs.String("id-strategy", "sequential", "How names are generated for links created without one. 'sequential', 'random', 'permuted' and 'words' currently supported.")
+	fs.String("id-alphabet", DefaultAlphabet, "The characters random names are made of")
+	fs.Int("id-length", 8, "The number of characters in a random name")
+	fs.String("id-key", "", "Secret key the permuted strategy scrambles the ID counter with. Best set through the ID_KEY environment variable.")
+	fs.Int("id-retries", DefaultRetries, "How many times a generated name that is already in use is generated again")
+}
+
+// Open the generator described by the flags, which takes names and IDs from
+// the given backend. Names generated by any strategy keep resolving after
+// the strategy is changed.
+func Open(b backend.Backend) (Generator, error) {
+	retries := viper.GetInt("id-retries")
+	switch name := viper.GetString("id-strategy"); name {
+	case "", "sequential":
+		return NewSequential(b), nil
+	case "random":
+		return NewRandom(b, viper.GetString("id-alphabet"), viper.GetInt("id-length"), retries)
+	case "permuted":
+		return NewPermuted(b, viper.GetString("id-key"), retries)
+	case "words":
+		return NewWords(b, retries), nil
+	default:
+		return nil, fmt.Errorf("unknown id strategy %q", name)
+	}
+}
@@ -0,0 +1,318 @@
+// Package ids generates the names of links that are created without one.
+// Every generated name starts with internal.GeneratedPrefix, so that it is
+// never a name someone would choose and is listed apart from chosen names.
+package ids
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/internal"
+)
+
+// Generator hands out names for links that are created without one.
+type Generator interface {
+	// Next returns a name that was not in use when it was generated.
+	Next(ctx context.Context) (string, error)
+
+	// Reserve makes sure that none of the given names, which were chosen
+	// explicitly, are handed out by Next.
+	Reserve(ctx context.Context, names ...string) error
+}
+
+// DefaultRetries is the number of times a name that is already in use is
+// generated again.
+const DefaultRetries = 5
+
+// ErrNoFreeName is returned by Next when every name it generated was in use.
+var ErrNoFreeName = errors.New("no free name was generated, try again")
+
+// Check whether a route is stored under name.
+func inUse(ctx context.Context, b backend.Backend, name string) (bool, error) {
+	_, err := b.Get(ctx, name)
+	if errors.Is(err, internal.ErrRouteNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Generate names with gen until one is not in use.
+func firstFree(ctx context.Context, b backend.Backend, retries int, gen func() (string, error)) (string, error) {
+	for i := 0; i <= retries; i++ {
+		name, err := gen()
+		if err != nil {
+			return "", err
+		}
+
+		used, err := inUse(ctx, b, name)
+		if err != nil {
+			return "", err
+		} else if !used {
+			return name, nil
+		}
+	}
+	return "", ErrNoFreeName
+}
+
+// sequential names are the ID counter encoded in base62, which is short but
+// lets anyone enumerate every generated link.
+type sequential struct {
+	b backend.Backend
+}
+
+// NewSequential returns a generator of the names :1, :2, and so on, from the
+// backend's ID counter. An ID whose name is in use is skipped, which can only
+// happen when IDs are leased in blocks and another server reserved the name
+// after the block was leased.
+func NewSequential(b backend.Backend) Generator {
+	return &sequential{b: b}
+}
+
+// Next encodes the next ID whose name is not in use.
+func (g *sequential) Next(ctx context.Context) (string, error) {
+	return firstFree(ctx, g.b, DefaultRetries, func() (string, error) {
+		id, err := g.b.NextID(ctx)
+		if err != nil {
+			return "", err
+		}
+		return internal.EncodeID(id), nil
+	})
+}
+
+// Reserve advances the ID counter past every name that encodes an ID. Names
+// that encode IDs above backend.MaxID are never handed out, so they are not
+// reserved.
+func (g *sequential) Reserve(ctx context.Context, names ...string) error {
+	var max uint64
+	for _, name := range names {
+		if id, ok := backend.CountedID(name); ok && id > max {
+			max = id
+		}
+	}
+
+	if max == 0 {
+		return nil
+	}
+	return g.b.EnsureID(ctx, max)
+}
+
+// FromCounter reports whether the names g generates encode IDs from the
+// backend's counter, in which case the counter must stay at or above every
+// generated name in use. A nil generator is the sequential one.
+func FromCounter(g Generator) bool {
+	if g == nil {
+		return true
+	}
+	_, ok := g.(*sequential)
+	return ok
+}
+
+// scrambledPrefix starts random and permuted names. The character after
+// internal.GeneratedPrefix is not a base62 digit, so the names never decode
+// as IDs and the backends do not raise the counter for them.
+const scrambledPrefix = string(internal.GeneratedPrefix) + "~"
+
+// DefaultAlphabet is the alphabet random names are made of by default.
+const DefaultAlphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// Whether c can appear in a name without being escaped in a URL.
+func isUnreserved(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		strings.ContainsRune("-._~", c)
+}
+
+// Pick a random index below n.
+func randIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
+
+type random struct {
+	b        backend.Backend
+	alphabet []rune
+	length   int
+	retries  int
+}
+
+// NewRandom returns a generator of names like :~k3Jd8aQz, made of length
+// characters picked at random from alphabet. A name that is in use is picked
+// again, up to retries times.
+func NewRandom(b backend.Backend, alphabet string, length, retries int) (Generator, error) {
+	chars := []rune(alphabet)
+	if len(chars) < 2 {
+		return nil, errors.New("an alphabet needs at least 2 characters")
+	}
+
+	seen := map[rune]bool{}
+	for _, c := range chars {
+		if !isUnreserved(c) {
+			return nil, fmt.Errorf("%q cannot be used in a name", c)
+		} else if seen[c] {
+			return nil, fmt.Errorf("%q is in the alphabet more than once", c)
+		}
+		seen[c] = true
+	}
+
+	if length < 1 {
+		return nil, errors.New("the length of a name must be at least 1")
+	}
+
+	return &random{
+		b:        b,
+		alphabet: chars,
+		length:   length,
+		retries:  retries,
+	}, nil
+}
+
+// Next picks a name that is not in use.
+func (g *random) Next(ctx context.Context) (string, error) {
+	return firstFree(ctx, g.b, g.retries, func() (string, error) {
+		name := make([]rune, 0, g.length+len(scrambledPrefix))
+		name = append(name, []rune(scrambledPrefix)...)
+		for i := 0; i < g.length; i++ {
+			ix, err := randIndex(len(g.alphabet))
+			if err != nil {
+				return "", err
+			}
+			name = append(name, g.alphabet[ix])
+		}
+		return string(name), nil
+	})
+}
+
+// Reserve does nothing, since Next never hands out a name that is in use.
+func (g *random) Reserve(ctx context.Context, names ...string) error {
+	return nil
+}
+
+// The number of bits in the IDs that are permuted, which keeps names to at
+// most 7 characters while leaving room for a trillion of them.
+const permutedBits = 40
+
+// The number of rounds of the Feistel network that permutes IDs.
+const permutedRounds = 4
+
+type permuted struct {
+	b       backend.Backend
+	key     []byte
+	retries int
+}
+
+// NewPermuted returns a generator that takes IDs from the backend's counter,
+// like NewSequential, but scrambles each one with a keyed permutation so that
+// the names cannot be enumerated without the key. Every ID gives a different
+// name, but a name may still be in use if it was chosen explicitly, or if the
+// key or the strategy was changed. Such a name is skipped, up to retries
+// times.
+func NewPermuted(b backend.Backend, key string, retries int) (Generator, error) {
+	if key == "" {
+		return nil, errors.New("a key is required to permute IDs")
+	}
+
+	return &permuted{
+		b:       b,
+		key:     []byte(key),
+		retries: retries,
+	}, nil
+}
+
+// The round function of the Feistel network, which is the HMAC of the round
+// and the half of the ID it is given.
+func (g *permuted) round(i int, half uint64) uint64 {
+	var b [9]byte
+	b[0] = byte(i)
+	binary.BigEndian.PutUint64(b[1:], half)
+
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write(b[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil)) & (1<<(permutedBits/2) - 1)
+}
+
+// Permute an ID below 1<<permutedBits to another below it.
+func (g *permuted) permute(id uint64) uint64 {
+	const half = permutedBits / 2
+	l, r := id>>half, id&(1<<half-1)
+	for i := 0; i < permutedRounds; i++ {
+		l, r = r, l^g.round(i, r)
+	}
+	return l<<half | r
+}
+
+// Next permutes the next ID.
+func (g *permuted) Next(ctx context.Context) (string, error) {
+	return firstFree(ctx, g.b, g.retries, func() (string, error) {
+		id, err := g.b.NextID(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		if id >= 1<<permutedBits {
+			return "", errors.New("every permuted ID has been handed out")
+		}
+
+		// the permutation may give 0, which has no name.
+		return scrambledPrefix + internal.EncodeID(g.permute(id) + 1)[1:], nil
+	})
+}
+
+// Reserve does nothing, since Next never hands out a name that is in use.
+func (g *permuted) Reserve(ctx context.Context, names ...string) error {
+	return nil
+}
+
+type words struct {
+	b       backend.Backend
+	retries int
+}
+
+// NewWords returns a generator of readable names like :brave-otter-42, made
+// of an adjective, an animal and a number. A name that is in use is picked
+// again, up to retries times. There are about 370,000 such names, so they
+// are meant for links that are easy to say rather than hard to guess.
+func NewWords(b backend.Backend, retries int) Generator {
+	return &words{
+		b:       b,
+		retries: retries,
+	}
+}
+
+// Next picks a name that is not in use.
+func (g *words) Next(ctx context.Context) (string, error) {
+	return firstFree(ctx, g.b, g.retries, func() (string, error) {
+		a, err := randIndex(len(adjectives))
+		if err != nil {
+			return "", err
+		}
+
+		n, err := randIndex(len(animals))
+		if err != nil {
+			return "", err
+		}
+
+		d, err := randIndex(90)
+		if err != nil {
+			return "", err
+		}
+
+		return fmt.Sprintf("%c%s-%s-%d", internal.GeneratedPrefix, adjectives[a], animals[n], d+10), nil
+	})
+}
+
+// Reserve does nothing, since Next never hands out a name that is in use.
+func (g *words) Reserve(ctx context.Context, names ...string) error {
+	return nil
+}
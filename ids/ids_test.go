@@ -0,0 +1,207 @@
+package ids
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/backend/memory"
+	"github.com/kellegous/go/internal"
+)
+
+func newBackend(t *testing.T) backend.Backend {
+	b, err := memory.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func mustPut(t *testing.T, b backend.Backend, name string) {
+	if err := b.Put(context.Background(), name, &internal.Route{
+		URL:  "https://example.com/",
+		Time: time.Unix(1601418236, 0),
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A generator that always generates the same names, in turn.
+func fixed(names ...string) func() (string, error) {
+	i := 0
+	return func() (string, error) {
+		name := names[i%len(names)]
+		i++
+		return name, nil
+	}
+}
+
+func TestSequential(t *testing.T) {
+	ctx := context.Background()
+	b := newBackend(t)
+	defer b.Close()
+
+	g := NewSequential(b)
+
+	name, err := g.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name != internal.EncodeID(1) {
+		t.Fatalf("expected %s, got %s", internal.EncodeID(1), name)
+	}
+
+	if err := g.Reserve(ctx, "a", internal.EncodeID(10), internal.EncodeID(5)); err != nil {
+		t.Fatal(err)
+	}
+
+	name, err = g.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name != internal.EncodeID(11) {
+		t.Fatalf("expected %s, got %s", internal.EncodeID(11), name)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	ctx := context.Background()
+	b := newBackend(t)
+	defer b.Close()
+
+	for _, test := range []struct {
+		alphabet string
+		length   int
+	}{
+		{"a", 8},
+		{"ab/", 8},
+		{"aba", 8},
+		{"ab", 0},
+	} {
+		if _, err := NewRandom(b, test.alphabet, test.length, DefaultRetries); err == nil {
+			t.Fatalf("expected %q with length %d to fail", test.alphabet, test.length)
+		}
+	}
+
+	g, err := NewRandom(b, "xyz", 6, DefaultRetries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	re := regexp.MustCompile(`^:~[xyz]{6}$`)
+	for i := 0; i < 20; i++ {
+		name, err := g.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !re.MatchString(name) {
+			t.Fatalf("unexpected name %s", name)
+		}
+
+		if _, ok := internal.DecodeID(name); ok {
+			t.Fatalf("expected %s not to decode as an ID", name)
+		}
+	}
+}
+
+func TestPermuted(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := NewPermuted(nil, "", DefaultRetries); err == nil {
+		t.Fatal("expected a permutation without a key to fail")
+	}
+
+	a := &permuted{key: []byte("a")}
+	b := &permuted{key: []byte("b")}
+
+	seen := map[uint64]bool{}
+	same := 0
+	for id := uint64(1); id <= 10000; id++ {
+		p := a.permute(id)
+		if p >= 1<<permutedBits {
+			t.Fatalf("%d was permuted to %d, which is out of range", id, p)
+		} else if seen[p] {
+			t.Fatalf("%d was permuted to %d, which was already seen", id, p)
+		}
+		seen[p] = true
+
+		if p == b.permute(id) {
+			same++
+		}
+	}
+
+	if same > 10 {
+		t.Fatalf("expected different keys to give different permutations, %d were the same", same)
+	}
+
+	be := newBackend(t)
+	defer be.Close()
+
+	g, err := NewPermuted(be, "shh", DefaultRetries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := g.Next(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(name, ":~") {
+		t.Fatalf("unexpected name %s", name)
+	}
+
+	// the name does not decode as an ID, so it does not move the counter.
+	if _, ok := internal.DecodeID(name); ok {
+		t.Fatalf("expected %s not to decode as an ID", name)
+	}
+}
+
+func TestWords(t *testing.T) {
+	ctx := context.Background()
+	b := newBackend(t)
+	defer b.Close()
+
+	g := NewWords(b, DefaultRetries)
+
+	re := regexp.MustCompile(`^:[a-z]+-[a-z]+-[1-9][0-9]$`)
+	for i := 0; i < 20; i++ {
+		name, err := g.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !re.MatchString(name) {
+			t.Fatalf("unexpected name %s", name)
+		}
+	}
+}
+
+func TestFirstFree(t *testing.T) {
+	ctx := context.Background()
+	b := newBackend(t)
+	defer b.Close()
+
+	mustPut(t, b, ":a")
+	mustPut(t, b, ":b")
+
+	name, err := firstFree(ctx, b, 2, fixed(":a", ":b", ":c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name != ":c" {
+		t.Fatalf("expected :c, got %s", name)
+	}
+
+	if _, err := firstFree(ctx, b, 1, fixed(":a", ":b", ":c")); !errors.Is(err, ErrNoFreeName) {
+		t.Fatalf("expected ErrNoFreeName, got %v", err)
+	}
+}
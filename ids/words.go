@@ -0,0 +1,24 @@
+package ids
+
+// The words names are made of. They are short, common and hard to misspell.
+var adjectives = []string{
+	"able", "bold", "brave", "bright", "brisk", "calm", "clever", "cozy",
+	"crisp", "curious", "daring", "eager", "early", "fair", "fancy", "fast",
+	"fierce", "fond", "free", "fresh", "gentle", "glad", "golden", "grand",
+	"happy", "hardy", "honest", "humble", "jolly", "keen", "kind", "lively",
+	"loyal", "lucky", "merry", "mighty", "modest", "neat", "nimble", "noble",
+	"plucky", "polite", "proud", "quick", "quiet", "rapid", "ready", "rosy",
+	"shiny", "silent", "silly", "smart", "snappy", "steady", "sunny", "swift",
+	"tidy", "tiny", "upbeat", "vivid", "warm", "wise", "witty", "zesty",
+}
+
+var animals = []string{
+	"badger", "bat", "bear", "beaver", "bison", "camel", "cat", "cheetah",
+	"cobra", "crane", "crow", "deer", "dingo", "dog", "dolphin", "donkey",
+	"duck", "eagle", "eel", "elk", "falcon", "ferret", "finch", "fox",
+	"frog", "gecko", "goat", "goose", "gull", "hare", "hawk", "heron",
+	"horse", "hyena", "ibis", "koala", "lemur", "lion", "llama", "lynx",
+	"mole", "moose", "mouse", "newt", "otter", "owl", "panda", "parrot",
+	"pony", "puffin", "quail", "rabbit", "raven", "robin", "seal", "shark",
+	"sloth", "swan", "tiger", "toad", "trout", "walrus", "wolf", "yak",
+}
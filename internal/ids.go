@@ -0,0 +1,52 @@
+package internal
+
+import "strings"
+
+// GeneratedPrefix starts every name that was generated from the ID counter.
+const GeneratedPrefix = ':'
+
+const alpha = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// EncodeID is a very simple encoding of numeric ids. This is simply a base62
+// encoding, least significant digit first, prefixed with ":"
+func EncodeID(id uint64) string {
+	n := uint64(len(alpha))
+	b := make([]byte, 0, 12)
+	if id == 0 {
+		return "0"
+	}
+
+	b = append(b, GeneratedPrefix)
+
+	for id > 0 {
+		b = append(b, alpha[id%n])
+		id /= n
+	}
+
+	return string(b)
+}
+
+// DecodeID returns the id that the given name was generated from by EncodeID.
+// The second return value is false if the name was not generated.
+func DecodeID(name string) (uint64, bool) {
+	if len(name) < 2 || name[0] != GeneratedPrefix {
+		return 0, false
+	}
+
+	// a trailing zero digit is never produced by EncodeID.
+	if name[len(name)-1] == '0' {
+		return 0, false
+	}
+
+	n := uint64(len(alpha))
+	var id uint64
+	for i := len(name) - 1; i > 0; i-- {
+		d := strings.IndexByte(alpha, name[i])
+		if d < 0 || id > (^uint64(0)-uint64(d))/n {
+			return 0, false
+		}
+		id = id*n + uint64(d)
+	}
+
+	return id, true
+}
@@ -1,17 +1,43 @@
 package internal
 
 import (
+	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"time"
 )
 
-// Route is the value part of a shortcut.
+// RouteEncodingVersion is the version of the encoding produced by
+// Route.MarshalBinary.
+const RouteEncodingVersion = 1
+
+// routeMagic marks a route encoded with a version header. It is followed by a
+// single version byte and a JSON payload for that version. The legacy encoding
+// starts with a little-endian timestamp, so a legacy record is only mistaken
+// for a versioned one if the low bytes of its timestamp happen to spell out
+// the whole header.
+var routeMagic = []byte{0xff, 'g', 'o'}
+
+// Route is the value part of a shortcut. Its JSON form is the canonical schema
+// shared by every backend; new fields must be optional so that older records
+// continue to decode.
 type Route struct {
-	URL  string    `json:"url"`
-	Time time.Time `json:"time"`
+	// The firestore names of URL and Time are those of the documents written
+	// before the fields were tagged, which is how existing documents store
+	// them.
+	URL  string    `json:"url" firestore:"URL"`
+	Time time.Time `json:"time" firestore:"Time"`
+
+	// Owner is the user who created the route, if they were known.
+	Owner string `json:"owner,omitempty" firestore:"owner,omitempty" yaml:"owner,omitempty"`
+
+	// Alias is the name of the route this one redirects to, if it was left
+	// behind when that route was renamed. URL is used if that route is gone.
+	Alias string `json:"alias,omitempty" firestore:"alias,omitempty" yaml:"alias,omitempty"`
 }
 
 // RouteIterator allows iteration of the named routes in the store.
@@ -27,32 +53,113 @@ type RouteIterator interface {
 
 var ErrRouteNotFound = errors.New("route not found")
 
-// Serialize this Route into the given Writer.
-func (o *Route) Write(w io.Writer) error {
-	if err := binary.Write(w, binary.LittleEndian, o.Time.UnixNano()); err != nil {
-		return err
+// MarshalBinary encodes this Route in the current versioned encoding.
+func (o *Route) MarshalBinary() ([]byte, error) {
+	p, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
 	}
 
-	if _, err := w.Write([]byte(o.URL)); err != nil {
-		return err
+	b := make([]byte, 0, len(routeMagic)+1+len(p))
+	b = append(b, routeMagic...)
+	b = append(b, RouteEncodingVersion)
+	return append(b, p...), nil
+}
+
+// UnmarshalBinary decodes a Route from any encoding that has been used to
+// store routes, including the unversioned legacy formats.
+func (o *Route) UnmarshalBinary(b []byte) error {
+	// A legacy leveldb record whose timestamp happens to start with the header
+	// is decoded as one if it cannot be decoded as a versioned route.
+	if isVersioned(b) {
+		err := o.readVersioned(b)
+		if err == nil {
+			return nil
+		}
+
+		var rt Route
+		if rt.readLegacy(b) != nil {
+			return err
+		}
+
+		*o = rt
+		return nil
+	}
+
+	// Routes were once stored by the redis backend as bare JSON. A legacy
+	// leveldb record starts with '{' whenever the low byte of its timestamp is
+	// 0x7b, so it is only treated as JSON if it decodes as JSON.
+	if len(b) > 0 && b[0] == '{' {
+		var rt Route
+		if err := json.Unmarshal(b, &rt); err == nil {
+			*o = rt
+			return nil
+		}
 	}
 
+	return o.readLegacy(b)
+}
+
+// Decode a route with a version header.
+func (o *Route) readVersioned(b []byte) error {
+	var rt Route
+	switch v, p := b[len(routeMagic)], b[len(routeMagic)+1:]; v {
+	case 1:
+		if err := json.Unmarshal(p, &rt); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported route encoding version %d", v)
+	}
+
+	*o = rt
 	return nil
 }
 
-// Deserialize this Route from the given Reader.
-func (o *Route) Read(r io.Reader) error {
-	var t int64
-	if err := binary.Read(r, binary.LittleEndian, &t); err != nil {
+// Serialize this Route into the given Writer.
+func (o *Route) Write(w io.Writer) error {
+	b, err := o.MarshalBinary()
+	if err != nil {
 		return err
 	}
 
+	_, err = w.Write(b)
+	return err
+}
+
+// Deserialize this Route from the given Reader.
+func (o *Route) Read(r io.Reader) error {
 	b, err := ioutil.ReadAll(r)
 	if err != nil {
 		return err
 	}
 
-	o.URL = string(b)
+	return o.UnmarshalBinary(b)
+}
+
+// Decode the original leveldb encoding, a little-endian timestamp followed
+// by the URL bytes.
+func (o *Route) readLegacy(b []byte) error {
+	var t int64
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &t); err != nil {
+		return err
+	}
+
+	o.URL = string(b[8:])
 	o.Time = time.Unix(0, t)
 	return nil
 }
+
+// IsCurrentEncoding indicates whether b holds a route in the encoding that
+// MarshalBinary currently produces. Records for which this is false should be
+// rewritten, including legacy records that only look like the current
+// encoding.
+func IsCurrentEncoding(b []byte) bool {
+	return isVersioned(b) && b[len(routeMagic)] == RouteEncodingVersion &&
+		(&Route{}).readVersioned(b) == nil
+}
+
+func isVersioned(b []byte) bool {
+	n := len(routeMagic)
+	return len(b) > n+1 && bytes.Equal(b[:n], routeMagic) && b[n+1] == '{'
+}
@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func mustBeSameRoute(t *testing.T, a, b *Route) {
+	if a.URL != b.URL {
+		t.Fatalf("expected URL of %s, got %s", a.URL, b.URL)
+	}
+
+	if !a.Time.Equal(b.Time) {
+		t.Fatalf("expected Time of %s, got %s", a.Time, b.Time)
+	}
+}
+
+func TestRouteRoundTrip(t *testing.T) {
+	a := &Route{
+		URL:  "http://www.kellegous.com/",
+		Time: time.Unix(0, 1601418236718910000),
+	}
+
+	var buf bytes.Buffer
+	if err := a.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsCurrentEncoding(buf.Bytes()) {
+		t.Fatal("expected route to be written in the current encoding")
+	}
+
+	b := &Route{}
+	if err := b.Read(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	mustBeSameRoute(t, a, b)
+}
+
+func TestRouteReadLegacy(t *testing.T) {
+	a := &Route{
+		URL:  "http://www.kellegous.com/",
+		Time: time.Unix(0, 1601418236718910000),
+	}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, a.Time.UnixNano()); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString(a.URL)
+
+	if IsCurrentEncoding(buf.Bytes()) {
+		t.Fatal("expected legacy route not to be in the current encoding")
+	}
+
+	b := &Route{}
+	if err := b.UnmarshalBinary(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	mustBeSameRoute(t, a, b)
+
+	c := &Route{}
+	if err := c.UnmarshalBinary([]byte(`{"url":"http://www.kellegous.com/","time":"2020-09-29T16:23:56.71891-06:00"}`)); err != nil {
+		t.Fatal(err)
+	}
+	mustBeSameRoute(t, a, c)
+}
+
+func TestRouteReadLegacyBrace(t *testing.T) {
+	// The low byte of this timestamp is 0x7b, which is '{'.
+	a := &Route{
+		URL:  "http://www.kellegous.com/",
+		Time: time.Unix(0, 1601418236718910000&^0xff|0x7b),
+	}
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, a.Time.UnixNano()); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString(a.URL)
+
+	if buf.Bytes()[0] != '{' {
+		t.Fatalf("expected legacy route to start with '{', got %#x", buf.Bytes()[0])
+	}
+
+	b := &Route{}
+	if err := b.UnmarshalBinary(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	mustBeSameRoute(t, a, b)
+}
+
+func TestRouteReadLegacyHeader(t *testing.T) {
+	// The low bytes of these timestamps are the header of a versioned route,
+	// with a supported version and then an unknown one.
+	for _, header := range []int64{0x7b016f67ff, 0x7b026f67ff} {
+		a := &Route{
+			URL:  "http://www.kellegous.com/",
+			Time: time.Unix(0, 1601418236718910000&^0xffffffffff|header),
+		}
+
+		var buf bytes.Buffer
+		if err := binary.Write(&buf, binary.LittleEndian, a.Time.UnixNano()); err != nil {
+			t.Fatal(err)
+		}
+		buf.WriteString(a.URL)
+
+		if !isVersioned(buf.Bytes()) || IsCurrentEncoding(buf.Bytes()) {
+			t.Fatalf("expected legacy route to only look versioned, got %#x", buf.Bytes()[:5])
+		}
+
+		b := &Route{}
+		if err := b.UnmarshalBinary(buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		mustBeSameRoute(t, a, b)
+	}
+}
+
+func TestRouteUnknownVersion(t *testing.T) {
+	// too short to be a legacy route.
+	b := append(append([]byte{}, routeMagic...), RouteEncodingVersion+1, '{', '}')
+
+	if err := (&Route{}).UnmarshalBinary(b); err == nil {
+		t.Fatal("expected an error for an unknown encoding version")
+	}
+}
+
+func TestEncodeDecodeID(t *testing.T) {
+	for _, id := range []uint64{1, 9, 61, 62, 63, 3843, 1 << 40, ^uint64(0)} {
+		name := EncodeID(id)
+		got, ok := DecodeID(name)
+		if !ok {
+			t.Fatalf("expected %s to decode", name)
+		}
+
+		if got != id {
+			t.Fatalf("expected %s to decode to %d, got %d", name, id, got)
+		}
+	}
+
+	for _, name := range []string{"", ":", "0", "abc", ":a-b", ":10", ":zzzzzzzzzzzzzzz"} {
+		if _, ok := DecodeID(name); ok {
+			t.Fatalf("expected %q not to decode", name)
+		}
+	}
+}
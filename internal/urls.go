@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// The ports that are implied by each scheme.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeURL returns the form of a URL that routes are indexed under, so
+// that URLs leading to the same page compare equal. The scheme and host are
+// lowercased, a default port is dropped, an empty path becomes "/", a slash
+// ending any other path is dropped, the query parameters are sorted and the
+// fragment is removed. A URL that cannot be parsed is returned unchanged.
+func NormalizeURL(s string) string {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return s
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Host != "" {
+		host, port := NormalizeHost(u.Host), u.Port()
+		if port != "" && port != defaultPorts[u.Scheme] {
+			u.Host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			u.Host = "[" + host + "]"
+		} else {
+			u.Host = host
+		}
+	}
+
+	if u.Host != "" && u.Path == "" {
+		u.Path = "/"
+	} else if len(u.Path) > 1 {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		u.RawPath = strings.TrimSuffix(u.RawPath, "/")
+	}
+
+	// parameters with the same name keep their order, which may matter.
+	if q, err := url.ParseQuery(u.RawQuery); err == nil {
+		u.RawQuery = q.Encode()
+	}
+	u.ForceQuery = false
+
+	u.Fragment = ""
+	return u.String()
+}
+
+// NormalizeHost lowercases a host and removes its port, any brackets around
+// an IPv6 address and the dot that may end a fully qualified name.
+func NormalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(strings.ToLower(host), "[]")
+	return strings.TrimSuffix(host, ".")
+}
+
+// HostOf returns the normalized host of a URL, without its port, or "" if the
+// URL has no host.
+func HostOf(s string) string {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return ""
+	}
+	return NormalizeHost(u.Host)
+}
@@ -0,0 +1,46 @@
+package internal
+
+import "testing"
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		url, exp string
+	}{
+		{"https://Example.COM", "https://example.com/"},
+		{"HTTPS://example.com:443/a/B", "https://example.com/a/B"},
+		{"http://example.com:80/a?b=C#top", "http://example.com/a?b=C"},
+		{"http://example.com:8080/a", "http://example.com:8080/a"},
+		{"https://example.com./a", "https://example.com/a"},
+		{" https://example.com/a/ ", "https://example.com/a"},
+		{"https://example.com/?", "https://example.com/"},
+		{"https://example.com/a?b=2&a=1&b=1", "https://example.com/a?a=1&b=2&b=1"},
+		{"https://example.com/a%2Fb/", "https://example.com/a%2Fb"},
+		{"http://[::1]:80/a", "http://[::1]/a"},
+		{"http://[::1]:81/a", "http://[::1]:81/a"},
+		{"mailto:Someone@example.com", "mailto:Someone@example.com"},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeURL(test.url); got != test.exp {
+			t.Fatalf("%q: expected %s, got %s", test.url, test.exp, got)
+		}
+	}
+}
+
+func TestHostOf(t *testing.T) {
+	tests := []struct {
+		url, exp string
+	}{
+		{"https://Jenkins.Example.com:8443/job/a", "jenkins.example.com"},
+		{"https://example.com.:443/a", "example.com"},
+		{"http://[::1]:80/a", "::1"},
+		{"mailto:someone@example.com", ""},
+		{"%", ""},
+	}
+
+	for _, test := range tests {
+		if got := HostOf(test.url); got != test.exp {
+			t.Fatalf("%q: expected %q, got %q", test.url, test.exp, got)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package rewrite changes the destinations of many routes at once, such as
+// when a site moves to a new domain.
+package rewrite
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/internal"
+)
+
+// The number of times a route is read again when it keeps changing between
+// reading and rewriting it.
+const putAttempts = 3
+
+// Rule rewrites the URLs that start with Prefix, replacing the prefix, or
+// that match the regular expression Pattern, replacing every match. In a
+// pattern's replacement, $1 and ${name} refer to its groups.
+type Rule struct {
+	Prefix  string `json:"prefix,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	Replace string `json:"replace"`
+
+	re *regexp.Regexp
+}
+
+// NewRule creates a rule from either a prefix or a pattern.
+func NewRule(prefix, pattern, replace string) (*Rule, error) {
+	if (prefix == "") == (pattern == "") {
+		return nil, errors.New("exactly one of a prefix or a pattern is required")
+	}
+
+	r := &Rule{
+		Prefix:  prefix,
+		Pattern: pattern,
+		Replace: replace,
+	}
+
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		r.re = re
+	}
+
+	return r, nil
+}
+
+// Rewrite returns the URL u is rewritten to and whether the rule matches it.
+func (r *Rule) Rewrite(u string) (string, bool) {
+	if r.re != nil {
+		if !r.re.MatchString(u) {
+			return u, false
+		}
+		return r.re.ReplaceAllString(u, r.Replace), true
+	}
+
+	if !strings.HasPrefix(u, r.Prefix) {
+		return u, false
+	}
+	return r.Replace + u[len(r.Prefix):], true
+}
+
+// Change is a route whose URL is, or would be, rewritten.
+type Change struct {
+	Name   string `json:"name"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Reverse returns the changes that undo the given ones.
+func Reverse(changes []*Change) []*Change {
+	rev := make([]*Change, 0, len(changes))
+	for _, c := range changes {
+		rev = append(rev, &Change{
+			Name:   c.Name,
+			Before: c.After,
+			After:  c.Before,
+		})
+	}
+	return rev
+}
+
+// Plan lists every route that the rule would rewrite, in order of name.
+func Plan(ctx context.Context, b backend.Backend, rule *Rule) ([]*Change, error) {
+	iter, err := b.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Release()
+
+	var changes []*Change
+	for iter.Next() {
+		u := iter.Route().URL
+		if after, ok := rule.Rewrite(u); ok && after != u {
+			changes = append(changes, &Change{
+				Name:   iter.Name(),
+				Before: u,
+				After:  after,
+			})
+		}
+	}
+
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// Options controls the behavior of Apply.
+type Options struct {
+	// Validate, if set, is called for each rewritten route. Routes that fail
+	// validation are reported as invalid and are not changed.
+	Validate func(name string, rt *internal.Route) error
+}
+
+// Report describes what Apply did with each change.
+type Report struct {
+	// Changed holds the routes that were rewritten. Reversing it undoes the
+	// rewrite.
+	Changed []*Change `json:"changed"`
+
+	// Skipped holds the routes that no longer had the URL they were planned
+	// with, which are left alone.
+	Skipped []*Change `json:"skipped"`
+
+	// Invalid holds the routes that would have had an invalid URL.
+	Invalid []*Change `json:"invalid"`
+}
+
+// What was done with a change.
+type action int
+
+const (
+	changed action = iota
+	skipped
+	invalid
+)
+
+// Rewrite a single route, as long as it still has the URL it was planned
+// with. The route is replaced only if it has not changed since it was read.
+// An invalid change is returned with the reason it is invalid.
+func apply(ctx context.Context, b backend.Backend, c *Change, opts *Options) (action, error) {
+	for i := 0; i < putAttempts; i++ {
+		rt, ver, err := b.GetVersion(ctx, c.Name)
+		if errors.Is(err, internal.ErrRouteNotFound) {
+			return skipped, nil
+		} else if err != nil {
+			return skipped, err
+		}
+
+		if rt.URL != c.Before {
+			return skipped, nil
+		}
+
+		// only the destination changes, the route keeps its time and owner.
+		rt.URL = c.After
+		if opts.Validate != nil {
+			if err := opts.Validate(c.Name, rt); err != nil {
+				return invalid, err
+			}
+		}
+
+		_, err = b.PutIf(ctx, c.Name, rt, ver)
+		if errors.Is(err, backend.ErrVersionMismatch) {
+			continue
+		} else if err != nil {
+			return skipped, err
+		}
+		return changed, nil
+	}
+
+	// the route is changing too often to tell whether it still matches.
+	return skipped, nil
+}
+
+// Apply makes each change, skipping the routes that no longer have the URL
+// they were planned with. Each route is changed on its own, so an error
+// leaves the changes made before it in place; the report describes them.
+func Apply(ctx context.Context, b backend.Backend, changes []*Change, opts *Options) (*Report, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	rep := &Report{
+		Changed: []*Change{},
+		Skipped: []*Change{},
+		Invalid: []*Change{},
+	}
+
+	for _, c := range changes {
+		act, err := apply(ctx, b, c, opts)
+		switch {
+		case act == invalid:
+			cp := *c
+			cp.Error = err.Error()
+			rep.Invalid = append(rep.Invalid, &cp)
+		case err != nil:
+			return rep, err
+		case act == changed:
+			rep.Changed = append(rep.Changed, c)
+		default:
+			rep.Skipped = append(rep.Skipped, c)
+		}
+	}
+
+	return rep, nil
+}
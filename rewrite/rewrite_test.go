@@ -0,0 +1,132 @@
+package rewrite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kellegous/go/backend/memory"
+	"github.com/kellegous/go/internal"
+)
+
+func TestRule(t *testing.T) {
+	if _, err := NewRule("", "", "x"); err == nil {
+		t.Fatal("expected a rule with no prefix or pattern to fail")
+	}
+
+	if _, err := NewRule("", "(", "x"); err == nil {
+		t.Fatal("expected an invalid pattern to fail")
+	}
+
+	prefix, err := NewRule("https://old.example.com/", "", "https://new.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pattern, err := NewRule("", `^https://([a-z]+)\.old\.example\.com/`, "https://new.example.com/$1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rule     *Rule
+		url, exp string
+		ok       bool
+	}{
+		{prefix, "https://old.example.com/a?b=c", "https://new.example.com/a?b=c", true},
+		{prefix, "https://other.example.com/a", "https://other.example.com/a", false},
+		{pattern, "https://wiki.old.example.com/a", "https://new.example.com/wiki/a", true},
+		{pattern, "https://old.example.com/a", "https://old.example.com/a", false},
+	}
+
+	for _, test := range tests {
+		got, ok := test.rule.Rewrite(test.url)
+		if got != test.exp || ok != test.ok {
+			t.Fatalf("%s: expected %s, %t, got %s, %t", test.url, test.exp, test.ok, got, ok)
+		}
+	}
+}
+
+func TestPlanApplyUndo(t *testing.T) {
+	ctx := context.Background()
+	b, err := memory.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	when := time.Unix(1601418236, 0)
+	for name, url := range map[string]string{
+		"a": "https://old.example.com/a",
+		"b": "https://old.example.com/b",
+		"c": "https://other.example.com/c",
+		"d": "https://old.example.com/bad",
+	} {
+		if err := b.Put(ctx, name, &internal.Route{URL: url, Time: when, Owner: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rule, err := NewRule("https://old.example.com/", "", "https://new.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := Plan(ctx, b, rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changes) != 3 || changes[0].Name != "a" || changes[0].After != "https://new.example.com/a" {
+		t.Fatalf("unexpected plan %+v", changes)
+	}
+
+	// a route changed after it was planned is left alone.
+	if err := b.Put(ctx, "b", &internal.Route{URL: "https://elsewhere.com/", Time: when}); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := Apply(ctx, b, changes, &Options{
+		Validate: func(name string, rt *internal.Route) error {
+			if name == "d" {
+				return errors.New("bad")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rep.Changed) != 1 || len(rep.Skipped) != 1 || len(rep.Invalid) != 1 {
+		t.Fatalf("unexpected report %+v", rep)
+	}
+
+	rt, err := b.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rt.URL != "https://new.example.com/a" || !rt.Time.Equal(when) || rt.Owner != "alice" {
+		t.Fatalf("unexpected route %+v", rt)
+	}
+
+	rep, err = Apply(ctx, b, Reverse(rep.Changed), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rep.Changed) != 1 {
+		t.Fatalf("unexpected undo report %+v", rep)
+	}
+
+	rt, err = b.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rt.URL != "https://old.example.com/a" {
+		t.Fatalf("expected the rewrite to be undone, got %s", rt.URL)
+	}
+}
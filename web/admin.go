@@ -2,17 +2,363 @@ package web
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"time"
 
+	"github.com/kellegous/go/audit"
 	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/backend/cache"
+	"github.com/kellegous/go/check"
+	"github.com/kellegous/go/dump"
+	"github.com/kellegous/go/ids"
+	"github.com/kellegous/go/internal"
+	"github.com/kellegous/go/rewrite"
+	"github.com/kellegous/go/webhook"
 )
 
 type adminHandler struct {
 	backend backend.Backend
+	hooks   *webhook.Dispatcher
+	audit   *audit.Log
+	names   ids.Generator
 }
 
-func adminGet(backend backend.Backend, w http.ResponseWriter, r *http.Request) {
+// Record an admin action in the audit log, if there is one.
+func recordAdmin(auditLog *audit.Log, r *http.Request, op audit.Op, detail interface{}) error {
+	if auditLog == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(detail)
+	if err != nil {
+		return err
+	}
+
+	return auditLog.Append(&audit.Entry{
+		Actor:  *auditLog.Actor(r),
+		Op:     op,
+		Detail: b,
+	})
+}
+
+// Record an admin action that has already been made. It cannot be undone, so
+// a failure to record it is logged rather than reported.
+func recordAdminDone(auditLog *audit.Log, r *http.Request, op audit.Op, detail interface{}) {
+	if err := recordAdmin(auditLog, r, op, detail); err != nil {
+		log.Printf("[error] could not record the %s in the audit log: %s", op, err)
+	}
+}
+
+// The detail recorded for exports.
+type exportDetail struct {
+	Via    string      `json:"via"`
+	Format dump.Format `json:"format,omitempty"`
+}
+
+type msgImport struct {
+	Ok     bool         `json:"ok"`
+	Report *dump.Report `json:"report"`
+}
+
+// Read the dump format options from the query string.
+func parseDumpOptions(r *http.Request) (*dump.Options, error) {
+	f := dump.JSON
+	if v := r.FormValue("format"); v != "" {
+		var err error
+		if f, err = dump.ParseFormat(v); err != nil {
+			return nil, err
+		}
+	}
+
+	cols, err := dump.ParseColumns(r.FormValue("columns"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &dump.Options{
+		Format:  f,
+		Columns: cols,
+	}, nil
+}
+
+func adminExport(backend backend.Backend, auditLog *audit.Log, w http.ResponseWriter, r *http.Request) {
+	opts, err := parseDumpOptions(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := recordAdmin(auditLog, r, audit.Export, &exportDetail{
+		Via:    "export",
+		Format: opts.Format,
+	}); err != nil {
+		writeJSONBackendError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	w.Header().Set("Content-Type", opts.Format.ContentType())
+	w.WriteHeader(http.StatusOK)
+	if _, err := dump.Export(ctx, backend, w, opts); err != nil {
+		// the response has already started, so all we can do is log.
+		log.Printf("[error] %s", err)
+	}
+}
+
+func adminImport(backend backend.Backend, names ids.Generator, auditLog *audit.Log, w http.ResponseWriter, r *http.Request) {
+	opts, err := parseDumpOptions(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conflict, err := dump.ParseConflict(r.FormValue("conflict"))
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dryRun, err := parseBool(r.FormValue("dry-run"), false)
+	if err != nil {
+		writeJSONError(w, "invalid dry-run value", http.StatusBadRequest)
+		return
+	}
+
+	ents, err := dump.Decode(r.Body, opts)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rep, err := dump.Import(ctx, backend, ents, &dump.ImportOptions{
+		Conflict: conflict,
+		DryRun:   dryRun,
+		Validate: func(name string, rt *internal.Route) error {
+			return validateRoute(r, name, rt)
+		},
+		Names: names,
+	})
+	if err != nil {
+		writeJSONBackendError(w, err)
+		return
+	}
+
+	if !dryRun {
+		recordAdminDone(auditLog, r, audit.Import, rep)
+	}
+
+	writeJSON(w, &msgImport{
+		Ok:     true,
+		Report: rep,
+	}, http.StatusOK)
+}
+
+type msgBackup struct {
+	Ok     bool             `json:"ok"`
+	Backup *dump.BackupInfo `json:"backup"`
+}
+
+func adminBackup(be backend.Backend, auditLog *audit.Log, w http.ResponseWriter, r *http.Request) {
+	if err := recordAdmin(auditLog, r, audit.Export, &exportDetail{
+		Via: "backup",
+	}); err != nil {
+		writeJSONBackendError(w, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	snap, err := backend.SnapshotOf(ctx, be)
+	if err != nil {
+		writeJSONBackendError(w, err)
+		return
+	}
+	defer snap.Release()
+
+	w.Header().Set("Content-Type", dump.NDJSON.ContentType())
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"backup-%s.ndjson\"", time.Now().Format("20060102-150405")))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := dump.Backup(ctx, snap, w); err != nil {
+		// the response has already started, so all we can do is log. The
+		// backup will be missing its footer and will not restore.
+		log.Printf("[error] %s", err)
+	}
+}
+
+func adminRestore(backend backend.Backend, auditLog *audit.Log, w http.ResponseWriter, r *http.Request) {
+	n, err := parseInt(r.FormValue("batch-size"), dump.DefaultBatchSize)
+	if err != nil || n <= 0 {
+		writeJSONError(w, "invalid batch-size value", http.StatusBadRequest)
+		return
+	}
+
+	// the backup may be uploaded from a form or be the whole body.
+	var body io.Reader = r.Body
+	if f, _, err := r.FormFile("dump"); err == nil {
+		defer f.Close()
+		body = f
+	} else if err != http.ErrNotMultipart {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	info, err := dump.Restore(ctx, backend, body, n)
+	if errors.Is(err, dump.ErrBadBackup) {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		writeJSONBackendError(w, err)
+		return
+	}
+
+	recordAdminDone(auditLog, r, audit.Restore, info)
+
+	writeJSON(w, &msgBackup{
+		Ok:     true,
+		Backup: info,
+	}, http.StatusOK)
+}
+
+type msgWebhooks struct {
+	Ok            bool                    `json:"ok"`
+	Subscriptions []*webhook.Subscription `json:"subscriptions"`
+	Deliveries    []*webhook.Delivery     `json:"deliveries"`
+}
+
+func adminWebhooks(hooks *webhook.Dispatcher, w http.ResponseWriter, r *http.Request) {
+	if hooks == nil {
+		writeJSONError(w, "webhooks are not enabled", http.StatusNotFound)
+		return
+	}
+
+	limit, err := parseInt(r.FormValue("limit"), 100)
+	if err != nil || limit <= 0 {
+		writeJSONError(w, "invalid limit value", http.StatusBadRequest)
+		return
+	}
+
+	status := webhook.Status(r.FormValue("status"))
+	switch status {
+	case "", webhook.Pending, webhook.Delivered, webhook.Failed:
+	default:
+		writeJSONError(w, "invalid status value", http.StatusBadRequest)
+		return
+	}
+
+	dls, err := hooks.Deliveries(status, limit)
+	if err != nil {
+		writeJSONBackendError(w, err)
+		return
+	}
+
+	writeJSON(w, &msgWebhooks{
+		Ok:            true,
+		Subscriptions: hooks.Subscriptions(),
+		Deliveries:    dls,
+	}, http.StatusOK)
+}
+
+type msgAudit struct {
+	Ok      bool           `json:"ok"`
+	Entries []*audit.Entry `json:"entries"`
+}
+
+// Read an audit log filter from the query string.
+func parseAuditFilter(r *http.Request) (*audit.Filter, error) {
+	f := &audit.Filter{
+		Name:  r.FormValue("name"),
+		Actor: r.FormValue("actor"),
+		Op:    audit.Op(r.FormValue("op")),
+	}
+
+	for _, t := range []struct {
+		key string
+		t   *time.Time
+	}{
+		{"since", &f.Since},
+		{"until", &f.Until},
+	} {
+		v := r.FormValue(t.key)
+		if v == "" {
+			continue
+		}
+
+		var err error
+		if *t.t, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, fmt.Errorf("invalid %s value", t.key)
+		}
+	}
+
+	return f, nil
+}
+
+func adminAudit(auditLog *audit.Log, w http.ResponseWriter, r *http.Request) {
+	f, err := parseAuditFilter(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := parseInt(r.FormValue("limit"), 100)
+	if err != nil || limit <= 0 {
+		writeJSONError(w, "invalid limit value", http.StatusBadRequest)
+		return
+	}
+
+	ents, err := auditLog.Recent(f, limit)
+	if err != nil {
+		writeJSONBackendError(w, err)
+		return
+	}
+
+	if ents == nil {
+		ents = []*audit.Entry{}
+	}
+
+	writeJSON(w, &msgAudit{
+		Ok:      true,
+		Entries: ents,
+	}, http.StatusOK)
+}
+
+func adminAuditExport(auditLog *audit.Log, w http.ResponseWriter, r *http.Request) {
+	f, err := parseAuditFilter(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", dump.NDJSON.ContentType())
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"audit-%s.ndjson\"", time.Now().Format("20060102-150405")))
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	if err := auditLog.Scan(f, func(e *audit.Entry) error {
+		return enc.Encode(e)
+	}); err != nil {
+		// the response has already started, so all we can do is log.
+		log.Printf("[error] %s", err)
+	}
+}
+
+func adminGet(backend backend.Backend, names ids.Generator, hooks *webhook.Dispatcher, auditLog *audit.Log, w http.ResponseWriter, r *http.Request) {
 	p := parseName("/admin/", r.URL.Path)
 
 	if p == "" {
@@ -23,22 +369,231 @@ func adminGet(backend backend.Backend, w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
 
-	if p == "dumps" {
+	switch p {
+	case "dumps":
+		if err := recordAdmin(auditLog, r, audit.Export, &exportDetail{
+			Via: "dumps",
+		}); err != nil {
+			writeJSONBackendError(w, err)
+			return
+		}
+
 		if golinks, err := backend.GetAll(ctx); err != nil {
 			writeJSONBackendError(w, err)
 			return
 		} else {
 			writeJSON(w, golinks, http.StatusOK)
 		}
+	case "export":
+		adminExport(backend, auditLog, w, r)
+	case "backup":
+		adminBackup(backend, auditLog, w, r)
+	case "cache":
+		c, ok := backend.(*cache.Backend)
+		if !ok {
+			writeJSONError(w, "cache is not enabled", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, c.Stats(), http.StatusOK)
+	case "check":
+		adminCheck(backend, names, auditLog, false, w, r)
+	case "webhooks":
+		adminWebhooks(hooks, w, r)
+	case "audit", "audit-export", "audit-verify":
+		if auditLog == nil {
+			writeJSONError(w, "the audit log is not enabled", http.StatusNotFound)
+			return
+		}
+
+		switch p {
+		case "audit":
+			adminAudit(auditLog, w, r)
+		case "audit-export":
+			adminAuditExport(auditLog, w, r)
+		default:
+			v, err := auditLog.Verify()
+			if err != nil {
+				writeJSONBackendError(w, err)
+				return
+			}
+			writeJSON(w, v, http.StatusOK)
+		}
+	default:
+		writeJSONError(w, "Not Found", http.StatusNotFound)
 	}
+}
+
+type msgRewrite struct {
+	Ok     bool              `json:"ok"`
+	Plan   []*rewrite.Change `json:"plan,omitempty"`
+	Report *rewrite.Report   `json:"report,omitempty"`
+}
 
+// The detail recorded for rewrites and their undoing.
+type rewriteDetail struct {
+	Rule    *rewrite.Rule `json:"rule,omitempty"`
+	Undo    bool          `json:"undo,omitempty"`
+	Changed int           `json:"changed"`
+}
+
+// Apply a set of rewrites, recording them in the audit log.
+func applyRewrite(backend backend.Backend, auditLog *audit.Log, w http.ResponseWriter, r *http.Request, changes []*rewrite.Change, detail *rewriteDetail) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	rep, err := rewrite.Apply(ctx, backend, changes, &rewrite.Options{
+		Validate: func(name string, rt *internal.Route) error {
+			return validateRoute(r, name, rt)
+		},
+	})
+
+	// some routes may have been changed before the error, so the rewrite is
+	// recorded either way.
+	if rep != nil {
+		detail.Changed = len(rep.Changed)
+		recordAdminDone(auditLog, r, audit.Rewrite, detail)
+	}
+
+	if err != nil {
+		writeJSONBackendError(w, err)
+		return
+	}
+
+	writeJSON(w, &msgRewrite{
+		Ok:     true,
+		Report: rep,
+	}, http.StatusOK)
+}
+
+// Rewrite the URLs that match a prefix or pattern, or preview the rewrite.
+func adminRewrite(backend backend.Backend, auditLog *audit.Log, w http.ResponseWriter, r *http.Request) {
+	rule, err := rewrite.NewRule(r.FormValue("prefix"), r.FormValue("pattern"), r.FormValue("replace"))
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dryRun, err := parseBool(r.FormValue("dry-run"), false)
+	if err != nil {
+		writeJSONError(w, "invalid dry-run value", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	changes, err := rewrite.Plan(ctx, backend, rule)
+	if err != nil {
+		writeJSONBackendError(w, err)
+		return
+	}
+
+	if dryRun {
+		writeJSON(w, &msgRewrite{
+			Ok:   true,
+			Plan: changes,
+		}, http.StatusOK)
+		return
+	}
+
+	applyRewrite(backend, auditLog, w, r, changes, &rewriteDetail{Rule: rule})
+}
+
+// Undo a rewrite given the report it returned.
+func adminRewriteUndo(backend backend.Backend, auditLog *audit.Log, w http.ResponseWriter, r *http.Request) {
+	var rep rewrite.Report
+	if err := json.NewDecoder(r.Body).Decode(&rep); err != nil {
+		writeJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	applyRewrite(backend, auditLog, w, r, rewrite.Reverse(rep.Changed), &rewriteDetail{Undo: true})
+}
+
+type msgCheck struct {
+	Ok     bool          `json:"ok"`
+	Report *check.Report `json:"report"`
+}
+
+// The detail recorded for repairs.
+type repairDetail struct {
+	Repaired int `json:"repaired"`
+}
+
+// Check the backend for problems, repairing those that can be repaired if
+// asked to. Repairs are recorded in the audit log.
+func adminCheck(backend backend.Backend, names ids.Generator, auditLog *audit.Log, repair bool, w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	rep, err := check.Run(ctx, backend, &check.Options{
+		Validate: func(name string, rt *internal.Route) error {
+			return validateRoute(r, name, rt)
+		},
+		Counter: ids.FromCounter(names),
+		Repair:  repair,
+	})
+
+	// some problems may have been repaired before the error, so the repair
+	// is recorded either way.
+	if repair && rep != nil {
+		recordAdminDone(auditLog, r, audit.Repair, &repairDetail{
+			Repaired: len(rep.Problems) - rep.Unrepaired(),
+		})
+	}
+
+	if err != nil {
+		writeJSONBackendError(w, err)
+		return
+	}
+
+	writeJSON(w, &msgCheck{
+		Ok:     true,
+		Report: rep,
+	}, http.StatusOK)
+}
+
+func adminPost(backend backend.Backend, names ids.Generator, auditLog *audit.Log, w http.ResponseWriter, r *http.Request) {
+	backend = audited(backend, auditLog, r)
+	switch parseName("/admin/", r.URL.Path) {
+	case "import":
+		adminImport(backend, names, auditLog, w, r)
+	case "restore":
+		adminRestore(backend, auditLog, w, r)
+	case "rewrite":
+		adminRewrite(backend, auditLog, w, r)
+	case "rewrite-undo":
+		adminRewriteUndo(backend, auditLog, w, r)
+	case "check":
+		adminCheck(backend, names, auditLog, true, w, r)
+	default:
+		writeJSONError(w, "Not Found", http.StatusNotFound)
+	}
 }
 
 func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
-		adminGet(h.backend, w, r)
+		adminGet(h.backend, h.names, h.hooks, h.audit, w, r)
+	case "POST":
+		adminPost(h.backend, h.names, h.audit, w, r)
 	default:
 		writeJSONError(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusOK) // fix
 	}
 }
+
+// SetupAdmin sets up the admin routes on the mux. They are trusted with
+// anything, including choosing generated names and times, so they should only
+// be reachable by operators.
+func SetupAdmin(m *http.ServeMux, backend backend.Backend, hooks *webhook.Dispatcher, auditLog *audit.Log, names ids.Generator) {
+	if names == nil {
+		names = ids.NewSequential(backend)
+	}
+
+	m.Handle("/admin/", &adminHandler{
+		backend: backend,
+		hooks:   hooks,
+		audit:   auditLog,
+		names:   names,
+	})
+}
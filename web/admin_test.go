@@ -0,0 +1,453 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kellegous/go/audit"
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/backend/cache"
+	"github.com/kellegous/go/check"
+	"github.com/kellegous/go/dump"
+	"github.com/kellegous/go/internal"
+)
+
+func (e *env) admin(method, path string, body string) *mockResponse {
+	req, err := http.NewRequest(method, path, strings.NewReader(body))
+	if err != nil {
+		panic(err)
+	}
+
+	res := &mockResponse{
+		header: map[string][]string{},
+	}
+
+	(&adminHandler{
+		backend: e.backend,
+		hooks:   e.hooks,
+		audit:   e.audit,
+		names:   e.names,
+	}).ServeHTTP(res, req)
+
+	return res
+}
+
+func TestAdminImportExport(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	csv := "Short,Destination\n" +
+		"a,http://a.com/\n" +
+		"edit,http://edit.com/\n" +
+		"b,not a url\n"
+
+	res := e.admin("POST", "/admin/import?format=csv&columns=name%3DShort,url%3DDestination", csv)
+	mustHaveStatus(t, res, http.StatusOK)
+
+	var m msgImport
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	mustBeOk(t, m.Ok)
+	if m.Report.Created != 1 || m.Report.Invalid != 2 {
+		t.Fatalf("unexpected report %+v", m.Report)
+	}
+
+	res = e.admin("GET", "/admin/export?format=ndjson", "")
+	mustHaveStatus(t, res, http.StatusOK)
+
+	ents, err := dump.Decode(bytes.NewReader(res.Bytes()), &dump.Options{Format: dump.NDJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ents) != 1 || ents[0].Name != "a" || ents[0].URL != "http://a.com/" {
+		t.Fatalf("unexpected export %v", ents)
+	}
+
+	res = e.admin("POST", "/admin/import?format=xml", "")
+	mustHaveStatus(t, res, http.StatusBadRequest)
+
+	res = e.admin("POST", "/admin/import?conflict=clobber", "{}")
+	mustHaveStatus(t, res, http.StatusBadRequest)
+}
+
+func TestAdminBackupRestore(t *testing.T) {
+	src := needEnv(t, "")
+	defer src.destroy()
+
+	dst := needEnv(t, "")
+	defer dst.destroy()
+
+	res, err := src.post("/api/url/", &urlReq{URL: "http://a.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+
+	res = src.admin("GET", "/admin/backup", "")
+	mustHaveStatus(t, res, http.StatusOK)
+	backup := res.String()
+
+	res = dst.admin("POST", "/admin/restore", backup[:len(backup)-10])
+	mustHaveStatus(t, res, http.StatusBadRequest)
+
+	res = dst.admin("POST", "/admin/restore", backup)
+	mustHaveStatus(t, res, http.StatusOK)
+
+	var m msgBackup
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	mustBeOk(t, m.Ok)
+	if m.Backup.Count != 1 || m.Backup.LastID != 1 {
+		t.Fatalf("unexpected backup info %+v", m.Backup)
+	}
+
+	res, err = dst.get("/api/url/:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+}
+
+func TestAdminCache(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	res := e.admin("GET", "/admin/cache", "")
+	mustHaveStatus(t, res, http.StatusNotFound)
+
+	c, err := cache.New(e.backend, &cache.Options{Size: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.backend = c
+
+	if _, err := c.Get(context.Background(), "a"); err == nil {
+		t.Fatal("expected a to not be found")
+	}
+
+	res = e.admin("GET", "/admin/cache", "")
+	mustHaveStatus(t, res, http.StatusOK)
+
+	var s cache.Stats
+	if err := json.NewDecoder(res).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Misses != 1 || s.Hits != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestAdminWebhooks(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	res := e.admin("GET", "/admin/webhooks", "")
+	mustHaveStatus(t, res, http.StatusNotFound)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	e.enableWebhooks(t, srv.URL)
+
+	if _, err := e.post("/api/url/a", &urlReq{URL: "http://a.com/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var m msgWebhooks
+	for i := 0; ; i++ {
+		res = e.admin("GET", "/admin/webhooks?status=failed", "")
+		mustHaveStatus(t, res, http.StatusOK)
+
+		if err := json.NewDecoder(res).Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(m.Deliveries) == 1 {
+			break
+		} else if i == 500 {
+			t.Fatal("timed out waiting for the delivery to fail")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mustBeOk(t, m.Ok)
+	if len(m.Subscriptions) != 1 || m.Subscriptions[0].Secret != "" {
+		t.Fatalf("unexpected subscriptions %+v", m.Subscriptions)
+	}
+
+	dl := m.Deliveries[0]
+	if dl.Event.Name != "a" || len(dl.Attempts) != 1 || dl.Attempts[0].StatusCode != http.StatusInternalServerError {
+		t.Fatalf("unexpected delivery %+v", dl)
+	}
+
+	res = e.admin("GET", "/admin/webhooks?status=lost", "")
+	mustHaveStatus(t, res, http.StatusBadRequest)
+}
+
+func TestAdminAudit(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	res := e.admin("GET", "/admin/audit", "")
+	mustHaveStatus(t, res, http.StatusNotFound)
+
+	e.enableAudit(t)
+
+	if _, err := e.post("/api/url/a", &urlReq{URL: "http://a.com/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.put("/api/url/a", &urlReq{URL: "http://b.com/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.call("DELETE", "/api/url/a", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	res = e.admin("POST", "/admin/import?format=csv&columns=name%3DShort,url%3DDestination",
+		"Short,Destination\nc,http://c.com/\n")
+	mustHaveStatus(t, res, http.StatusOK)
+
+	res = e.admin("GET", "/admin/export?format=ndjson", "")
+	mustHaveStatus(t, res, http.StatusOK)
+
+	var m msgAudit
+	res = e.admin("GET", "/admin/audit", "")
+	mustHaveStatus(t, res, http.StatusOK)
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	mustBeOk(t, m.Ok)
+
+	var ops []audit.Op
+	for _, ent := range m.Entries {
+		ops = append(ops, ent.Op)
+	}
+
+	exp := []audit.Op{audit.Export, audit.Import, audit.Create, audit.Delete, audit.Update, audit.Create}
+	if len(ops) != len(exp) {
+		t.Fatalf("expected %v, got %v", exp, ops)
+	}
+	for i := range exp {
+		if ops[i] != exp[i] {
+			t.Fatalf("expected %v, got %v", exp, ops)
+		}
+	}
+
+	if upd := m.Entries[4]; upd.Old.URL != "http://a.com/" || upd.New.URL != "http://b.com/" {
+		t.Fatalf("unexpected update %+v", upd)
+	}
+	head := m.Entries[0].Hash
+
+	res = e.admin("GET", "/admin/audit?name=a&op=create", "")
+	mustHaveStatus(t, res, http.StatusOK)
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Entries) != 1 || m.Entries[0].New.URL != "http://a.com/" {
+		t.Fatalf("unexpected entries %+v", m.Entries)
+	}
+
+	res = e.admin("GET", "/admin/audit?since=yesterday", "")
+	mustHaveStatus(t, res, http.StatusBadRequest)
+
+	res = e.admin("GET", "/admin/audit-export?op=import", "")
+	mustHaveStatus(t, res, http.StatusOK)
+	if lines := strings.Split(strings.TrimSpace(res.String()), "\n"); len(lines) != 1 {
+		t.Fatalf("expected 1 exported entry, got %d", len(lines))
+	}
+
+	var v audit.Verification
+	res = e.admin("GET", "/admin/audit-verify", "")
+	mustHaveStatus(t, res, http.StatusOK)
+	if err := json.NewDecoder(res).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	if !v.Ok || v.Entries != 6 || v.Head != head {
+		t.Fatalf("unexpected verification %+v", v)
+	}
+}
+
+func TestAdminRewrite(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	e.enableAudit(t)
+
+	for _, name := range []string{"a", "b"} {
+		res, err := e.post("/api/url/"+name, &urlReq{URL: "http://old.com/" + name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustHaveStatus(t, res, http.StatusOK)
+	}
+
+	res := e.admin("POST", "/admin/rewrite?prefix=http://old.com/&pattern=x", "")
+	mustHaveStatus(t, res, http.StatusBadRequest)
+
+	res = e.admin("POST", "/admin/rewrite?prefix=http://old.com/&replace=http://new.com/&dry-run=true", "")
+	mustHaveStatus(t, res, http.StatusOK)
+
+	var m msgRewrite
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Plan) != 2 || m.Plan[1].Before != "http://old.com/b" || m.Plan[1].After != "http://new.com/b" {
+		t.Fatalf("unexpected plan %+v", m.Plan)
+	}
+
+	ctx := context.Background()
+	if rt, err := e.backend.Get(ctx, "a"); err != nil || rt.URL != "http://old.com/a" {
+		t.Fatalf("expected a dry run to change nothing, got %v, %v", rt, err)
+	}
+
+	res = e.admin("POST", "/admin/rewrite?prefix=http://old.com/&replace=http://new.com/", "")
+	mustHaveStatus(t, res, http.StatusOK)
+
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	mustBeOk(t, m.Ok)
+
+	if len(m.Report.Changed) != 2 {
+		t.Fatalf("unexpected report %+v", m.Report)
+	}
+
+	if rt, err := e.backend.Get(ctx, "b"); err != nil || rt.URL != "http://new.com/b" {
+		t.Fatalf("expected b to be rewritten, got %v, %v", rt, err)
+	}
+
+	// the report of a rewrite is all it takes to undo it.
+	report, err := json.Marshal(m.Report)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res = e.admin("POST", "/admin/rewrite-undo", string(report))
+	mustHaveStatus(t, res, http.StatusOK)
+
+	if rt, err := e.backend.Get(ctx, "b"); err != nil || rt.URL != "http://old.com/b" {
+		t.Fatalf("expected b to be restored, got %v, %v", rt, err)
+	}
+
+	var a msgAudit
+	res = e.admin("GET", "/admin/audit?op=rewrite", "")
+	mustHaveStatus(t, res, http.StatusOK)
+	if err := json.NewDecoder(res).Decode(&a); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(a.Entries) != 2 {
+		t.Fatalf("expected the rewrite and the undo to be recorded, got %+v", a.Entries)
+	}
+}
+
+// A backend with a counter of its own that routes do not raise, as though it
+// had been lost.
+type lostCounter struct {
+	backend.Backend
+	id uint64
+}
+
+func (b *lostCounter) LastID(ctx context.Context) (uint64, error) {
+	return b.id, nil
+}
+
+func (b *lostCounter) EnsureID(ctx context.Context, id uint64) error {
+	if id > b.id {
+		b.id = id
+	}
+	return nil
+}
+
+func TestAdminCheck(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	e.backend = &lostCounter{Backend: e.backend}
+	e.enableAudit(t)
+
+	res, err := e.post("/api/url/a", &urlReq{URL: "http://a.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+
+	// routes written around the API, as a restore might.
+	ctx := context.Background()
+	for name, u := range map[string]string{
+		"api": "http://b.com/",
+		":9":  "http://c.com/",
+	} {
+		if err := e.backend.Put(ctx, name, &internal.Route{
+			URL:  u,
+			Time: time.Now(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var m msgCheck
+	res = e.admin("GET", "/admin/check", "")
+	mustHaveStatus(t, res, http.StatusOK)
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	mustBeOk(t, m.Ok)
+
+	if m.Report.Routes != 3 || len(m.Report.Problems) != 2 || m.Report.Unrepaired() != 2 {
+		t.Fatalf("unexpected report %+v", m.Report)
+	}
+
+	if p := m.Report.Problems[0]; p.Kind != check.Invalid || p.Name != "api" || p.Repairable {
+		t.Fatalf("expected api to be invalid, got %+v", p)
+	}
+
+	if p := m.Report.Problems[1]; p.Kind != check.Counter || p.Name != ":9" || !p.Repairable {
+		t.Fatalf("expected the counter to be behind, got %+v", p)
+	}
+
+	res = e.admin("POST", "/admin/check", "")
+	mustHaveStatus(t, res, http.StatusOK)
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Report.Unrepaired() != 1 || !m.Report.Problems[1].Repaired {
+		t.Fatalf("expected the counter to be repaired, got %+v", m.Report)
+	}
+
+	if id, err := e.backend.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 9 {
+		t.Fatalf("expected the counter to be advanced to 9, got %d", id)
+	}
+
+	var a msgAudit
+	res = e.admin("GET", "/admin/audit?op=repair", "")
+	mustHaveStatus(t, res, http.StatusOK)
+	if err := json.NewDecoder(res).Decode(&a); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(a.Entries) != 1 {
+		t.Fatalf("expected the repair to be recorded, got %+v", a.Entries)
+	}
+}
@@ -5,55 +5,33 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/kellegous/go/audit"
 	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/ids"
 	"github.com/kellegous/go/internal"
-)
-
-const (
-	alpha = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	"github.com/kellegous/go/webhook"
 )
 
 var (
-	errInvalidURL        = errors.New("Invalid URL")
-	errRedirectLoop      = errors.New(" I'm sorry, Dave. I'm afraid I can't do that")
-	genURLPrefix    byte = ':'
-	postGenCursor        = []byte{genURLPrefix + 1}
+	errInvalidURL          = errors.New("Invalid URL")
+	errRedirectLoop        = errors.New(" I'm sorry, Dave. I'm afraid I can't do that")
+	errBannedName          = errors.New("name cannot be used")
+	errRouteChanged        = errors.New("the link has been changed")
+	errRouteExists         = errors.New("a link with that name already exists")
+	errTooManyChanges      = errors.New("the link is being changed too often, try again")
+	errNotOwner            = errors.New("only the owner of a link can rename it")
+	errGeneratedName       = errors.New("generated names can only be chosen through the admin API")
+	genURLPrefix      byte = internal.GeneratedPrefix
+	postGenCursor          = []byte{genURLPrefix + 1}
 )
 
-// A very simple encoding of numeric ids. This is simply a base62 encoding
-// prefixed with ":"
-func encodeID(id uint64) string {
-	n := uint64(len(alpha))
-	b := make([]byte, 0, 8)
-	if id == 0 {
-		return "0"
-	}
-
-	b = append(b, genURLPrefix)
-
-	for id > 0 {
-		b = append(b, alpha[id%n])
-		id /= n
-	}
-
-	return string(b)
-}
-
-// Advance to the next id and encode it as an ID.
-func nextEncodedID(ctx context.Context, backend backend.Backend) (string, error) {
-	id, err := backend.NextID(ctx)
-	if err != nil {
-		return "", err
-	}
-	return encodeID(id), nil
-}
-
 // Check that the given URL is suitable as a shortcut link.
 func validateURL(r *http.Request, s string) error {
 	u, err := url.Parse(s)
@@ -68,18 +46,284 @@ func validateURL(r *http.Request, s string) error {
 		return errInvalidURL
 	}
 
-	if r.Host == u.Host {
+	if r != nil && r.Host == u.Host {
 		return errRedirectLoop
 	}
 
 	return nil
 }
 
-func apiURLPost(backend backend.Backend, host string, w http.ResponseWriter, r *http.Request) {
+// Check that the given route could have been created through the API.
+func validateRoute(r *http.Request, name string, rt *internal.Route) error {
+	if isBannedName(name) {
+		return errBannedName
+	}
+
+	return validateURL(r, rt.URL)
+}
+
+// ValidateRoute checks that a route could have been created through the API.
+// It is intended for tools that write to the backend directly.
+func ValidateRoute(name string, rt *internal.Route) error {
+	return validateRoute(nil, name, rt)
+}
+
+// Record the changes made by a request in the audit log, if there is one.
+func audited(b backend.Backend, auditLog *audit.Log, r *http.Request) backend.Backend {
+	if auditLog == nil {
+		return b
+	}
+	return audit.Wrap(b, auditLog, auditLog.Actor(r))
+}
+
+// Tell the webhooks about a change, if there are any.
+func notify(hooks *webhook.Dispatcher, e *webhook.Event) {
+	if hooks == nil {
+		return
+	}
+
+	// the change has been made, so a failure to queue it is only logged.
+	if err := hooks.Notify(e); err != nil {
+		log.Printf("[error] webhook: %s", err)
+	}
+}
+
+// The number of times a put is attempted when the route keeps changing
+// between reading its version and writing it.
+const putAttempts = 3
+
+// The ETag of a route with the given version.
+func etagOf(version string) string {
+	return `"` + version + `"`
+}
+
+// Check whether an ETag of the given version is in a list of ETags.
+func matchesETag(etags []string, version string) bool {
+	for _, etag := range etags {
+		if etag == "*" || etag == etagOf(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse a header holding a list of ETags, which is nil if it is absent.
+func parseETags(r *http.Request, name string) []string {
+	var etags []string
+	for _, v := range r.Header.Values(name) {
+		etags = append(etags, splitETags(v)...)
+	}
+	return etags
+}
+
+// Split a list of ETags, which is nil if it is empty.
+func splitETags(v string) []string {
+	var etags []string
+	for _, etag := range strings.Split(v, ",") {
+		if etag = strings.TrimSpace(etag); etag != "" {
+			etags = append(etags, etag)
+		}
+	}
+	return etags
+}
+
+// precondition holds the If-Match and If-None-Match headers of a request,
+// along with whether the request creates a route, which requires that there
+// is none, or replaces one, which requires that there is.
+type precondition struct {
+	match     []string
+	noneMatch []string
+	create    bool
+	replace   bool
+}
+
+func parsePrecondition(r *http.Request, create bool) *precondition {
+	return &precondition{
+		match:     parseETags(r, "If-Match"),
+		noneMatch: parseETags(r, "If-None-Match"),
+		create:    create,
+		replace:   !create,
+	}
+}
+
+// Check the precondition against the current version of a route.
+func (p *precondition) check(exists bool, version string) error {
+	if p.match != nil && !(exists && matchesETag(p.match, version)) {
+		return errRouteChanged
+	}
+
+	if exists && matchesETag(p.noneMatch, version) {
+		// If-None-Match: * is how a client asks to only create a route.
+		for _, etag := range p.noneMatch {
+			if etag == "*" {
+				return errRouteExists
+			}
+		}
+		return errRouteChanged
+	}
+
+	if p.create && exists {
+		return errRouteExists
+	} else if p.replace && !exists {
+		return internal.ErrRouteNotFound
+	}
+
+	return nil
+}
+
+// Put a route if the request's precondition holds for the route it replaces.
+// The put is made against the version the precondition was checked against,
+// so the route returned is exactly the one that was replaced. A route keeps
+// the owner of the one it replaces.
+func putRoute(ctx context.Context, be backend.Backend, name string, rt *internal.Route, pre *precondition) (*internal.Route, string, error) {
+	owner := rt.Owner
+	for i := 0; i < putAttempts; i++ {
+		prev, ver, err := be.GetVersion(ctx, name)
+		if errors.Is(err, internal.ErrRouteNotFound) {
+			prev, ver = nil, backend.NoVersion
+		} else if err != nil {
+			return nil, "", err
+		}
+
+		if err := pre.check(prev != nil, ver); err != nil {
+			return nil, "", err
+		}
+
+		rt.Owner = owner
+		if prev != nil {
+			rt.Owner = prev.Owner
+		}
+
+		ver, err = be.PutIf(ctx, name, rt, ver)
+		if errors.Is(err, backend.ErrVersionMismatch) {
+			continue
+		} else if err != nil {
+			return nil, "", err
+		}
+
+		return prev, ver, nil
+	}
+
+	return nil, "", errTooManyChanges
+}
+
+// Delete a route if the request's precondition holds for it. The delete is
+// made against the version the precondition was checked against, so the route
+// returned is exactly the one that was deleted, or nil if there was none.
+func delRoute(ctx context.Context, be backend.Backend, name string, pre *precondition) (*internal.Route, error) {
+	for i := 0; i < putAttempts; i++ {
+		prev, ver, err := be.GetVersion(ctx, name)
+		if errors.Is(err, internal.ErrRouteNotFound) {
+			prev, ver = nil, backend.NoVersion
+		} else if err != nil {
+			return nil, err
+		}
+
+		if err := pre.check(prev != nil, ver); err != nil {
+			return nil, err
+		}
+
+		if prev == nil {
+			return nil, nil
+		}
+
+		_, err = be.Apply(ctx, []*backend.Change{{
+			Op:          backend.OpDel,
+			Name:        name,
+			Conditional: true,
+			Version:     ver,
+		}})
+		if errors.Is(err, backend.ErrVersionMismatch) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		return prev, nil
+	}
+
+	return nil, errTooManyChanges
+}
+
+// Respond to a put that conflicted with the current route, which is sent
+// along with its ETag so that the client can decide what to do.
+func writeJSONConflict(backend backend.Backend, host string, w http.ResponseWriter, name string, err error) {
+	status := http.StatusPreconditionFailed
+	if err != errRouteChanged {
+		status = http.StatusConflict
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	res := &msgRouteErr{
+		Ok:    false,
+		Error: err.Error(),
+	}
+
+	rt, ver, gerr := backend.GetVersion(ctx, name)
+	if gerr == nil {
+		w.Header().Set("ETag", etagOf(ver))
+		res.Route = newRouteWithName(name, rt, host)
+	} else if !errors.Is(gerr, internal.ErrRouteNotFound) {
+		writeJSONBackendError(w, gerr)
+		return
+	}
+
+	writeJSON(w, res, status)
+}
+
+// Find a generated name that already leads to the URL, so that shortening a
+// URL twice gives the same name. Aliases are left out, since they lead to
+// wherever the route they alias does. The name is empty if there is none.
+func findGenerated(ctx context.Context, be backend.Backend, u string) (string, *internal.Route, string, error) {
+	names, err := be.NamesForURL(ctx, u)
+	if err != nil {
+		return "", nil, backend.NoVersion, err
+	}
+
+	for _, name := range names {
+		if !isGenerated(name) {
+			continue
+		}
+
+		rt, ver, err := be.GetVersion(ctx, name)
+		if errors.Is(err, internal.ErrRouteNotFound) {
+			continue
+		} else if err != nil {
+			return "", nil, backend.NoVersion, err
+		}
+
+		if rt.Alias == "" {
+			return name, rt, ver, nil
+		}
+	}
+
+	return "", nil, backend.NoVersion, nil
+}
+
+// The user making a request, as named by the user header.
+func requestUser(r *http.Request, userHeader string) string {
+	if userHeader == "" {
+		return ""
+	}
+	return r.Header.Get(userHeader)
+}
+
+// Create a route with POST, which fails if the name is taken, or replace one
+// with PUT, which fails if it does not exist.
+func apiURLSave(backend backend.Backend, host, userHeader string, hooks *webhook.Dispatcher, names ids.Generator, create bool, w http.ResponseWriter, r *http.Request) {
 	p := parseName("/api/url/", r.URL.Path)
 
+	if p == "" && !create {
+		writeJSONError(w, "name required", http.StatusBadRequest)
+		return
+	}
+
+	// Unique asks for a new generated name even if the URL already has one.
 	var req struct {
-		URL string `json:"url"`
+		URL    string `json:"url"`
+		Unique bool   `json:"unique"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -93,7 +337,14 @@ func apiURLPost(backend backend.Backend, host string, w http.ResponseWriter, r *
 	}
 
 	if isBannedName(p) {
-		writeJSONError(w, "name cannot be used", http.StatusBadRequest)
+		writeJSONError(w, errBannedName.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// An existing route with a generated name may be replaced, but choosing a
+	// new one would let anyone move the ID counter.
+	if create && isGenerated(p) {
+		writeJSONError(w, errGeneratedName.Error(), http.StatusForbidden)
 		return
 	}
 
@@ -105,29 +356,223 @@ func apiURLPost(backend backend.Backend, host string, w http.ResponseWriter, r *
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
 
-	// If no name is specified, an ID must be generated.
+	// If no name is specified, the URL's generated name is reused or, if it
+	// has none, an ID must be generated.
+	if p == "" && !req.Unique {
+		name, rt, ver, err := findGenerated(ctx, backend, req.URL)
+		if err != nil {
+			writeJSONBackendError(w, err)
+			return
+		}
+
+		if rt != nil {
+			w.Header().Set("ETag", etagOf(ver))
+			writeJSONRoute(w, name, rt, host)
+			return
+		}
+	}
+
 	if p == "" {
 		var err error
-		p, err = nextEncodedID(ctx, backend)
-		if err != nil {
+		p, err = names.Next(ctx)
+		if errors.Is(err, ids.ErrNoFreeName) {
+			writeJSONError(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
 			writeJSONBackendError(w, err)
 			return
 		}
 	}
 
 	rt := internal.Route{
-		URL:  req.URL,
-		Time: time.Now(),
+		URL:   req.URL,
+		Time:  time.Now(),
+		Owner: requestUser(r, userHeader),
 	}
 
-	if err := backend.Put(ctx, p, &rt); err != nil {
+	prev, ver, err := putRoute(ctx, backend, p, &rt, parsePrecondition(r, create))
+	switch err {
+	case nil:
+	case internal.ErrRouteNotFound:
+		writeJSONError(w, "Not Found", http.StatusNotFound)
+		return
+	case errRouteChanged, errRouteExists, errTooManyChanges:
+		writeJSONConflict(backend, host, w, p, err)
+		return
+	default:
 		writeJSONBackendError(w, err)
 		return
 	}
 
+	e := &webhook.Event{
+		Type:     webhook.Create,
+		Name:     p,
+		Route:    &rt,
+		Previous: prev,
+		Time:     time.Now(),
+	}
+	if prev != nil {
+		e.Type = webhook.Update
+	}
+	notify(hooks, e)
+
+	w.Header().Set("ETag", etagOf(ver))
 	writeJSONRoute(w, p, &rt, host)
 }
 
+// The body of a rename request. A copy leaves the original route alone, while
+// an alias replaces it with one that redirects to the new name.
+type renameReq struct {
+	To    string `json:"to"`
+	Alias bool   `json:"alias"`
+	Copy  bool   `json:"copy"`
+}
+
+// Move or copy the route under from to the name in req, which must not be in
+// use, if the request's precondition holds for the route. Only the owner of a
+// route, if it has one, can move it. It returns the route and its version
+// under the new name, along with the route left behind, if any.
+func renameRoute(ctx context.Context, be backend.Backend, from string, req *renameReq, user string, pre *precondition) (*internal.Route, string, *internal.Route, error) {
+	for i := 0; i < putAttempts; i++ {
+		rt, ver, err := be.GetVersion(ctx, from)
+		if err != nil {
+			return nil, "", nil, err
+		}
+
+		if err := pre.check(true, ver); err != nil {
+			return nil, "", nil, err
+		}
+
+		if !req.Copy && rt.Owner != "" && rt.Owner != user {
+			return nil, "", nil, errNotOwner
+		}
+
+		if _, err := be.Get(ctx, req.To); err == nil {
+			return nil, "", nil, errRouteExists
+		} else if !errors.Is(err, internal.ErrRouteNotFound) {
+			return nil, "", nil, err
+		}
+
+		var leave *internal.Route
+		if req.Copy {
+			ver, err = be.PutIf(ctx, req.To, rt, backend.NoVersion)
+		} else {
+			if req.Alias {
+				leave = &internal.Route{
+					URL:   rt.URL,
+					Time:  time.Now(),
+					Owner: rt.Owner,
+					Alias: req.To,
+				}
+			}
+			ver, err = be.Rename(ctx, from, ver, req.To, leave)
+		}
+
+		if errors.Is(err, backend.ErrVersionMismatch) {
+			continue
+		} else if err != nil {
+			return nil, "", nil, err
+		}
+
+		return rt, ver, leave, nil
+	}
+
+	return nil, "", nil, errTooManyChanges
+}
+
+// Rename a route, or copy it, to a new name.
+func apiRename(backend backend.Backend, host, userHeader string, hooks *webhook.Dispatcher, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeJSONError(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	p := parseName("/api/rename/", r.URL.Path)
+	if p == "" {
+		writeJSONError(w, "name required", http.StatusBadRequest)
+		return
+	}
+
+	var req renameReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if req.To == "" || strings.Contains(req.To, "/") {
+		writeJSONError(w, "invalid new name", http.StatusBadRequest)
+		return
+	}
+
+	if req.To == p {
+		writeJSONError(w, "the new name is the same as the old one", http.StatusBadRequest)
+		return
+	}
+
+	if req.Alias && req.Copy {
+		writeJSONError(w, "a copy cannot leave an alias", http.StatusBadRequest)
+		return
+	}
+
+	if isBannedName(req.To) {
+		writeJSONError(w, errBannedName.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if isGenerated(req.To) {
+		writeJSONError(w, errGeneratedName.Error(), http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rt, ver, leave, err := renameRoute(ctx, backend, p, &req, requestUser(r, userHeader), parsePrecondition(r, false))
+	switch err {
+	case nil:
+	case internal.ErrRouteNotFound:
+		writeJSONError(w, "Not Found", http.StatusNotFound)
+		return
+	case errNotOwner:
+		writeJSONError(w, err.Error(), http.StatusForbidden)
+		return
+	case errRouteChanged, errTooManyChanges:
+		writeJSONConflict(backend, host, w, p, err)
+		return
+	case errRouteExists:
+		writeJSONConflict(backend, host, w, req.To, err)
+		return
+	default:
+		writeJSONBackendError(w, err)
+		return
+	}
+
+	now := time.Now()
+	notify(hooks, &webhook.Event{
+		Type:  webhook.Create,
+		Name:  req.To,
+		Route: rt,
+		Time:  now,
+	})
+
+	if !req.Copy {
+		e := &webhook.Event{
+			Type:     webhook.Delete,
+			Name:     p,
+			Previous: rt,
+			Time:     now,
+		}
+		if leave != nil {
+			e.Type = webhook.Update
+			e.Route = leave
+		}
+		notify(hooks, e)
+	}
+
+	w.Header().Set("ETag", etagOf(ver))
+	writeJSONRoute(w, req.To, rt, host)
+}
+
 func apiURLGet(backend backend.Backend, host string, w http.ResponseWriter, r *http.Request) {
 	p := parseName("/api/url/", r.URL.Path)
 
@@ -139,7 +584,7 @@ func apiURLGet(backend backend.Backend, host string, w http.ResponseWriter, r *h
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
 
-	rt, err := backend.Get(ctx, p)
+	rt, ver, err := backend.GetVersion(ctx, p)
 	if errors.Is(err, internal.ErrRouteNotFound) {
 		writeJSONError(w, "Not Found", http.StatusNotFound)
 		return
@@ -148,10 +593,16 @@ func apiURLGet(backend backend.Backend, host string, w http.ResponseWriter, r *h
 		return
 	}
 
+	w.Header().Set("ETag", etagOf(ver))
+	if matchesETag(parseETags(r, "If-None-Match"), ver) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	writeJSONRoute(w, p, rt, host)
 }
 
-func apiURLDelete(backend backend.Backend, w http.ResponseWriter, r *http.Request) {
+func apiURLDelete(backend backend.Backend, host string, hooks *webhook.Dispatcher, w http.ResponseWriter, r *http.Request) {
 	p := parseName("/api/url/", r.URL.Path)
 
 	if p == "" {
@@ -162,11 +613,30 @@ func apiURLDelete(backend backend.Backend, w http.ResponseWriter, r *http.Reques
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
 
-	if err := backend.Del(ctx, p); err != nil {
+	// deleting a link that does not exist is not an error.
+	pre := parsePrecondition(r, false)
+	pre.replace = false
+
+	prev, err := delRoute(ctx, backend, p, pre)
+	switch err {
+	case nil:
+	case errRouteChanged, errRouteExists, errTooManyChanges:
+		writeJSONConflict(backend, host, w, p, err)
+		return
+	default:
 		writeJSONBackendError(w, err)
 		return
 	}
 
+	if prev != nil {
+		notify(hooks, &webhook.Event{
+			Type:     webhook.Delete,
+			Name:     p,
+			Previous: prev,
+			Time:     time.Now(),
+		})
+	}
+
 	writeJSONOk(w)
 }
 
@@ -278,14 +748,16 @@ func apiURLsGet(backend backend.Backend, host string, w http.ResponseWriter, r *
 	writeJSON(w, &res, http.StatusOK)
 }
 
-func apiURL(backend backend.Backend, host string, w http.ResponseWriter, r *http.Request) {
+func apiURL(backend backend.Backend, host, userHeader string, hooks *webhook.Dispatcher, names ids.Generator, w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "POST":
-		apiURLPost(backend, host, w, r)
+		apiURLSave(backend, host, userHeader, hooks, names, true, w, r)
+	case "PUT":
+		apiURLSave(backend, host, userHeader, hooks, names, false, w, r)
 	case "GET":
 		apiURLGet(backend, host, w, r)
 	case "DELETE":
-		apiURLDelete(backend, w, r)
+		apiURLDelete(backend, host, hooks, w, r)
 	default:
 		writeJSONError(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusOK) // fix
 	}
@@ -300,13 +772,86 @@ func apiURLs(backend backend.Backend, host string, w http.ResponseWriter, r *htt
 	}
 }
 
-// Setup ...
-func Setup(m *http.ServeMux, backend backend.Backend, host string) {
+// List the routes that lead to the URL, or have URLs on the host, given in the
+// query.
+func apiReverse(backend backend.Backend, host string, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeJSONError(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	u, h := r.FormValue("url"), r.FormValue("host")
+	if (u == "") == (h == "") {
+		writeJSONError(w, "exactly one of url or host is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var names []string
+	var err error
+	if u != "" {
+		names, err = backend.NamesForURL(ctx, u)
+	} else {
+		names, err = backend.NamesForHost(ctx, h)
+	}
+	if err != nil {
+		writeJSONBackendError(w, err)
+		return
+	}
+
+	res := msgRoutes{
+		Ok:     true,
+		Routes: []*routeWithName{},
+	}
+
+	for _, name := range names {
+		rt, err := backend.Get(ctx, name)
+		if errors.Is(err, internal.ErrRouteNotFound) {
+			// the route was deleted after it was looked up.
+			continue
+		} else if err != nil {
+			writeJSONBackendError(w, err)
+			return
+		}
+
+		res.Routes = append(res.Routes, newRouteWithName(name, rt, host))
+	}
+
+	writeJSON(w, &res, http.StatusOK)
+}
+
+// Setup registers the API on m. The owners of new routes are taken from the
+// userHeader of the request that creates them, unless it is empty. Changes are
+// sent to hooks and recorded in auditLog unless they are nil. Routes created
+// without a name are named by names or, if it is nil, sequentially.
+func Setup(m *http.ServeMux, backend backend.Backend, host, userHeader string, hooks *webhook.Dispatcher, auditLog *audit.Log, names ids.Generator) {
+	if names == nil {
+		names = ids.NewSequential(backend)
+	}
+
 	m.HandleFunc("/api/url/", func(w http.ResponseWriter, r *http.Request) {
-		apiURL(backend, host, w, r)
+		apiURL(audited(backend, auditLog, r), host, userHeader, hooks, names, w, r)
 	})
 
 	m.HandleFunc("/api/urls/", func(w http.ResponseWriter, r *http.Request) {
 		apiURLs(backend, host, w, r)
 	})
+
+	m.HandleFunc("/api/rename/", func(w http.ResponseWriter, r *http.Request) {
+		apiRename(audited(backend, auditLog, r), host, userHeader, hooks, w, r)
+	})
+
+	m.HandleFunc("/api/batch", func(w http.ResponseWriter, r *http.Request) {
+		apiBatch(audited(backend, auditLog, r), host, userHeader, hooks, names, w, r)
+	})
+
+	m.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		apiEvents(backend, w, r)
+	})
+
+	m.HandleFunc("/api/reverse", func(w http.ResponseWriter, r *http.Request) {
+		apiReverse(backend, host, w, r)
+	})
 }
@@ -10,29 +10,95 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/kellegous/go/audit"
 	"github.com/kellegous/go/backend"
-	"github.com/kellegous/go/backend/leveldb"
+	"github.com/kellegous/go/backend/memory"
+	"github.com/kellegous/go/ids"
 	"github.com/kellegous/go/internal"
+	"github.com/kellegous/go/webhook"
 )
 
 type urlReq struct {
-	URL string `json:"url"`
+	URL    string `json:"url"`
+	Unique bool   `json:"unique,omitempty"`
 }
 
 type env struct {
 	mux     *http.ServeMux
-	dir     string
 	backend backend.Backend
+	host    string
+	hooks   *webhook.Dispatcher
+	audit   *audit.Log
+	names   ids.Generator
+	tmp     string
 }
 
 func (e *env) destroy() {
-	os.RemoveAll(e.dir)
+	if e.hooks != nil {
+		e.hooks.Close()
+	}
+	if e.audit != nil {
+		e.audit.Close()
+	}
+	if e.tmp != "" {
+		os.RemoveAll(e.tmp)
+	}
+	e.backend.Close()
+}
+
+// A temporary directory that is removed along with the env.
+func (e *env) tempDir(t *testing.T) string {
+	if e.tmp == "" {
+		tmp, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.tmp = tmp
+	}
+	return e.tmp
+}
+
+// Set the handlers up again after the env has changed.
+func (e *env) setup() {
+	e.mux = http.NewServeMux()
+	Setup(e.mux, e.backend, e.host, "X-Forwarded-User", e.hooks, e.audit, e.names)
+}
+
+// Send the changes made through the API to the webhook at url.
+func (e *env) enableWebhooks(t *testing.T, url string) {
+	hooks, err := webhook.Open(filepath.Join(e.tempDir(t), "q"), []*webhook.Subscription{
+		{ID: "test", URL: url, Secret: "shh"},
+	}, &webhook.Options{
+		MaxAttempts: 1,
+		Timeout:     time.Second,
+		LogSize:     10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.hooks = hooks
+	e.setup()
+}
+
+// Record the changes made through the API and the admin in an audit log.
+func (e *env) enableAudit(t *testing.T) {
+	l, err := audit.Open(filepath.Join(e.tempDir(t), "audit.log"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.audit = l
+	e.setup()
 }
 
 func (e *env) get(path string) (*mockResponse, error) {
@@ -43,6 +109,10 @@ func (e *env) post(path string, body interface{}) (*mockResponse, error) {
 	return e.callWithJSON("POST", path, body)
 }
 
+func (e *env) put(path string, body interface{}) (*mockResponse, error) {
+	return e.callWithJSON("PUT", path, body)
+}
+
 func (e *env) callWithJSON(method, path string, body interface{}) (*mockResponse, error) {
 	var r io.Reader
 
@@ -58,11 +128,19 @@ func (e *env) callWithJSON(method, path string, body interface{}) (*mockResponse
 }
 
 func (e *env) call(method, path string, body io.Reader) (*mockResponse, error) {
+	return e.callWithHeader(method, path, body, nil)
+}
+
+func (e *env) callWithHeader(method, path string, body io.Reader, header http.Header) (*mockResponse, error) {
 	req, err := http.NewRequest(method, path, body)
 	if err != nil {
 		return nil, err
 	}
 
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
 	res := &mockResponse{
 		header: map[string][]string{},
 	}
@@ -73,25 +151,19 @@ func (e *env) call(method, path string, body io.Reader) (*mockResponse, error) {
 }
 
 func newEnv(host string) (*env, error) {
-	dir, err := ioutil.TempDir("", "")
-	if err != nil {
-		return nil, err
-	}
-
-	backend, err := leveldb.New(filepath.Join(dir, "data"))
+	backend, err := memory.New("")
 	if err != nil {
-		os.RemoveAll(dir)
 		return nil, err
 	}
 
 	mux := http.NewServeMux()
 
-	Setup(mux, backend, host)
+	Setup(mux, backend, host, "X-Forwarded-User", nil, nil, nil)
 
 	return &env{
 		mux:     mux,
-		dir:     dir,
 		backend: backend,
+		host:    host,
 	}, nil
 }
 
@@ -300,7 +372,7 @@ func TestBadPuts(t *testing.T) {
 	}
 	mustBeErr(t, &m)
 
-	res, err = e.post("/api/url/yyy", &urlReq{"not a URL"})
+	res, err = e.post("/api/url/yyy", &urlReq{URL: "not a URL"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -380,6 +452,98 @@ func TestAPIPutThenGetAuto(t *testing.T) {
 	mustBeNamedRouteOf(t, bm.Route, am.Route.Name, "http://b.com/", "")
 }
 
+func TestAPIShortenTwice(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	shorten := func(req *urlReq) string {
+		res, err := e.post("/api/url/", req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustHaveStatus(t, res, http.StatusOK)
+
+		var m msgRoute
+		if err := json.NewDecoder(res).Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		mustBeOk(t, m.Ok)
+		return m.Route.Name
+	}
+
+	a := shorten(&urlReq{URL: "https://b.com/x/?q=1&p=2"})
+
+	// the same page is given the same name.
+	if b := shorten(&urlReq{URL: "HTTPS://B.com:443/x?p=2&q=1"}); b != a {
+		t.Fatalf("expected %s, got %s", a, b)
+	}
+
+	// unless a unique name is asked for.
+	b := shorten(&urlReq{URL: "https://b.com/x/?q=1&p=2", Unique: true})
+	if b == a {
+		t.Fatalf("expected a name other than %s", a)
+	}
+
+	// a name that was chosen is never reused for shortening.
+	res, err := e.post("/api/url/named", &urlReq{URL: "https://c.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+
+	if c := shorten(&urlReq{URL: "https://c.com/"}); c == "named" {
+		t.Fatal("expected a generated name")
+	}
+}
+
+func TestAPIGeneratedNames(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	// a sequentially generated name keeps resolving after the strategy is
+	// changed.
+	res, err := e.post("/api/url/", &urlReq{URL: "https://a.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+
+	var m msgRoute
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	seq := m.Route.Name
+
+	e.names = ids.NewWords(e.backend, ids.DefaultRetries)
+	e.setup()
+
+	res, err = e.post("/api/url/", &urlReq{URL: "https://b.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	if !regexp.MustCompile(`^:[a-z]+-[a-z]+-[0-9]+$`).MatchString(m.Route.Name) {
+		t.Fatalf("expected a name made of words, got %s", m.Route.Name)
+	}
+
+	res, err = e.get("/api/url/" + seq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+
+	res, err = e.get("/api/url/" + m.Route.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+}
+
 func getInPages(e *env, params url.Values) ([][]*routeWithName, error) {
 	var pages [][]*routeWithName
 
@@ -628,3 +792,493 @@ func TestBadList(t *testing.T) {
 		mustBeErr(t, &m)
 	}
 }
+
+func TestAPIChosenGeneratedNames(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	// a generated name cannot be chosen, since it would move the counter.
+	res, err := e.post("/api/url/:zzzzzzzzzzz", &urlReq{URL: "http://ex.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusForbidden)
+
+	res, err = e.post("/api/url/", &urlReq{URL: "http://a.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+
+	var m msgRoute
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Route.Name != ":1" {
+		t.Fatalf("expected generated name of :1, got %s", m.Route.Name)
+	}
+
+	// but one that exists can be replaced, with the time it is replaced at.
+	ts := time.Unix(1601418236, 0)
+	res, err = e.put("/api/url/:1", map[string]interface{}{
+		"url":  "http://b.com/",
+		"time": ts,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	mustBeNamedRouteOf(t, m.Route, ":1", "http://b.com/", "")
+	if m.Route.Time.Equal(ts) {
+		t.Fatal("expected the time in the request to be ignored")
+	}
+
+	res, err = e.post("/api/rename/:1", &renameReq{To: ":2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusForbidden)
+}
+
+func TestAPIWebhooks(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	events := make(chan *webhook.Event, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		if sig := r.Header.Get("X-Go-Signature"); sig != webhook.Sign("shh", body) {
+			t.Errorf("invalid signature %s", sig)
+		}
+
+		var e webhook.Event
+		if err := json.Unmarshal(body, &e); err != nil {
+			t.Error(err)
+			return
+		}
+		events <- &e
+	}))
+	defer srv.Close()
+
+	e.enableWebhooks(t, srv.URL)
+
+	for _, req := range []struct {
+		method string
+		url    string
+	}{
+		{"POST", "http://a.com/"},
+		{"PUT", "http://b.com/"},
+	} {
+		res, err := e.callWithJSON(req.method, "/api/url/a", &urlReq{URL: req.url})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustHaveStatus(t, res, http.StatusOK)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		res, err := e.call("DELETE", "/api/url/"+name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustHaveStatus(t, res, http.StatusOK)
+	}
+
+	// deleting b, which did not exist, is not an event.
+	for _, exp := range []struct {
+		t        webhook.EventType
+		url      string
+		previous string
+	}{
+		{webhook.Create, "http://a.com/", ""},
+		{webhook.Update, "http://b.com/", "http://a.com/"},
+		{webhook.Delete, "", "http://b.com/"},
+	} {
+		var ev *webhook.Event
+		select {
+		case ev = <-events:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %s", exp.t)
+		}
+
+		if ev.Type != exp.t || ev.Name != "a" {
+			t.Fatalf("expected %s of a, got %s of %s", exp.t, ev.Type, ev.Name)
+		}
+
+		if exp.url != "" {
+			mustBeRouteOf(t, ev.Route, exp.url)
+		} else if ev.Route != nil {
+			t.Fatalf("expected no route, got %v", ev.Route)
+		}
+
+		if exp.previous != "" {
+			mustBeRouteOf(t, ev.Previous, exp.previous)
+		} else if ev.Previous != nil {
+			t.Fatalf("expected no previous route, got %v", ev.Previous)
+		}
+	}
+
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAPIConditionalPut(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	save := func(method, url, header, etag string) *mockResponse {
+		res, err := e.callWithHeader(method, "/api/url/oncall",
+			strings.NewReader(fmt.Sprintf(`{"url": %q}`, url)),
+			http.Header{header: {etag}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	mustBeConflict := func(res *mockResponse, status int, url string) {
+		mustHaveStatus(t, res, status)
+
+		var m msgRouteErr
+		if err := json.NewDecoder(res).Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+
+		if m.Ok || m.Route == nil || m.Route.URL != url || res.header.Get("ETag") == "" {
+			t.Fatalf("expected a conflict with %s, got %+v", url, m)
+		}
+	}
+
+	// If-Match needs the route to exist.
+	res := save("PUT", "http://a.com/", "If-Match", "*")
+	mustHaveStatus(t, res, http.StatusPreconditionFailed)
+
+	res = save("POST", "http://a.com/", "If-None-Match", "*")
+	mustHaveStatus(t, res, http.StatusOK)
+	v1 := res.header.Get("ETag")
+
+	// the route can only be created once.
+	mustBeConflict(save("POST", "http://b.com/", "If-None-Match", "*"), http.StatusConflict, "http://a.com/")
+
+	res, err := e.get("/api/url/oncall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+	if etag := res.header.Get("ETag"); etag != v1 {
+		t.Fatalf("expected ETag %s, got %s", v1, etag)
+	}
+
+	res, err = e.callWithHeader("GET", "/api/url/oncall", nil, http.Header{"If-None-Match": {v1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusNotModified)
+
+	res = save("PUT", "http://b.com/", "If-Match", v1)
+	mustHaveStatus(t, res, http.StatusOK)
+	v2 := res.header.Get("ETag")
+	if v2 == "" || v2 == v1 {
+		t.Fatalf("expected a new ETag, got %s", v2)
+	}
+
+	// an edit of the route as it was is rejected.
+	mustBeConflict(save("PUT", "http://c.com/", "If-Match", v1), http.StatusPreconditionFailed, "http://b.com/")
+	mustBeConflict(save("PUT", "http://c.com/", "If-None-Match", v2), http.StatusPreconditionFailed, "http://b.com/")
+
+	// as are edits after an unconditional put.
+	res, err = e.put("/api/url/oncall", &urlReq{URL: "http://d.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+	mustBeConflict(save("PUT", "http://c.com/", "If-Match", v2), http.StatusPreconditionFailed, "http://d.com/")
+
+	res = save("PUT", "http://c.com/", "If-Match", `"x", `+res.header.Get("ETag"))
+	mustHaveStatus(t, res, http.StatusOK)
+
+	rt, err := e.backend.Get(context.Background(), "oncall")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeRouteOf(t, rt, "http://c.com/")
+}
+
+func TestAPIConditionalDelete(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	del := func(etag string) *mockResponse {
+		res, err := e.callWithHeader("DELETE", "/api/url/oncall", nil, http.Header{"If-Match": {etag}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	res, err := e.post("/api/url/oncall", &urlReq{URL: "http://a.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+	v1 := res.header.Get("ETag")
+
+	res, err = e.put("/api/url/oncall", &urlReq{URL: "http://b.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+	v2 := res.header.Get("ETag")
+
+	// a delete of the route as it was is rejected, with the route as it is.
+	res = del(v1)
+	mustHaveStatus(t, res, http.StatusPreconditionFailed)
+
+	var m msgRouteErr
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Ok || m.Route == nil || m.Route.URL != "http://b.com/" || res.header.Get("ETag") != v2 {
+		t.Fatalf("expected a conflict with http://b.com/, got %+v", m)
+	}
+
+	if _, err := e.backend.Get(context.Background(), "oncall"); err != nil {
+		t.Fatalf("expected oncall to survive, got %v", err)
+	}
+
+	mustHaveStatus(t, del(v2), http.StatusOK)
+
+	if _, err := e.backend.Get(context.Background(), "oncall"); !errors.Is(err, internal.ErrRouteNotFound) {
+		t.Fatalf("expected oncall to be deleted, got %v", err)
+	}
+
+	// If-Match needs the route to exist.
+	mustHaveStatus(t, del("*"), http.StatusPreconditionFailed)
+}
+
+func TestAPICreateAndReplace(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	create := func(url, user string) *mockResponse {
+		res, err := e.callWithHeader("POST", "/api/url/wiki",
+			strings.NewReader(fmt.Sprintf(`{"url": %q}`, url)),
+			http.Header{"X-Forwarded-User": {user}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	// replacing needs something to replace.
+	res, err := e.put("/api/url/wiki", &urlReq{URL: "http://a.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusNotFound)
+
+	res, err = e.put("/api/url/", &urlReq{URL: "http://a.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusBadRequest)
+
+	res = create("http://a.com/", "alice")
+	mustHaveStatus(t, res, http.StatusOK)
+
+	// a name that is taken is not clobbered, and whoever took it is named.
+	res = create("http://b.com/", "bob")
+	mustHaveStatus(t, res, http.StatusConflict)
+
+	var m msgRouteErr
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Route == nil || m.Route.URL != "http://a.com/" || m.Route.Owner != "alice" {
+		t.Fatalf("expected the conflict to show alice's route, got %+v", m)
+	}
+
+	// a route keeps its owner when it is replaced.
+	res, err = e.callWithHeader("PUT", "/api/url/wiki",
+		strings.NewReader(`{"url": "http://b.com/"}`),
+		http.Header{"X-Forwarded-User": {"bob"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+
+	rt, err := e.backend.Get(context.Background(), "wiki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeRouteOf(t, rt, "http://b.com/")
+	if rt.Owner != "alice" {
+		t.Fatalf("expected owner alice, got %q", rt.Owner)
+	}
+}
+
+func TestAPIRename(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	rename := func(from, body, user string) *mockResponse {
+		res, err := e.callWithHeader("POST", "/api/rename/"+from,
+			strings.NewReader(body),
+			http.Header{"X-Forwarded-User": {user}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	redirect := func(name string) string {
+		res := httptest.NewRecorder()
+		getDefault(e.backend, res, httptest.NewRequest("GET", "/"+name, nil))
+		return res.Header().Get("Location")
+	}
+
+	res, err := e.post("/api/url/", &urlReq{URL: "http://a.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+
+	res = rename(":1", `{"to": "edit"}`, "")
+	mustHaveStatus(t, res, http.StatusBadRequest)
+
+	res = rename(":2", `{"to": "a"}`, "")
+	mustHaveStatus(t, res, http.StatusNotFound)
+
+	// a generated name can be promoted to a vanity one.
+	res = rename(":1", `{"to": "a", "alias": true}`, "")
+	mustHaveStatus(t, res, http.StatusOK)
+
+	var m msgRoute
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	mustBeNamedRouteOf(t, m.Route, "a", "http://a.com/", "")
+
+	// and the alias left behind follows it.
+	if _, err := e.put("/api/url/a", &urlReq{URL: "http://b.com/"}); err != nil {
+		t.Fatal(err)
+	}
+	if loc := redirect(":1"); loc != "http://b.com/" {
+		t.Fatalf("expected :1 to redirect to http://b.com/, got %s", loc)
+	}
+
+	res, err = e.callWithHeader("POST", "/api/url/owned",
+		strings.NewReader(`{"url": "http://c.com/"}`),
+		http.Header{"X-Forwarded-User": {"alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+
+	// a name that is taken is not clobbered.
+	res = rename("owned", `{"to": "a"}`, "alice")
+	mustHaveStatus(t, res, http.StatusConflict)
+
+	// only the owner can move a route, but anyone can copy it.
+	res = rename("owned", `{"to": "mine"}`, "bob")
+	mustHaveStatus(t, res, http.StatusForbidden)
+
+	res = rename("owned", `{"to": "copied", "copy": true}`, "bob")
+	mustHaveStatus(t, res, http.StatusOK)
+
+	res = rename("owned", `{"to": "moved"}`, "alice")
+	mustHaveStatus(t, res, http.StatusOK)
+
+	ctx := context.Background()
+	if _, err := e.backend.Get(ctx, "owned"); !errors.Is(err, internal.ErrRouteNotFound) {
+		t.Fatalf("expected owned to be gone, got %v", err)
+	}
+
+	for _, name := range []string{"copied", "moved"} {
+		rt, err := e.backend.Get(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustBeRouteOf(t, rt, "http://c.com/")
+		if rt.Owner != "alice" {
+			t.Fatalf("%s: expected owner alice, got %q", name, rt.Owner)
+		}
+	}
+}
+
+func TestAPIReverse(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	for name, u := range map[string]string{
+		"a": "https://jenkins.example.com/job/a",
+		"b": "HTTPS://Jenkins.example.com:443/job/a#log",
+		"c": "https://jenkins.example.com/job/c",
+		"d": "https://wiki.example.com/job/a",
+	} {
+		res, err := e.post("/api/url/"+name, &urlReq{URL: u})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustHaveStatus(t, res, http.StatusOK)
+	}
+
+	reverse := func(query string) []string {
+		res, err := e.get("/api/reverse?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustHaveStatus(t, res, http.StatusOK)
+
+		var m msgRoutes
+		if err := json.NewDecoder(res).Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, rt := range m.Routes {
+			names = append(names, rt.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		query string
+		names []string
+	}{
+		{"url=" + url.QueryEscape("https://jenkins.example.com/job/a"), []string{"a", "b"}},
+		{"url=" + url.QueryEscape("https://jenkins.example.com/job/x"), nil},
+		{"host=Jenkins.example.com", []string{"a", "b", "c"}},
+		{"host=example.com", nil},
+	}
+
+	for _, test := range tests {
+		if names := reverse(test.query); fmt.Sprint(names) != fmt.Sprint(test.names) {
+			t.Fatalf("%s: expected %v, got %v", test.query, test.names, names)
+		}
+	}
+
+	for _, query := range []string{"", "url=a&host=b"} {
+		res, err := e.get("/api/reverse?" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustHaveStatus(t, res, http.StatusBadRequest)
+	}
+}
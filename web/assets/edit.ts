@@ -37,21 +37,42 @@ namespace go {
         }
     };
 
+    // Replace the link if it was loaded, as long as it has not changed since,
+    // otherwise create it.
+    var save = (name: string) => {
+        if (etag) {
+            return xhr.create('PUT', '/api/url/' + name)
+                .withHeader('If-Match', etag);
+        }
+        return xhr.post('/api/url/' + name);
+    };
+
     var formDidSubmit = (e: Event) => {
         e.preventDefault();
 
         var name = nameFrom(location.pathname),
             url = ($url.value || '').trim();
 
-        xhr.post('/api/url/' + name)
-            .sendJSON({ url: url })
+        var req = save(name);
+        req.sendJSON({ url: url })
             .onDone((data: string, status: number) => {
                 var msg = <MsgRoute>JSON.parse(data);
+
+                // Someone else took the name or changed the link. Saving
+                // again replaces their link.
+                if (status == 409 || status == 412) {
+                    etag = req.header('ETag');
+                    showChanged(msg.route, status == 409);
+                    return;
+                }
+
                 if (!msg.ok) {
                     showError(msg.error);
                     return;
                 }
 
+                etag = req.header('ETag');
+
                 var route = msg.route;
                 if (!route) {
                     hideDrawer();
@@ -64,6 +85,7 @@ namespace go {
                 if (url) {
                     history.replaceState({}, null, '/edit/' + name);
                     showLink(name, host);
+                    showOthers(name, url);
                 }
             });
     };
@@ -73,6 +95,9 @@ namespace go {
             url = ($url.value || '').trim();
 
         $url.value = '';
+        etag = null;
+        showOwner(null);
+        showOthers(name, '');
         urlDidChange();
 
         if (!name) {
@@ -105,6 +130,70 @@ namespace go {
         dom.css($cmp, 'transform', 'scaleY(1)');
     };
 
+    var showChanged = (route: Route, taken: boolean) => {
+        $cmp.textContent = '';
+        $cmp.classList.remove('link');
+        $cmp.classList.add('fuck');
+
+        var $s = dom.c('span');
+        if (!route) {
+            $s.textContent = 'Someone removed this link while you were editing it. Save again to create it.';
+        } else if (taken) {
+            $s.textContent = 'go/' + route.name + ' is already taken'
+                + (route.owner ? ' by ' + route.owner : '')
+                + ' and points to ' + route.url + '. Save again to replace it.';
+        } else {
+            $s.textContent = 'Someone changed this link to ' + route.url
+                + ' while you were editing it. Save again to replace their change.';
+        }
+        showOwner(route);
+        $cmp.appendChild($s);
+
+        dom.css($cmp, 'transform', 'scaleY(1)');
+    };
+
+    // Say who owns the link being edited.
+    var showOwner = (route: Route) => {
+        $own.textContent = route && route.owner
+            ? 'go/' + route.name + ' is owned by ' + route.owner
+            : '';
+    };
+
+    // List the other links that lead to the same page as the one being
+    // edited.
+    var showOthers = (name: string, url: string) => {
+        $oth.textContent = '';
+        if (!url) {
+            return;
+        }
+
+        xhr.get('/api/reverse?url=' + encodeURIComponent(url))
+            .send()
+            .onDone((data: string, status: number) => {
+                var msg = <MsgRoutes>JSON.parse(data);
+                if (!msg.ok) {
+                    return;
+                }
+
+                var others = msg.routes.filter((route) => route.name != name);
+                if (others.length == 0) {
+                    return;
+                }
+
+                $oth.textContent = 'Other links to this page: ';
+                others.forEach((route, i) => {
+                    if (i > 0) {
+                        $oth.appendChild(document.createTextNode(', '));
+                    }
+
+                    var $a = dom.c('a');
+                    $a.setAttribute('href', '/edit/' + route.name);
+                    $a.textContent = 'go/' + route.name;
+                    $oth.appendChild($a);
+                });
+            });
+    };
+
     var showLink = (name: string, src: string) => {
         var lnk = '/' + name;
 
@@ -151,8 +240,8 @@ namespace go {
             return;
         }
 
-        xhr.get('/api/url/' + name)
-            .send()
+        var req = xhr.get('/api/url/' + name);
+        req.send()
             .onDone((data: string, status: number) => {
                 var msg = <MsgRoute>JSON.parse(data);
 
@@ -160,8 +249,12 @@ namespace go {
                     return;
                 }
 
+                etag = req.header('ETag');
+                showOwner(msg.route);
+
                 // TODO(knorton): Hanlde things.
                 var url = msg.route.url || '';
+                showOthers(name, url);
                 $url.value = url;
                 $url.focus();
                 urlDidChange();
@@ -171,8 +264,11 @@ namespace go {
     var $frm = <HTMLFormElement>dom.q('form'),
         $cmp = dom.q('#cmp'),
         $cls = dom.q('#cls'),
+        $own = dom.q('#own'),
+        $oth = dom.q('#oth'),
         $url = <HTMLInputElement>dom.q('#url'),
-        lastUrl: string;
+        lastUrl: string,
+        etag: string;
 
     appDidLoad();
 }
\ No newline at end of file
@@ -3,6 +3,7 @@ interface Route {
 	url: string;
 	time: string;
 	source_host: string;
+	owner?: string;
 }
 
 interface Msg {
@@ -12,4 +13,9 @@ interface Msg {
 
 interface MsgRoute extends Msg {
 	route: Route;
+}
+
+interface MsgRoutes extends Msg {
+	routes: Route[];
+	next?: string;
 }
\ No newline at end of file
@@ -33,6 +33,10 @@ namespace xhr {
 			return this;
 		}
 
+		public header(k: string) {
+			return this.xhr.getResponseHeader(k);
+		}
+
 		public sendJSON(data: any) {
 			this.withHeader('Content-Type', 'application/json;charset=utf8');
 			this.xhr.send(JSON.stringify(data));
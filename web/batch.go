@@ -0,0 +1,352 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/ids"
+	"github.com/kellegous/go/internal"
+	"github.com/kellegous/go/webhook"
+)
+
+// The most operations a single batch may hold, which is also the most writes
+// firestore allows in a batch.
+const maxBatchOps = 500
+
+// The operations a batch may hold, which behave like POST, PUT and DELETE on
+// /api/url/.
+const (
+	batchCreate = "create"
+	batchUpdate = "update"
+	batchDelete = "delete"
+)
+
+var errNotApplied = errors.New("not applied, another operation in the batch failed")
+
+// batchOp is a single operation in a batch. IfMatch is a list of ETags, as it
+// would be in an If-Match header.
+type batchOp struct {
+	Op      string `json:"op"`
+	Name    string `json:"name"`
+	URL     string `json:"url,omitempty"`
+	IfMatch string `json:"if_match,omitempty"`
+
+	// time is when the operation was received.
+	time time.Time
+}
+
+// batchReq is the body of a batch. In an atomic batch either every operation
+// is applied or none are; otherwise each is applied on its own.
+type batchReq struct {
+	Atomic bool       `json:"atomic"`
+	Ops    []*batchOp `json:"ops"`
+}
+
+// batchResult is the outcome of one operation, with the status it would have
+// had as a request of its own.
+type batchResult struct {
+	Ok     bool           `json:"ok"`
+	Status int            `json:"status"`
+	Error  string         `json:"error,omitempty"`
+	Route  *routeWithName `json:"route,omitempty"`
+	ETag   string         `json:"etag,omitempty"`
+}
+
+type msgBatch struct {
+	Ok      bool           `json:"ok"`
+	Results []*batchResult `json:"results"`
+}
+
+// Check that an operation could be applied.
+func validateBatchOp(r *http.Request, op *batchOp) error {
+	switch op.Op {
+	case batchCreate, batchUpdate, batchDelete:
+	default:
+		return fmt.Errorf("invalid op %q", op.Op)
+	}
+
+	if op.Name == "" && op.Op != batchCreate {
+		return errors.New("name required")
+	}
+
+	if strings.Contains(op.Name, "/") {
+		return errors.New("invalid name")
+	}
+
+	if op.Op == batchDelete {
+		return nil
+	}
+
+	if op.URL == "" {
+		return errors.New("url required")
+	}
+
+	if isBannedName(op.Name) {
+		return errBannedName
+	}
+
+	if op.Op == batchCreate && isGenerated(op.Name) {
+		return errGeneratedName
+	}
+
+	return validateURL(r, op.URL)
+}
+
+// Check an operation against the route it changes and turn it into a change
+// that is only made if that route has not changed since. The change is nil if
+// there is nothing to do. The route it changes is returned even if the check
+// fails.
+func prepareBatchOp(ctx context.Context, be backend.Backend, op *batchOp, user string) (*backend.Change, *internal.Route, error) {
+	prev, ver, err := be.GetVersion(ctx, op.Name)
+	if errors.Is(err, internal.ErrRouteNotFound) {
+		prev, ver = nil, backend.NoVersion
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	pre := &precondition{
+		match:   splitETags(op.IfMatch),
+		create:  op.Op == batchCreate,
+		replace: op.Op == batchUpdate,
+	}
+	if err := pre.check(prev != nil, ver); err != nil {
+		return nil, prev, err
+	}
+
+	c := &backend.Change{
+		Op:          backend.OpDel,
+		Name:        op.Name,
+		Conditional: true,
+		Version:     ver,
+	}
+
+	if op.Op == batchDelete {
+		if prev == nil {
+			return nil, nil, nil
+		}
+		return c, prev, nil
+	}
+
+	// as with a put, a route keeps the owner of the one it replaces.
+	c.Op = backend.OpPut
+	c.Route = &internal.Route{
+		URL:   op.URL,
+		Time:  op.time,
+		Owner: user,
+	}
+	if prev != nil {
+		c.Route.Owner = prev.Owner
+	}
+
+	return c, prev, nil
+}
+
+// The result of an operation that failed.
+func batchError(name string, err error, prev *internal.Route, host string) *batchResult {
+	res := &batchResult{
+		Error: err.Error(),
+	}
+
+	switch err {
+	case internal.ErrRouteNotFound:
+		res.Status = http.StatusNotFound
+		res.Error = "Not Found"
+	case errRouteChanged:
+		res.Status = http.StatusPreconditionFailed
+	case errRouteExists, errTooManyChanges, ids.ErrNoFreeName:
+		res.Status = http.StatusConflict
+	case errNotApplied:
+		res.Status = http.StatusFailedDependency
+	default:
+		log.Printf("[error] %s", err)
+		res.Status = http.StatusInternalServerError
+		res.Error = "backend error"
+	}
+
+	if prev != nil && res.Status != http.StatusInternalServerError {
+		res.Route = newRouteWithName(name, prev, host)
+	}
+
+	return res
+}
+
+// Apply the operations in a single write, filling in the result of each. If
+// any operation fails, none are applied.
+func applyBatch(ctx context.Context, be backend.Backend, host string, hooks *webhook.Dispatcher, user string, ops []*batchOp, results []*batchResult) {
+	// fail the operation at i, or every operation if i is negative.
+	fail := func(i int, err error, prev *internal.Route) {
+		for j, op := range ops {
+			if i < 0 {
+				results[j] = batchError(op.Name, err, nil, host)
+			} else if j == i {
+				results[j] = batchError(op.Name, err, prev, host)
+			} else {
+				results[j] = batchError(op.Name, errNotApplied, nil, host)
+			}
+		}
+	}
+
+	for attempt := 0; attempt < putAttempts; attempt++ {
+		var changes []*backend.Change
+		prevs := make([]*internal.Route, len(ops))
+		ixs := make([]int, len(ops))
+		for i, op := range ops {
+			c, prev, err := prepareBatchOp(ctx, be, op, user)
+			if err != nil {
+				fail(i, err, prev)
+				return
+			}
+
+			prevs[i], ixs[i] = prev, -1
+			if c != nil {
+				ixs[i] = len(changes)
+				changes = append(changes, c)
+			}
+		}
+
+		vers, err := be.Apply(ctx, changes)
+		if errors.Is(err, backend.ErrVersionMismatch) {
+			continue
+		} else if err != nil {
+			fail(-1, err, nil)
+			return
+		}
+
+		for i, op := range ops {
+			results[i] = &batchResult{
+				Ok:     true,
+				Status: http.StatusOK,
+			}
+
+			// deleting a route that does not exist changes nothing.
+			ix := ixs[i]
+			if ix < 0 {
+				continue
+			}
+
+			c := changes[ix]
+			e := &webhook.Event{
+				Type:     webhook.Delete,
+				Name:     op.Name,
+				Previous: prevs[i],
+				Time:     time.Now(),
+			}
+
+			if c.Op == backend.OpPut {
+				results[i].Route = newRouteWithName(op.Name, c.Route, host)
+				results[i].ETag = etagOf(vers[ix])
+
+				e.Type = webhook.Create
+				e.Route = c.Route
+				if prevs[i] != nil {
+					e.Type = webhook.Update
+				}
+			}
+			notify(hooks, e)
+		}
+		return
+	}
+
+	fail(-1, errTooManyChanges, nil)
+}
+
+// Apply a list of operations, either all at once or each on its own.
+func apiBatch(backend backend.Backend, host, userHeader string, hooks *webhook.Dispatcher, names ids.Generator, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeJSONError(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req batchReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Ops) == 0 || len(req.Ops) > maxBatchOps {
+		writeJSONError(w, fmt.Sprintf("a batch must hold between 1 and %d ops", maxBatchOps), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	res := &msgBatch{
+		Ok:      true,
+		Results: make([]*batchResult, len(req.Ops)),
+	}
+
+	// In an atomic batch each name may only be changed once, so that every
+	// change can be checked against the route as it was before the batch.
+	seen := map[string]bool{}
+	for i, op := range req.Ops {
+		err := validateBatchOp(r, op)
+		if err == nil && req.Atomic && op.Name != "" {
+			if seen[op.Name] {
+				err = fmt.Errorf("%s is changed more than once", op.Name)
+			}
+			seen[op.Name] = true
+		}
+
+		if err != nil {
+			res.Ok = false
+			res.Results[i] = &batchResult{
+				Status: http.StatusBadRequest,
+				Error:  err.Error(),
+			}
+		}
+	}
+
+	// If no name is given, an ID must be generated. None are generated once
+	// an atomic batch has failed, since it will not be applied.
+	for i, op := range req.Ops {
+		if req.Atomic && !res.Ok {
+			break
+		}
+
+		if res.Results[i] != nil || op.Op == batchDelete {
+			continue
+		}
+
+		op.time = time.Now()
+		if op.Name != "" {
+			continue
+		}
+
+		var err error
+		if op.Name, err = names.Next(ctx); err != nil {
+			res.Ok = false
+			res.Results[i] = batchError(op.Name, err, nil, host)
+		}
+	}
+
+	user := requestUser(r, userHeader)
+	if req.Atomic && !res.Ok {
+		for i, op := range req.Ops {
+			if res.Results[i] == nil {
+				res.Results[i] = batchError(op.Name, errNotApplied, nil, host)
+			}
+		}
+	} else if req.Atomic {
+		applyBatch(ctx, backend, host, hooks, user, req.Ops, res.Results)
+	} else {
+		for i := range req.Ops {
+			if res.Results[i] == nil {
+				applyBatch(ctx, backend, host, hooks, user, req.Ops[i:i+1], res.Results[i:i+1])
+			}
+		}
+	}
+
+	for _, rs := range res.Results {
+		res.Ok = res.Ok && rs.Ok
+	}
+
+	writeJSON(w, res, http.StatusOK)
+}
@@ -0,0 +1,113 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/kellegous/go/internal"
+)
+
+func (e *env) batch(t *testing.T, atomic bool, ops ...*batchOp) *msgBatch {
+	res, err := e.callWithJSON("POST", "/api/batch", &batchReq{
+		Atomic: atomic,
+		Ops:    ops,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustHaveStatus(t, res, http.StatusOK)
+
+	var m msgBatch
+	if err := json.NewDecoder(res).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	return &m
+}
+
+func mustHaveStatuses(t *testing.T, m *msgBatch, statuses ...int) {
+	if len(m.Results) != len(statuses) {
+		t.Fatalf("expected %d results, got %d", len(statuses), len(m.Results))
+	}
+
+	for i, status := range statuses {
+		if m.Results[i].Status != status {
+			t.Fatalf("op %d: expected status %d, got %+v", i, status, m.Results[i])
+		}
+	}
+}
+
+func TestAPIBatch(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	ctx := context.Background()
+
+	// each op in a best-effort batch is applied on its own.
+	m := e.batch(t, false,
+		&batchOp{Op: batchCreate, Name: "a", URL: "http://a.com/"},
+		&batchOp{Op: batchCreate, URL: "http://gen.com/"},
+		&batchOp{Op: batchUpdate, Name: "b", URL: "http://b.com/"},
+		&batchOp{Op: batchCreate, Name: "edit", URL: "http://edit.com/"},
+		&batchOp{Op: batchCreate, Name: "a", URL: "http://a2.com/"},
+		&batchOp{Op: batchCreate, Name: ":9", URL: "http://gen9.com/"})
+	if m.Ok {
+		t.Fatal("expected the batch to fail")
+	}
+	mustHaveStatuses(t, m, http.StatusOK, http.StatusOK, http.StatusNotFound,
+		http.StatusBadRequest, http.StatusConflict, http.StatusBadRequest)
+	mustBeNamedRouteOf(t, m.Results[1].Route, ":1", "http://gen.com/", "")
+
+	etag := m.Results[0].ETag
+
+	// an atomic batch that fails validation does not use up a name.
+	m = e.batch(t, true,
+		&batchOp{Op: batchCreate, URL: "http://gen2.com/"},
+		&batchOp{Op: batchCreate, Name: "edit", URL: "http://edit.com/"})
+	mustHaveStatuses(t, m, http.StatusFailedDependency, http.StatusBadRequest)
+
+	if id, err := e.backend.LastID(ctx); err != nil {
+		t.Fatal(err)
+	} else if id != 1 {
+		t.Fatalf("expected the id counter to stay at 1, got %d", id)
+	}
+
+	// an atomic batch is not applied if any op fails.
+	m = e.batch(t, true,
+		&batchOp{Op: batchCreate, Name: "c", URL: "http://c.com/"},
+		&batchOp{Op: batchUpdate, Name: "a", URL: "http://a3.com/", IfMatch: `"nope"`})
+	if m.Ok {
+		t.Fatal("expected the batch to fail")
+	}
+	mustHaveStatuses(t, m, http.StatusFailedDependency, http.StatusPreconditionFailed)
+
+	if _, err := e.backend.Get(ctx, "c"); !errors.Is(err, internal.ErrRouteNotFound) {
+		t.Fatalf("expected c to not be created, got %v", err)
+	}
+
+	m = e.batch(t, true,
+		&batchOp{Op: batchCreate, Name: "c", URL: "http://c.com/"},
+		&batchOp{Op: batchUpdate, Name: "a", URL: "http://a3.com/", IfMatch: etag},
+		&batchOp{Op: batchDelete, Name: ":1"})
+	if !m.Ok {
+		t.Fatalf("expected the batch to succeed, got %+v", m.Results)
+	}
+
+	rt, err := e.backend.Get(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeRouteOf(t, rt, "http://a3.com/")
+
+	if _, err := e.backend.Get(ctx, ":1"); !errors.Is(err, internal.ErrRouteNotFound) {
+		t.Fatalf("expected :1 to be deleted, got %v", err)
+	}
+
+	// a name can only be changed once in an atomic batch.
+	m = e.batch(t, true,
+		&batchOp{Op: batchDelete, Name: "c"},
+		&batchOp{Op: batchDelete, Name: "c"})
+	mustHaveStatuses(t, m, http.StatusFailedDependency, http.StatusBadRequest)
+}
@@ -94,7 +94,7 @@ func closeSvg() (*asset, error) {
 	return a, nil
 }
 
-var _editCss = "\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\x93\xdf\x8e\xda\x3c\x10\xc5\xef\xbf\xa7\xb0\xe0\x06\x24\x9c\x35\xec\xc2\x7e\xd8\x52\x1f\xa2\x77\xbd\x74\xec\x49\x62\xad\xe3\xb1\x6c\x07\xc2\x46\xbc\x7b\x95\x3f\x40\x5a\xb6\xaa\xaa\x08\x14\xec\x1f\x9e\x99\x73\x8e\x73\xd4\x97\x2e\x97\xea\xa3\x0c\xd8\x38\xcd\x97\x45\x51\x88\x02\x5d\xa2\x85\xac\x8d\xbd\xf0\xc5\x77\x69\xe1\x2c\x2f\x8b\x4d\x94\x2e\xd2\x08\xc1\x4c\x40\x34\x9f\xc0\xdf\x76\xbe\x1d\x7f\x9e\xc1\x94\x55\xe2\xaf\x8c\x5d\x0b\x0c\x75\x97\xa0\x4d\x54\x5a\x53\x3a\xae\xc0\x25\x08\xd7\x65\x2e\x43\x77\x36\x3a\x55\xfc\xb0\xef\xff\x57\xcb\x50\x1a\xc7\x19\x91\x4d\x42\xe1\x31\x9a\x64\xd0\xf1\x00\x56\x26\x73\x82\xeb\xb2\x09\xb6\xfb\x87\x66\x5e\xbf\x68\x46\x4c\x05\x19\xf3\xad\xf0\x52\x6b\xe3\x4a\xbe\xdb\xfb\x56\x28\xb4\x18\xf8\xf2\x78\x3c\x8a\x1c\x83\x86\x40\x83\xd4\xa6\x89\xfc\xcd\xb7\xd3\x0a\xdf\xfa\x96\x44\xb4\x46\x93\xa5\x52\x4a\x60\x93\xac\x71\xc0\x1d\x3a\x10\x39\xb6\x34\x56\x52\xe3\x99\x33\xb2\xf3\x2d\x39\xf8\x96\x84\x32\x97\x2b\xb6\xe9\x9f\x6c\xb7\x1e\x26\xe0\x05\xaa\x26\x76\xcf\x27\xb2\x63\x31\x02\x9c\x9e\x21\xff\x30\x89\x1a\xe7\x9b\x44\xbd\x95\x0a\x2a\xb4\x1a\x42\x37\x35\xa9\xb5\xbe\xa1\x35\x7e\xfe\x91\x50\xb5\xef\x7e\x99\x71\x1c\x7e\x7f\x60\x4f\x6a\xcf\xec\xb1\x50\xa4\x99\x8a\xbb\xad\x6f\x45\x0a\xd2\x4d\x76\x0c\xaf\xbd\xa5\x64\xc7\x58\x1d\x09\xc8\x08\xd4\x38\x8a\x4d\x12\xf7\x3d\x1e\x95\xb4\xf0\x63\xc5\xd6\x8f\x35\x8a\xc1\xf4\x15\x13\x7a\x32\x46\xe0\x26\x74\x8e\x29\x61\x4d\xfb\xc2\xcf\xa2\xdf\x76\x43\x6f\xe1\x5f\x3d\x19\x86\xce\xac\x71\x1f\xb3\x18\xd3\x49\x94\xe2\xd0\x3f\x23\x52\x34\xea\x4b\x04\x60\x96\x84\x01\xfd\x26\x6f\xa2\xb2\x63\x31\x0a\xa5\x41\x61\x90\x83\x1c\xbd\xf7\x23\x96\x55\x2e\xcd\xe4\x1f\xc9\x29\x11\x7d\x93\xfd\x87\x91\xfe\x46\xcd\xf8\xc2\xa2\x4c\x7c\x98\xed\xba\x54\x36\x76\xf7\xd8\xcb\x3c\xa2\x6d\x12\x88\x84\x9e\x33\x31\x20\x9c\x89\x51\x0d\x7e\x0f\xf2\xa0\xc4\x63\x0c\x53\xcb\x12\x78\x13\xec\x6a\xf1\x12\x5f\x94\xc5\x08\x59\x3c\x95\x8b\xf5\x1c\xba\xd7\x18\x6d\xb8\xbb\xf1\x20\x02\x78\x90\x89\x3b\x9c\xde\xe6\x7b\xe3\x45\xff\xdf\xb7\xa4\xff\x12\xaa\x09\x11\x03\xf7\x68\x86\x43\x66\x49\x41\x2f\x95\x49\x97\x29\x27\xaa\xc9\x8d\xa2\x39\x7c\x1a\x08\x2b\x96\xbd\xbf\x6f\x08\xdb\x10\x96\x6d\xdf\xf7\x1b\xb2\x5d\x8b\x89\xe6\x4c\x4c\x47\x51\x38\x81\x4b\xf1\xa6\xb0\x8d\xd9\xc9\xc4\xee\x86\x65\xaf\xbf\x73\xc6\x55\x10\xcc\x28\x23\xaf\xf0\x04\xe1\x01\x1f\xae\xff\xfd\x0c\x00\x00\xff\xff\xd0\xd6\xde\x37\xdb\x04\x00\x00"
+var _editCss = "\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\x93\xdf\x6e\xf2\x38\x10\xc5\xef\xf7\x29\x2c\x72\x03\x12\xce\x67\x68\x49\x3f\x6c\x69\x1f\x62\xef\xf6\xd2\x71\x26\x89\x55\xc7\x63\xd9\x0e\x84\x46\x79\xf7\x55\xfe\x00\xe9\xb6\xab\x6a\x15\x81\x82\xfd\x63\x3c\x73\xce\x71\x8e\xc5\xad\xcf\xa5\x7a\xaf\x3c\xb6\xb6\xe0\x49\x59\x96\xa2\x44\x1b\x69\x29\x1b\x6d\x6e\x7c\xf3\x97\x34\x70\x95\xb7\xcd\x3e\x48\x1b\x68\x00\xaf\x17\x20\xe8\x0f\xe0\xaf\x47\xd7\xcd\x3f\xaf\xa0\xab\x3a\xf2\x17\xc6\x86\x12\x7d\xd3\x47\xe8\x22\x95\x46\x57\x96\x2b\xb0\x11\xfc\x90\xe4\xd2\xf7\x57\x5d\xc4\x9a\x67\xa7\xf1\x7f\x8d\xf4\x95\xb6\x9c\x11\xd9\x46\x14\x0e\x83\x8e\x1a\x2d\xf7\x60\x64\xd4\x17\x18\x92\xd6\x9b\xfe\x7f\x34\xf3\xf2\x4d\x33\x62\x39\x90\x31\xd7\x09\x27\x8b\x42\xdb\x8a\x1f\x4f\xae\x13\x0a\x0d\x7a\x9e\x9c\xcf\x67\x91\xa3\x2f\xc0\x53\x2f\x0b\xdd\x06\xfe\xea\xba\x65\x85\x1f\x5c\x47\x02\x1a\x5d\x90\x44\x29\x25\xb0\x8d\x46\x5b\xe0\x16\x2d\x88\x1c\x3b\x1a\x6a\x59\xe0\x95\x33\x72\x74\x1d\xc9\x5c\x47\x7c\x95\xcb\x2d\xdb\x8f\x4f\x7a\xdc\x4d\x13\xf0\x12\x55\x1b\xfa\xaf\x15\xd9\xb9\x9c\x01\x4e\xaf\x90\xbf\xeb\x48\xb5\x75\x6d\xa4\xce\x48\x05\x35\x9a\x02\x7c\xbf\x34\x59\x14\xc5\x1d\x6d\xf0\xe3\x3f\x09\xd5\xb8\xfe\xd3\x8c\xf3\xf0\xa7\x8c\x7d\x51\x7b\x65\x8f\x81\x32\xae\x54\x3c\x1e\x5c\x27\xa2\x97\x76\xb1\x63\x7a\x1d\x2d\x25\x47\xc6\x9a\x40\x40\x06\xa0\xda\x52\x6c\xa3\x78\xec\xf1\xa0\xa4\x81\xbf\xb7\x6c\xf7\x5c\xa3\xe8\xf5\xe8\x6f\x44\x47\xe6\x08\xdc\x85\xce\x31\x46\x6c\xe8\x78\xf0\x57\xd1\xef\xbb\x7e\xcc\xd3\x8f\x9e\x0c\x89\x6a\x5c\x6a\xb4\x7d\x5f\xc5\x98\x2e\xa2\x94\xd9\xf8\xcc\x48\xd9\xaa\x6f\x11\x80\x55\x12\x26\xf4\x4f\x79\x17\x95\x9d\xcb\x59\xa8\x02\x14\x7a\x39\xc9\x31\x7a\x3f\x63\x69\x6d\xe3\x4a\xfe\x99\x5c\x12\x31\x06\x67\xfc\x30\x32\xde\xa8\x15\x5f\x1a\x94\x91\x4f\xb3\x0d\x09\x5e\x6d\x3f\xdb\x42\x23\x3a\x7e\x38\x7e\x8e\xe5\xd3\x93\x43\xe6\xba\x21\xc1\x58\xaf\xf1\xdf\x3f\xd2\xe4\x31\x49\x96\x65\x43\xa2\x4c\xe8\x1f\xb7\x4c\xe6\x01\x4d\x1b\x41\x8c\xa5\x98\x98\x3a\xe2\x4c\xcc\xe2\xf3\xc7\xbd\x99\x84\x7f\xaa\xa6\x1b\x59\x01\x6f\xbd\xd9\x6e\x7e\x85\x5f\xca\x60\x80\x34\x5c\xaa\xcd\x6e\x0d\x3d\xce\x98\x5d\x7f\x98\xff\x24\x3c\x38\x90\x91\x5b\x5c\xde\xd6\x7b\x53\x08\x5f\x7f\xbb\x8e\x8c\x5f\x42\xb5\x3e\xa0\xe7\x0e\xf5\x58\x6b\x1d\x4c\x74\x52\xe9\x78\x5b\x62\xa9\xda\x5c\x2b\x9a\xc3\x87\x06\xbf\x65\xe9\xdb\xdb\x9e\xb0\x3d\x61\xe9\xe1\xed\xb4\x27\x87\x9d\x58\x68\xce\xc4\x52\x8a\xc2\x05\x6c\x0c\x77\x43\x4d\x48\x2f\x3a\xf4\x77\x2c\x7d\xf9\x37\xa7\x6d\x0d\x5e\xc7\x09\xe5\x35\x5e\xc0\x3f\xe1\x6c\xf8\xe3\x9f\x01\x00\xc5\x25\x57\x4a\x4a\x05\x00\x00"
 
 func editCssBytes() ([]byte, error) {
 	return bindataRead(
@@ -109,12 +109,12 @@ func editCss() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "edit.css", size: 1243, mode: os.FileMode(420), modTime: time.Unix(1588282081, 0)}
+	info := bindataFileInfo{name: "edit.css", size: 1354, mode: os.FileMode(420), modTime: time.Unix(1792401276, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var _editHtml = "\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\x52\xb1\x72\xe3\x20\x10\xed\xfd\x15\x7b\xd4\x67\xa3\x99\xbb\xe2\xc6\x07\x4a\xe1\x78\x52\x26\x93\x71\x93\x12\xa3\x95\x21\x41\x82\xc0\xca\x89\xfe\x3e\x83\x50\x6c\x65\xd2\x85\x86\xdd\x7d\xec\x7b\x8f\x05\xf1\xeb\xf6\x7e\x77\x78\x7a\xd8\x83\xa1\xce\xd5\x2b\x51\x36\x00\x61\x50\x35\x39\x00\x10\x64\xc9\x61\x7d\xe7\x05\x2f\x51\xa9\x76\x48\x0a\x0c\x51\x58\xe3\xeb\x60\xcf\x92\xed\x7c\x4f\xd8\xd3\xfa\x30\x06\x64\xa0\x4b\x26\x19\xe1\x3b\xf1\x4c\xfb\x1f\xb4\x51\x31\x21\xc9\x81\xda\xf5\x3f\xc6\x67\x22\x67\xfb\x17\x30\x11\x5b\xc9\x78\xe2\xd8\x58\xda\xe8\x94\xd8\x04\xe6\x15\xd1\x49\x96\x68\x74\x98\x0c\x22\x5d\x01\x1a\x03\xce\xfc\xb9\xe1\x3b\x5d\x76\x97\xb6\x9c\xb7\xbe\xa7\xb4\x39\x79\x7f\x72\xa8\x82\x4d\x1b\xed\xbb\xdc\x72\xd3\xaa\xce\xba\x51\x3e\x2a\x87\x6f\x6a\xdc\xfe\xad\xaa\xdf\x7f\xaa\xea\x67\xd2\x82\x7f\x8e\x4c\x1c\x7d\x33\xce\x6e\x5a\x1f\x3b\x50\x03\x79\xed\xbb\xe0\x90\x50\x32\xdf\xb6\xb3\x57\x00\xd1\xd8\x33\xd8\x46\xb2\xa3\x8a\x97\xe2\xa2\xac\x5d\x62\xb5\xe0\x8d\x3d\x2f\x40\xdb\x87\x81\x16\x16\xd8\x74\x74\x88\x8e\x41\x70\x4a\xa3\xf1\xae\xc1\x28\xd9\xbe\x27\x8c\x40\x06\x61\x88\x0e\xc8\x43\x32\x3e\x12\xf6\x99\x71\xe2\xb8\xb8\x58\x0a\x5c\xb5\xbb\xf0\x45\x5b\xf0\x7c\x99\x7a\x55\x92\xa4\xa3\x0d\x04\x29\xea\xeb\xb3\x3d\x4f\x66\x0b\x52\x46\x52\x26\x21\x78\xf9\x56\x1f\x01\x00\x00\xff\xff\x1e\x7c\x18\x18\x6e\x02\x00\x00"
+var _editHtml = "\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x9c\x91\xcf\x8e\xd3\x30\x10\xc6\xef\x7d\x8a\xc1\x67\x5a\x47\x82\x03\x2a\x76\x38\x94\x8a\x23\x08\xf5\xc2\xd1\x75\x26\xb5\xc1\xff\xb0\x27\x2d\x79\x7b\xe4\x24\xdd\xb6\xda\xdd\xcb\x4a\x96\x3c\x33\x9f\xfd\x9b\xcf\x63\xf1\xee\xeb\xf7\xdd\xe1\xd7\x8f\x3d\x18\xf2\xae\x5d\x89\x79\x03\x10\x06\x55\x57\x03\x00\x41\x96\x1c\xb6\xdf\xa2\xe0\x73\x34\x57\x3d\x92\x02\x43\x94\xd6\xf8\x77\xb0\x67\xc9\x76\x31\x10\x06\x5a\x1f\xc6\x84\x0c\xf4\x9c\x49\x46\xf8\x8f\x78\xc5\x7e\x06\x6d\x54\x2e\x48\x72\xa0\x7e\xfd\x89\xf1\x05\xe4\x6c\xf8\x03\x26\x63\x2f\x19\x2f\x1c\x3b\x4b\x1b\x5d\x0a\x9b\xc4\xba\x32\x3a\xc9\x0a\x8d\x0e\x8b\x41\xa4\x9b\x40\x63\xc2\x85\x5f\x2f\x3c\xc7\x55\x77\x65\xcb\x79\x1f\x03\x95\xcd\x29\xc6\x93\x43\x95\x6c\xd9\xe8\xe8\xb9\x2e\xe5\x4b\xaf\xbc\x75\xa3\xfc\xa9\x1c\x5e\xd4\xb8\xfd\xd8\x34\xef\x3f\x34\xcd\xdb\x5a\x0b\x7e\x1d\x99\x38\xc6\x6e\x5c\xdc\xf4\x31\x7b\x50\x03\x45\x1d\x7d\x72\x48\x28\x59\xec\xfb\xc5\x2b\x80\xe8\xec\x19\x6c\x27\xd9\x51\xe5\xa7\xe2\x5d\x59\xbb\xc2\x5a\xc1\x3b\x7b\xbe\x13\x6d\x48\x03\xdd\x59\x60\xd3\xd1\x21\x3b\x06\xc9\x29\x8d\x26\xba\x0e\xb3\x64\xfb\x40\x98\x81\x0c\xc2\x90\x1d\x50\x84\x62\x62\x26\x0c\x95\x38\x31\xae\xcc\x87\x06\xb7\xde\x3e\xb1\xf6\x65\x29\x5e\xc2\xab\x12\x99\x07\x49\xf0\x3a\x82\x76\x35\x27\x45\x67\x9b\x08\x4a\xd6\xb7\xcf\xfe\x3d\x3d\x71\x56\x2a\x4e\xf0\x79\x7e\x82\x1b\xf2\xae\x5d\xfd\x1f\x00\x45\xf3\x02\x7e\xa4\x02\x00\x00"
 
 func editHtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -129,12 +129,12 @@ func editHtml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "edit.html", size: 622, mode: os.FileMode(420), modTime: time.Unix(1588282052, 0)}
+	info := bindataFileInfo{name: "edit.html", size: 676, mode: os.FileMode(420), modTime: time.Unix(1792401276, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var _editJs = "\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x94\x96\x6f\x4f\xdc\xb8\x13\xc7\x9f\xf3\x2a\xc0\x3f\x09\xd9\xc2\x78\xa1\x7d\x52\x91\x5f\x54\x51\xba\x77\xd5\xa9\x3d\x2a\xe0\xc1\x9d\x7a\xd5\x69\xec\x4c\x12\x1f\x59\x3b\xd8\x0e\xec\xde\x6e\xde\xfb\xc9\x49\x76\xc9\xc2\xb6\xb4\x0f\x08\xfe\x33\xfe\xce\xd8\xfe\xcc\x78\xef\xc1\xed\x67\x76\x96\xd0\xbc\x31\x2a\x68\x6b\xa8\x62\x4b\x25\xee\xd2\x4d\x5f\xb2\xa5\xc3\xd0\x38\xb3\x9f\x59\xd5\xcc\xd0\x04\x71\xd7\xa0\x5b\x5c\x63\x85\x2a\x58\x47\x25\x6b\x13\x25\xee\xe0\xc7\x97\x9c\x57\xd5\xb0\x4a\x7d\x77\x91\x72\x08\x01\xa7\x15\xc6\xde\x7a\x85\xf7\xa3\x35\x1c\x78\xc6\x96\x52\xf8\xb0\xa8\x50\x78\x0c\x9f\x9d\xad\xd1\x85\x05\x05\x9e\x71\x42\x58\xdb\x32\x9a\xd9\xd9\x6a\x15\xbf\xe9\xb2\x65\x2c\x89\x5b\x9e\x97\x2e\xd9\xdb\xda\x73\x1c\x95\x8f\xca\x6c\xb9\x6e\xee\x03\xcd\xfa\x69\x48\x43\xa9\x7d\x12\x3f\x62\x5e\xba\x34\xeb\x9b\x99\x35\xf8\x8b\xf1\xe9\x97\xaf\x7d\x1f\x9d\xb3\x6e\x18\xc8\x84\x35\x95\x85\x6c\x2c\xdc\x7b\xca\x84\x43\x5f\x5b\xe3\xf1\x06\xe7\x81\xab\x34\x13\x3e\x40\x68\x7c\x02\x6b\x45\x91\x5b\x37\x05\x55\x3e\xc6\x09\x6c\x09\x54\x72\xc5\x5a\xd6\x76\xda\x9d\xaf\xb1\x38\x6c\xdc\xef\x5c\x3d\x9c\x30\xd0\xa8\xd0\x82\xa8\x9d\x0d\x36\x2c\x6a\x14\xd6\xbc\xb7\x06\xd3\xb1\xf1\x78\x77\xa2\x6e\x7c\x49\x81\x25\x83\x42\x9c\x6b\x93\x6d\x81\xe9\x76\x30\x6b\x85\x4d\x40\x2f\x4a\x3c\xe8\x50\x7e\x40\xc8\x70\xac\xc2\xe5\xa0\x33\x2f\x5d\xbc\xe1\x2b\xbc\x6b\xd0\x87\xde\xae\x9b\xfe\xb6\xa0\x47\x93\xfd\x76\x7d\xf9\xfb\xf3\xa0\x1e\x5d\x51\x72\x61\x4d\x40\x13\x8e\x6f\x16\x35\x12\xbe\x47\xa0\xae\x2b\xad\x20\xda\x4f\xfe\xf1\xd6\x24\xaa\x04\xe7\x31\xa4\x4d\xc8\xdf\x10\x96\x8c\xa2\x31\x19\x8d\xfa\xc2\x07\xa7\x4d\xa1\xf3\x05\x05\xf6\x42\x3c\xcf\x63\xd9\x48\x3d\x3d\x9b\xf5\x6d\xb5\x94\x25\x4a\x5c\xe1\x5d\x2a\x63\x06\x74\x59\x31\x3e\xa1\x01\xdf\x2c\x35\xf8\xb0\xff\xc7\xa7\x8f\x1f\x42\xa8\x87\x63\x8a\x94\xd4\xd8\x19\xf1\x83\x93\x8d\x7e\x34\x94\x34\xeb\x32\xaa\xc0\x90\xee\x60\x64\xed\x88\x92\x5f\xa7\x37\x84\x43\x67\x5b\x5b\xff\x82\xf1\xe7\xcb\xeb\xde\xba\x65\x74\x5e\xba\xd5\x2a\x7e\x1f\x13\xaf\xb0\x2f\xe5\x5d\x9f\x69\x45\x0c\xeb\x9d\x6d\x4c\xa6\x4d\x71\x51\x69\x34\xe1\x0a\x55\xa0\x2c\xc9\xec\x2c\x16\x01\x5a\x70\x32\x03\x57\x68\x73\x1c\x6c\x4d\xf8\x83\x36\x99\x7d\x10\xda\x18\x74\x1f\x50\x17\x65\x98\xbc\x3e\x06\x51\xf6\xcd\x57\x47\xa4\x9e\x13\xd6\x72\x78\xee\x8a\xe6\xe2\x1e\xaa\x06\x57\x2b\x42\x98\x08\x4e\xcf\x28\x4b\xe0\x20\x9d\x1d\x1e\xd2\x59\x0a\xfc\x96\x32\x0e\x6f\x4b\xa1\x2a\xf0\xfe\xa3\xf6\x41\x40\x96\x51\x72\xaf\x3d\x61\x67\xe3\x61\x87\x33\x7b\x8f\xc3\x0c\x6b\xf9\xf6\x55\x47\x0e\xf0\x1e\x4d\x78\x8f\x39\x34\x55\xdc\x0a\xa4\x95\xed\x39\x13\x35\x84\xd2\xc0\x0c\x85\x6f\x64\x0f\x13\x3d\x65\xc2\xd7\x95\x0e\x94\x4c\x08\xfb\x72\xfa\x35\xe9\x8f\x6a\x67\xb8\x11\xa1\x78\x37\x94\x4c\xa0\xd6\x93\xc6\x55\x13\x72\x04\x6c\x93\x00\x74\xd9\xb8\xea\x4c\xb6\x6c\xc8\x73\xba\x9d\x5f\x90\x76\x14\xd7\x11\xf3\x48\xa1\xce\x29\x08\x7b\xcb\x74\x4e\x65\x0a\xc2\xd9\x26\x60\x7f\x5c\x2a\x95\x22\xc6\x19\xbd\x27\x90\x4a\xe1\x6d\xe3\x14\xfe\x5d\x5a\x1f\xba\x31\x29\x1a\x57\x1d\x1e\xd2\x52\xfb\x60\xdd\x42\x38\xac\x2b\x50\x78\x1d\x22\x1d\xcb\x96\xef\x99\xa6\xaa\x38\x99\x60\xa6\xc3\x84\x1c\x29\xc6\x65\x4a\x62\x23\xfe\x27\x07\x29\xbc\x85\x23\x79\xb6\x39\x17\xeb\x74\xa1\xcd\x91\xe4\x28\x02\xce\xc3\x90\xaa\x29\x21\x1c\x77\x9c\x7c\xde\xa8\x5b\xc2\xb6\xa6\xba\xbb\xaa\xb4\x89\xe3\x90\x76\xf0\x50\x02\xb1\x13\x8b\xc9\x79\x08\x4e\xcb\x26\x82\x5b\x3a\xcc\x09\x97\x71\x62\xec\x29\x7a\x86\xba\x46\x93\x5d\x94\xba\x8a\x39\xca\xe5\x5a\xc6\xd7\x60\x08\xe3\xf2\xa9\xbb\xd2\x84\x6e\x78\xac\x73\xf2\xff\xd4\xc0\xbd\x2e\x20\x58\x27\x1a\x8f\xee\xbc\x88\x4f\x9c\x36\x19\xce\x2f\x73\x4a\x3e\x81\xd2\x26\x58\x5f\x12\xf6\x96\xfc\xd5\xbc\x7a\x7d\xfa\xe6\xf8\x82\x9c\x91\x8b\xe0\xaa\xe3\x0b\xf2\x24\x0a\xc9\xf8\x3a\x0f\x90\x93\xe0\xc0\xf8\xdc\xba\x19\xe1\xc4\x2b\xa8\xf0\x4f\x7a\xca\x08\xe3\x05\x86\xfe\xc9\xed\x70\x8f\xfb\x7d\x07\x1e\xcf\x4d\x36\x9d\xc7\x98\x28\xf0\x13\x0e\xfc\x94\xb1\x16\x2b\x8f\xfb\xb7\x94\x25\x5d\xa3\xa2\xc3\x33\x12\x5f\x09\x6e\x9e\x3f\x5e\x3f\x85\xed\x23\xb0\x7b\x23\x62\x87\xc1\x34\x62\x44\x3b\xe2\x24\x8b\x14\xaf\xeb\xc8\xfb\xe9\xc7\xe9\xcd\x94\xf0\x31\xd0\xb2\x07\x9a\xfe\x20\xc5\x11\xe1\xd5\x6a\x7b\x33\xb7\xe3\xcd\x7c\xff\x08\x4f\x58\x2c\x18\xd5\x56\x12\x3f\xa5\x30\xd9\x45\x61\x4f\x5b\xf2\x8c\xc2\x9e\xce\x21\x8d\xb7\x10\x4a\xb6\x59\x21\xd3\xab\xab\xcb\xab\xb3\x7d\x72\x04\xc9\xd3\x7b\x4f\x5e\xbe\xf7\x96\x17\x9d\xfc\x1d\x25\xdd\x24\xe3\xb8\xee\xff\x4f\xcd\x6a\xc2\x78\xf9\xd8\xaf\x3c\x61\x3c\xdf\xf4\x1b\x57\x11\xc6\xc7\xbf\x07\xd9\x52\x52\x96\x0c\xe5\x15\xb2\x6c\x1a\x6b\x58\xdc\x14\x9a\xf8\x78\x3a\xf4\xfa\x5f\x24\x5c\xf2\x83\x53\x96\x14\x3b\x2c\x7c\x23\x67\x3a\x10\xbe\x97\x75\x26\xf9\x0e\x93\x5b\x5c\x34\x35\xe1\xf0\x4d\x83\x1a\x7c\xc0\xef\x19\xa8\x12\x4c\xb1\xb1\x28\x77\x59\x54\x5a\xdd\x12\x6e\x3a\x83\xbe\x94\xfd\x14\xc6\x3a\xa7\xaa\x23\xb4\xc0\xed\x32\xab\xbe\x49\x65\xfc\xa5\xb6\x94\x63\x2a\x25\x4b\x5e\x9d\x9c\xa4\xa9\x3a\x3c\x5c\xa7\x45\x2a\xfb\xfa\x1a\xeb\x66\xac\xa0\x3c\x17\xb9\x55\x8d\x8f\xaf\x0e\x65\xac\x1d\x72\x72\x33\xda\xb2\xee\xaf\xb0\xab\x15\x2d\x6c\xff\xb2\xee\xfd\x17\x00\x00\xff\xff\xa0\x37\xb8\x86\xc7\x0b\x00\x00"
+var _editJs = "\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xcc\x59\xff\x72\xdb\xb8\xf1\xff\xdf\x4f\x01\xcf\x57\x73\x24\xc7\x32\x6d\xe7\xdb\x3f\x5a\x6b\x74\x99\x9c\xed\x6b\xae\x4d\xce\x37\x72\x32\xd3\xce\xcd\x4d\x06\x21\x57\x24\x6a\x08\xa0\x01\xd0\xb2\x9a\xd3\x1b\xf4\x01\xfa\x7c\x7d\x92\xce\x82\xbf\x00\x92\x52\x14\xdf\xf5\xe6\x44\x4d\x14\xe3\xc7\xee\x67\x17\xfb\x0b\xcb\x47\xaa\x48\x2a\x57\xb3\xa3\x70\x59\x8a\xc4\x30\x29\x48\x98\xca\x55\x44\x3e\x1d\x11\x42\x70\x2a\x7e\x20\x73\xd2\x4d\xea\x66\x0a\x1f\x05\xa6\x54\x82\xa4\x32\x29\x57\x20\x4c\xfc\x50\x82\xda\xdc\x01\x87\xc4\x48\x15\xea\x68\x76\x84\xab\xb6\xb3\x8e\x16\x7d\x26\xb1\x57\x9c\x8f\xd1\x4b\x3c\x72\x62\x1f\xb9\x44\x01\x35\x70\xc3\x01\x91\x86\x62\x84\x96\xd6\x1e\x35\xe0\x53\x52\x4c\xc9\xa3\x4b\x14\x78\xac\xcd\x86\x43\xac\xc1\xfc\xa0\x64\x01\xca\x6c\x42\x5c\x34\x25\x41\xd0\x91\xdc\x46\xa8\x44\xf2\xf3\xcf\x56\x99\x64\x4e\x3e\x6d\xa3\x68\x76\x84\xca\x7e\xca\x95\xa7\xec\xa7\x5c\x7d\xb8\x68\x58\xe0\x82\x05\xa0\xc2\x9d\x15\x2e\xff\x76\x74\x01\x0f\xe1\x53\xae\xdc\xb9\x86\xc0\x07\x93\x33\x94\x04\x7f\x66\xde\x2c\x8e\xc4\x4f\xb9\x22\xf3\x0a\xc6\x60\x2e\x95\x02\xbe\x15\xb8\xf9\xc7\x9f\x46\xa6\x41\x29\xa9\xc6\xe7\x9f\x72\x15\x4b\xc1\x25\x4d\x3d\x1d\xf6\xf1\x35\x18\x0d\x3c\x99\x0a\x45\xac\x40\x17\x52\x68\x78\x07\x4f\x66\x4a\xb4\xa1\xa6\xd4\xf5\x54\xf5\x87\xcf\x08\x9f\x0f\x2e\xd8\x78\x29\xd5\x0d\x4d\x72\x47\x63\x4b\xcf\x10\xdc\x67\x29\x42\xe3\xf0\xa9\x4f\xcc\x7d\xb6\xbd\xb1\xad\xff\x27\xc2\x92\xc2\x2a\xe2\xb3\x82\x7e\xf0\x94\xb6\x0b\x67\x63\xa8\x4b\x11\x46\xb3\x7d\xec\xb7\xed\xff\x16\xf0\x10\x17\x4a\x1a\x69\x36\x05\xc4\x52\x5c\x4b\x01\x1e\x9a\xa1\x02\x3c\x8d\x15\xa5\xce\x91\xb9\xcf\xaa\xc6\xe1\x9b\xcd\x76\xb6\x93\xeb\xcd\x40\x09\x3b\xd8\xb6\x1a\xf8\x35\xf8\xae\x99\xc9\x5f\x03\x4d\xc1\x67\x7d\xdf\x73\xd4\x96\x39\x1e\x98\x06\xb3\x80\x87\x12\xb4\xa9\x76\x56\xab\x7f\x09\x8a\x7c\x04\x41\x9f\xbd\x43\x11\x9d\x2e\xce\x10\x45\x65\xeb\x0d\x8c\xe8\x00\x56\x1a\x44\xfa\x97\xbb\xdb\xef\x3d\x66\x29\x35\x74\x54\xdc\x4e\x3d\x61\x70\x25\x85\x01\x61\x4e\xdf\x6d\x0a\x08\xa6\x24\xa0\x45\xc1\x59\x42\x11\xee\xd9\x3f\xb4\x14\xb3\x24\xa7\x4a\x83\x99\x97\x66\xf9\xc7\x26\x7a\x8d\x28\x4f\xa4\x21\x02\x88\xb5\x51\x4c\x64\x6c\xb9\xa9\xd8\x47\xb3\x5d\xe2\x1e\x28\xd5\x61\x12\xb5\x18\x2c\xd3\x2f\xe3\x59\xcf\x2f\xe0\xa1\x0e\xcd\x61\x83\xda\x86\xdd\xb8\x8a\xb5\xed\x74\x35\x58\x25\x0a\x0f\xdc\x0a\x4c\x2e\xd3\x29\x29\x15\x77\x31\xd6\xf1\x9c\xcc\x89\x80\x35\xf9\xdb\xdb\x37\xaf\x8d\x29\x6a\x4b\x0b\x1d\xf5\xa0\x08\xb2\x00\xe1\xd2\x99\x12\xa3\x4a\x88\x06\x58\x91\x52\x13\xdc\xdb\x7c\xd2\x81\xcb\xc0\x78\xc8\x7a\x88\x6a\x22\xae\x20\x61\xf0\xe7\x9b\x77\x81\xe5\x39\x46\xb0\x90\xfa\xcb\x29\xfe\x70\x7b\x37\x20\xb9\x8d\x30\x21\xd9\x9c\x87\xbf\x6e\xce\xcb\xa4\x97\xf2\x32\xd9\x30\xc0\xc9\x44\x16\x9b\xbf\xc2\xc6\xc3\xe0\x84\x45\x41\x1f\x59\x46\x8d\x54\x71\xa9\x41\xbd\xca\x30\x95\x33\x91\xc2\xd3\xed\x32\x0c\xde\xd2\x84\x09\x23\x75\x1e\x44\xe4\xeb\x39\x39\x6f\x51\xbf\x24\xc1\x7f\xfe\xf5\xef\xd3\xab\xa0\x1d\xb9\x24\xc1\x95\x51\xfc\xf4\x2a\x98\x35\x0a\x40\xee\x82\xae\xe0\x5b\x25\x57\x3d\x15\x30\x57\x05\xb8\xae\xa0\xca\x60\x5a\x2a\x15\x8b\x75\xf9\xb1\x72\x85\xf0\x22\x8a\x75\xc1\x99\x09\x83\x33\xd7\x7f\x6a\xe8\x76\xcf\x8f\x17\x3f\x79\x5a\x47\x62\x6b\x26\x52\xb9\xbe\x66\xe9\x02\x34\xfb\xa7\x6f\x6a\x7d\xc6\x0a\x12\x3c\x9f\xc9\x52\xad\x30\x82\x7c\x23\x4b\x91\x32\x91\x5d\x71\x06\xc2\x2c\x20\xf1\x0c\xad\x2e\x63\x42\x5c\x3d\x25\xc1\x8a\xaa\x8c\x89\x53\x23\x8b\x60\x4a\xc2\x8a\x6b\xcc\x84\x00\xf5\x1a\x58\x96\x1b\x72\x46\xfe\x9f\x9c\x5a\x16\x71\xde\x8c\xbc\x88\xc8\x09\x09\x8a\xa7\x20\x1a\xe0\x2e\x15\xbf\x66\xe9\x55\x4e\x45\xb6\x1f\x74\xa9\x38\xd6\x30\x93\x52\xf1\xf8\x91\xf2\x12\xd0\x2c\x82\x20\x8a\x8d\x62\x2b\x17\x30\x5b\x5a\x83\x23\xf3\x39\xe1\x54\x9b\xf7\xbe\xed\x75\xba\x1c\xcb\x82\xf5\x06\x7b\x28\xbc\x5b\x90\xb3\x14\xae\x15\x5d\x83\x1a\x61\xd4\xa7\x3e\x49\xb8\x8e\x13\x4e\xb5\x7e\xc3\xb4\x89\x69\x9a\x86\xc1\x23\xd3\x41\x34\xc6\x10\xb8\x86\xfd\xfb\x15\xac\xe4\x23\xec\x20\xe1\x28\x52\xd3\x47\x5f\x81\x68\x86\x2e\x36\x84\x0b\x86\x66\x7d\xbc\xb5\x65\x61\x40\x69\x7d\xf1\x3d\xba\x62\x70\x46\x0b\x76\x56\x2a\x7e\x16\x90\x13\x62\xc9\x79\x1b\xf1\xeb\xe4\xce\x30\xf8\x6e\x79\xfa\x96\x9a\x24\x0f\xa6\xc4\x32\x1a\x13\xd8\xe1\x86\x61\x22\x1c\x61\x32\xb0\x91\xa5\x54\xab\x6b\x96\xde\x95\x1f\x57\xcc\x0f\x2c\x9e\x80\x10\x17\x0a\x1e\x41\x98\x6b\x58\xd2\x92\x7b\x56\xdc\xf8\x25\x99\xb7\xee\x19\x72\x59\x25\xae\xb8\xa0\x26\xc7\xc9\x68\x7a\xb8\x95\x21\x41\x65\x43\x3d\x2a\x3e\x74\x80\xe3\x57\xc1\x43\x9b\x64\xc3\x4f\x48\xf5\x12\xff\x21\xdb\xa8\x5d\x82\xdf\xba\xce\x72\xe2\x18\x26\xa4\xb6\x92\xec\x1d\x14\xb2\x5c\xe9\x8c\xcc\x89\x4d\x9d\x05\x26\xda\xb1\x0c\x86\x07\xdd\xd4\xbc\x73\xf2\x87\xf3\x3f\xa1\xa7\x38\x03\x17\x2f\xfa\x26\x80\x0f\x9e\x18\x99\x5b\xe4\x79\x7d\x9e\x37\xef\x68\xe6\xda\x5c\xf3\xd1\xb9\x5c\x57\x1e\x9b\x86\x2b\x9d\xc5\x4a\x96\x06\xa6\xc4\xe3\x39\xb2\xad\xef\x76\xbe\x61\x34\xc8\x8f\x91\xa2\xbc\x1f\x83\x88\x7c\x6d\x85\x68\xb9\xda\x12\xf0\x59\x6c\x0e\x14\x15\xf5\x6d\x45\x23\x73\xd2\x8a\xe9\x2f\xb1\x80\xed\xf8\x18\xde\xf1\xb0\x71\x38\xce\x2e\xec\x59\x16\x31\xfe\xdf\x9a\xe3\xb4\xb1\xe5\x6a\xdc\xfe\x51\x4f\xe4\x55\xee\xad\x26\xb4\x2c\x55\x02\x1f\xec\x98\x9d\xf7\xb9\xed\x08\x60\xf8\xcd\x99\x36\x52\x6d\x62\x05\x05\xa7\x09\xdc\x19\x6a\x20\xfc\xb4\x9d\x12\x51\x72\x8e\xa1\x01\x52\x66\xfa\x2e\xeb\x7e\xf0\xac\xde\x30\x71\x6f\x3d\x63\x4a\x10\xc2\x8e\x55\xb7\x26\x07\xa5\xeb\x75\x5d\xfa\x1f\xaa\x64\xbb\x33\x32\x5c\x71\xa0\x7e\xe5\xec\xca\xf4\xab\xfb\xbe\xb3\x62\xee\x29\xb5\x36\x2c\xd4\x51\x37\x88\x9a\xb8\x5d\x0b\x50\x21\x8e\x3b\x64\x06\xc2\xb7\xd7\x7d\xfc\xba\x89\xd1\x65\x8e\x87\x76\xdc\x8f\xed\x63\xf6\xd4\x29\xce\x0d\xed\xd7\x37\x6f\x6e\xde\xdd\x1c\x10\xdd\x6d\xfc\x0a\x7f\xab\x78\xf5\x8b\xbc\x7e\xaf\x89\x74\x4e\xb8\xd3\x40\xda\x12\x27\x59\x15\x53\x12\x18\x45\x85\xc6\x9c\x83\x5a\xd2\x09\xe5\xf0\xf7\xf0\x3c\x0a\x86\xa4\x5b\x64\x1e\xe5\x95\xf6\x52\xec\x24\x59\x15\x31\x36\x08\xea\xab\x53\xcf\x64\xec\xf4\x30\xdb\x73\x26\xee\x83\x68\xe7\x32\x5b\x54\x2c\xcb\xc4\x5b\x83\xfa\x9e\x60\x41\x69\xe5\x09\x03\x5d\x50\xe1\xd1\xd0\x7d\x1c\x37\x8b\xc5\xed\xe2\x92\xa0\x1b\xaf\x74\xe6\xac\x44\x50\xb4\x28\x40\xa4\x57\x39\xe3\x69\x38\xd1\x63\x15\xe1\x6e\x75\x5d\xec\x52\x57\x9d\x36\x3c\x85\xd5\xe9\xc3\xd0\x7b\x10\xbf\x4f\xcd\xed\x0e\xf3\x43\x9d\xde\xc9\x15\x60\xef\xa4\x3a\xc9\xd4\x5e\x24\x09\x1e\x27\x59\xe7\x8c\x03\xd9\xc8\x92\xac\x41\x01\xc1\x08\xca\x44\x46\x98\x89\xc9\x1d\x16\x6f\x34\xa3\x4c\x10\x23\x49\x7d\x5b\x64\x26\x0e\xc6\xdc\xd9\xd6\x8c\x08\x69\xa0\xb1\x71\x44\x99\xb4\x2e\xee\xe4\x8a\x13\x12\x10\xa6\x09\xe5\x0a\x68\xba\x21\x96\x4e\x77\xad\x69\x3e\x27\xf5\xd1\xc4\x12\xa3\x17\x79\x49\x02\xf2\x71\x43\x3a\x52\xd5\xf0\x25\x86\xc8\x91\xbd\x01\xa1\x22\x25\x85\x64\xc2\x68\x14\xaa\xdb\x87\x71\xf6\x84\x04\x7d\xa9\xeb\x54\xb3\x5f\xec\x43\xb5\x9f\xd4\x76\xd6\x69\xbf\x0f\x61\x14\xf2\xc1\x47\xd4\x80\x35\x39\x30\x55\x73\x1b\x87\xdd\x85\x7f\x2b\xbd\x63\x55\xff\x3b\x2f\xb3\xfc\x86\x3e\xe6\x9a\xca\x44\xae\x45\x4f\x79\x16\x1f\xf9\xea\xab\x5a\x47\xf6\x78\xdb\xf5\xf5\x0d\x78\xa7\x2d\xe1\xea\x74\xc4\x3e\x3c\x02\x97\xad\x03\xf7\x01\xdb\x1a\xc0\x43\xdc\xd5\x03\x1e\x6a\x93\xf7\x8f\xdc\xd1\x3a\x3a\xc5\xf1\x48\x45\xb3\x3f\x35\x66\xd0\x5c\x43\xf0\xfa\xa0\x34\xbc\x2c\x15\x9f\xa3\x1c\x20\x12\x99\xc2\xfb\xc5\x77\x57\x72\x55\x48\x81\x4d\x7e\xa4\xfe\x3b\x4d\x94\x7d\x29\x7d\x49\x1b\x46\xb2\x51\x75\x5b\xd2\xea\x78\xc9\xb8\x01\x15\x0e\xcd\xa5\x2e\x2a\xdc\xf3\x3e\xae\x6e\x50\xc3\xb6\x32\xa2\xab\x88\xc7\x1c\x44\x66\x72\xbc\x09\x9c\x3f\x0f\xe8\xd8\x39\xdb\x52\xc9\xfa\xb2\x8d\x27\xd6\xb3\x0b\x9a\xc1\x25\x71\x2c\x00\xbf\x35\x88\x61\x6f\xbc\x4e\x34\x5e\x23\xa6\x79\x10\x3d\x23\x5f\x8f\x03\x6e\x21\xb9\xde\xda\x7b\x0b\x84\xef\x1a\xbe\x97\x29\x84\xe8\xa0\x4d\x4b\x70\xb7\x84\xcd\x71\x4c\x68\x97\x76\xa8\x9b\x73\x9a\xcf\x84\xe2\x8b\xa1\x57\xc6\x28\xf6\xb1\xc4\x0a\x2e\x57\xb0\x0c\xbc\x12\xbc\x3b\x9d\xf1\xfd\x9f\xcb\x07\xb3\xa3\xcf\x0a\x3b\xe9\xdb\xa2\x7b\xfa\xdb\x68\xd4\xa9\xb1\xfc\x1f\x71\x69\xad\x12\x57\xc7\xa8\x04\x6e\x17\x06\x6d\x25\xda\x91\xc6\x63\xd1\x2a\x21\xc7\x98\xfb\xfb\x47\x53\x6d\xc3\xe9\x13\xc2\xc5\xbd\x03\x68\x5f\xd2\xa8\x76\xb5\x17\x00\xa9\x58\xc6\xc4\x6e\x0a\xcf\xab\x42\xfa\x15\xc6\x58\x15\xd2\xaf\x54\xf6\x9a\xc3\x2e\x33\xe0\xc2\xed\xf8\x0f\x0e\xdb\x13\x6a\x98\x70\xdc\x53\xb5\xec\xf3\xdd\x45\xd0\x24\xef\x0b\x90\x0b\xd3\x5b\xe0\x33\xaf\xdb\xb0\x61\xb4\x0f\x42\xfe\xdc\x9c\x87\x4f\x06\xa6\x7a\x35\xcc\xa4\x08\x23\xd4\xd0\x37\x54\xc3\x2b\x91\xde\x3c\xa1\x02\xc2\x09\x9d\x92\xf3\x29\xc1\x9f\x8b\xa1\x91\xd2\xa2\xb8\x66\xe9\x9b\x7d\x2f\x18\x7b\x6d\x55\x57\x94\xba\xf7\x49\xd3\xf4\xe6\x11\x84\x41\xb5\x00\xa6\xf9\x40\xd9\xa5\xc1\xb4\xbf\x79\x4a\x96\x94\x6b\xd7\x47\xb1\xa7\x3a\x42\x40\xdb\x46\x57\x30\x6d\xae\xb7\x55\xe3\x6b\x64\x3b\xde\x43\x87\xdb\xef\x61\x53\x62\x77\xd6\xbd\x41\x1e\xbc\xb9\xa0\xda\xc0\x73\x37\x57\x75\xd0\xe7\x77\x63\x87\x73\x64\x37\x67\xc9\x7d\x27\xb5\xbd\xd4\x0f\x37\x1f\x76\x9b\x3f\xe0\xbe\x6c\x65\x58\xca\xa4\xd4\xee\xa9\x8e\xe5\xa7\xed\x48\xd7\xcf\x2f\x1c\x46\xfa\x97\x6e\x1b\xf0\x37\xab\x0e\xea\x16\xdc\xf1\x9c\xbc\x38\x7f\x66\xea\x3d\xb0\x39\xd6\x95\xb5\x6d\x1d\x11\xcd\x76\x74\xaf\xda\x15\x5d\x07\x6b\x76\xf4\x85\x6d\x20\xaf\xe7\xe2\x35\xe7\xf7\x9f\xa5\x6b\x89\xe1\xfe\x9c\x85\xde\x58\x87\xbf\x87\x30\x40\xdf\x0b\xa2\xa9\x0d\xf0\xdd\xe8\xff\x25\xab\xa2\x1a\xe5\xcd\x7d\xd1\x8e\x72\x6d\x47\xe5\x5a\x38\xa3\x72\x2d\xaa\x51\xd3\x84\x55\x5c\x2b\x4d\x6e\x47\x51\x17\xdd\x68\xa9\x38\x8e\xd6\x2f\x20\xaa\x06\x7a\x85\xb0\x8b\x52\x88\x7f\x1b\x85\x99\x44\x1d\xe2\xcf\x9c\x7c\xda\x46\xd1\xec\xe8\xbf\x03\x00\x81\x23\x90\xc2\x72\x23\x00\x00"
 
 func editJsBytes() ([]byte, error) {
 	return bindataRead(
@@ -149,7 +149,7 @@ func editJs() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "edit.js", size: 3015, mode: os.FileMode(420), modTime: time.Unix(1588282081, 0)}
+	info := bindataFileInfo{name: "edit.js", size: 9074, mode: os.FileMode(420), modTime: time.Unix(1792401276, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
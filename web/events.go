@@ -0,0 +1,91 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/kellegous/go/backend"
+)
+
+// heartbeatInterval is how often a comment is sent to idle event streams so
+// that proxies do not close them.
+var heartbeatInterval = 15 * time.Second
+
+// Write a single server-sent event.
+func writeEvent(w http.ResponseWriter, e *backend.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Op, data)
+	return err
+}
+
+// Stream changes to the routes as server-sent events. Each event is named
+// for its op and carries the JSON encoded backend.Event. A resync event is
+// sent before the stream is closed because the client fell behind, after
+// which the client should reload whatever it holds.
+func apiEventsGet(be backend.Backend, w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	ch, err := backend.Watch(ctx, be)
+	if err == backend.ErrWatchNotSupported {
+		writeJSONError(w, err.Error(), http.StatusNotImplemented)
+		return
+	} else if err != nil {
+		writeJSONBackendError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+
+	hb := time.NewTicker(heartbeatInterval)
+	defer hb.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hb.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-ch:
+			if !ok {
+				if ctx.Err() == nil {
+					fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+					f.Flush()
+				}
+				return
+			}
+
+			if err := writeEvent(w, e); err != nil {
+				log.Printf("[error] %s", err)
+				return
+			}
+		}
+		f.Flush()
+	}
+}
+
+func apiEvents(backend backend.Backend, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		apiEventsGet(backend, w, r)
+	default:
+		writeJSONError(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusOK) // fix
+	}
+}
@@ -0,0 +1,158 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/internal"
+)
+
+// Read the next event from a stream, skipping comments.
+func readEvent(t *testing.T, r *bufio.Reader) map[string]string {
+	ev := map[string]string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(ev) > 0 {
+				return ev
+			}
+			continue
+		} else if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		ix := strings.Index(line, ": ")
+		if ix == -1 {
+			t.Fatalf("invalid event line %q", line)
+		}
+		ev[line[:ix]] = line[ix+2:]
+	}
+}
+
+func TestAPIEvents(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	heartbeatInterval = 10 * time.Millisecond
+	defer func() {
+		heartbeatInterval = 15 * time.Second
+	}()
+
+	srv := httptest.NewServer(e.mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"/api/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %s", ct)
+	}
+
+	// give the stream time to send a heartbeat, which the reader skips.
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := e.post("/api/url/a", &urlReq{URL: "http://a.com/"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := e.call("DELETE", "/api/url/a", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(res.Body)
+	for _, exp := range []struct {
+		id     string
+		op     backend.Op
+		before string
+		after  string
+	}{
+		{"1", backend.OpPut, "", "http://a.com/"},
+		{"2", backend.OpDel, "http://a.com/", ""},
+	} {
+		ev := readEvent(t, r)
+		if ev["id"] != exp.id || ev["event"] != string(exp.op) {
+			t.Fatalf("expected event %s %s, got %v", exp.id, exp.op, ev)
+		}
+
+		var m backend.Event
+		if err := json.Unmarshal([]byte(ev["data"]), &m); err != nil {
+			t.Fatal(err)
+		}
+
+		if m.Name != "a" || m.Op != exp.op {
+			t.Fatalf("unexpected event %+v", m)
+		}
+
+		for _, rt := range []struct {
+			rt  *internal.Route
+			url string
+		}{
+			{m.Before, exp.before},
+			{m.After, exp.after},
+		} {
+			if rt.url == "" && rt.rt != nil {
+				t.Fatalf("expected no route, got %v", rt.rt)
+			} else if rt.url != "" {
+				mustBeRouteOf(t, rt.rt, rt.url)
+			}
+		}
+	}
+}
+
+// A backend that cannot be watched.
+type unwatchableBackend struct {
+	backend.Backend
+}
+
+type flushingResponse struct {
+	*mockResponse
+}
+
+func (r *flushingResponse) Flush() {}
+
+func TestAPIEventsNotSupported(t *testing.T) {
+	e := needEnv(t, "")
+	defer e.destroy()
+
+	mux := http.NewServeMux()
+	Setup(mux, &unwatchableBackend{e.backend}, "", "", nil, nil, nil)
+
+	res := &mockResponse{
+		header: map[string][]string{},
+	}
+
+	req, err := http.NewRequest("GET", "/api/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux.ServeHTTP(&flushingResponse{res}, req)
+	mustHaveStatus(t, res, http.StatusNotImplemented)
+}
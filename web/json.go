@@ -30,6 +30,12 @@ type msgRoute struct {
 	Route *routeWithName `json:"route"`
 }
 
+type msgRouteErr struct {
+	Ok    bool           `json:"ok"`
+	Error string         `json:"error"`
+	Route *routeWithName `json:"route,omitempty"`
+}
+
 type msgRoutes struct {
 	Ok     bool             `json:"ok"`
 	Routes []*routeWithName `json:"routes"`
@@ -66,9 +72,8 @@ func writeJSONBackendError(w http.ResponseWriter, err error) {
 	writeJSONError(w, "backend error", http.StatusInternalServerError)
 }
 
-// Encode the given named route as a msg and send it to the client.
-func writeJSONRoute(w http.ResponseWriter, name string, rt *internal.Route, host string) {
-	r := routeWithName{
+func newRouteWithName(name string, rt *internal.Route, host string) *routeWithName {
+	r := &routeWithName{
 		Name:  name,
 		Route: rt,
 	}
@@ -77,8 +82,13 @@ func writeJSONRoute(w http.ResponseWriter, name string, rt *internal.Route, host
 		r.SourceHost = host
 	}
 
+	return r
+}
+
+// Encode the given named route as a msg and send it to the client.
+func writeJSONRoute(w http.ResponseWriter, name string, rt *internal.Route, host string) {
 	writeJSON(w, &msgRoute{
 		Ok:    true,
-		Route: &r,
+		Route: newRouteWithName(name, rt, host),
 	}, http.StatusOK)
 }
@@ -13,7 +13,6 @@ var bannedNames = map[string]bool{
 	"links":   true,
 	"s":       true,
 	"version": true,
-	"nextID":  true,
 }
 
 // Parse the shortcut name from the given URL path, given the base URL that is
@@ -7,15 +7,26 @@ import (
 	"fmt"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/spf13/viper"
 
+	"github.com/kellegous/go/audit"
 	"github.com/kellegous/go/backend"
+	"github.com/kellegous/go/ids"
 	"github.com/kellegous/go/internal"
+	"github.com/kellegous/go/webhook"
 )
 
+// shutdownTimeout is how long requests in progress are given to finish when
+// the server is shut down.
+const shutdownTimeout = 10 * time.Second
+
 // Serve a bundled asset over HTTP.
 func serveAsset(w http.ResponseWriter, r *http.Request, name string) {
 	n, err := AssetInfo(name)
@@ -65,6 +76,16 @@ func getDefault(backend backend.Backend, w http.ResponseWriter, r *http.Request)
 		log.Panic(err)
 	}
 
+	// An alias follows the route it was renamed to, for as long as there is
+	// one.
+	if rt.Alias != "" {
+		if to, err := backend.Get(ctx, rt.Alias); err == nil {
+			rt = to
+		} else if !errors.Is(err, internal.ErrRouteNotFound) {
+			log.Panic(err)
+		}
+	}
+
 	http.Redirect(w, r,
 		rt.URL,
 		http.StatusTemporaryRedirect)
@@ -90,22 +111,112 @@ func getLinks(backend backend.Backend, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Open the webhook queue if any subscriptions are configured.
+func openWebhooks() (*webhook.Dispatcher, error) {
+	filename := viper.GetString("webhooks")
+	if filename == "" {
+		return nil, nil
+	}
+
+	subs, err := webhook.LoadSubscriptions(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return webhook.Open(viper.GetString("webhook-queue"), subs, &webhook.DefaultOptions)
+}
+
+// Open the audit log if one is configured.
+func openAuditLog() (*audit.Log, error) {
+	filename := viper.GetString("audit-log")
+	if filename == "" {
+		return nil, nil
+	}
+
+	return audit.Open(filename, &audit.Options{
+		ActorHeader: viper.GetString("user-header"),
+	})
+}
+
 // ListenAndServe sets up all web routes, binds the port and handles incoming
-// web requests.
+// web requests until the process is interrupted or terminated. It then waits
+// for the requests in progress and returns nil, so that the backend can be
+// closed.
 func ListenAndServe(backend backend.Backend) error {
-	addr := viper.GetString("addr")
+	ln, err := net.Listen("tcp", viper.GetString("addr"))
+	if err != nil {
+		return err
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case sig := <-sigs:
+			log.Printf("[info] %s, shutting down", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return serve(ctx, ln, backend)
+}
+
+// Handle requests on ln until ctx is done. Requests are given ctx, so that
+// event streams end, and those in progress are given shutdownTimeout to
+// finish.
+func serve(ctx context.Context, ln net.Listener, backend backend.Backend) error {
 	admin := viper.GetBool("admin")
 	version := viper.GetString("version")
 	host := viper.GetString("host")
+	userHeader := viper.GetString("user-header")
+
+	hooks, err := openWebhooks()
+	if err != nil {
+		return err
+	}
+	if hooks != nil {
+		defer hooks.Close()
+	}
+
+	auditLog, err := openAuditLog()
+	if err != nil {
+		return err
+	}
+	if auditLog != nil {
+		defer auditLog.Close()
+	}
+
+	names, err := ids.Open(backend)
+	if err != nil {
+		return err
+	}
 
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/api/url/", func(w http.ResponseWriter, r *http.Request) {
-		apiURL(backend, host, w, r)
+		apiURL(audited(backend, auditLog, r), host, userHeader, hooks, names, w, r)
 	})
 	mux.HandleFunc("/api/urls/", func(w http.ResponseWriter, r *http.Request) {
 		apiURLs(backend, host, w, r)
 	})
+	mux.HandleFunc("/api/rename/", func(w http.ResponseWriter, r *http.Request) {
+		apiRename(audited(backend, auditLog, r), host, userHeader, hooks, w, r)
+	})
+	mux.HandleFunc("/api/batch", func(w http.ResponseWriter, r *http.Request) {
+		apiBatch(audited(backend, auditLog, r), host, userHeader, hooks, names, w, r)
+	})
+	mux.HandleFunc("/api/events", func(w http.ResponseWriter, r *http.Request) {
+		apiEvents(backend, w, r)
+	})
+	mux.HandleFunc("/api/reverse", func(w http.ResponseWriter, r *http.Request) {
+		apiReverse(backend, host, w, r)
+	})
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		getDefault(backend, w, r)
 	})
@@ -135,8 +246,29 @@ func ListenAndServe(backend backend.Backend) error {
 
 	// TODO(knorton): Remove the admin handler.
 	if admin {
-		mux.Handle("/admin/", &adminHandler{backend})
+		SetupAdmin(mux, backend, hooks, auditLog, names)
+	}
+
+	srv := &http.Server{
+		Handler: mux,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
 	}
 
-	return http.ListenAndServe(addr, mux)
+	sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	return srv.Shutdown(sctx)
 }
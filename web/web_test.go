@@ -1,3 +1,95 @@
 package web
 
-// TODO: Add tests
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kellegous/go/backend/memory"
+)
+
+// The assets that are embedded as they are, rather than compiled, must match
+// their sources, or bindata.go needs to be generated again.
+func TestAssetsUpToDate(t *testing.T) {
+	for _, name := range []string{"close.svg", "edit.html", "index.js", "links.html"} {
+		want, err := ioutil.ReadFile(filepath.Join("assets", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := Asset(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got, want) {
+			t.Fatalf("%s is out of date in bindata.go, run make", name)
+		}
+	}
+}
+
+// Links created while the server runs must survive a restart, which for the
+// memory backend means the server has to stop for it to be closed and saved.
+func TestServeShutdown(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	filename := filepath.Join(tmp, "links.json")
+	backend, err := memory.New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, ln, backend)
+	}()
+
+	res, err := http.Post("http://"+ln.Addr().String()+"/api/url/a", "application/json",
+		strings.NewReader(`{"url": "http://a.com/"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", res.StatusCode)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backend, err = memory.New(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rt, err := backend.Get(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustBeRouteOf(t, rt, "http://a.com/")
+}
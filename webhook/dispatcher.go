@@ -0,0 +1,466 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Status is where a delivery stands.
+type Status string
+
+const (
+	// Pending deliveries are waiting for their next attempt.
+	Pending Status = "pending"
+
+	// Delivered deliveries were accepted by the subscriber.
+	Delivered Status = "delivered"
+
+	// Failed deliveries ran out of attempts.
+	Failed Status = "failed"
+)
+
+// Attempt records a single try at delivering an event.
+type Attempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Delivery is an event on its way to a subscriber.
+type Delivery struct {
+	ID           string     `json:"id"`
+	Subscription string     `json:"subscription"`
+	Event        *Event     `json:"event"`
+	Status       Status     `json:"status"`
+	Attempts     []*Attempt `json:"attempts"`
+	NextAttempt  time.Time  `json:"next_attempt"`
+	Created      time.Time  `json:"created"`
+}
+
+// Options controls how deliveries are retried and how many are remembered.
+type Options struct {
+	// MaxAttempts is the number of times a delivery is tried before it fails.
+	MaxAttempts int
+
+	// MinBackoff is the wait after the first failed attempt. The wait doubles
+	// after each further failure, up to MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Timeout bounds each attempt.
+	Timeout time.Duration
+
+	// LogSize is the number of finished deliveries kept in the log.
+	LogSize int
+}
+
+// DefaultOptions retries a delivery for about a day.
+var DefaultOptions = Options{
+	MaxAttempts: 12,
+	MinBackoff:  10 * time.Second,
+	MaxBackoff:  6 * time.Hour,
+	Timeout:     10 * time.Second,
+	LogSize:     1000,
+}
+
+// Each delivery is stored under its ID, which orders deliveries by when they
+// were created. Pending deliveries also have a key in the queue.
+var (
+	deliveryNS = []byte("d:")
+	queueNS    = []byte("q:")
+)
+
+func deliveryKey(id string) []byte {
+	return append(append([]byte{}, deliveryNS...), id...)
+}
+
+func queueKey(id string) []byte {
+	return append(append([]byte{}, queueNS...), id...)
+}
+
+// Dispatcher sends events to the subscriptions they match. Deliveries are
+// queued on disk before Notify returns, so they survive a restart, and are
+// retried with exponential backoff until they succeed or run out of
+// attempts.
+type Dispatcher struct {
+	subs   []*Subscription
+	opts   Options
+	client *http.Client
+	db     *leveldb.DB
+
+	mu  sync.Mutex
+	seq uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wake   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Open the delivery queue at path and start delivering to subs.
+func Open(path string, subs []*Subscription, opts *Options) (*Dispatcher, error) {
+	if opts == nil {
+		opts = &DefaultOptions
+	}
+
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// carry on numbering from the newest delivery.
+	var seq uint64
+	it := db.NewIterator(util.BytesPrefix(deliveryNS), nil)
+	if it.Last() {
+		seq, _ = strconv.ParseUint(string(it.Key()[len(deliveryNS):]), 16, 64)
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		subs:   subs,
+		opts:   *opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		db:     db,
+		seq:    seq,
+		ctx:    ctx,
+		cancel: cancel,
+		wake:   make(chan struct{}, 1),
+	}
+
+	d.wg.Add(1)
+	go d.run()
+
+	return d, nil
+}
+
+// Close stops delivering. Pending deliveries resume when the queue is opened
+// again.
+func (d *Dispatcher) Close() error {
+	d.cancel()
+	d.wg.Wait()
+	return d.db.Close()
+}
+
+// Subscriptions returns the subscriptions with their secrets removed.
+func (d *Dispatcher) Subscriptions() []*Subscription {
+	subs := make([]*Subscription, 0, len(d.subs))
+	for _, s := range d.subs {
+		cp := *s
+		cp.Secret = ""
+		subs = append(subs, &cp)
+	}
+	return subs
+}
+
+func (d *Dispatcher) subscription(id string) *Subscription {
+	for _, s := range d.subs {
+		if s.ID == id {
+			return s
+		}
+	}
+	return nil
+}
+
+// Notify queues e for every subscription it matches.
+func (d *Dispatcher) Notify(e *Event) error {
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var b leveldb.Batch
+	for _, s := range d.subs {
+		if !s.Matches(e) {
+			continue
+		}
+
+		d.seq++
+		dl := &Delivery{
+			ID:           fmt.Sprintf("%016x", d.seq),
+			Subscription: s.ID,
+			Event:        e,
+			Status:       Pending,
+			Attempts:     []*Attempt{},
+			NextAttempt:  now,
+			Created:      now,
+		}
+
+		val, err := json.Marshal(dl)
+		if err != nil {
+			return err
+		}
+
+		b.Put(deliveryKey(dl.ID), val)
+		b.Put(queueKey(dl.ID), nil)
+	}
+
+	if b.Len() == 0 {
+		return nil
+	}
+
+	if err := d.db.Write(&b, nil); err != nil {
+		return err
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Deliveries returns up to limit deliveries with the given status, newest
+// first. An empty status matches every delivery.
+func (d *Dispatcher) Deliveries(status Status, limit int) ([]*Delivery, error) {
+	dls := []*Delivery{}
+
+	it := d.db.NewIterator(util.BytesPrefix(deliveryNS), nil)
+	defer it.Release()
+
+	for ok := it.Last(); ok && len(dls) < limit; ok = it.Prev() {
+		var dl Delivery
+		if err := json.Unmarshal(it.Value(), &dl); err != nil {
+			return nil, err
+		}
+
+		if status == "" || dl.Status == status {
+			dls = append(dls, &dl)
+		}
+	}
+
+	return dls, it.Error()
+}
+
+// Deliver whatever is due until the dispatcher is closed.
+func (d *Dispatcher) run() {
+	defer d.wg.Done()
+
+	for {
+		next, err := d.deliverDue()
+		if err != nil {
+			log.Printf("[webhook] %s", err)
+			next = time.Now().Add(d.opts.MinBackoff)
+		}
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+
+		select {
+		case <-d.ctx.Done():
+		case <-d.wake:
+		case <-due:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if d.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Attempt every queued delivery that is due, returning when the next one will
+// be.
+func (d *Dispatcher) deliverDue() (time.Time, error) {
+	var ids []string
+	it := d.db.NewIterator(util.BytesPrefix(queueNS), nil)
+	for it.Next() {
+		ids = append(ids, string(it.Key()[len(queueNS):]))
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return time.Time{}, err
+	}
+
+	var next time.Time
+	for _, id := range ids {
+		if d.ctx.Err() != nil {
+			return time.Time{}, nil
+		}
+
+		val, err := d.db.Get(deliveryKey(id), nil)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		var dl Delivery
+		if err := json.Unmarshal(val, &dl); err != nil {
+			return time.Time{}, err
+		}
+
+		if time.Now().Before(dl.NextAttempt) {
+			if next.IsZero() || dl.NextAttempt.Before(next) {
+				next = dl.NextAttempt
+			}
+			continue
+		}
+
+		d.attempt(&dl)
+
+		// an attempt cut short by Close is made again after a restart.
+		if d.ctx.Err() != nil {
+			return time.Time{}, nil
+		}
+
+		if err := d.save(&dl); err != nil {
+			return time.Time{}, err
+		}
+
+		if dl.Status == Pending && (next.IsZero() || dl.NextAttempt.Before(next)) {
+			next = dl.NextAttempt
+		}
+	}
+
+	return next, nil
+}
+
+// The wait before the attempt following the nth failure.
+func (d *Dispatcher) backoff(n int) time.Duration {
+	b := d.opts.MinBackoff
+	for i := 1; i < n && b < d.opts.MaxBackoff; i++ {
+		b *= 2
+	}
+	if b > d.opts.MaxBackoff {
+		b = d.opts.MaxBackoff
+	}
+	return b
+}
+
+// Try to deliver dl once, updating its status.
+func (d *Dispatcher) attempt(dl *Delivery) {
+	a := &Attempt{Time: time.Now()}
+	dl.Attempts = append(dl.Attempts, a)
+
+	s := d.subscription(dl.Subscription)
+	if s == nil {
+		a.Error = "subscription no longer exists"
+		dl.Status = Failed
+		dl.NextAttempt = time.Time{}
+		return
+	}
+
+	err := d.post(s, dl, a)
+	if err == nil {
+		dl.Status = Delivered
+		dl.NextAttempt = time.Time{}
+		return
+	}
+	a.Error = err.Error()
+
+	if len(dl.Attempts) >= d.opts.MaxAttempts {
+		dl.Status = Failed
+		dl.NextAttempt = time.Time{}
+		return
+	}
+
+	dl.NextAttempt = time.Now().Add(d.backoff(len(dl.Attempts)))
+}
+
+// POST a delivery to its subscriber, recording the response in a.
+func (d *Dispatcher) post(s *Subscription, dl *Delivery, a *Attempt) error {
+	body, err := s.payload(dl.Event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(d.ctx)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Go-Event", string(dl.Event.Type))
+	req.Header.Set("X-Go-Delivery", dl.ID)
+	if s.Secret != "" {
+		req.Header.Set("X-Go-Signature", Sign(s.Secret, body))
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+
+	a.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("subscriber responded with %s", res.Status)
+	}
+	return nil
+}
+
+// Store dl, taking it off the queue once it is finished.
+func (d *Dispatcher) save(dl *Delivery) error {
+	val, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+
+	var b leveldb.Batch
+	b.Put(deliveryKey(dl.ID), val)
+	if dl.Status != Pending {
+		b.Delete(queueKey(dl.ID))
+	}
+
+	if err := d.db.Write(&b, nil); err != nil {
+		return err
+	}
+
+	if dl.Status != Pending {
+		return d.trim()
+	}
+	return nil
+}
+
+// Forget the oldest finished deliveries beyond the size of the log.
+func (d *Dispatcher) trim() error {
+	var finished [][]byte
+	it := d.db.NewIterator(util.BytesPrefix(deliveryNS), nil)
+	for it.Next() {
+		id := string(it.Key()[len(deliveryNS):])
+		if ok, err := d.db.Has(queueKey(id), nil); err != nil {
+			it.Release()
+			return err
+		} else if !ok {
+			finished = append(finished, append([]byte{}, it.Key()...))
+		}
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return err
+	}
+
+	if len(finished) <= d.opts.LogSize {
+		return nil
+	}
+
+	var b leveldb.Batch
+	for _, key := range finished[:len(finished)-d.opts.LogSize] {
+		b.Delete(key)
+	}
+	return d.db.Write(&b, nil)
+}
@@ -0,0 +1,189 @@
+// Package webhook delivers changes made to routes to the HTTP endpoints that
+// subscribe to them.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kellegous/go/internal"
+)
+
+// EventType is the kind of change an Event describes.
+type EventType string
+
+const (
+	// Create is a route being added.
+	Create EventType = "create"
+
+	// Update is an existing route being replaced.
+	Update EventType = "update"
+
+	// Delete is a route being removed.
+	Delete EventType = "delete"
+)
+
+// Event is a change made to a route through the API.
+type Event struct {
+	Type     EventType       `json:"type"`
+	Name     string          `json:"name"`
+	Route    *internal.Route `json:"route,omitempty"`
+	Previous *internal.Route `json:"previous,omitempty"`
+	Time     time.Time       `json:"time"`
+}
+
+// Format is the shape of the payload sent to a subscriber.
+type Format string
+
+const (
+	// JSON sends the Event as it is.
+	JSON Format = "json"
+
+	// Slack sends a message suitable for a Slack incoming webhook.
+	Slack Format = "slack"
+)
+
+// Subscription is an endpoint that is sent the events matching its filters.
+type Subscription struct {
+	// ID names the subscription in the delivery log.
+	ID string `json:"id"`
+
+	// URL receives a POST for each event.
+	URL string `json:"url"`
+
+	// Secret signs each payload, if it is given.
+	Secret string `json:"secret,omitempty"`
+
+	// Format of the payload, JSON by default.
+	Format Format `json:"format,omitempty"`
+
+	// Events limits the types of event that are sent. Empty means all.
+	Events []EventType `json:"events,omitempty"`
+
+	// Prefixes limits the events to those for names starting with any of the
+	// prefixes. Empty means all names.
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+// Matches reports whether e passes the subscription's filters.
+func (s *Subscription) Matches(e *Event) bool {
+	if len(s.Events) > 0 {
+		var ok bool
+		for _, t := range s.Events {
+			if t == e.Type {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if len(s.Prefixes) == 0 {
+		return true
+	}
+
+	for _, p := range s.Prefixes {
+		if strings.HasPrefix(e.Name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subscription) validate() error {
+	if s.ID == "" {
+		return fmt.Errorf("subscription to %s has no id", s.URL)
+	}
+
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("subscription %s: invalid url %q", s.ID, s.URL)
+	}
+
+	switch s.Format {
+	case "", JSON, Slack:
+	default:
+		return fmt.Errorf("subscription %s: unknown format %q", s.ID, s.Format)
+	}
+
+	for _, t := range s.Events {
+		switch t {
+		case Create, Update, Delete:
+		default:
+			return fmt.Errorf("subscription %s: unknown event %q", s.ID, t)
+		}
+	}
+
+	return nil
+}
+
+// ParseSubscriptions decodes a JSON array of subscriptions and checks them.
+func ParseSubscriptions(b []byte) ([]*Subscription, error) {
+	var subs []*Subscription
+	if err := json.Unmarshal(b, &subs); err != nil {
+		return nil, err
+	}
+
+	ids := map[string]bool{}
+	for _, s := range subs {
+		if err := s.validate(); err != nil {
+			return nil, err
+		}
+
+		if ids[s.ID] {
+			return nil, fmt.Errorf("duplicate subscription id %s", s.ID)
+		}
+		ids[s.ID] = true
+	}
+
+	return subs, nil
+}
+
+// LoadSubscriptions reads the subscriptions from a JSON file.
+func LoadSubscriptions(filename string) ([]*Subscription, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSubscriptions(b)
+}
+
+// Sign returns the signature sent in the X-Go-Signature header for a payload
+// signed with secret. Receivers should compute it over the raw request body
+// and compare it with hmac.Equal.
+func Sign(secret string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// Describe an event in a sentence.
+func (e *Event) String() string {
+	switch e.Type {
+	case Create:
+		return fmt.Sprintf("go/%s was created, pointing to %s", e.Name, e.Route.URL)
+	case Update:
+		return fmt.Sprintf("go/%s was changed from %s to %s", e.Name, e.Previous.URL, e.Route.URL)
+	default:
+		return fmt.Sprintf("go/%s was deleted, it pointed to %s", e.Name, e.Previous.URL)
+	}
+}
+
+// Encode the payload for an event in the subscription's format.
+func (s *Subscription) payload(e *Event) ([]byte, error) {
+	if s.Format == Slack {
+		return json.Marshal(struct {
+			Text string `json:"text"`
+		}{e.String()})
+	}
+	return json.Marshal(e)
+}
@@ -0,0 +1,391 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kellegous/go/internal"
+)
+
+func TestParseSubscriptions(t *testing.T) {
+	subs, err := ParseSubscriptions([]byte(`[
+		{"id": "slack", "url": "https://hooks.slack.com/x", "format": "slack"},
+		{"id": "cmdb", "url": "http://cmdb/hook", "secret": "s", "events": ["create"], "prefixes": ["svc/"]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(subs) != 2 || subs[1].Secret != "s" || subs[1].Events[0] != Create {
+		t.Fatalf("unexpected subscriptions %+v", subs)
+	}
+
+	for _, src := range []string{
+		`{}`,
+		`[{"url": "http://a/"}]`,
+		`[{"id": "a", "url": "ftp://a/"}]`,
+		`[{"id": "a", "url": "http://a/", "format": "xml"}]`,
+		`[{"id": "a", "url": "http://a/", "events": ["rename"]}]`,
+		`[{"id": "a", "url": "http://a/"}, {"id": "a", "url": "http://b/"}]`,
+	} {
+		if _, err := ParseSubscriptions([]byte(src)); err == nil {
+			t.Fatalf("expected an error parsing %s", src)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	s := &Subscription{
+		Events:   []EventType{Create, Delete},
+		Prefixes: []string{"svc/", "team/"},
+	}
+
+	for _, test := range []struct {
+		t     EventType
+		name  string
+		match bool
+	}{
+		{Create, "svc/a", true},
+		{Delete, "team/b", true},
+		{Update, "svc/a", false},
+		{Create, "other", false},
+	} {
+		if m := s.Matches(&Event{Type: test.t, Name: test.name}); m != test.match {
+			t.Fatalf("%s %s: expected match %t, got %t", test.t, test.name, test.match, m)
+		}
+	}
+
+	if !(&Subscription{}).Matches(&Event{Type: Update, Name: "x"}) {
+		t.Fatal("expected a subscription with no filters to match everything")
+	}
+}
+
+// A receiver that records the requests it is sent and fails the first
+// failures of them.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	failures int
+	reqs     []*http.Request
+	bodies   [][]byte
+	got      chan struct{}
+}
+
+func newReceiver(failures int) *receiver {
+	r := &receiver{
+		failures: failures,
+		got:      make(chan struct{}, 100),
+	}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+
+		r.mu.Lock()
+		r.reqs = append(r.reqs, req)
+		r.bodies = append(r.bodies, body)
+		fail := r.failures > 0
+		if fail {
+			r.failures--
+		}
+		r.mu.Unlock()
+
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		r.got <- struct{}{}
+	}))
+	return r
+}
+
+func (r *receiver) wait(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.got:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a delivery")
+		}
+	}
+}
+
+// A path for a queue in a new temporary directory.
+func tempQueue(t *testing.T) (string, func()) {
+	tmp, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(tmp, "q"), func() {
+		os.RemoveAll(tmp)
+	}
+}
+
+func open(t *testing.T, path string, subs []*Subscription, opts *Options) *Dispatcher {
+	d, err := Open(path, subs, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// Wait for the newest delivery to have the given status.
+func waitForStatus(t *testing.T, d *Dispatcher, status Status) *Delivery {
+	for i := 0; i < 500; i++ {
+		dls, err := d.Deliveries("", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(dls) == 1 && dls[0].Status == status {
+			return dls[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for a %s delivery", status)
+	return nil
+}
+
+var testOptions = Options{
+	MaxAttempts: 3,
+	MinBackoff:  10 * time.Millisecond,
+	MaxBackoff:  40 * time.Millisecond,
+	Timeout:     time.Second,
+	LogSize:     10,
+}
+
+func TestDeliver(t *testing.T) {
+	r := newReceiver(0)
+	defer r.Close()
+
+	path, cleanup := tempQueue(t)
+	defer cleanup()
+
+	d := open(t, path, []*Subscription{
+		{ID: "all", URL: r.URL, Secret: "shh"},
+		{ID: "svc", URL: r.URL, Prefixes: []string{"svc/"}},
+		{ID: "slack", URL: r.URL, Format: Slack, Events: []EventType{Update}},
+	}, &testOptions)
+	defer d.Close()
+
+	e := &Event{
+		Type:  Create,
+		Name:  "a",
+		Route: &internal.Route{URL: "http://a/"},
+		Time:  time.Unix(1601418237, 0).UTC(),
+	}
+	if err := d.Notify(e); err != nil {
+		t.Fatal(err)
+	}
+
+	r.wait(t, 1)
+	waitForStatus(t, d, Delivered)
+
+	r.mu.Lock()
+	req, body := r.reqs[0], r.bodies[0]
+	r.mu.Unlock()
+
+	if sig := req.Header.Get("X-Go-Signature"); sig != Sign("shh", body) {
+		t.Fatalf("invalid signature %s", sig)
+	}
+
+	if req.Header.Get("X-Go-Event") != "create" || req.Header.Get("X-Go-Delivery") == "" {
+		t.Fatalf("unexpected headers %v", req.Header)
+	}
+
+	var got Event
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Type != Create || got.Name != "a" || got.Route.URL != "http://a/" || got.Previous != nil {
+		t.Fatalf("unexpected payload %s", body)
+	}
+
+	if err := d.Notify(&Event{
+		Type:     Update,
+		Name:     "svc/b",
+		Route:    &internal.Route{URL: "http://c/"},
+		Previous: &internal.Route{URL: "http://b/"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	r.wait(t, 3)
+	waitForStatus(t, d, Delivered)
+
+	dls, err := d.Deliveries("", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dls) != 4 || dls[0].Subscription != "slack" || dls[3].Subscription != "all" {
+		t.Fatalf("unexpected deliveries %+v", dls)
+	}
+
+	subs := map[string]string{}
+	for _, dl := range dls {
+		subs[dl.ID] = dl.Subscription
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, req := range r.reqs {
+		sub := subs[req.Header.Get("X-Go-Delivery")]
+		if signed := req.Header.Get("X-Go-Signature") != ""; signed != (sub == "all") {
+			t.Fatalf("%s: expected only deliveries with a secret to be signed", sub)
+		}
+
+		if sub != "slack" {
+			continue
+		}
+
+		var msg struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(r.bodies[i], &msg); err != nil {
+			t.Fatal(err)
+		}
+
+		if msg.Text != "go/svc/b was changed from http://b/ to http://c/" {
+			t.Fatalf("unexpected slack message %q", msg.Text)
+		}
+	}
+
+	for _, s := range d.Subscriptions() {
+		if s.Secret != "" {
+			t.Fatal("expected subscriptions to be listed without secrets")
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	r := newReceiver(2)
+	defer r.Close()
+
+	path, cleanup := tempQueue(t)
+	defer cleanup()
+
+	d := open(t, path, []*Subscription{
+		{ID: "a", URL: r.URL},
+	}, &testOptions)
+	defer d.Close()
+
+	if err := d.Notify(&Event{Type: Delete, Name: "a", Previous: &internal.Route{URL: "http://a/"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	r.wait(t, 3)
+	dl := waitForStatus(t, d, Delivered)
+	if len(dl.Attempts) != 3 || dl.Attempts[0].StatusCode != http.StatusServiceUnavailable || dl.Attempts[0].Error == "" {
+		t.Fatalf("unexpected attempts %+v", dl.Attempts)
+	}
+
+	// the receiver fails every attempt.
+	r.mu.Lock()
+	r.failures = 3
+	r.mu.Unlock()
+
+	if err := d.Notify(&Event{Type: Delete, Name: "b", Previous: &internal.Route{URL: "http://b/"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	r.wait(t, 3)
+	dl = waitForStatus(t, d, Failed)
+	if len(dl.Attempts) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(dl.Attempts))
+	}
+
+	if failed, err := d.Deliveries(Failed, 10); err != nil {
+		t.Fatal(err)
+	} else if len(failed) != 1 || failed[0].Event.Name != "b" {
+		t.Fatalf("unexpected failed deliveries %+v", failed)
+	}
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	r := newReceiver(1)
+	defer r.Close()
+
+	path, cleanup := tempQueue(t)
+	defer cleanup()
+
+	subs := []*Subscription{{ID: "a", URL: r.URL}}
+	opts := testOptions
+	opts.MinBackoff = 200 * time.Millisecond
+
+	d := open(t, path, subs, &opts)
+	if err := d.Notify(&Event{Type: Create, Name: "a", Route: &internal.Route{URL: "http://a/"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	r.wait(t, 1)
+	for i := 0; ; i++ {
+		dls, err := d.Deliveries(Pending, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(dls) == 1 && len(dls[0].Attempts) == 1 {
+			break
+		} else if i == 500 {
+			t.Fatal("timed out waiting for the first attempt")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d = open(t, path, subs, &opts)
+	defer d.Close()
+
+	r.wait(t, 1)
+	first := waitForStatus(t, d, Delivered)
+
+	if err := d.Notify(&Event{Type: Create, Name: "b", Route: &internal.Route{URL: "http://b/"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	r.wait(t, 1)
+	second := waitForStatus(t, d, Delivered)
+	if second.ID <= first.ID {
+		t.Fatalf("expected delivery %s to follow %s", second.ID, first.ID)
+	}
+}
+
+func TestLogSize(t *testing.T) {
+	r := newReceiver(0)
+	defer r.Close()
+
+	opts := testOptions
+	opts.LogSize = 3
+
+	path, cleanup := tempQueue(t)
+	defer cleanup()
+
+	d := open(t, path, []*Subscription{{ID: "a", URL: r.URL}}, &opts)
+	defer d.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := d.Notify(&Event{Type: Create, Name: "a", Route: &internal.Route{URL: "http://a/"}}); err != nil {
+			t.Fatal(err)
+		}
+		r.wait(t, 1)
+		waitForStatus(t, d, Delivered)
+	}
+
+	dls, err := d.Deliveries("", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dls) != 3 {
+		t.Fatalf("expected 3 deliveries in the log, got %d", len(dls))
+	}
+}